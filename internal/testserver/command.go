@@ -0,0 +1,435 @@
+package testserver
+
+import (
+	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+	"phoenix/minecraft/protocol"
+	"phoenix/minecraft/protocol/packet"
+	"strconv"
+	"strings"
+)
+
+// maxFillVolume is the maximum amount of blocks a single fill command may change, equal to the vanilla limit.
+const maxFillVolume = 32768
+
+// source is the origin a command is executed from: The player that sent it, and the position that relative
+// coordinates are resolved against.
+type source struct {
+	p   *player
+	pos mgl32.Vec3
+}
+
+// execute executes a command line sent by the player passed and returns its output.
+func (s *Server) execute(p *player, line string) *packet.CommandOutput {
+	s.mu.Lock()
+	pos := p.Position
+	s.mu.Unlock()
+	return s.run(source{p: p, pos: pos}, line)
+}
+
+// run runs a command line from the source passed.
+func (s *Server) run(src source, line string) *packet.CommandOutput {
+	line = strings.TrimPrefix(strings.TrimSpace(line), "/")
+	s.mu.Lock()
+	s.commands = append(s.commands, line)
+	s.mu.Unlock()
+
+	args := tokenize(line)
+	if len(args) == 0 {
+		return failure("commands.generic.syntax", "", "", "")
+	}
+	switch name := strings.ToLower(args[0]); name {
+	case "setblock":
+		return s.setblock(src, args[1:])
+	case "fill":
+		return s.fill(src, args[1:])
+	case "testforblock":
+		return s.testforblock(src, args[1:])
+	case "tp", "teleport":
+		return s.tp(src, args[1:])
+	case "gamerule":
+		return s.gamerule(args[1:])
+	case "execute":
+		return s.executeAs(src, args[1:])
+	case "say", "tellraw", "title", "particle":
+		// Accepted so that clients sending them get a successful output, but they have no effect on the
+		// state of the server.
+		return success("commands." + name + ".success")
+	default:
+		return failure("commands.generic.unknown", name)
+	}
+}
+
+// setblock implements /setblock <x> <y> <z> <block> [data|states] [replace|destroy|keep].
+func (s *Server) setblock(src source, args []string) *packet.CommandOutput {
+	if len(args) < 4 {
+		return syntaxError(args)
+	}
+	pos, err := blockPosition(src.pos, args[:3])
+	if err != nil {
+		return syntaxError(args)
+	}
+	b, rest := parseBlock(args[3:])
+	b = b.placed()
+	if pos[1] < MinY || pos[1] > MaxY {
+		return failure("commands.setblock.outOfWorld")
+	}
+	current := s.world.Block(pos)
+	if len(rest) > 0 && rest[0] == "keep" && current != Air {
+		return failure("commands.setblock.noChange")
+	}
+	if current == b {
+		return failure("commands.setblock.noChange")
+	}
+	s.world.SetBlock(pos, b)
+	return success("commands.setblock.success")
+}
+
+// fill implements /fill <from> <to> <block> [data|states] [replace [block [data]]|hollow|outline|keep|destroy].
+func (s *Server) fill(src source, args []string) *packet.CommandOutput {
+	if len(args) < 7 {
+		return syntaxError(args)
+	}
+	from, err := blockPosition(src.pos, args[:3])
+	if err != nil {
+		return syntaxError(args)
+	}
+	to, err := blockPosition(src.pos, args[3:6])
+	if err != nil {
+		return syntaxError(args)
+	}
+	b, rest := parseBlock(args[6:])
+	b = b.placed()
+	lo, hi := corners(from, to)
+	if volume := int64(hi[0]-lo[0]+1) * int64(hi[1]-lo[1]+1) * int64(hi[2]-lo[2]+1); volume > maxFillVolume {
+		return failure("commands.fill.tooManyBlocks", strconv.FormatInt(volume, 10), strconv.Itoa(maxFillVolume))
+	}
+	if lo[1] < MinY || hi[1] > MaxY {
+		return failure("commands.fill.outOfWorld")
+	}
+	mode := "replace"
+	var filter *Block
+	if len(rest) > 0 {
+		mode = rest[0]
+		if mode == "replace" && len(rest) > 1 {
+			f, _ := parseBlock(rest[1:])
+			filter = &f
+		}
+	}
+
+	count := 0
+	for x := lo[0]; x <= hi[0]; x++ {
+		for y := lo[1]; y <= hi[1]; y++ {
+			for z := lo[2]; z <= hi[2]; z++ {
+				pos := protocol.BlockPos{x, y, z}
+				border := x == lo[0] || x == hi[0] || y == lo[1] || y == hi[1] || z == lo[2] || z == hi[2]
+				place := b
+				current := s.world.Block(pos)
+				switch mode {
+				case "keep":
+					if current != Air {
+						continue
+					}
+				case "outline":
+					if !border {
+						continue
+					}
+				case "hollow":
+					if !border {
+						place = Air
+					}
+				case "replace":
+					if filter != nil && (current.Name != filter.Name || (filter.Data != -1 && current.Data != filter.Data)) {
+						continue
+					}
+				}
+				if current != place {
+					s.world.SetBlock(pos, place)
+					count++
+				}
+			}
+		}
+	}
+	if count == 0 {
+		return failure("commands.fill.failed")
+	}
+	return successCount(uint32(count), "commands.fill.success", strconv.Itoa(count))
+}
+
+// testforblock implements /testforblock <x> <y> <z> <block> [data].
+func (s *Server) testforblock(src source, args []string) *packet.CommandOutput {
+	if len(args) < 4 {
+		return syntaxError(args)
+	}
+	pos, err := blockPosition(src.pos, args[:3])
+	if err != nil {
+		return syntaxError(args)
+	}
+	b, _ := parseBlock(args[3:])
+	x, y, z := strconv.Itoa(int(pos[0])), strconv.Itoa(int(pos[1])), strconv.Itoa(int(pos[2]))
+	current := s.world.Block(pos)
+	if current.Name != b.Name {
+		return failure("commands.testforblock.failed.tile", x, y, z, current.Name, b.Name)
+	}
+	if b.Data != -1 && current.Data != b.Data {
+		return failure("commands.testforblock.failed.data", x, y, z, strconv.Itoa(int(current.Data)), strconv.Itoa(int(b.Data)))
+	}
+	return success("commands.testforblock.success", x, y, z)
+}
+
+// tp implements /tp <x> <y> <z>, /tp <target> <x> <y> <z> and /tp <target> <destination>.
+func (s *Server) tp(src source, args []string) *packet.CommandOutput {
+	targets := []*player{src.p}
+	switch len(args) {
+	case 3:
+	case 2, 4:
+		var ok bool
+		if targets, ok = s.selectPlayers(src, args[0]); !ok {
+			return failure("commands.generic.noTargetMatch")
+		}
+		args = args[1:]
+	default:
+		return syntaxError(args)
+	}
+
+	var dst mgl32.Vec3
+	if len(args) == 1 {
+		destinations, ok := s.selectPlayers(src, args[0])
+		if !ok || len(destinations) != 1 {
+			return failure("commands.generic.noTargetMatch")
+		}
+		s.mu.Lock()
+		dst = destinations[0].Position
+		s.mu.Unlock()
+	} else {
+		var err error
+		if dst, err = position(src.pos, args); err != nil {
+			return syntaxError(args)
+		}
+	}
+
+	output := &packet.CommandOutput{}
+	for _, p := range targets {
+		s.mu.Lock()
+		p.Position = dst
+		s.mu.Unlock()
+		move := &packet.MovePlayer{
+			EntityRuntimeID: p.RuntimeID,
+			Position:        dst.Add(mgl32.Vec3{0, playerEyeHeight}),
+			Pitch:           p.Pitch,
+			Yaw:             p.Yaw,
+			HeadYaw:         p.Yaw,
+			Mode:            packet.MoveModeTeleport,
+		}
+		s.broadcast(move)
+		output.SuccessCount++
+		output.OutputMessages = append(output.OutputMessages, protocol.CommandOutputMessage{
+			Success:    true,
+			Message:    "commands.tp.success.coordinates",
+			Parameters: []string{p.Name, formatFloat(dst[0]), formatFloat(dst[1]), formatFloat(dst[2])},
+		})
+	}
+	return output
+}
+
+// gamerule implements /gamerule, /gamerule <rule> and /gamerule <rule> <value>.
+func (s *Server) gamerule(args []string) *packet.CommandOutput {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch len(args) {
+	case 0:
+		rules := make([]string, 0, len(s.gameRules))
+		for name, v := range s.gameRules {
+			rules = append(rules, fmt.Sprintf("%s = %v", name, v))
+		}
+		return success(strings.Join(rules, ", "))
+	case 1:
+		v, ok := s.gameRules[strings.ToLower(args[0])]
+		if !ok {
+			return failure("commands.gamerule.type.invalid", args[0])
+		}
+		return success(fmt.Sprintf("%s = %v", strings.ToLower(args[0]), v))
+	}
+	name := strings.ToLower(args[0])
+	var v interface{}
+	if b, err := strconv.ParseBool(args[1]); err == nil {
+		v = b
+	} else if n, err := strconv.ParseUint(args[1], 10, 32); err == nil {
+		v = uint32(n)
+	} else if f, err := strconv.ParseFloat(args[1], 32); err == nil {
+		v = float32(f)
+	} else {
+		return failure("commands.gamerule.type.invalid", args[1])
+	}
+	s.gameRules[name] = v
+	pk := &packet.GameRulesChanged{GameRules: []protocol.GameRule{{Name: name, Value: v}}}
+	for _, p := range s.players {
+		_ = p.conn.WritePacket(pk)
+	}
+	return success("commands.gamerule.success", name, args[1])
+}
+
+// executeAs implements the legacy /execute <target> <x> <y> <z> <command>, running the command once for each
+// target, from the position passed relative to the target.
+func (s *Server) executeAs(src source, args []string) *packet.CommandOutput {
+	if len(args) < 5 {
+		return syntaxError(args)
+	}
+	targets, ok := s.selectPlayers(src, args[0])
+	if !ok {
+		return failure("commands.generic.noTargetMatch")
+	}
+	output := &packet.CommandOutput{}
+	for _, p := range targets {
+		s.mu.Lock()
+		origin := p.Position
+		s.mu.Unlock()
+		pos, err := position(origin, args[1:4])
+		if err != nil {
+			return syntaxError(args)
+		}
+		res := s.run(source{p: p, pos: pos}, strings.Join(args[4:], " "))
+		output.SuccessCount += res.SuccessCount
+		output.OutputMessages = append(output.OutputMessages, res.OutputMessages...)
+	}
+	return output
+}
+
+// selectPlayers resolves a target selector or player name to the players it matches. Only @s, @p, @a and
+// player names are supported.
+func (s *Server) selectPlayers(src source, target string) ([]*player, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch target {
+	case "@s", "@p":
+		return []*player{src.p}, true
+	case "@a":
+		players := make([]*player, 0, len(s.players))
+		for _, p := range s.players {
+			players = append(players, p)
+		}
+		return players, len(players) > 0
+	}
+	p, ok := s.players[strings.ToLower(strings.Trim(target, `"`))]
+	return []*player{p}, ok
+}
+
+// parseBlock parses a block name followed by an optional data value or block states, returning the block and
+// the remaining arguments. If no data value is passed, the Data of the block returned is -1 to indicate any
+// data matches.
+func parseBlock(args []string) (Block, []string) {
+	b := Block{Name: blockName(args[0]), Data: -1}
+	args = args[1:]
+	if len(args) > 0 {
+		if strings.HasPrefix(args[0], "[") {
+			b.States, args = args[0], args[1:]
+		} else if n, err := strconv.ParseInt(args[0], 10, 32); err == nil {
+			b.Data, args = int32(n), args[1:]
+		}
+	}
+	return b, args
+}
+
+// placed returns the block as it is placed in the world: Without a data value, a block is placed with data
+// value 0.
+func (b Block) placed() Block {
+	if b.Data == -1 {
+		b.Data = 0
+	}
+	return b
+}
+
+// blockPosition parses three coordinates into a block position, resolving relative coordinates against the
+// origin passed.
+func blockPosition(origin mgl32.Vec3, args []string) (protocol.BlockPos, error) {
+	v, err := position(origin, args)
+	if err != nil {
+		return protocol.BlockPos{}, err
+	}
+	return protocol.BlockPos{int32(math.Floor(float64(v[0]))), int32(math.Floor(float64(v[1]))), int32(math.Floor(float64(v[2])))}, nil
+}
+
+// position parses three coordinates, which may be relative (~) to the origin passed.
+func position(origin mgl32.Vec3, args []string) (mgl32.Vec3, error) {
+	var v mgl32.Vec3
+	for i := 0; i < 3; i++ {
+		arg := args[i]
+		base := float32(0)
+		if strings.HasPrefix(arg, "~") {
+			base, arg = origin[i], arg[1:]
+			if arg == "" {
+				v[i] = base
+				continue
+			}
+		}
+		f, err := strconv.ParseFloat(arg, 32)
+		if err != nil {
+			return v, fmt.Errorf("invalid coordinate %q", args[i])
+		}
+		v[i] = base + float32(f)
+	}
+	return v, nil
+}
+
+// tokenize splits a command line into arguments separated by spaces. Spaces within quotes or brackets, such
+// as those in block states or JSON text, do not split arguments.
+func tokenize(line string) []string {
+	var (
+		args    []string
+		current strings.Builder
+		depth   int
+		quoted  bool
+	)
+	for _, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case !quoted && (r == '[' || r == '{'):
+			depth++
+		case !quoted && (r == ']' || r == '}'):
+			depth--
+		case r == ' ' && !quoted && depth <= 0:
+			if current.Len() > 0 {
+				args = append(args, current.String())
+				current.Reset()
+			}
+			continue
+		}
+		current.WriteRune(r)
+	}
+	if current.Len() > 0 {
+		args = append(args, current.String())
+	}
+	return args
+}
+
+// formatFloat formats a coordinate the way vanilla command output does.
+func formatFloat(f float32) string {
+	return strconv.FormatFloat(float64(f), 'f', 2, 32)
+}
+
+// success returns the output of a command that succeeded once.
+func success(message string, parameters ...string) *packet.CommandOutput {
+	return successCount(1, message, parameters...)
+}
+
+// successCount returns the output of a command that succeeded the amount of times passed.
+func successCount(count uint32, message string, parameters ...string) *packet.CommandOutput {
+	return &packet.CommandOutput{
+		SuccessCount:   count,
+		OutputMessages: []protocol.CommandOutputMessage{{Success: true, Message: message, Parameters: parameters}},
+	}
+}
+
+// failure returns the output of a command that failed.
+func failure(message string, parameters ...string) *packet.CommandOutput {
+	return &packet.CommandOutput{
+		OutputMessages: []protocol.CommandOutputMessage{{Message: message, Parameters: parameters}},
+	}
+}
+
+// syntaxError returns the output of a command with invalid arguments.
+func syntaxError(args []string) *packet.CommandOutput {
+	return failure("commands.generic.syntax", "", strings.Join(args, " "), "")
+}
@@ -0,0 +1,392 @@
+// Package testserver implements a small Minecraft: Bedrock Edition server on top of minecraft.Listener, to be
+// embedded in tests of clients such as the bot. It spawns players in a flat world held in memory, relays
+// chat and implements a handful of commands: setblock, fill, testforblock, tp, gamerule and execute.
+// Commands sent in CommandRequest packets are answered with CommandOutput packets carrying the same messages
+// and parameters vanilla servers send.
+package testserver
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/google/uuid"
+	"io/ioutil"
+	"log"
+	"phoenix/minecraft"
+	"phoenix/minecraft/protocol"
+	"phoenix/minecraft/protocol/packet"
+	"phoenix/minecraft/version"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// playerEyeHeight is the offset between the feet of a player and the position sent in MovePlayer packets.
+const playerEyeHeight = 1.62
+
+// Config holds settings of a Server.
+type Config struct {
+	// Network is the name of the network to listen on. If empty, a new minecraft.Pipe is registered under a
+	// unique name and used, so that clients in the same process can connect without using the network. The
+	// Pipe is unregistered when the Server is closed.
+	Network string
+	// Address is the address to listen on. It defaults to "127.0.0.1:19132".
+	Address string
+	// WorldName is the name of the world sent to players when they spawn.
+	WorldName string
+	// ErrorLog is the logger errors of connections are written to. By default, errors are discarded.
+	ErrorLog *log.Logger
+	// Items holds the item entries sent to players when they spawn. By default, no items are sent.
+	Items []protocol.ItemEntry
+}
+
+// Player is the state of a player connected to a Server.
+type Player struct {
+	// Name is the display name of the player.
+	Name string
+	// UUID is the UUID of the player sent in its login.
+	UUID uuid.UUID
+	// RuntimeID is the runtime ID, equal to the unique ID, the player was given when it spawned.
+	RuntimeID uint64
+	// Position is the position of the feet of the player.
+	Position mgl32.Vec3
+	// Pitch and Yaw are the rotation of the player.
+	Pitch, Yaw float32
+}
+
+// player is a player connected to the Server.
+type player struct {
+	Player
+	conn *minecraft.Conn
+}
+
+// Server is a Minecraft server for tests, holding a flat World in memory.
+type Server struct {
+	world     *World
+	listener  *minecraft.Listener
+	network   string
+	pipe      bool
+	address   string
+	log       *log.Logger
+	worldName string
+	items     []protocol.ItemEntry
+	ids       uint64
+	closeErr  error
+	once      sync.Once
+
+	mu        sync.Mutex
+	players   map[string]*player
+	gameRules map[string]interface{}
+	commands  []string
+	spawned   chan struct{}
+}
+
+// networkCount is used to register the pipe of each Server under a unique name.
+var networkCount uint64
+
+// New starts a Server listening using the Config passed. Connections are accepted until Close is called.
+func New(cfg Config) (*Server, error) {
+	pipe := cfg.Network == ""
+	if pipe {
+		cfg.Network = fmt.Sprintf("testserver-%d", atomic.AddUint64(&networkCount, 1))
+		minecraft.RegisterNetwork(cfg.Network, minecraft.NewPipe())
+	}
+	if cfg.Address == "" {
+		cfg.Address = "127.0.0.1:19132"
+	}
+	if cfg.WorldName == "" {
+		cfg.WorldName = "Test World"
+	}
+	if cfg.ErrorLog == nil {
+		cfg.ErrorLog = log.New(ioutil.Discard, "", 0)
+	}
+	listener, err := minecraft.ListenConfig{
+		AuthenticationDisabled: true,
+		StatusProvider:         minecraft.NewStatusProvider(cfg.WorldName),
+		ErrorLog:               cfg.ErrorLog,
+		AcceptedProtocols:      version.All(),
+	}.Listen(cfg.Network, cfg.Address)
+	if err != nil {
+		if pipe {
+			minecraft.UnregisterNetwork(cfg.Network)
+		}
+		return nil, err
+	}
+	s := &Server{
+		world:     NewWorld(),
+		listener:  listener,
+		network:   cfg.Network,
+		pipe:      pipe,
+		address:   cfg.Address,
+		log:       cfg.ErrorLog,
+		worldName: cfg.WorldName,
+		items:     cfg.Items,
+		players:   make(map[string]*player),
+		gameRules: map[string]interface{}{"sendcommandfeedback": true, "commandblockoutput": true},
+		spawned:   make(chan struct{}),
+	}
+	go s.accept()
+	return s, nil
+}
+
+// Network returns the name of the network the Server listens on, to be passed to minecraft.Dialer.Dial.
+func (s *Server) Network() string {
+	return s.network
+}
+
+// Address returns the address the Server listens on, to be passed to minecraft.Dialer.Dial.
+func (s *Server) Address() string {
+	return s.address
+}
+
+// World returns the World of the Server, which may be used to inspect or change blocks.
+func (s *Server) World() *World {
+	return s.world
+}
+
+// Close closes the listener of the Server and disconnects all players.
+func (s *Server) Close() error {
+	s.once.Do(func() {
+		s.closeErr = s.listener.Close()
+		if s.pipe {
+			minecraft.UnregisterNetwork(s.network)
+		}
+		s.mu.Lock()
+		for _, p := range s.players {
+			_ = s.listener.Disconnect(p.conn, "Server closed.")
+		}
+		s.mu.Unlock()
+	})
+	return s.closeErr
+}
+
+// Player returns the state of the connected player with the name passed.
+func (s *Server) Player(name string) (Player, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.players[strings.ToLower(name)]
+	if !ok {
+		return Player{}, false
+	}
+	return p.Player, true
+}
+
+// WaitPlayer waits until a player with the name passed has spawned, or until the context passed is done.
+func (s *Server) WaitPlayer(ctx context.Context, name string) (Player, error) {
+	for {
+		s.mu.Lock()
+		p, ok := s.players[strings.ToLower(name)]
+		spawned := s.spawned
+		s.mu.Unlock()
+		if ok {
+			return p.Player, nil
+		}
+		select {
+		case <-spawned:
+		case <-ctx.Done():
+			return Player{}, fmt.Errorf("wait for player %v: %w", name, ctx.Err())
+		}
+	}
+}
+
+// GameRule returns the value of the game rule with the name passed: A bool, uint32 or float32.
+func (s *Server) GameRule(name string) (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.gameRules[strings.ToLower(name)]
+	return v, ok
+}
+
+// Commands returns all command lines executed by the Server, including those run through execute, in the
+// order they were executed.
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// Chat sends a chat message to all players, as if the player with the name passed sent it.
+func (s *Server) Chat(source, message string) {
+	s.broadcast(&packet.Text{TextType: packet.TextTypeChat, SourceName: source, Message: message})
+}
+
+// Kick disconnects the player with the name passed, showing it the message passed. It returns false if no
+// such player is connected.
+func (s *Server) Kick(name, message string) bool {
+	s.mu.Lock()
+	p, ok := s.players[strings.ToLower(name)]
+	s.mu.Unlock()
+	if ok {
+		_ = s.listener.Disconnect(p.conn, message)
+	}
+	return ok
+}
+
+// Transfer sends the player with the name passed a Transfer packet, telling it to connect to the address and
+// port passed. It returns false if no such player is connected.
+func (s *Server) Transfer(name, address string, port uint16) bool {
+	s.mu.Lock()
+	p, ok := s.players[strings.ToLower(name)]
+	s.mu.Unlock()
+	if ok {
+		_ = p.conn.WritePacket(&packet.Transfer{Address: address, Port: port})
+	}
+	return ok
+}
+
+// accept accepts connections until the listener is closed.
+func (s *Server) accept() {
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handleConn(c.(*minecraft.Conn))
+	}
+}
+
+// handleConn spawns the player of the connection passed and handles its packets until it disconnects.
+func (s *Server) handleConn(conn *minecraft.Conn) {
+	defer conn.Close()
+	runtimeID := atomic.AddUint64(&s.ids, 1)
+	spawn := mgl32.Vec3{0.5, groundY + 1, 0.5}
+	if err := conn.StartGameTimeout(minecraft.GameData{
+		WorldName:       s.worldName,
+		EntityUniqueID:  int64(runtimeID),
+		EntityRuntimeID: runtimeID,
+		PlayerGameMode:  1,
+		WorldGameMode:   1,
+		PlayerPosition:  spawn.Add(mgl32.Vec3{0, playerEyeHeight}),
+		WorldSpawn:      protocol.BlockPos{0, groundY + 1, 0},
+		GameRules:       s.gameRuleList(),
+		Items:           s.items,
+	}, time.Minute); err != nil {
+		s.log.Printf("start game: %v", err)
+		return
+	}
+	identity := conn.IdentityData()
+	id, _ := uuid.Parse(identity.Identity)
+	p := &player{conn: conn, Player: Player{
+		Name:      identity.DisplayName,
+		UUID:      id,
+		RuntimeID: runtimeID,
+		Position:  spawn,
+	}}
+	s.join(p)
+	defer s.quit(p)
+
+	for {
+		pk, err := conn.ReadPacket()
+		if err != nil {
+			return
+		}
+		switch pk := pk.(type) {
+		case *packet.CommandRequest:
+			output := s.execute(p, pk.CommandLine)
+			output.CommandOrigin = pk.CommandOrigin
+			output.OutputType = packet.CommandOutputTypeAllOutput
+			_ = conn.WritePacket(output)
+		case *packet.SettingsCommand:
+			s.execute(p, pk.CommandLine)
+		case *packet.Text:
+			if pk.TextType == packet.TextTypeChat {
+				s.Chat(p.Name, pk.Message)
+			}
+		case *packet.MovePlayer:
+			s.mu.Lock()
+			p.Position = pk.Position.Sub(mgl32.Vec3{0, playerEyeHeight})
+			p.Pitch, p.Yaw = pk.Pitch, pk.Yaw
+			s.mu.Unlock()
+			s.broadcastExcept(p, &packet.MovePlayer{
+				EntityRuntimeID: p.RuntimeID,
+				Position:        pk.Position,
+				Pitch:           pk.Pitch,
+				Yaw:             pk.Yaw,
+				HeadYaw:         pk.HeadYaw,
+				OnGround:        pk.OnGround,
+			})
+		}
+	}
+}
+
+// join adds a player that spawned to the Server and shows it to the other players, and them to it.
+func (s *Server) join(p *player) {
+	s.mu.Lock()
+	// The states of the players are copied while s.mu is held, as commands such as tp change them.
+	others := make([]*player, 0, len(s.players))
+	states := make([]Player, 0, len(s.players))
+	for _, other := range s.players {
+		others, states = append(others, other), append(states, other.Player)
+	}
+	state := p.Player
+	s.players[strings.ToLower(p.Name)] = p
+	close(s.spawned)
+	s.spawned = make(chan struct{})
+	s.mu.Unlock()
+
+	list := &packet.PlayerList{ActionType: packet.PlayerListActionAdd}
+	for _, other := range append(others, p) {
+		list.Entries = append(list.Entries, protocol.PlayerListEntry{
+			UUID:           other.UUID,
+			EntityUniqueID: int64(other.RuntimeID),
+			Username:       other.Name,
+		})
+	}
+	_ = p.conn.WritePacket(list)
+	for i, other := range others {
+		_ = p.conn.WritePacket(addPlayer(states[i]))
+		_ = other.conn.WritePacket(&packet.PlayerList{ActionType: packet.PlayerListActionAdd, Entries: list.Entries[len(list.Entries)-1:]})
+		_ = other.conn.WritePacket(addPlayer(state))
+	}
+}
+
+// quit removes a player that disconnected from the Server and the view of other players.
+func (s *Server) quit(p *player) {
+	s.mu.Lock()
+	delete(s.players, strings.ToLower(p.Name))
+	s.mu.Unlock()
+	s.broadcast(&packet.RemoveActor{EntityUniqueID: int64(p.RuntimeID)})
+	s.broadcast(&packet.PlayerList{ActionType: packet.PlayerListActionRemove, Entries: []protocol.PlayerListEntry{{UUID: p.UUID}}})
+}
+
+// addPlayer returns an AddPlayer packet that shows the player passed.
+func addPlayer(p Player) *packet.AddPlayer {
+	return &packet.AddPlayer{
+		UUID:            p.UUID,
+		Username:        p.Name,
+		EntityUniqueID:  int64(p.RuntimeID),
+		EntityRuntimeID: p.RuntimeID,
+		Position:        p.Position.Add(mgl32.Vec3{0, playerEyeHeight}),
+		Pitch:           p.Pitch,
+		Yaw:             p.Yaw,
+		HeadYaw:         p.Yaw,
+	}
+}
+
+// broadcast writes a packet to all players.
+func (s *Server) broadcast(pk packet.Packet) {
+	s.broadcastExcept(nil, pk)
+}
+
+// broadcastExcept writes a packet to all players but the one passed.
+func (s *Server) broadcastExcept(except *player, pk packet.Packet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.players {
+		if p != except {
+			_ = p.conn.WritePacket(pk)
+		}
+	}
+}
+
+// gameRuleList returns the game rules of the Server as sent in the StartGame packet.
+func (s *Server) gameRuleList() []protocol.GameRule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rules := make([]protocol.GameRule, 0, len(s.gameRules))
+	for name, v := range s.gameRules {
+		rules = append(rules, protocol.GameRule{Name: name, Value: v})
+	}
+	return rules
+}
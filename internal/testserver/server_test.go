@@ -0,0 +1,156 @@
+package testserver
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"net"
+	"phoenix/minecraft"
+	"phoenix/minecraft/protocol"
+	"phoenix/minecraft/protocol/login"
+	"phoenix/minecraft/protocol/packet"
+	"testing"
+	"time"
+)
+
+// dial starts a Server and connects a spawned client to it with the name passed. Both are closed when the
+// test ends.
+func dial(t *testing.T, name string) (*Server, *minecraft.Conn) {
+	t.Helper()
+	s, err := New(Config{})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = s.Close()
+	})
+	conn, err := minecraft.Dialer{IdentityData: login.IdentityData{DisplayName: name}}.DialTimeout(s.Network(), s.Address(), time.Second*5)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	if err := conn.DoSpawnTimeout(time.Second * 5); err != nil {
+		t.Fatalf("spawn: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if _, err := s.WaitPlayer(ctx, name); err != nil {
+		t.Fatal(err)
+	}
+	return s, conn
+}
+
+// command sends a command over the connection and returns the CommandOutput answering it.
+func command(t *testing.T, conn *minecraft.Conn, line string) *packet.CommandOutput {
+	t.Helper()
+	id := uuid.New()
+	if err := conn.WritePacket(&packet.CommandRequest{
+		CommandOrigin: protocol.CommandOrigin{Origin: protocol.CommandOriginPlayer, UUID: id},
+		CommandLine:   line,
+	}); err != nil {
+		t.Fatalf("write command: %v", err)
+	}
+	for {
+		pk, err := conn.ReadPacket()
+		if err != nil {
+			t.Fatalf("read output of %v: %v", line, err)
+		}
+		if output, ok := pk.(*packet.CommandOutput); ok && output.CommandOrigin.UUID == id {
+			return output
+		}
+	}
+}
+
+// expect checks that the output passed has a first message with the success and message passed.
+func expect(t *testing.T, output *packet.CommandOutput, success bool, message string) {
+	t.Helper()
+	if len(output.OutputMessages) == 0 {
+		t.Fatalf("expected output %v, got no messages", message)
+	}
+	if msg := output.OutputMessages[0]; msg.Success != success || msg.Message != message {
+		t.Fatalf("expected output %v (success %v), got %+v", message, success, msg)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	s, conn := dial(t, "Builder")
+	w := s.World()
+
+	expect(t, command(t, conn, "setblock 1 10 1 stone 2"), true, "commands.setblock.success")
+	if b := w.Block(protocol.BlockPos{1, 10, 1}); b != (Block{Name: "minecraft:stone", Data: 2}) {
+		t.Fatalf("unexpected block after setblock: %v", b)
+	}
+	expect(t, command(t, conn, "setblock 1 10 1 stone 2"), false, "commands.setblock.noChange")
+	expect(t, command(t, conn, `setblock 2 10 1 minecraft:log ["pillar_axis":"x"]`), true, "commands.setblock.success")
+	if b := w.Block(protocol.BlockPos{2, 10, 1}); b.States != `["pillar_axis":"x"]` {
+		t.Fatalf("unexpected block states after setblock: %v", b)
+	}
+
+	out := command(t, conn, "fill 0 20 0 3 21 3 glass")
+	expect(t, out, true, "commands.fill.success")
+	if out.OutputMessages[0].Parameters[0] != "32" || w.Count(protocol.BlockPos{0, 20, 0}, protocol.BlockPos{3, 21, 3}, "glass") != 32 {
+		t.Fatalf("unexpected fill result: %+v", out.OutputMessages[0])
+	}
+	expect(t, command(t, conn, "fill 0 20 0 3 21 3 air 0 replace glass"), true, "commands.fill.success")
+	expect(t, command(t, conn, "fill 0 0 0 100 100 100 stone"), false, "commands.fill.tooManyBlocks")
+
+	expect(t, command(t, conn, "testforblock 1 10 1 stone"), true, "commands.testforblock.success")
+	out = command(t, conn, "testforblock 1 10 1 dirt")
+	expect(t, out, false, "commands.testforblock.failed.tile")
+	if p := out.OutputMessages[0].Parameters; len(p) != 5 || p[3] != "minecraft:stone" {
+		t.Fatalf("unexpected testforblock parameters: %v", p)
+	}
+	expect(t, command(t, conn, "testforblock 0 0 0 bedrock"), true, "commands.testforblock.success")
+
+	expect(t, command(t, conn, "gamerule sendcommandfeedback false"), true, "commands.gamerule.success")
+	if v, _ := s.GameRule("sendcommandfeedback"); v != false {
+		t.Fatalf("game rule not changed: %v", v)
+	}
+
+	expect(t, command(t, conn, "tp 10 64 -5"), true, "commands.tp.success.coordinates")
+	if p, _ := s.Player("Builder"); p.Position[0] != 10 || p.Position[1] != 64 || p.Position[2] != -5 {
+		t.Fatalf("player not teleported: %v", p.Position)
+	}
+	out = command(t, conn, "execute Builder ~ ~ ~ testforblock ~ ~-1 ~ air")
+	expect(t, out, true, "commands.testforblock.success")
+	if p := out.OutputMessages[0].Parameters; p[0] != "10" || p[1] != "63" || p[2] != "-5" {
+		t.Fatalf("execute resolved unexpected position: %v", p)
+	}
+	expect(t, command(t, conn, "kill @e"), false, "commands.generic.unknown")
+}
+
+func TestChat(t *testing.T) {
+	s, conn := dial(t, "Chatter")
+	if err := conn.WritePacket(&packet.Text{TextType: packet.TextTypeChat, SourceName: "Chatter", Message: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	s.Chat("Server", "hello")
+	var got []string
+	for len(got) < 2 {
+		pk, err := conn.ReadPacket()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if text, ok := pk.(*packet.Text); ok {
+			got = append(got, text.SourceName+": "+text.Message)
+		}
+	}
+	if got[0] != "Chatter: hi" && got[1] != "Chatter: hi" {
+		t.Fatalf("chat message not relayed: %v", got)
+	}
+}
+
+// TestCloseNetwork checks that the pipe registered by a Server is unregistered when it is closed.
+func TestCloseNetwork(t *testing.T) {
+	s, err := New(Config{})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	_ = s.Close()
+	var unknown net.UnknownNetworkError
+	if _, err := (minecraft.Dialer{}).DialTimeout(s.Network(), s.Address(), time.Second); !errors.As(err, &unknown) {
+		t.Fatalf("expected network of closed server to be unregistered, got %v", err)
+	}
+}
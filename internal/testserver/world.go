@@ -0,0 +1,130 @@
+package testserver
+
+import (
+	"fmt"
+	"phoenix/minecraft/protocol"
+	"strings"
+	"sync"
+)
+
+const (
+	// MinY and MaxY are the lowest and highest Y coordinates blocks may be placed at.
+	MinY, MaxY = -64, 319
+	// groundY is the Y coordinate of the top layer of the flat world. Players spawn on top of it.
+	groundY = 3
+)
+
+// Block is a block in the World.
+type Block struct {
+	// Name is the name of the block including its namespace, such as 'minecraft:stone'.
+	Name string
+	// Data is the data value of the block, as passed to commands such as /setblock.
+	Data int32
+	// States holds the block states of the block as passed to commands, such as '["stone_type":"granite"]'.
+	// It is empty if the block was placed using a data value.
+	States string
+}
+
+// Air is the block found in every empty position of a World.
+var Air = Block{Name: "minecraft:air"}
+
+// String ...
+func (b Block) String() string {
+	if b.States != "" {
+		return b.Name + " " + b.States
+	}
+	return fmt.Sprintf("%s %d", b.Name, b.Data)
+}
+
+// blockName adds the minecraft namespace to the block name passed if it has none.
+func blockName(name string) string {
+	name = strings.ToLower(name)
+	if !strings.Contains(name, ":") {
+		return "minecraft:" + name
+	}
+	return name
+}
+
+// World is a flat world held in memory. Below Y 4 it consists of a layer of bedrock, two layers of dirt and
+// a layer of grass. Methods on World may be called from multiple goroutines simultaneously.
+type World struct {
+	mu     sync.RWMutex
+	blocks map[protocol.BlockPos]Block
+}
+
+// NewWorld returns an unchanged flat World.
+func NewWorld() *World {
+	return &World{blocks: make(map[protocol.BlockPos]Block)}
+}
+
+// Block returns the block at the position passed.
+func (w *World) Block(pos protocol.BlockPos) Block {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.block(pos)
+}
+
+// block returns the block at the position passed without locking.
+func (w *World) block(pos protocol.BlockPos) Block {
+	if b, ok := w.blocks[pos]; ok {
+		return b
+	}
+	switch {
+	case pos[1] == 0:
+		return Block{Name: "minecraft:bedrock"}
+	case pos[1] > 0 && pos[1] < groundY:
+		return Block{Name: "minecraft:dirt"}
+	case pos[1] == groundY:
+		return Block{Name: "minecraft:grass"}
+	}
+	return Air
+}
+
+// SetBlock places a block at the position passed.
+func (w *World) SetBlock(pos protocol.BlockPos, b Block) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.blocks[pos] = b
+}
+
+// Changed returns all positions of the World holding a block that was set, mapped to that block.
+func (w *World) Changed() map[protocol.BlockPos]Block {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	m := make(map[protocol.BlockPos]Block, len(w.blocks))
+	for pos, b := range w.blocks {
+		m[pos] = b
+	}
+	return m
+}
+
+// Count returns the amount of blocks with the name passed in the cuboid between the two corners passed.
+func (w *World) Count(a, b protocol.BlockPos, name string) int {
+	name = blockName(name)
+	lo, hi := corners(a, b)
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	n := 0
+	for x := lo[0]; x <= hi[0]; x++ {
+		for y := lo[1]; y <= hi[1]; y++ {
+			for z := lo[2]; z <= hi[2]; z++ {
+				if w.block(protocol.BlockPos{x, y, z}).Name == name {
+					n++
+				}
+			}
+		}
+	}
+	return n
+}
+
+// corners returns the lowest and highest corner of the cuboid between the two corners passed.
+func corners(a, b protocol.BlockPos) (lo, hi protocol.BlockPos) {
+	for i := 0; i < 3; i++ {
+		lo[i], hi[i] = a[i], b[i]
+		if lo[i] > hi[i] {
+			lo[i], hi[i] = hi[i], lo[i]
+		}
+	}
+	return lo, hi
+}
@@ -0,0 +1,144 @@
+package minecraft
+
+import (
+	"fmt"
+	"phoenix/ligo"
+	"strings"
+)
+
+// Role is the level of access a player has to the REPL. Roles are ordered: every role may do whatever the
+// roles below it may do.
+type Role int
+
+const (
+	// RoleNone is the role of players that are not listed in the config. Their chat is ignored.
+	RoleNone Role = iota
+	// RoleViewer may evaluate expressions and use generators, but may not change the world.
+	RoleViewer
+	// RoleBuilder may additionally call functions that place blocks or query the world.
+	RoleBuilder
+	// RoleOperator may call any function.
+	RoleOperator
+)
+
+// String ...
+func (r Role) String() string {
+	switch r {
+	case RoleViewer:
+		return "viewer"
+	case RoleBuilder:
+		return "builder"
+	case RoleOperator:
+		return "operator"
+	}
+	return "none"
+}
+
+// ParseRole parses a role name as found in the config, such as "builder", into a Role.
+func ParseRole(name string) (Role, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "viewer":
+		return RoleViewer, nil
+	case "builder":
+		return RoleBuilder, nil
+	case "operator":
+		return RoleOperator, nil
+	case "none", "":
+		return RoleNone, nil
+	}
+	return RoleNone, fmt.Errorf("unknown role %q", name)
+}
+
+// defaultPermissions holds the minimum role needed to call a function. Functions not found here may be
+// called by any viewer. Entries in the Access.Permissions section of the config take precedence.
+var defaultPermissions = map[string]Role{
+	"get":         RoleBuilder,
+	"plot":        RoleBuilder,
+	"pos1":        RoleBuilder,
+	"pos2":        RoleBuilder,
+	"expand":      RoleBuilder,
+	"contract":    RoleBuilder,
+	"shift":       RoleBuilder,
+	"fill":        RoleBuilder,
+	"replace":     RoleBuilder,
+	"walls":       RoleBuilder,
+	"clone":       RoleBuilder,
+	"copy":        RoleBuilder,
+	"cut":         RoleBuilder,
+	"paste":       RoleBuilder,
+	"undo":        RoleBuilder,
+	"stack":       RoleBuilder,
+	"input":       RoleOperator,
+	"input-lines": RoleOperator,
+	"sleep":       RoleOperator,
+}
+
+// AccessList resolves the Role of players and the Role needed to call a function.
+type AccessList struct {
+	players     map[string]Role
+	permissions map[string]Role
+}
+
+// NewAccessList creates an AccessList from the player name lists passed. A player listed under several roles
+// is given the highest of them. Permissions maps function names to role names and overrides the defaults.
+func NewAccessList(operators, builders, viewers []string, permissions map[string]string) (*AccessList, error) {
+	a := &AccessList{players: make(map[string]Role), permissions: make(map[string]Role)}
+	for _, l := range []struct {
+		names []string
+		role  Role
+	}{{viewers, RoleViewer}, {builders, RoleBuilder}, {operators, RoleOperator}} {
+		for _, name := range l.names {
+			if name = playerKey(strings.TrimSpace(name)); name != "" {
+				a.players[name] = l.role
+			}
+		}
+	}
+	for fn, role := range defaultPermissions {
+		a.permissions[fn] = role
+	}
+	for fn, name := range permissions {
+		role, err := ParseRole(name)
+		if err != nil {
+			return nil, fmt.Errorf("permission of function %v: %w", fn, err)
+		}
+		a.permissions[fn] = role
+	}
+	return a, nil
+}
+
+// Role returns the role of the player with the name passed. Player names are matched case-insensitively, the
+// same way the game treats them.
+func (a *AccessList) Role(player string) Role {
+	return a.players[playerKey(player)]
+}
+
+// playerKey returns the key that the player with the name passed is stored under in maps keyed by player,
+// so that names differing only in case refer to the same player.
+func playerKey(player string) string {
+	return strings.ToLower(player)
+}
+
+// Required returns the minimum role needed to call the function with the name passed.
+func (a *AccessList) Required(fn string) Role {
+	if role, ok := a.permissions[fn]; ok {
+		return role
+	}
+	return RoleViewer
+}
+
+// restrict replaces every function in the VM passed that requires a higher role than the one passed with a
+// function that throws a permission error.
+func (a *AccessList) restrict(vm *ligo.VM, role Role) {
+	for name := range vm.Funcs {
+		if required := a.Required(name); required > role {
+			vm.Funcs[name] = denied(name, required)
+		}
+	}
+}
+
+// denied returns an InBuilt that throws an error stating the function requires the role passed.
+func denied(name string, required Role) ligo.InBuilt {
+	return func(vm *ligo.VM, variable ...ligo.Variable) ligo.Variable {
+		return vm.Throw(fmt.Sprintf("%s : permission denied, requires role %s", name, required))
+	}
+}
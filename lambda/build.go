@@ -0,0 +1,210 @@
+package minecraft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/pterm/pterm"
+	"math"
+	"phoenix/lambda/function"
+	"phoenix/minecraft/protocol"
+	"time"
+)
+
+const (
+	// maxUndo is the amount of builds a Session can undo.
+	maxUndo = 10
+	// maxUndoVolume is the largest volume, in blocks, of the bounding box of a build for which the previous
+	// blocks are saved so that it can be undone. Saving larger builds takes too many structure exports.
+	maxUndoVolume = 1 << 20
+	// buildQueueSize is the amount of builds that may be queued in a Session before new builds are refused.
+	buildQueueSize = 16
+)
+
+var (
+	// errSessionClosed is returned when a build is queued in a session that was closed.
+	errSessionClosed = errors.New("session closed")
+	// errBuildCancelled is returned by runBuild if the session running the build was closed.
+	errBuildCancelled = errors.New("build cancelled")
+)
+
+// placement is a single block to place at an absolute position in the world.
+type placement struct {
+	pos   protocol.BlockPos
+	block string
+}
+
+// buildJob is a list of blocks placed one by one, at a limited rate, by the build loop of a session.
+type buildJob struct {
+	// name describes the job in messages, for example 'paste'.
+	name   string
+	blocks []placement
+	// undoable specifies if the blocks replaced by the job are saved, so that it can be undone.
+	undoable bool
+	// done is the amount of blocks in the job placed so far. Blocks are placed in order unless the job is
+	// placed in parallel, in which case done is only a count and unplaced holds the blocks left.
+	done int
+	// unplaced holds the blocks not yet placed once the job was placed in parallel by runParallel. It is nil
+	// until then.
+	unplaced []placement
+}
+
+// undoEntry holds the blocks replaced by a build job, so that they can be placed back.
+type undoEntry struct {
+	name   string
+	blocks []placement
+}
+
+// build queues a job in the build loop of the session passed. Jobs of a session are run one after another, in
+// the order they were queued, so that a later job never interleaves with an earlier one. build never blocks,
+// as it is called from the packet loop, and returns an error if the queue is full or the session is closed.
+func (client *Client) build(s *Session, job *buildJob) error {
+	if len(job.blocks) == 0 {
+		return nil
+	}
+	s.buildMu.Lock()
+	defer s.buildMu.Unlock()
+	if s.closed {
+		return errSessionClosed
+	}
+	select {
+	case s.builds <- job:
+		return nil
+	default:
+		return fmt.Errorf("%d builds are already queued", buildQueueSize)
+	}
+}
+
+// buildLoop runs the build jobs queued in the session passed until the session is closed. Jobs still queued
+// when the session is closed are dropped.
+func (client *Client) buildLoop(s *Session) {
+	for job := range s.builds {
+		select {
+		case <-s.stop:
+			continue
+		default:
+		}
+		if job.undoable {
+			if entry, err := client.snapshot(job); err != nil {
+				pterm.Warning.Println(fmt.Sprintf("%s: cannot be undone: %s", job.name, err))
+			} else {
+				s.pushUndo(entry)
+			}
+		}
+		if err := client.runBuild(job, s.stop); err != nil {
+			pterm.Error.Println(fmt.Sprintf("%s: %s", job.name, err))
+			continue
+		}
+		pterm.Info.Println(fmt.Sprintf("[%s] %s: placed %d blocks", s.Player, job.name, job.done))
+	}
+}
+
+// runBuild places the remaining blocks of a job, waiting a millisecond between blocks so that the server is
+// not flooded with commands. If the connection is lost, runBuild waits for the client to reconnect and
+// resumes the job slightly before the block it stopped at. It returns an error if the client stopped
+// reconnecting, or errBuildCancelled once the stop channel passed is closed. If the client has a crew, the
+// job is placed by all bots in parallel using runParallel.
+func (client *Client) runBuild(job *buildJob, stop <-chan struct{}) error {
+	if len(client.crew) != 0 {
+		return client.runParallel(job, stop)
+	}
+	for job.done < len(job.blocks) {
+		select {
+		case <-stop:
+			return errBuildCancelled
+		default:
+		}
+		p := job.blocks[job.done]
+		if err := client.setBlock(p.pos, p.block); err != nil {
+			pterm.Warning.Println(fmt.Sprintf("%s: paused at block %d of %d: %s", job.name, job.done, len(job.blocks), err))
+			connected, stopped := client.connectionState()
+			select {
+			case <-connected:
+			case <-stopped:
+				return ErrGaveUp
+			case <-stop:
+				return errBuildCancelled
+			}
+			if job.done -= resumeOverlap; job.done < 0 {
+				job.done = 0
+			}
+			pterm.Info.Println(fmt.Sprintf("%s: resumed at block %d of %d", job.name, job.done, len(job.blocks)))
+			continue
+		}
+		job.done++
+		time.Sleep(time.Millisecond)
+	}
+	return nil
+}
+
+// snapshot exports the blocks a job is about to replace, returning an undoEntry that places them back.
+func (client *Client) snapshot(job *buildJob) (undoEntry, error) {
+	lo, hi := job.blocks[0].pos, job.blocks[0].pos
+	for _, p := range job.blocks {
+		for i := 0; i < 3; i++ {
+			if p.pos[i] < lo[i] {
+				lo[i] = p.pos[i]
+			}
+			if p.pos[i] > hi[i] {
+				hi[i] = p.pos[i]
+			}
+		}
+	}
+	if volume := int64(hi[0]-lo[0]+1) * int64(hi[1]-lo[1]+1) * int64(hi[2]-lo[2]+1); volume > maxUndoVolume {
+		return undoEntry{}, fmt.Errorf("region of %d blocks is larger than %d blocks", volume, maxUndoVolume)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	cb, err := client.ExportRegion(ctx, function.NewSubSpace(
+		function.Vector{float64(lo[0]), float64(lo[1]), float64(lo[2])},
+		function.Vector{float64(hi[0]), float64(hi[1]), float64(hi[2])},
+	))
+	if err != nil {
+		return undoEntry{}, err
+	}
+	placed := make(map[protocol.BlockPos]struct{}, len(job.blocks))
+	for _, p := range job.blocks {
+		placed[p.pos] = struct{}{}
+	}
+	entry := undoEntry{name: job.name}
+	for _, v := range cb.Voxels {
+		pos := protocol.BlockPos{lo[0] + v.Pos[0], lo[1] + v.Pos[1], lo[2] + v.Pos[2]}
+		if _, ok := placed[pos]; ok {
+			entry.blocks = append(entry.blocks, placement{pos: pos, block: v.Block.String()})
+		}
+	}
+	return entry, nil
+}
+
+// pushUndo adds an entry to the undo stack of the session, dropping the oldest entry if the stack is full.
+func (s *Session) pushUndo(entry undoEntry) {
+	s.buildMu.Lock()
+	defer s.buildMu.Unlock()
+	s.undo = append(s.undo, entry)
+	if len(s.undo) > maxUndo {
+		s.undo = s.undo[len(s.undo)-maxUndo:]
+	}
+}
+
+// popUndo removes the most recent entry from the undo stack of the session. It returns false if the stack is
+// empty.
+func (s *Session) popUndo() (undoEntry, bool) {
+	s.buildMu.Lock()
+	defer s.buildMu.Unlock()
+	if len(s.undo) == 0 {
+		return undoEntry{}, false
+	}
+	entry := s.undo[len(s.undo)-1]
+	s.undo = s.undo[:len(s.undo)-1]
+	return entry, true
+}
+
+// setBlock places a block, formatted as in a /setblock command, at the position passed.
+func (client *Client) setBlock(pos protocol.BlockPos, block string) error {
+	return client.SendCommandNoCallback(fmt.Sprintf("setblock %d %d %d %s", pos[0], pos[1], pos[2], block))
+}
+
+// blockPos converts a vector to the position of the block it is in.
+func blockPos(v function.Vector) protocol.BlockPos {
+	return protocol.BlockPos{int32(math.Floor(v[0])), int32(math.Floor(v[1])), int32(math.Floor(v[2]))}
+}
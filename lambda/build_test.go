@@ -0,0 +1,60 @@
+package minecraft
+
+import (
+	"phoenix/minecraft/protocol"
+	"phoenix/minecraft/protocol/packet"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSessionCloseBuilds(t *testing.T) {
+	access, err := NewAccessList(nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written int64
+	release := make(chan struct{})
+	client := &Client{access: access, sessions: make(map[string]*Session), entities: NewEntityRegistry()}
+	client.commands = newCommander(func(packet.Packet) error {
+		// Block the first placement until the session is closed.
+		if atomic.AddInt64(&written, 1) == 1 {
+			<-release
+		}
+		return nil
+	})
+	t.Cleanup(client.commands.Close)
+
+	s := client.session("Operator", RoleOperator)
+	job := func() *buildJob {
+		job := &buildJob{name: "test"}
+		for i := int32(0); i < 10; i++ {
+			job.blocks = append(job.blocks, placement{pos: protocol.BlockPos{i, 0, 0}, block: "stone"})
+		}
+		return job
+	}
+	first, second := job(), job()
+	if err := client.build(s, first); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.build(s, second); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "first placement", func() bool {
+		return atomic.LoadInt64(&written) == 1
+	})
+
+	// Replacing the session because the role of the player changed closes the old session.
+	if client.session("Operator", RoleBuilder) == s {
+		t.Fatal("session not replaced after role change")
+	}
+	close(release)
+	time.Sleep(time.Millisecond * 50)
+	if n := atomic.LoadInt64(&written); n != 1 {
+		t.Fatalf("%d blocks were placed after the session was closed, expected none", n-1)
+	}
+	if err := client.build(s, job()); err != errSessionClosed {
+		t.Fatalf("build in closed session returned %v, expected %v", err, errSessionClosed)
+	}
+	client.closeSessions()
+}
@@ -2,17 +2,16 @@ package minecraft
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"github.com/google/uuid"
 	"github.com/pterm/pterm"
 	"os"
 	"phoenix/lambda/function"
 	"phoenix/ligo"
 	"phoenix/minecraft"
-	"phoenix/minecraft/protocol"
 	"phoenix/minecraft/protocol/packet"
+	"sync"
 	"time"
 )
 
@@ -20,10 +19,41 @@ type Callback func(output *packet.CommandOutput) error
 type Client struct {
 	bot, operator string
 	spaces        map[string]*function.Space
-	vm            *ligo.VM
-	conn          *minecraft.Conn
-	config        PlotConfig
-	callbacks     map[string]Callback
+	// connection holds the connection to the server, which is replaced when the client reconnects.
+	connection connection
+	commands   *commander
+	structures *structureExporter
+	entities   *EntityRegistry
+	// crew holds the additional bots that place the blocks of builds together with this bot.
+	crew []*Client
+
+	// lib holds the libraries and scripts loaded into the VM of each new session.
+	lib struct {
+		Std    bool
+		Script []string
+	}
+	access *AccessList
+	// wand is the name of the item used to select positions by clicking blocks through the proxy.
+	wand string
+	// console is the session of the operator using the standard input.
+	console   *Session
+	sessionMu sync.Mutex
+	// sessions holds the session of each player, keyed by the name of the player as returned by playerKey.
+	sessions map[string]*Session
+}
+
+// register registers the handlers of all features of the client to the Dispatcher passed.
+func (client *Client) register(d *minecraft.Dispatcher) {
+	client.entities.Register(d)
+	client.commands.register(d)
+	client.structures.register(d)
+	d.Handle(packet.IDText, func(pk packet.Packet) bool {
+		p := pk.(*packet.Text)
+		client.handleChat(p.SourceName, p.Message)
+		return true
+	}, minecraft.Filter(func(pk packet.Packet) bool {
+		return pk.(*packet.Text).TextType == packet.TextTypeChat
+	}))
 }
 
 func (client *Client) StartConsole() {
@@ -33,7 +63,7 @@ func (client *Client) StartConsole() {
 			if scanner.Scan() {
 
 				line := scanner.Text()
-				value, err := client.vm.Eval(line)
+				value, err := client.console.Eval(line)
 				if err != nil {
 					pterm.Error.Println(err)
 				} else {
@@ -44,41 +74,62 @@ func (client *Client) StartConsole() {
 	}()
 }
 
-func (client *Client) Init() {
-	client.vm.Funcs["get"] = func(vm *ligo.VM, variable ...ligo.Variable) ligo.Variable {
-		client.SendCommand("gamerule sendcommandfeedback true", func(output *packet.CommandOutput) error { return nil })
-		err := client.SendCommand(fmt.Sprintf("execute %s ~ ~ ~ testforblock ~ ~ ~ air", client.operator), func(output *packet.CommandOutput) error {
-			pos, _ := function.SliceAtoi(output.OutputMessages[0].Parameters)
-			pterm.Info.Println(output.OutputMessages[0])
-			if len(pos) != 3 {
-				return errors.New("testforblock function have got wrong number of positions")
-			} else {
-				space := vm.Vars["space"].Value.(*function.Space)
-				space.SetPointer(pos)
-				pterm.Info.Println("Position got: ", pos)
-				client.SendCommand("gamerule sendcommandfeedback false", func(output *packet.CommandOutput) error { return nil })
-			}
-			return nil
-		})
-		if err != nil {
-			return vm.Throw(fmt.Sprintf("SendCommand: %s", err))
-		} else {
-			return ligo.Variable{Type: ligo.TypeNil, Value: nil}
+// registerFuncs registers the functions interacting with the world in the VM of the session passed.
+func (client *Client) registerFuncs(s *Session) {
+	s.vm.Funcs["get"] = func(vm *ligo.VM, variable ...ligo.Variable) ligo.Variable {
+		space := vm.Vars["space"].Value.(*function.Space)
+		if e, ok := client.entities.Player(s.Player); ok {
+			pos := blockVector(e.Position)
+			space.SetPointer(pos)
+			pterm.Info.Println("Position got: ", pos)
+			return vectorVariable(pos)
 		}
+		// The player is not within view of the bot, so we fall back to asking the server, which requires the
+		// bot to be an operator. The output is awaited on another goroutine, as (get) is evaluated from the
+		// packet loop that delivers it.
+		go func() {
+			ctx := context.Background()
+			if _, err := client.Command(ctx, "gamerule sendcommandfeedback true"); err != nil {
+				pterm.Error.Println(fmt.Sprintf("get: %s", err))
+				return
+			}
+			defer func() {
+				_ = client.SendCommandNoCallback("gamerule sendcommandfeedback false")
+			}()
+			output, err := client.Command(ctx, fmt.Sprintf("execute %s ~ ~ ~ testforblock ~ ~ ~ air", s.Player))
+			if err != nil {
+				pterm.Error.Println(fmt.Sprintf("get: %s", err))
+				return
+			}
+			res, err := ParseTestForBlock(output)
+			if err != nil {
+				pterm.Error.Println(fmt.Sprintf("get: %s", err))
+				return
+			}
+			pos := function.Vector{float64(res.Position[0]), float64(res.Position[1]), float64(res.Position[2])}
+			space.SetPointer(pos)
+			pterm.Info.Println("Position got: ", pos)
+		}()
+		return ligo.Variable{Type: ligo.TypeNil, Value: nil}
 	}
+	client.registerEntityFuncs(s)
+	client.registerSelectionFuncs(s)
+	client.registerClipboardFuncs(s)
 
-	client.vm.Funcs["plot"] = func(vm *ligo.VM, variable ...ligo.Variable) ligo.Variable {
+	s.vm.Funcs["plot"] = func(vm *ligo.VM, variable ...ligo.Variable) ligo.Variable {
 		workSpace := vm.Vars["space"].Value.(*function.Space)
 		if variable[0].Type == ligo.TypeArray {
 			vec := variable[0].Value.([]function.Vector)
+			block := Block{
+				name: vm.Vars["block"].Value.(string),
+				data: byte(vm.Vars["data"].Value.(int64)),
+			}
+			job := &buildJob{name: "plot", undoable: true}
 			for _, v := range vec {
-				client.config.block.name = vm.Vars["block"].Value.(string)
-				client.config.block.data = byte(vm.Vars["data"].Value.(int64))
-				err := client.SetBlock(function.AddVector(v, workSpace.GetPointer()))
-				time.Sleep(time.Millisecond)
-				if err != nil {
-					return vm.Throw(fmt.Sprintf("setblock: Unable to setblock: %s", err))
-				}
+				job.blocks = append(job.blocks, placement{pos: blockPos(function.AddVector(v, workSpace.GetPointer())), block: block.String()})
+			}
+			if err := client.build(s, job); err != nil {
+				return vm.Throw(fmt.Sprintf("plot : %s", err))
 			}
 		} else if variable[0].Type == ligo.TypeFloat {
 			workSpace.Plot(variable[0].Value.(function.Vector))
@@ -91,21 +142,32 @@ func (client *Client) Init() {
 	}
 }
 
+// Command sends the command passed to the server and waits for its output. It returns ErrCommandTimeout if
+// no output arrived before ctx expired, or before 10 seconds passed if ctx has no deadline. Command must not
+// be called from the packet loop itself, as that loop delivers the output.
+func (client *Client) Command(ctx context.Context, command string) (*packet.CommandOutput, error) {
+	return client.commands.Command(ctx, command)
+}
+
+// SendCommand sends the command passed to the server and calls the callback with its output once it arrives.
+// An error is returned if the command could not be sent. The callback is called on a separate goroutine, so
+// errors it returns are logged rather than returned. If no output arrives in time, the callback is not called.
 func (client *Client) SendCommand(command string, callback Callback) error {
-	requestID := uuid.New()
-	callbackID := uuid.New()
-	commandRequest := &packet.CommandRequest{
-		CommandOrigin: protocol.CommandOrigin{
-			Origin:         protocol.CommandOriginPlayer,
-			UUID:           callbackID,
-			RequestID:      requestID.String(),
-			PlayerUniqueID: 0,
-		},
-		CommandLine: command,
-		Internal:    false,
+	wait, err := client.commands.Request(context.Background(), command)
+	if err != nil {
+		return err
 	}
-	client.callbacks[callbackID.String()] = callback
-	return client.conn.WritePacket(commandRequest)
+	go func() {
+		output, err := wait()
+		if err != nil {
+			pterm.Warning.Println(fmt.Sprintf("%s: %s", command, err))
+			return
+		}
+		if err := callback(output); err != nil {
+			pterm.Warning.Println(err)
+		}
+	}()
+	return nil
 }
 
 func (client *Client) SendCommandWO(command string) error {
@@ -113,32 +175,19 @@ func (client *Client) SendCommandWO(command string) error {
 		CommandLine:    command,
 		SuppressOutput: false,
 	}
-	return client.conn.WritePacket(commandRequest)
+	return client.writePacket(commandRequest)
 }
 
 func (client *Client) SendCommandNoCallback(command string) error {
-	requestID := uuid.New()
-	callbackID := uuid.New()
-	commandRequest := &packet.CommandRequest{
-		CommandOrigin: protocol.CommandOrigin{
-			Origin:         protocol.CommandOriginPlayer,
-			UUID:           callbackID,
-			RequestID:      requestID.String(),
-			PlayerUniqueID: 0,
-		},
-		CommandLine: command,
-		Internal:    false,
-	}
-	return client.conn.WritePacket(commandRequest)
+	return client.commands.Send(command)
 }
 
 func (client *Client) Actionbar(target, text string) error {
 	return client.SendCommandNoCallback(fmt.Sprintf("title %s actionbar %s", target, text))
 }
 
-func (client *Client) SetBlock(pos function.Vector) error {
-	cmd := fmt.Sprintf("setblock %v %v %v %s %d", pos[0], pos[1], pos[2], client.config.block.name, client.config.block.data)
-	return client.SendCommandNoCallback(cmd)
+func (client *Client) SetBlock(pos function.Vector, block Block) error {
+	return client.setBlock(blockPos(pos), block.String())
 }
 
 func (client *Client) Info(text ...string) error {
@@ -0,0 +1,452 @@
+package minecraft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/pterm/pterm"
+	"phoenix/lambda/function"
+	"phoenix/ligo"
+	"phoenix/minecraft/protocol"
+	"sort"
+	"strings"
+	"time"
+)
+
+// errNoClipboard is returned by functions using the clipboard of a session before anything was copied.
+var errNoClipboard = errors.New("clipboard is empty, use copy first")
+
+// BlockState is a block together with its block states, as found in the palette of a structure.
+type BlockState struct {
+	// Name is the name of the block, such as 'minecraft:stone'.
+	Name string
+	// States holds the block states of the block. Values are strings, int32s, or uint8s for boolean states.
+	States map[string]interface{}
+}
+
+// Air checks if the block is air.
+func (b BlockState) Air() bool {
+	return b.Name == "minecraft:air" || b.Name == "air"
+}
+
+// String returns the block in the form used by commands such as /setblock: The name followed by its states,
+// for example 'minecraft:stone ["stone_type":"granite"]'.
+func (b BlockState) String() string {
+	if len(b.States) == 0 {
+		return b.Name
+	}
+	keys := make([]string, 0, len(b.States))
+	for k := range b.States {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	states := make([]string, 0, len(keys))
+	for _, k := range keys {
+		switch v := b.States[k].(type) {
+		case string:
+			states = append(states, fmt.Sprintf("%q:%q", k, v))
+		case uint8:
+			states = append(states, fmt.Sprintf("%q:%v", k, v != 0))
+		default:
+			states = append(states, fmt.Sprintf("%q:%v", k, v))
+		}
+	}
+	return b.Name + " [" + strings.Join(states, ",") + "]"
+}
+
+// Voxel is a block at a position relative to the origin of a Clipboard.
+type Voxel struct {
+	Pos   protocol.BlockPos
+	Block BlockState
+}
+
+// Clipboard holds a copied region of the world as a set of voxels. Its origin is the lowest corner of the
+// region copied.
+type Clipboard struct {
+	// Size is the size of the region held.
+	Size protocol.BlockPos
+	// Voxels holds every block in the region, including air.
+	Voxels []Voxel
+	// Offset is the position of the origin relative to the anchor it was copied from, usually the position
+	// of the player copying it. Pasting places the origin at the same offset from the anchor pasted at.
+	Offset protocol.BlockPos
+}
+
+// addTemplate adds the blocks found in a structure template, as sent in a StructureTemplateDataResponse, to
+// the clipboard, with the origin of the structure placed at the offset passed.
+func (cb *Clipboard) addTemplate(template map[string]interface{}, offset protocol.BlockPos) error {
+	size, ok := intList(template["size"])
+	if !ok || len(size) != 3 {
+		return errors.New("structure template has no valid size")
+	}
+	structure, _ := template["structure"].(map[string]interface{})
+	layers, _ := structure["block_indices"].([]interface{})
+	if len(layers) == 0 {
+		return errors.New("structure template has no block indices")
+	}
+	indices, ok := intList(layers[0])
+	if !ok || len(indices) != int(size[0]*size[1]*size[2]) {
+		return fmt.Errorf("structure template has %v block indices for a size of %v", len(indices), size)
+	}
+	palettes, _ := structure["palette"].(map[string]interface{})
+	def, _ := palettes["default"].(map[string]interface{})
+	entries, _ := def["block_palette"].([]interface{})
+	palette := make([]BlockState, len(entries))
+	for i, entry := range entries {
+		m, _ := entry.(map[string]interface{})
+		palette[i].Name, _ = m["name"].(string)
+		palette[i].States, _ = m["states"].(map[string]interface{})
+	}
+
+	// Block indices are ordered with the X axis outermost and the Z axis innermost.
+	for i, index := range indices {
+		if index < 0 {
+			// Structure void: The block is not part of the structure.
+			continue
+		}
+		if int(index) >= len(palette) {
+			return fmt.Errorf("structure template has block index %v out of range of palette with length %v", index, len(palette))
+		}
+		x := int32(i) / (size[1] * size[2])
+		y := int32(i) / size[2] % size[1]
+		z := int32(i) % size[2]
+		cb.Voxels = append(cb.Voxels, Voxel{
+			Pos:   protocol.BlockPos{offset[0] + x, offset[1] + y, offset[2] + z},
+			Block: palette[index],
+		})
+	}
+	return nil
+}
+
+// intList converts a TAG_List of TAG_Int decoded into an interface{} to a []int32.
+func intList(v interface{}) ([]int32, bool) {
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	ints := make([]int32, len(list))
+	for i, e := range list {
+		if ints[i], ok = e.(int32); !ok {
+			return nil, false
+		}
+	}
+	return ints, true
+}
+
+// Rotate rotates the clipboard clockwise, seen from above, around its anchor by the amount of degrees passed,
+// which must be a multiple of 90. The block states holding the direction of blocks are rotated too.
+func (cb *Clipboard) Rotate(degrees int) error {
+	if degrees%90 != 0 {
+		return fmt.Errorf("rotation must be a multiple of 90 degrees, got %v", degrees)
+	}
+	for steps := ((degrees/90)%4 + 4) % 4; steps > 0; steps-- {
+		cb.transform(func(p protocol.BlockPos) protocol.BlockPos {
+			return protocol.BlockPos{-p[2], p[1], p[0]}
+		}, rotateState)
+		cb.Size = protocol.BlockPos{cb.Size[2], cb.Size[1], cb.Size[0]}
+	}
+	return nil
+}
+
+// Flip mirrors the clipboard along the axis passed, "x", "y" or "z", through its anchor. The block states
+// holding the direction of blocks are mirrored too.
+func (cb *Clipboard) Flip(axis string) error {
+	var i int
+	switch axis {
+	case "x":
+		i = 0
+	case "y":
+		i = 1
+	case "z":
+		i = 2
+	default:
+		return fmt.Errorf("unknown axis %q, expected x, y or z", axis)
+	}
+	cb.transform(func(p protocol.BlockPos) protocol.BlockPos {
+		p[i] = -p[i]
+		return p
+	}, func(states map[string]interface{}) {
+		flipState(states, i)
+	})
+	return nil
+}
+
+// transform moves every voxel to the position returned by f, relative to the anchor of the clipboard, and
+// changes its states using the function passed. The origin and offset are then recomputed so that the origin
+// is again the lowest corner of the clipboard.
+func (cb *Clipboard) transform(f func(p protocol.BlockPos) protocol.BlockPos, state func(states map[string]interface{})) {
+	if len(cb.Voxels) == 0 {
+		return
+	}
+	var lo protocol.BlockPos
+	for i, v := range cb.Voxels {
+		p := f(protocol.BlockPos{v.Pos[0] + cb.Offset[0], v.Pos[1] + cb.Offset[1], v.Pos[2] + cb.Offset[2]})
+		for axis := 0; axis < 3; axis++ {
+			if i == 0 || p[axis] < lo[axis] {
+				lo[axis] = p[axis]
+			}
+		}
+		cb.Voxels[i].Pos = p
+		if len(v.Block.States) != 0 {
+			states := make(map[string]interface{}, len(v.Block.States))
+			for k, s := range v.Block.States {
+				states[k] = s
+			}
+			state(states)
+			cb.Voxels[i].Block.States = states
+		}
+	}
+	for i := range cb.Voxels {
+		cb.Voxels[i].Pos = protocol.BlockPos{cb.Voxels[i].Pos[0] - lo[0], cb.Voxels[i].Pos[1] - lo[1], cb.Voxels[i].Pos[2] - lo[2]}
+	}
+	cb.Offset = lo
+}
+
+// Block states holding a horizontal direction, each mapped to the value they have after a clockwise rotation
+// of 90 degrees.
+var (
+	// facing_direction: 2 = north, 3 = south, 4 = west, 5 = east.
+	facingRotation = map[int32]int32{2: 5, 5: 3, 3: 4, 4: 2}
+	// direction: 0 = south, 1 = west, 2 = north, 3 = east.
+	directionRotation = map[int32]int32{0: 1, 1: 2, 2: 3, 3: 0}
+	// weirdo_direction, used by stairs: 0 = east, 1 = west, 2 = south, 3 = north.
+	weirdoRotation = map[int32]int32{0: 2, 2: 1, 1: 3, 3: 0}
+	// torch_facing_direction.
+	torchRotation = map[string]string{"north": "east", "east": "south", "south": "west", "west": "north"}
+)
+
+// rotateState rotates the directional block states passed by 90 degrees clockwise.
+func rotateState(states map[string]interface{}) {
+	if v, ok := states["facing_direction"].(int32); ok {
+		if r, ok := facingRotation[v]; ok {
+			states["facing_direction"] = r
+		}
+	}
+	if v, ok := states["direction"].(int32); ok {
+		if r, ok := directionRotation[v]; ok {
+			states["direction"] = r
+		}
+	}
+	if v, ok := states["weirdo_direction"].(int32); ok {
+		if r, ok := weirdoRotation[v]; ok {
+			states["weirdo_direction"] = r
+		}
+	}
+	if v, ok := states["ground_sign_direction"].(int32); ok {
+		states["ground_sign_direction"] = (v + 4) % 16
+	}
+	if v, ok := states["torch_facing_direction"].(string); ok {
+		if r, ok := torchRotation[v]; ok {
+			states["torch_facing_direction"] = r
+		}
+	}
+	if v, ok := states["pillar_axis"].(string); ok {
+		switch v {
+		case "x":
+			states["pillar_axis"] = "z"
+		case "z":
+			states["pillar_axis"] = "x"
+		}
+	}
+}
+
+// Block states holding a direction, mapped to the value they have after mirroring along the X (index 0), Y
+// (index 1) and Z (index 2) axis.
+var (
+	facingFlip    = [3]map[int32]int32{{4: 5, 5: 4}, {0: 1, 1: 0}, {2: 3, 3: 2}}
+	directionFlip = [3]map[int32]int32{{1: 3, 3: 1}, {}, {0: 2, 2: 0}}
+	weirdoFlip    = [3]map[int32]int32{{0: 1, 1: 0}, {}, {2: 3, 3: 2}}
+	torchFlip     = [3]map[string]string{{"east": "west", "west": "east"}, {}, {"north": "south", "south": "north"}}
+)
+
+// flipState mirrors the directional block states passed along the axis with the index passed.
+func flipState(states map[string]interface{}, axis int) {
+	if v, ok := states["facing_direction"].(int32); ok {
+		if r, ok := facingFlip[axis][v]; ok {
+			states["facing_direction"] = r
+		}
+	}
+	if v, ok := states["direction"].(int32); ok {
+		if r, ok := directionFlip[axis][v]; ok {
+			states["direction"] = r
+		}
+	}
+	if v, ok := states["weirdo_direction"].(int32); ok {
+		if r, ok := weirdoFlip[axis][v]; ok {
+			states["weirdo_direction"] = r
+		}
+	}
+	if v, ok := states["torch_facing_direction"].(string); ok {
+		if r, ok := torchFlip[axis][v]; ok {
+			states["torch_facing_direction"] = r
+		}
+	}
+	if v, ok := states["ground_sign_direction"].(int32); ok {
+		switch axis {
+		case 0:
+			states["ground_sign_direction"] = (16 - v) % 16
+		case 2:
+			states["ground_sign_direction"] = (24 - v) % 16
+		}
+	}
+	if axis == 1 {
+		for _, k := range []string{"upside_down_bit", "top_slot_bit"} {
+			if v, ok := states[k].(uint8); ok {
+				states[k] = 1 - v
+			}
+		}
+	}
+}
+
+// anchor returns the position clipboards of a session are copied from and pasted at: The position of the
+// player if the bot can see them, or the pointer of the session's space otherwise.
+func (client *Client) anchor(s *Session, vm *ligo.VM) protocol.BlockPos {
+	if e, ok := client.entities.Player(s.Player); ok {
+		return blockPos(blockVector(e.Position))
+	}
+	return blockPos(vm.Vars["space"].Value.(*function.Space).GetPointer())
+}
+
+// copyRegion exports the selection of the session into its clipboard, relative to the anchor passed, and
+// calls then with the clipboard if the export succeeded.
+func (client *Client) copyRegion(s *Session, name string, anchor protocol.BlockPos, then func(cb *Clipboard) error) error {
+	region, err := s.selection.Region()
+	if err != nil {
+		return err
+	}
+	client.exportRegion(s, name, region, func(cb *Clipboard) error {
+		lo := blockPos(region.Min())
+		cb.Offset = protocol.BlockPos{lo[0] - anchor[0], lo[1] - anchor[1], lo[2] - anchor[2]}
+		s.buildMu.Lock()
+		s.clipboard = cb
+		s.buildMu.Unlock()
+		pterm.Info.Println(fmt.Sprintf("[%s] %s: copied %d blocks", s.Player, name, len(cb.Voxels)))
+		if then != nil {
+			return then(cb)
+		}
+		return nil
+	})
+	return nil
+}
+
+// exportRegion exports the region passed into a new clipboard and calls then with it if the export
+// succeeded. The export runs on a separate goroutine, as the packet loop running the VM of the session
+// delivers its responses, so errors of the export and of then are printed rather than returned.
+func (client *Client) exportRegion(s *Session, name string, region function.SubSpace, then func(cb *Clipboard) error) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		cb, err := client.ExportRegion(ctx, region)
+		if err == nil {
+			err = then(cb)
+		}
+		if err != nil {
+			pterm.Error.Println(fmt.Sprintf("[%s] %s: %s", s.Player, name, err))
+		}
+	}()
+}
+
+// withClipboard calls f with the clipboard of the session while holding its lock.
+func (s *Session) withClipboard(f func(cb *Clipboard) error) error {
+	s.buildMu.Lock()
+	defer s.buildMu.Unlock()
+	if s.clipboard == nil {
+		return errNoClipboard
+	}
+	return f(s.clipboard)
+}
+
+// registerClipboardFuncs registers the functions copying, transforming and pasting regions in the VM of the
+// session passed.
+func (client *Client) registerClipboardFuncs(s *Session) {
+	// (copy) copies the blocks in the selection into the clipboard, relative to the player.
+	s.vm.Funcs["copy"] = func(vm *ligo.VM, variable ...ligo.Variable) ligo.Variable {
+		if err := client.copyRegion(s, "copy", client.anchor(s, vm), nil); err != nil {
+			return vm.Throw(fmt.Sprintf("copy : %s", err))
+		}
+		return ligo.Variable{Type: ligo.TypeNil}
+	}
+	// (cut) copies the blocks in the selection into the clipboard and replaces them with air.
+	s.vm.Funcs["cut"] = func(vm *ligo.VM, variable ...ligo.Variable) ligo.Variable {
+		anchor := client.anchor(s, vm)
+		if err := client.copyRegion(s, "cut", anchor, func(cb *Clipboard) error {
+			job := &buildJob{name: "cut", undoable: true}
+			for _, v := range cb.Voxels {
+				if !v.Block.Air() {
+					job.blocks = append(job.blocks, placement{pos: cb.at(anchor, v), block: "air"})
+				}
+			}
+			return client.build(s, job)
+		}); err != nil {
+			return vm.Throw(fmt.Sprintf("cut : %s", err))
+		}
+		return ligo.Variable{Type: ligo.TypeNil}
+	}
+	// (paste [skip-air]) places the clipboard relative to the player, the same way it was copied. If skip-air
+	// is true, air in the clipboard does not replace the blocks already there.
+	s.vm.Funcs["paste"] = func(vm *ligo.VM, variable ...ligo.Variable) ligo.Variable {
+		skipAir := false
+		if len(variable) > 0 {
+			if variable[0].Type != ligo.TypeBool {
+				return vm.Throw(fmt.Sprintf("paste : expected a bool, got type %s", variable[0].GetTypeString()))
+			}
+			skipAir = variable[0].Value.(bool)
+		}
+		anchor := client.anchor(s, vm)
+		job := &buildJob{name: "paste", undoable: true}
+		if err := s.withClipboard(func(cb *Clipboard) error {
+			for _, v := range cb.Voxels {
+				if !skipAir || !v.Block.Air() {
+					job.blocks = append(job.blocks, placement{pos: cb.at(anchor, v), block: v.Block.String()})
+				}
+			}
+			return nil
+		}); err != nil {
+			return vm.Throw(fmt.Sprintf("paste : %s", err))
+		}
+		if err := client.build(s, job); err != nil {
+			return vm.Throw(fmt.Sprintf("paste : %s", err))
+		}
+		return ligo.Variable{Type: ligo.TypeNil}
+	}
+	// (rotate degrees) rotates the clipboard clockwise around the player by a multiple of 90 degrees.
+	s.vm.Funcs["rotate"] = func(vm *ligo.VM, variable ...ligo.Variable) ligo.Variable {
+		if len(variable) != 1 || variable[0].Type != ligo.TypeInt {
+			return vm.Throw("rotate : expected an amount of degrees")
+		}
+		if err := s.withClipboard(func(cb *Clipboard) error {
+			return cb.Rotate(int(variable[0].Value.(int64)))
+		}); err != nil {
+			return vm.Throw(fmt.Sprintf("rotate : %s", err))
+		}
+		return ligo.Variable{Type: ligo.TypeNil}
+	}
+	// (flip axis) mirrors the clipboard along the axis "x", "y" or "z" through the player.
+	s.vm.Funcs["flip"] = func(vm *ligo.VM, variable ...ligo.Variable) ligo.Variable {
+		if len(variable) != 1 || variable[0].Type != ligo.TypeString {
+			return vm.Throw("flip : expected an axis")
+		}
+		if err := s.withClipboard(func(cb *Clipboard) error {
+			return cb.Flip(variable[0].Value.(string))
+		}); err != nil {
+			return vm.Throw(fmt.Sprintf("flip : %s", err))
+		}
+		return ligo.Variable{Type: ligo.TypeNil}
+	}
+	// (undo) places back the blocks replaced by the last plot, paste or cut of the session.
+	s.vm.Funcs["undo"] = func(vm *ligo.VM, variable ...ligo.Variable) ligo.Variable {
+		entry, ok := s.popUndo()
+		if !ok {
+			return vm.Throw("undo : nothing to undo")
+		}
+		if err := client.build(s, &buildJob{name: "undo " + entry.name, blocks: entry.blocks}); err != nil {
+			return vm.Throw(fmt.Sprintf("undo : %s", err))
+		}
+		return ligo.Variable{Type: ligo.TypeNil}
+	}
+}
+
+// at returns the absolute position of a voxel of the clipboard pasted at the anchor passed.
+func (cb *Clipboard) at(anchor protocol.BlockPos, v Voxel) protocol.BlockPos {
+	return protocol.BlockPos{anchor[0] + cb.Offset[0] + v.Pos[0], anchor[1] + cb.Offset[1] + v.Pos[1], anchor[2] + cb.Offset[2] + v.Pos[2]}
+}
@@ -0,0 +1,181 @@
+package minecraft
+
+import (
+	"phoenix/minecraft/protocol"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// testClipboard returns a clipboard holding an L shaped row of three blocks, with a stair facing east at
+// the corner, copied one block north of the anchor.
+func testClipboard() *Clipboard {
+	return &Clipboard{
+		Size: protocol.BlockPos{2, 1, 2},
+		Voxels: []Voxel{
+			{Pos: protocol.BlockPos{0, 0, 0}, Block: BlockState{Name: "minecraft:oak_stairs", States: map[string]interface{}{"weirdo_direction": int32(0)}}},
+			{Pos: protocol.BlockPos{1, 0, 0}, Block: BlockState{Name: "minecraft:stone"}},
+			{Pos: protocol.BlockPos{0, 0, 1}, Block: BlockState{Name: "minecraft:dirt"}},
+		},
+		Offset: protocol.BlockPos{0, 0, -1},
+	}
+}
+
+// anchored returns the positions of the blocks with the names passed relative to the anchor of the clipboard.
+func anchored(cb *Clipboard) map[string]protocol.BlockPos {
+	m := make(map[string]protocol.BlockPos, len(cb.Voxels))
+	for _, v := range cb.Voxels {
+		m[v.Block.Name] = protocol.BlockPos{v.Pos[0] + cb.Offset[0], v.Pos[1] + cb.Offset[1], v.Pos[2] + cb.Offset[2]}
+	}
+	return m
+}
+
+func TestClipboardRotate(t *testing.T) {
+	for _, tc := range []struct {
+		degrees   int
+		positions map[string]protocol.BlockPos
+		size      protocol.BlockPos
+		stair     int32
+	}{
+		{0, map[string]protocol.BlockPos{"minecraft:oak_stairs": {0, 0, -1}, "minecraft:stone": {1, 0, -1}, "minecraft:dirt": {0, 0, 0}}, protocol.BlockPos{2, 1, 2}, 0},
+		// Clockwise, seen from above: North becomes east and east becomes south.
+		{90, map[string]protocol.BlockPos{"minecraft:oak_stairs": {1, 0, 0}, "minecraft:stone": {1, 0, 1}, "minecraft:dirt": {0, 0, 0}}, protocol.BlockPos{2, 1, 2}, 2},
+		{180, map[string]protocol.BlockPos{"minecraft:oak_stairs": {0, 0, 1}, "minecraft:stone": {-1, 0, 1}, "minecraft:dirt": {0, 0, 0}}, protocol.BlockPos{2, 1, 2}, 1},
+		{-90, map[string]protocol.BlockPos{"minecraft:oak_stairs": {-1, 0, 0}, "minecraft:stone": {-1, 0, -1}, "minecraft:dirt": {0, 0, 0}}, protocol.BlockPos{2, 1, 2}, 3},
+		{360, map[string]protocol.BlockPos{"minecraft:oak_stairs": {0, 0, -1}, "minecraft:stone": {1, 0, -1}, "minecraft:dirt": {0, 0, 0}}, protocol.BlockPos{2, 1, 2}, 0},
+	} {
+		cb := testClipboard()
+		if err := cb.Rotate(tc.degrees); err != nil {
+			t.Fatal(err)
+		}
+		if pos := anchored(cb); !reflect.DeepEqual(pos, tc.positions) {
+			t.Errorf("rotate %v: got positions %v, expected %v", tc.degrees, pos, tc.positions)
+		}
+		if cb.Size != tc.size {
+			t.Errorf("rotate %v: got size %v, expected %v", tc.degrees, cb.Size, tc.size)
+		}
+		if stair := cb.Voxels[0].Block.States["weirdo_direction"]; stair != tc.stair {
+			t.Errorf("rotate %v: got stair direction %v, expected %v", tc.degrees, stair, tc.stair)
+		}
+		checkOrigin(t, cb)
+	}
+	if err := testClipboard().Rotate(45); err == nil {
+		t.Fatal("rotation of 45 degrees accepted")
+	}
+
+	// Rotating a clipboard that is not square on the X and Z axis swaps its size.
+	cb := &Clipboard{Size: protocol.BlockPos{3, 1, 1}, Voxels: []Voxel{{Pos: protocol.BlockPos{0, 0, 0}}, {Pos: protocol.BlockPos{2, 0, 0}}}}
+	if err := cb.Rotate(90); err != nil {
+		t.Fatal(err)
+	}
+	if cb.Size != (protocol.BlockPos{1, 1, 3}) {
+		t.Fatalf("got size %v after rotating, expected [1 1 3]", cb.Size)
+	}
+}
+
+func TestClipboardFlip(t *testing.T) {
+	for _, tc := range []struct {
+		axis      string
+		positions map[string]protocol.BlockPos
+		stair     int32
+	}{
+		{"x", map[string]protocol.BlockPos{"minecraft:oak_stairs": {0, 0, -1}, "minecraft:stone": {-1, 0, -1}, "minecraft:dirt": {0, 0, 0}}, 1},
+		{"y", map[string]protocol.BlockPos{"minecraft:oak_stairs": {0, 0, -1}, "minecraft:stone": {1, 0, -1}, "minecraft:dirt": {0, 0, 0}}, 0},
+		{"z", map[string]protocol.BlockPos{"minecraft:oak_stairs": {0, 0, 1}, "minecraft:stone": {1, 0, 1}, "minecraft:dirt": {0, 0, 0}}, 0},
+	} {
+		cb := testClipboard()
+		if err := cb.Flip(tc.axis); err != nil {
+			t.Fatal(err)
+		}
+		if pos := anchored(cb); !reflect.DeepEqual(pos, tc.positions) {
+			t.Errorf("flip %v: got positions %v, expected %v", tc.axis, pos, tc.positions)
+		}
+		if stair := cb.Voxels[0].Block.States["weirdo_direction"]; stair != tc.stair {
+			t.Errorf("flip %v: got stair direction %v, expected %v", tc.axis, stair, tc.stair)
+		}
+		checkOrigin(t, cb)
+	}
+	if err := testClipboard().Flip("w"); err == nil {
+		t.Fatal("flip along unknown axis accepted")
+	}
+}
+
+// checkOrigin checks that the origin of the clipboard passed is its lowest corner.
+func checkOrigin(t *testing.T, cb *Clipboard) {
+	t.Helper()
+	var lo protocol.BlockPos
+	for i, v := range cb.Voxels {
+		for axis := 0; axis < 3; axis++ {
+			if i == 0 || v.Pos[axis] < lo[axis] {
+				lo[axis] = v.Pos[axis]
+			}
+		}
+	}
+	if lo != (protocol.BlockPos{}) {
+		t.Errorf("lowest corner of clipboard is at %v, expected the origin", lo)
+	}
+}
+
+func TestClipboardAddTemplate(t *testing.T) {
+	palette := []interface{}{
+		map[string]interface{}{"name": "minecraft:stone", "states": map[string]interface{}{}},
+		map[string]interface{}{"name": "minecraft:dirt"},
+	}
+	template := func(size []interface{}, indices []interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"size": size,
+			"structure": map[string]interface{}{
+				"block_indices": []interface{}{indices, []interface{}{}},
+				"palette":       map[string]interface{}{"default": map[string]interface{}{"block_palette": palette}},
+			},
+		}
+	}
+	for _, tc := range []struct {
+		name     string
+		template map[string]interface{}
+		offset   protocol.BlockPos
+		voxels   []Voxel
+		fails    bool
+	}{
+		{
+			// Indices are ordered with the X axis outermost and the Z axis innermost.
+			name:     "order",
+			template: template([]interface{}{int32(2), int32(1), int32(2)}, []interface{}{int32(0), int32(1), int32(1), int32(0)}),
+			voxels: []Voxel{
+				{Pos: protocol.BlockPos{0, 0, 0}, Block: BlockState{Name: "minecraft:stone", States: map[string]interface{}{}}},
+				{Pos: protocol.BlockPos{0, 0, 1}, Block: BlockState{Name: "minecraft:dirt"}},
+				{Pos: protocol.BlockPos{1, 0, 0}, Block: BlockState{Name: "minecraft:dirt"}},
+				{Pos: protocol.BlockPos{1, 0, 1}, Block: BlockState{Name: "minecraft:stone", States: map[string]interface{}{}}},
+			},
+		},
+		{
+			name:     "offset and structure void",
+			template: template([]interface{}{int32(1), int32(2), int32(1)}, []interface{}{int32(-1), int32(1)}),
+			offset:   protocol.BlockPos{32, 0, -64},
+			voxels:   []Voxel{{Pos: protocol.BlockPos{32, 1, -64}, Block: BlockState{Name: "minecraft:dirt"}}},
+		},
+		{name: "no size", template: map[string]interface{}{}, fails: true},
+		{name: "index count", template: template([]interface{}{int32(2), int32(2), int32(2)}, []interface{}{int32(0)}), fails: true},
+		{name: "index out of range", template: template([]interface{}{int32(1), int32(1), int32(1)}, []interface{}{int32(2)}), fails: true},
+	} {
+		cb := &Clipboard{}
+		err := cb.addTemplate(tc.template, tc.offset)
+		if tc.fails {
+			if err == nil {
+				t.Errorf("%v: invalid template accepted", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", tc.name, err)
+			continue
+		}
+		sort.Slice(cb.Voxels, func(i, j int) bool {
+			a, b := cb.Voxels[i].Pos, cb.Voxels[j].Pos
+			return a[0] < b[0] || (a[0] == b[0] && (a[1] < b[1] || (a[1] == b[1] && a[2] < b[2])))
+		})
+		if !reflect.DeepEqual(cb.Voxels, tc.voxels) {
+			t.Errorf("%v: got voxels %+v, expected %+v", tc.name, cb.Voxels, tc.voxels)
+		}
+	}
+}
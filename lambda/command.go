@@ -0,0 +1,279 @@
+package minecraft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/pterm/pterm"
+	"phoenix/minecraft"
+	"phoenix/minecraft/protocol"
+	"phoenix/minecraft/protocol/packet"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultCommandTimeout is the time a command waits for its CommandOutput if the context passed to
+	// Command has no deadline of its own.
+	defaultCommandTimeout = time.Second * 10
+	// maxInFlightCommands is the maximum amount of commands that may be awaiting a response at the same
+	// time. Command blocks until a slot frees up once this limit is reached.
+	maxInFlightCommands = 64
+)
+
+var (
+	// ErrCommandTimeout is returned by Command if no CommandOutput arrived before the context expired.
+	ErrCommandTimeout = errors.New("command timed out waiting for output")
+	// ErrCommanderClosed is returned by Command if the client was closed while the command was pending.
+	ErrCommanderClosed = errors.New("command request on closed client")
+)
+
+// CommandError is returned when a CommandOutput was received for a command, but the server reported that
+// the command failed.
+type CommandError struct {
+	// Command is the command line that was sent.
+	Command string
+	// Message is the (usually translatable) message of the first output message, such as
+	// 'commands.generic.unknown'.
+	Message string
+	// Parameters holds the parameters of the first output message.
+	Parameters []string
+}
+
+// Error ...
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("command %q failed: %s %v", e.Command, e.Message, e.Parameters)
+}
+
+// pendingCommand is a command that was sent to the server and is awaiting its CommandOutput.
+type pendingCommand struct {
+	line   string
+	sent   time.Time
+	result chan *packet.CommandOutput
+}
+
+// commander matches CommandRequests written to the server with the CommandOutput packets sent back. It is
+// safe for concurrent use: requests may be sent from the console, chat and ligo goroutines while the packet
+// loop delivers the responses.
+type commander struct {
+	write   func(pk packet.Packet) error
+	timeout time.Duration
+
+	mu      sync.Mutex
+	pending map[uuid.UUID]*pendingCommand
+
+	slots chan struct{}
+	once  sync.Once
+	close chan struct{}
+}
+
+// newCommander returns a commander that writes its requests using the function passed and starts sweeping
+// requests that never got a response.
+func newCommander(write func(pk packet.Packet) error) *commander {
+	c := &commander{
+		write:   write,
+		timeout: defaultCommandTimeout,
+		pending: make(map[uuid.UUID]*pendingCommand),
+		slots:   make(chan struct{}, maxInFlightCommands),
+		close:   make(chan struct{}),
+	}
+	go c.sweep()
+	return c
+}
+
+// Command sends the command line passed and blocks until its CommandOutput arrives, the context is done or
+// the commander is closed. If ctx has no deadline, a default timeout of 10 seconds is applied.
+func (c *commander) Command(ctx context.Context, line string) (*packet.CommandOutput, error) {
+	wait, err := c.Request(ctx, line)
+	if err != nil {
+		return nil, err
+	}
+	return wait()
+}
+
+// Request sends the command line passed and returns once it was written, without waiting for its output. The
+// function returned blocks until the CommandOutput arrives, the context is done or the commander is closed,
+// and must be called exactly once so that the request is cleaned up. If ctx has no deadline, a default
+// timeout of 10 seconds is applied.
+func (c *commander) Request(ctx context.Context, line string) (wait func() (*packet.CommandOutput, error), err error) {
+	cancel := func() {}
+	if _, ok := ctx.Deadline(); !ok {
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+	}
+	select {
+	case c.slots <- struct{}{}:
+	case <-ctx.Done():
+		cancel()
+		return nil, ErrCommandTimeout
+	case <-c.close:
+		cancel()
+		return nil, ErrCommanderClosed
+	}
+
+	id := uuid.New()
+	cmd := &pendingCommand{line: line, sent: time.Now(), result: make(chan *packet.CommandOutput, 1)}
+	c.mu.Lock()
+	c.pending[id] = cmd
+	c.mu.Unlock()
+	done := func() {
+		c.forget(id)
+		<-c.slots
+		cancel()
+	}
+
+	if err := c.write(commandRequest(line, id)); err != nil {
+		done()
+		return nil, err
+	}
+	return func() (*packet.CommandOutput, error) {
+		defer done()
+		select {
+		case out := <-cmd.result:
+			return out, nil
+		case <-ctx.Done():
+			return nil, ErrCommandTimeout
+		case <-c.close:
+			return nil, ErrCommanderClosed
+		}
+	}, nil
+}
+
+// Send sends the command line passed without waiting for, or registering interest in, its output.
+func (c *commander) Send(line string) error {
+	return c.write(commandRequest(line, uuid.New()))
+}
+
+// register registers a handler to the Dispatcher passed that delivers CommandOutput packets to the commands
+// awaiting them.
+func (c *commander) register(d *minecraft.Dispatcher) *minecraft.Registration {
+	return d.Handle(packet.IDCommandOutput, func(pk packet.Packet) bool {
+		if p := pk.(*packet.CommandOutput); !c.handle(p) {
+			pterm.Debug.Println(fmt.Sprintf("Command output for unknown request %s", p.CommandOrigin.UUID))
+		}
+		return true
+	})
+}
+
+// handle delivers a CommandOutput to the command awaiting it. It returns false if no command with the UUID
+// found in the output was pending, for example because it already timed out.
+func (c *commander) handle(pk *packet.CommandOutput) bool {
+	c.mu.Lock()
+	cmd, ok := c.pending[pk.CommandOrigin.UUID]
+	delete(c.pending, pk.CommandOrigin.UUID)
+	c.mu.Unlock()
+	if !ok {
+		return false
+	}
+	// The channel is buffered with a size of 1 and only ever receives one value, so this never blocks.
+	cmd.result <- pk
+	return true
+}
+
+// forget removes the pending command with the UUID passed, if it still exists.
+func (c *commander) forget(id uuid.UUID) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+// sweep periodically removes pending commands that are older than twice the timeout. These normally clean up
+// after themselves, but sweeping ensures the map does not grow if that ever fails to happen.
+func (c *commander) sweep() {
+	ticker := time.NewTicker(c.timeout)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.mu.Lock()
+			for id, cmd := range c.pending {
+				if time.Since(cmd.sent) > c.timeout*2 {
+					pterm.Debug.Println(fmt.Sprintf("Dropping stale command request: %s", cmd.line))
+					delete(c.pending, id)
+				}
+			}
+			c.mu.Unlock()
+		case <-c.close:
+			return
+		}
+	}
+}
+
+// Close stops the commander. Pending and future calls to Command return ErrCommanderClosed.
+func (c *commander) Close() {
+	c.once.Do(func() {
+		close(c.close)
+	})
+}
+
+// commandRequest returns a CommandRequest packet for the command line passed, using the UUID passed to match
+// the CommandOutput sent back.
+func commandRequest(line string, id uuid.UUID) *packet.CommandRequest {
+	return &packet.CommandRequest{
+		CommandOrigin: protocol.CommandOrigin{
+			Origin:         protocol.CommandOriginPlayer,
+			UUID:           id,
+			RequestID:      uuid.New().String(),
+			PlayerUniqueID: 0,
+		},
+		CommandLine: line,
+		Internal:    false,
+	}
+}
+
+// CheckOutput returns a *CommandError if the CommandOutput passed reports that the command failed, or nil if
+// it succeeded.
+func CheckOutput(line string, output *packet.CommandOutput) error {
+	if len(output.OutputMessages) == 0 {
+		if output.SuccessCount > 0 {
+			return nil
+		}
+		return &CommandError{Command: line}
+	}
+	msg := output.OutputMessages[0]
+	if !msg.Success {
+		return &CommandError{Command: line, Message: msg.Message, Parameters: msg.Parameters}
+	}
+	return nil
+}
+
+// TestForBlockResult is the result of a testforblock command.
+type TestForBlockResult struct {
+	// Position is the position of the block that was tested.
+	Position protocol.BlockPos
+	// Matched is true if the block at Position was the block tested for.
+	Matched bool
+	// Block is the name of the block actually found at Position. It is only set if Matched is false, as the
+	// server does not report it otherwise.
+	Block string
+}
+
+// ParseTestForBlock parses the CommandOutput of a testforblock command. Both a successful and a failed test
+// carry the coordinates of the block tested, so the position is set regardless of whether the block matched.
+func ParseTestForBlock(output *packet.CommandOutput) (TestForBlockResult, error) {
+	if len(output.OutputMessages) == 0 {
+		return TestForBlockResult{}, errors.New("testforblock: command output has no messages")
+	}
+	msg := output.OutputMessages[0]
+	if !strings.HasPrefix(msg.Message, "commands.testforblock.") {
+		return TestForBlockResult{}, fmt.Errorf("testforblock: unexpected output message %v", msg.Message)
+	}
+	if len(msg.Parameters) < 3 {
+		return TestForBlockResult{}, fmt.Errorf("testforblock: expected at least 3 parameters, got %v", len(msg.Parameters))
+	}
+	var res TestForBlockResult
+	for i := 0; i < 3; i++ {
+		v, err := strconv.ParseInt(msg.Parameters[i], 10, 32)
+		if err != nil {
+			return TestForBlockResult{}, fmt.Errorf("testforblock: invalid coordinate %q: %v", msg.Parameters[i], err)
+		}
+		res.Position[i] = int32(v)
+	}
+	res.Matched = msg.Success
+	if !msg.Success && len(msg.Parameters) > 3 {
+		res.Block = msg.Parameters[3]
+	}
+	return res, nil
+}
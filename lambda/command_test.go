@@ -0,0 +1,130 @@
+package minecraft
+
+import (
+	"context"
+	"errors"
+	"phoenix/internal/testserver"
+	"phoenix/lambda/function"
+	"phoenix/minecraft"
+	"phoenix/minecraft/protocol"
+	"phoenix/minecraft/protocol/login"
+	"phoenix/minecraft/protocol/packet"
+	"testing"
+	"time"
+)
+
+// testClient connects a Client to a new test server and reads its packets until the test ends.
+func testClient(t *testing.T) (*Client, *testserver.Server) {
+	t.Helper()
+	s, err := testserver.New(testserver.Config{})
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = s.Close()
+	})
+	conn, err := minecraft.Dialer{IdentityData: login.IdentityData{DisplayName: "Bot"}}.DialTimeout(s.Network(), s.Address(), time.Second*5)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if err := conn.DoSpawnTimeout(time.Second * 5); err != nil {
+		t.Fatalf("spawn: %v", err)
+	}
+	client := &Client{bot: "Bot", commands: newCommander(conn.WritePacket), entities: NewEntityRegistry()}
+	client.setConn(conn)
+	client.entities.Spawn("Bot", conn.GameData())
+	t.Cleanup(func() {
+		client.commands.Close()
+		_ = conn.Close()
+	})
+	d := minecraft.NewDispatcher(conn)
+	client.entities.Register(d)
+	client.commands.register(d)
+	go func() {
+		_ = d.Run()
+	}()
+	return client, s
+}
+
+func TestClientCommand(t *testing.T) {
+	client, s := testClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err := client.SetBlock(function.Vector{3, 10, -2}, Block{name: "gold_block"}); err != nil {
+		t.Fatal(err)
+	}
+	line := "testforblock 3 10 -2 gold_block"
+	output, err := client.Command(ctx, line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckOutput(line, output); err != nil {
+		t.Fatalf("block not placed: %v", err)
+	}
+	if b := s.World().Block(protocol.BlockPos{3, 10, -2}); b.Name != "minecraft:gold_block" {
+		t.Fatalf("server has unexpected block %v", b)
+	}
+
+	line = "testforblock 3 10 -2 stone"
+	if output, err = client.Command(ctx, line); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := CheckOutput(line, output).(*CommandError); !ok {
+		t.Fatalf("expected a CommandError for %v", line)
+	}
+	res, err := ParseTestForBlock(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Matched || res.Position != (protocol.BlockPos{3, 10, -2}) || res.Block != "minecraft:gold_block" {
+		t.Fatalf("unexpected testforblock result %+v", res)
+	}
+}
+
+func TestClientSendCommand(t *testing.T) {
+	client, _ := testClient(t)
+	outputs := make(chan *packet.CommandOutput, 1)
+	if err := client.SendCommand("testforblock 0 0 0 air", func(output *packet.CommandOutput) error {
+		outputs <- output
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case output := <-outputs:
+		if _, err := ParseTestForBlock(output); err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("callback not called with command output")
+	}
+
+	errWrite := errors.New("write failed")
+	failing := &Client{commands: newCommander(func(packet.Packet) error { return errWrite })}
+	defer failing.commands.Close()
+	if err := failing.SendCommand("say hi", func(*packet.CommandOutput) error {
+		t.Error("callback called for a command that was never sent")
+		return nil
+	}); err != errWrite {
+		t.Fatalf("SendCommand returned %v, expected %v", err, errWrite)
+	}
+}
+
+func TestClientEntityPosition(t *testing.T) {
+	client, _ := testClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if _, err := client.Command(ctx, "tp 20 30 40"); err != nil {
+		t.Fatal(err)
+	}
+	// The MovePlayer packet of the teleport is sent before the output, so the registry is up to date.
+	e, ok := client.entities.Player("Bot")
+	if !ok {
+		t.Fatal("bot not found in entity registry")
+	}
+	if pos := blockVector(e.Position); pos[0] != 20 || pos[1] != 30 || pos[2] != 40 {
+		t.Fatalf("unexpected position after teleport: %v", pos)
+	}
+}
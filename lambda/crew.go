@@ -0,0 +1,379 @@
+package minecraft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/pterm/pterm"
+	"phoenix/minecraft/protocol"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// shardRadius is the distance, in chunks, from the chunk a bot teleported to within which it places blocks
+	// before teleporting again, so that the blocks it places are always in chunks loaded around it.
+	shardRadius = 4
+	// progressInterval is the interval at which the progress of a build placed by several bots is reported.
+	progressInterval = time.Second * 5
+	// chunkLoadTimeout is the time a bot waits for the chunk it teleported to to be loaded before it gives up
+	// on the teleport.
+	chunkLoadTimeout = time.Second * 10
+	// chunkLoadRetry is the interval at which a bot that teleported checks if the chunk it is in was loaded.
+	chunkLoadRetry = time.Millisecond * 50
+	// loadCheckMinY and loadCheckMaxY are the lowest and highest Y coordinates tested to check if a chunk was
+	// loaded. They lie within the world height of all versions, so that a test only fails if the chunk
+	// holding the position is not loaded.
+	loadCheckMinY, loadCheckMaxY = 0, 255
+)
+
+// errChunkNotLoaded is returned by teleport if the chunk teleported to was not loaded in time.
+var errChunkNotLoaded = errors.New("chunk teleported to was not loaded in time")
+
+// newCrewBot returns a Client for an additional bot with the name passed. Crew bots have no sessions and do
+// not handle chat: They only place the blocks of builds started through the main bot.
+func newCrewBot(name string) *Client {
+	bot := &Client{bot: name}
+	bot.commands = newCommander(bot.writePacket)
+	return bot
+}
+
+// shard is a part of a build job that is placed by one bot at a time. If the bot loses its connection, the
+// remaining blocks of the shard are handed to another bot.
+type shard struct {
+	blocks []placement
+	// done is the amount of blocks in the shard placed so far.
+	done int
+}
+
+// shardBlocks splits the blocks passed into at most n shards of about the same size. Blocks are grouped by
+// the chunk column they are in, and every shard holds a contiguous range of columns, so that a bot placing a
+// shard stays in a small area. Blocks in the same column keep their order.
+func shardBlocks(blocks []placement, n int) []*shard {
+	columns := make(map[[2]int32][]placement)
+	var keys [][2]int32
+	for _, p := range blocks {
+		col := chunkColumn(p.pos)
+		if _, ok := columns[col]; !ok {
+			keys = append(keys, col)
+		}
+		columns[col] = append(columns[col], p)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+
+	var shards []*shard
+	current, total := &shard{}, 0
+	for _, col := range keys {
+		current.blocks = append(current.blocks, columns[col]...)
+		total += len(columns[col])
+		// Close the shard once it reaches its share of all blocks, leaving the rest to the shards that follow.
+		if total >= len(blocks)*(len(shards)+1)/n {
+			shards, current = append(shards, current), &shard{}
+		}
+	}
+	if len(current.blocks) != 0 {
+		shards = append(shards, current)
+	}
+	return shards
+}
+
+// chunkColumn returns the X and Z coordinate of the chunk column that the position passed is in.
+func chunkColumn(pos protocol.BlockPos) [2]int32 {
+	return [2]int32{pos[0] >> 4, pos[2] >> 4}
+}
+
+// shardQueue hands out the shards of a build job to the bots placing them. Shards that a bot could not finish
+// are put back, so that another bot continues them.
+type shardQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []*shard
+	// active is the amount of shards currently placed by a bot.
+	active int
+	// finished is closed once all shards were placed.
+	finished chan struct{}
+}
+
+// newShardQueue returns a shardQueue for the shards passed. The first active shards are considered handed out
+// already and are not pending.
+func newShardQueue(shards []*shard, active int) *shardQueue {
+	q := &shardQueue{pending: shards[active:], active: active, finished: make(chan struct{})}
+	q.cond = sync.NewCond(&q.mu)
+	q.check()
+	return q
+}
+
+// take returns a pending shard. If no shard is pending, take blocks until one is put back, or returns nil
+// once all shards were placed.
+func (q *shardQueue) take() *shard {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.pending) == 0 && q.active > 0 {
+		q.cond.Wait()
+	}
+	if len(q.pending) == 0 {
+		return nil
+	}
+	sh := q.pending[0]
+	q.pending = q.pending[1:]
+	q.active++
+	return sh
+}
+
+// putBack makes a shard taken pending again, so that another bot continues it.
+func (q *shardQueue) putBack(sh *shard) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending = append(q.pending, sh)
+	q.active--
+	q.cond.Broadcast()
+}
+
+// finish notes that a shard taken was placed completely.
+func (q *shardQueue) finish() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.active--
+	q.check()
+	q.cond.Broadcast()
+}
+
+// unplaced returns the blocks of pending shards that were not yet placed. As shards are placed side by side,
+// these blocks may lie anywhere in the job that the shards were made from.
+func (q *shardQueue) unplaced() []placement {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	blocks := make([]placement, 0)
+	for _, sh := range q.pending {
+		blocks = append(blocks, sh.blocks[sh.done:]...)
+	}
+	return blocks
+}
+
+// check closes the finished channel if all shards were placed. q.mu must be held.
+func (q *shardQueue) check() {
+	if q.active == 0 && len(q.pending) == 0 {
+		close(q.finished)
+	}
+}
+
+// runParallel places the remaining blocks of a job using the bot of the client and its crew. The blocks are
+// split into a shard per bot, and if a bot loses its connection, the rest of its shard is placed by the first
+// bot that is done with its own shard. runParallel returns an error if all bots stopped reconnecting before
+// the job was placed, or errBuildCancelled once the stop channel passed is closed.
+func (client *Client) runParallel(job *buildJob, stop <-chan struct{}) error {
+	bots := append([]*Client{client}, client.crew...)
+	if job.unplaced == nil {
+		job.unplaced = job.blocks[job.done:]
+	}
+	shards := shardBlocks(job.unplaced, len(bots))
+	q := newShardQueue(shards, len(shards))
+	var placed int64
+
+	reported := make(chan struct{})
+	go func() {
+		t := time.NewTicker(progressInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				pterm.Info.Println(fmt.Sprintf("%s: placed %d of %d blocks using %d bots", job.name, job.done+int(atomic.LoadInt64(&placed)), len(job.blocks), connectedBots(bots)))
+			case <-reported:
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i, bot := range bots {
+		var first *shard
+		if i < len(shards) {
+			first = shards[i]
+		}
+		wg.Add(1)
+		go func(bot *Client) {
+			defer wg.Done()
+			bot.placeShards(job.name, q, first, &placed, stop)
+		}(bot)
+	}
+	wg.Wait()
+	close(reported)
+
+	job.unplaced = q.unplaced()
+	job.done = len(job.blocks) - len(job.unplaced)
+	select {
+	case <-stop:
+		return errBuildCancelled
+	default:
+	}
+	if len(job.unplaced) != 0 {
+		return fmt.Errorf("%d blocks were not placed: %w", len(job.unplaced), ErrGaveUp)
+	}
+	return nil
+}
+
+// placeShards places the shard passed, if not nil, and then the shards taken from the queue until all shards
+// were placed or the bot stops reconnecting. Shards that the bot cannot finish because it lost its connection
+// are put back in the queue, as are shards taken once the stop channel passed is closed. placed is increased
+// atomically by the amount of blocks placed.
+func (client *Client) placeShards(name string, q *shardQueue, sh *shard, placed *int64, stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			if sh != nil {
+				q.putBack(sh)
+			}
+			return
+		default:
+		}
+		if sh == nil {
+			if sh = q.take(); sh == nil {
+				return
+			}
+		}
+		if client.Conn() == nil {
+			q.putBack(sh)
+			sh = nil
+			connected, stopped := client.connectionState()
+			select {
+			case <-connected:
+				continue
+			case <-stopped:
+			case <-q.finished:
+			case <-stop:
+			}
+			return
+		}
+		if err := client.placeShard(sh, placed, stop); err != nil {
+			if err == errBuildCancelled {
+				q.putBack(sh)
+				return
+			}
+			pterm.Warning.Println(fmt.Sprintf("%s: Bot<%s> stopped with %d blocks left, which are handed to another bot: %s", name, client.bot, len(sh.blocks)-sh.done, err))
+			q.putBack(sh)
+			sh = nil
+			continue
+		}
+		q.finish()
+		sh = nil
+	}
+}
+
+// placeShard places the remaining blocks of a shard, teleporting the bot to the blocks as it moves along. If
+// placing a block fails, the shard is rewound slightly, as in runBuild, and the error is returned. If the stop
+// channel passed is closed, errBuildCancelled is returned.
+func (client *Client) placeShard(sh *shard, placed *int64, stop <-chan struct{}) error {
+	var at [2]int32
+	teleported := false
+	for sh.done < len(sh.blocks) {
+		select {
+		case <-stop:
+			return errBuildCancelled
+		default:
+		}
+		p := sh.blocks[sh.done]
+		col := chunkColumn(p.pos)
+		var err error
+		if !teleported || abs32(col[0]-at[0]) > shardRadius || abs32(col[1]-at[1]) > shardRadius {
+			err = client.teleport(p.pos)
+			at, teleported = col, true
+		}
+		if err == nil {
+			err = client.setBlock(p.pos, p.block)
+		}
+		if err != nil {
+			rewind := resumeOverlap
+			if rewind > sh.done {
+				rewind = sh.done
+			}
+			sh.done -= rewind
+			atomic.AddInt64(placed, -int64(rewind))
+			return err
+		}
+		sh.done++
+		atomic.AddInt64(placed, 1)
+		time.Sleep(time.Millisecond)
+	}
+	return nil
+}
+
+// teleport teleports the bot to the position passed and waits until the chunk holding it was loaded, so that
+// blocks placed right after are not dropped by the server. The teleport is awaited through the output of the
+// tp command, after which the chunk is tested with testforblock until the server reports the block found
+// there rather than that the position is outside the world, which it also reports for unloaded chunks. If the
+// connection is lost meanwhile, teleport returns ErrNotConnected right away.
+func (client *Client) teleport(pos protocol.BlockPos) error {
+	ctx, cancel := context.WithTimeout(context.Background(), chunkLoadTimeout)
+	defer cancel()
+	lost := client.connectionLost()
+	go func() {
+		select {
+		case <-lost:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	err := client.awaitChunk(ctx, pos)
+	select {
+	case <-lost:
+		return ErrNotConnected
+	default:
+		return err
+	}
+}
+
+// awaitChunk teleports the bot to the position passed and tests the chunk holding it until it was loaded or
+// ctx is done.
+func (client *Client) awaitChunk(ctx context.Context, pos protocol.BlockPos) error {
+	if _, err := client.Command(ctx, fmt.Sprintf("tp @s %d %d %d", pos[0], pos[1], pos[2])); err != nil {
+		return fmt.Errorf("teleport: %w", err)
+	}
+	y := pos[1]
+	if y < loadCheckMinY {
+		y = loadCheckMinY
+	} else if y > loadCheckMaxY {
+		y = loadCheckMaxY
+	}
+	for {
+		output, err := client.Command(ctx, fmt.Sprintf("testforblock %d %d %d air", pos[0], y, pos[2]))
+		if err == ErrCommandTimeout {
+			return errChunkNotLoaded
+		} else if err != nil {
+			return fmt.Errorf("teleport: %w", err)
+		}
+		if _, err := ParseTestForBlock(output); err == nil {
+			return nil
+		}
+		select {
+		case <-time.After(chunkLoadRetry):
+		case <-ctx.Done():
+			return errChunkNotLoaded
+		}
+	}
+}
+
+// connectedBots returns the amount of bots passed that are currently connected.
+func connectedBots(bots []*Client) int {
+	n := 0
+	for _, bot := range bots {
+		if bot.Conn() != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// abs32 returns the absolute value of x.
+func abs32(x int32) int32 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
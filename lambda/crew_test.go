@@ -0,0 +1,240 @@
+package minecraft
+
+import (
+	"context"
+	"phoenix/internal/testserver"
+	"phoenix/minecraft"
+	"phoenix/minecraft/protocol"
+	"phoenix/minecraft/protocol/login"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShardBlocks(t *testing.T) {
+	var blocks []placement
+	for x := int32(-40); x < 60; x++ {
+		for z := int32(0); z < 3; z++ {
+			blocks = append(blocks, placement{pos: protocol.BlockPos{x, 0, z * 20}, block: "stone"})
+		}
+	}
+	shards := shardBlocks(blocks, 3)
+	if len(shards) != 3 {
+		t.Fatalf("got %d shards, expected 3", len(shards))
+	}
+	owner := make(map[[2]int32]int)
+	total := 0
+	for i, sh := range shards {
+		if n := len(sh.blocks); n < len(blocks)/6 || n > len(blocks)/2 {
+			t.Fatalf("shard %d holds %d of %d blocks", i, n, len(blocks))
+		}
+		for _, p := range sh.blocks {
+			if o, ok := owner[chunkColumn(p.pos)]; ok && o != i {
+				t.Fatalf("chunk column %v is split between shards %d and %d", chunkColumn(p.pos), o, i)
+			}
+			owner[chunkColumn(p.pos)] = i
+		}
+		total += len(sh.blocks)
+	}
+	if total != len(blocks) {
+		t.Fatalf("shards hold %d blocks, expected %d", total, len(blocks))
+	}
+	if shards := shardBlocks(blocks[:1], 3); len(shards) != 1 {
+		t.Fatalf("got %d shards for a single block, expected 1", len(shards))
+	}
+}
+
+// testCrewBot starts a supervisor for a crew bot with the name passed connecting to the server passed, and
+// waits until it spawned.
+func testCrewBot(t *testing.T, s *testserver.Server, name string, policy reconnectPolicy) *Client {
+	t.Helper()
+	bot := newCrewBot(name)
+	t.Cleanup(bot.commands.Close)
+	sup := &supervisor{
+		client:  bot,
+		dialer:  minecraft.Dialer{IdentityData: login.IdentityData{DisplayName: name}},
+		policy:  policy,
+		network: s.Network(),
+		address: s.Address(),
+		crew:    true,
+	}
+	go func() {
+		_ = sup.run()
+	}()
+	if err := bot.awaitConnection(); err != nil {
+		t.Fatalf("connect %s: %v", name, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if _, err := s.WaitPlayer(ctx, name); err != nil {
+		t.Fatal(err)
+	}
+	return bot
+}
+
+// TestRunParallel places a build using a bot and two crew bots, one of which is kicked and does not
+// reconnect, and checks that the build is completed by the other bots.
+func TestRunParallel(t *testing.T) {
+	s, err := testserver.New(testserver.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	client, session, _ := testSupervisor(t, s)
+	client.crew = []*Client{
+		testCrewBot(t, s, "Crew1", reconnectPolicy{minDelay: time.Millisecond * 10, maxDelay: time.Millisecond * 10}),
+		testCrewBot(t, s, "Crew2", reconnectPolicy{disabled: true}),
+	}
+
+	const length = 1500
+	job := &buildJob{name: "line"}
+	for x := int32(0); x < length; x++ {
+		job.blocks = append(job.blocks, placement{pos: protocol.BlockPos{x, 10, 0}, block: "gold_block"})
+	}
+	if err := client.build(session, job); err != nil {
+		t.Fatal(err)
+	}
+	count := func() int {
+		return s.World().Count(protocol.BlockPos{0, 10, 0}, protocol.BlockPos{length - 1, 10, 0}, "gold_block")
+	}
+	waitFor(t, "the build to start", func() bool {
+		return count() >= length/10
+	})
+	if !s.Kick("Crew2", "Kicked for testing") {
+		t.Fatal("crew bot not connected")
+	}
+	waitFor(t, "the build to complete", func() bool {
+		return count() == length
+	})
+	if client.crew[1].Conn() != nil {
+		t.Fatal("kicked crew bot reconnected")
+	}
+
+	// The first crew bot places the second shard, which starts at the first chunk column with more than a
+	// third of the blocks before it, and possibly the rest of the third shard afterwards.
+	p, ok := s.Player("Crew1")
+	if !ok {
+		t.Fatal("crew bot not connected")
+	}
+	if x := p.Position[0]; x < 512 {
+		t.Fatalf("crew bot was teleported to X %v, outside of its shards", x)
+	}
+}
+
+func TestShardQueueUnplaced(t *testing.T) {
+	var blocks []placement
+	for x := int32(0); x < 96; x++ {
+		blocks = append(blocks, placement{pos: protocol.BlockPos{x, 0, 0}, block: "stone"})
+	}
+	shards := shardBlocks(blocks, 3)
+	if len(shards) != 3 {
+		t.Fatalf("got %d shards, expected 3", len(shards))
+	}
+	// The first and last shard were partly placed, leaving holes before the blocks of the second shard.
+	shards[0].done, shards[1].done, shards[2].done = 5, 0, len(shards[2].blocks)-1
+	q := newShardQueue(shards, 0)
+
+	var expected []placement
+	for _, sh := range shards {
+		expected = append(expected, sh.blocks[sh.done:]...)
+	}
+	unplaced := q.unplaced()
+	if len(unplaced) != len(expected) {
+		t.Fatalf("got %d unplaced blocks, expected %d", len(unplaced), len(expected))
+	}
+	for i, p := range unplaced {
+		if p != expected[i] {
+			t.Fatalf("unplaced block %d is %v, expected %v", i, p, expected[i])
+		}
+	}
+	if unplaced := newShardQueue(nil, 0).unplaced(); unplaced == nil || len(unplaced) != 0 {
+		t.Fatalf("got unplaced blocks %v for an empty queue, expected an empty, non-nil slice", unplaced)
+	}
+}
+
+// TestRunParallelUnplaced checks that a job placed in parallel again only places the blocks it did not get to
+// before, rather than the blocks from its count of placed blocks onwards.
+func TestRunParallelUnplaced(t *testing.T) {
+	s, err := testserver.New(testserver.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	client, _, _ := testSupervisor(t, s)
+	client.crew = []*Client{testCrewBot(t, s, "Crew1", reconnectPolicy{disabled: true})}
+
+	const length = 64
+	job := &buildJob{name: "line"}
+	for x := int32(0); x < length; x++ {
+		job.blocks = append(job.blocks, placement{pos: protocol.BlockPos{x, 10, 0}, block: "gold_block"})
+		if x%2 == 0 {
+			job.unplaced = append(job.unplaced, job.blocks[x])
+		}
+	}
+	job.done = length / 2
+	if err := client.runParallel(job, nil); err != nil {
+		t.Fatal(err)
+	}
+	if job.done != length || len(job.unplaced) != 0 {
+		t.Fatalf("job has %d blocks done and %d unplaced, expected %d and 0", job.done, len(job.unplaced), length)
+	}
+	waitFor(t, "the unplaced blocks to be placed", func() bool {
+		return s.World().Count(protocol.BlockPos{0, 10, 0}, protocol.BlockPos{length - 1, 10, 0}, "gold_block") == length/2
+	})
+	for x := int32(1); x < length; x += 2 {
+		if n := s.World().Count(protocol.BlockPos{x, 10, 0}, protocol.BlockPos{x, 10, 0}, "gold_block"); n != 0 {
+			t.Fatalf("block at X %d was placed again", x)
+		}
+	}
+}
+
+// TestPlaceShardTeleport checks that a bot placing a shard waits for its teleport and a testforblock in the
+// chunk teleported to before placing blocks there.
+func TestPlaceShardTeleport(t *testing.T) {
+	s, err := testserver.New(testserver.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	client, _, _ := testSupervisor(t, s)
+
+	// The blocks span 16 chunk columns, so the bot teleports every 5 columns.
+	sh := &shard{}
+	for x := int32(0); x < 256; x += 8 {
+		sh.blocks = append(sh.blocks, placement{pos: protocol.BlockPos{x, 400, 0}, block: "stone"})
+	}
+	var placed int64
+	if err := client.placeShard(sh, &placed, nil); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "all blocks to be placed", func() bool {
+		n := 0
+		for _, line := range s.Commands() {
+			if strings.HasPrefix(line, "setblock") {
+				n++
+			}
+		}
+		return n == len(sh.blocks)
+	})
+
+	// Blocks are placed above the world, so the chunk is tested at the highest Y coordinate in every world.
+	teleports, tested := 0, false
+	for _, line := range s.Commands() {
+		switch {
+		case strings.HasPrefix(line, "tp @s"):
+			teleports, tested = teleports+1, false
+		case strings.HasPrefix(line, "testforblock"):
+			if !strings.HasSuffix(line, " 255 0 air") {
+				t.Fatalf("chunk tested with %q, expected Y 255", line)
+			}
+			tested = true
+		case strings.HasPrefix(line, "setblock"):
+			if !tested {
+				t.Fatalf("%q sent before the chunk teleported to was tested", line)
+			}
+		}
+	}
+	if teleports != 4 {
+		t.Fatalf("bot teleported %d times, expected 4", teleports)
+	}
+}
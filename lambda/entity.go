@@ -0,0 +1,302 @@
+package minecraft
+
+import (
+	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/google/uuid"
+	"math"
+	"phoenix/lambda/function"
+	"phoenix/ligo"
+	"phoenix/minecraft"
+	"phoenix/minecraft/protocol/packet"
+	"strings"
+	"sync"
+)
+
+// playerEyeHeight is the offset between the feet of a player and the position sent for it in AddPlayer and
+// MovePlayer packets.
+const playerEyeHeight = 1.62
+
+// Entity is the state of an entity as last seen by the bot.
+type Entity struct {
+	// RuntimeID and UniqueID are the IDs the server identifies the entity with.
+	RuntimeID uint64
+	UniqueID  int64
+	// Type is the entity type, such as 'minecraft:zombie'. It is 'minecraft:player' for players.
+	Type string
+	// Name and UUID are only set for players.
+	Name string
+	UUID uuid.UUID
+	// Position is the position of the entity. For players, it is the position of their feet.
+	Position mgl32.Vec3
+	// Rotation holds the pitch, yaw and head yaw of the entity.
+	Rotation mgl32.Vec3
+	// Dimension is the dimension the entity was seen in.
+	Dimension int32
+}
+
+// Player checks if the entity is a player.
+func (e Entity) Player() bool {
+	return e.Type == "minecraft:player"
+}
+
+// EntityRegistry keeps track of the entities and players around the bot using the packets the server sends.
+// It is safe for concurrent use.
+type EntityRegistry struct {
+	mu        sync.RWMutex
+	dimension int32
+	// self is the runtime ID of the bot itself.
+	self     uint64
+	entities map[uint64]*Entity
+	// uniqueIDs maps the unique ID of an entity to its runtime ID, as RemoveActor only holds the former.
+	uniqueIDs map[int64]uint64
+	// names maps the UUIDs of the players in the player list to their names.
+	names map[uuid.UUID]string
+}
+
+// NewEntityRegistry returns an empty EntityRegistry.
+func NewEntityRegistry() *EntityRegistry {
+	return &EntityRegistry{
+		entities:  make(map[uint64]*Entity),
+		uniqueIDs: make(map[int64]uint64),
+		names:     make(map[uuid.UUID]string),
+	}
+}
+
+// Spawn registers the bot itself using the game data of the connection passed. Entities registered before
+// are removed, as their runtime IDs are only valid for the connection they were seen on.
+func (r *EntityRegistry) Spawn(name string, data minecraft.GameData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entities = make(map[uint64]*Entity)
+	r.uniqueIDs = make(map[int64]uint64)
+	r.names = make(map[uuid.UUID]string)
+	r.dimension = data.Dimension
+	r.self = data.EntityRuntimeID
+	r.add(&Entity{
+		RuntimeID: data.EntityRuntimeID,
+		UniqueID:  data.EntityUniqueID,
+		Type:      "minecraft:player",
+		Name:      name,
+		Position:  data.PlayerPosition.Sub(mgl32.Vec3{0, playerEyeHeight}),
+		Rotation:  mgl32.Vec3{data.Pitch, data.Yaw, data.Yaw},
+		Dimension: data.Dimension,
+	})
+}
+
+// entityPriority is the priority of the handler of the EntityRegistry. It is higher than that of other
+// handlers, so that these see the entities as updated by the packet they handle.
+const entityPriority = 10
+
+// Register registers a handler to the Dispatcher passed that updates the registry with every packet read.
+func (r *EntityRegistry) Register(d *minecraft.Dispatcher) *minecraft.Registration {
+	return d.HandleAll(func(pk packet.Packet) bool {
+		r.HandlePacket(pk)
+		return true
+	}, minecraft.Priority(entityPriority))
+}
+
+// HandlePacket updates the registry using the packet passed. Packets that do not affect entities are ignored.
+func (r *EntityRegistry) HandlePacket(pk packet.Packet) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch pk := pk.(type) {
+	case *packet.AddPlayer:
+		r.add(&Entity{
+			RuntimeID: pk.EntityRuntimeID,
+			UniqueID:  pk.EntityUniqueID,
+			Type:      "minecraft:player",
+			Name:      pk.Username,
+			UUID:      pk.UUID,
+			Position:  pk.Position.Sub(mgl32.Vec3{0, playerEyeHeight}),
+			Rotation:  mgl32.Vec3{pk.Pitch, pk.Yaw, pk.HeadYaw},
+			Dimension: r.dimension,
+		})
+	case *packet.AddActor:
+		r.add(&Entity{
+			RuntimeID: pk.EntityRuntimeID,
+			UniqueID:  pk.EntityUniqueID,
+			Type:      pk.EntityType,
+			Position:  pk.Position,
+			Rotation:  mgl32.Vec3{pk.Pitch, pk.Yaw, pk.HeadYaw},
+			Dimension: r.dimension,
+		})
+	case *packet.RemoveActor:
+		if id, ok := r.uniqueIDs[pk.EntityUniqueID]; ok {
+			delete(r.entities, id)
+			delete(r.uniqueIDs, pk.EntityUniqueID)
+		}
+	case *packet.MovePlayer:
+		if e, ok := r.entities[pk.EntityRuntimeID]; ok {
+			e.Position = pk.Position.Sub(mgl32.Vec3{0, playerEyeHeight})
+			e.Rotation = mgl32.Vec3{pk.Pitch, pk.Yaw, pk.HeadYaw}
+			e.Dimension = r.dimension
+		}
+	case *packet.MoveActorAbsolute:
+		if e, ok := r.entities[pk.EntityRuntimeID]; ok {
+			e.Position = pk.Position
+			if e.Player() {
+				e.Position = pk.Position.Sub(mgl32.Vec3{0, playerEyeHeight})
+			}
+			e.Rotation = pk.Rotation
+			e.Dimension = r.dimension
+		}
+	case *packet.MoveActorDelta:
+		if e, ok := r.entities[pk.EntityRuntimeID]; ok {
+			// Despite its name, the packet holds absolute values, but only for the fields flagged as present.
+			pos := pk.Position
+			if e.Player() {
+				pos = pk.Position.Sub(mgl32.Vec3{0, playerEyeHeight})
+			}
+			for i, flag := range []uint16{packet.MoveActorDeltaFlagHasX, packet.MoveActorDeltaFlagHasY, packet.MoveActorDeltaFlagHasZ} {
+				if pk.Flags&flag != 0 {
+					e.Position[i] = pos[i]
+				}
+			}
+			for i, flag := range []uint16{packet.MoveActorDeltaFlagHasRotX, packet.MoveActorDeltaFlagHasRotY, packet.MoveActorDeltaFlagHasRotZ} {
+				if pk.Flags&flag != 0 {
+					e.Rotation[i] = pk.Rotation[i]
+				}
+			}
+		}
+	case *packet.PlayerList:
+		for _, entry := range pk.Entries {
+			if pk.ActionType == packet.PlayerListActionRemove {
+				delete(r.names, entry.UUID)
+				continue
+			}
+			r.names[entry.UUID] = entry.Username
+		}
+	case *packet.ChangeDimension:
+		// Entities of the previous dimension are no longer visible, and will be sent again by the server if
+		// we return, so we drop all of them except for the bot itself.
+		r.dimension = pk.Dimension
+		for id, e := range r.entities {
+			if id == r.self {
+				e.Dimension = pk.Dimension
+				continue
+			}
+			delete(r.entities, id)
+			delete(r.uniqueIDs, e.UniqueID)
+		}
+	}
+}
+
+// add adds an entity to the registry, replacing any entity with the same runtime ID.
+func (r *EntityRegistry) add(e *Entity) {
+	r.entities[e.RuntimeID] = e
+	r.uniqueIDs[e.UniqueID] = e.RuntimeID
+}
+
+// Player looks up the player with the name passed, matched case-insensitively. The bool returned is false if
+// the player is not within view of the bot.
+func (r *EntityRegistry) Player(name string) (Entity, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, e := range r.entities {
+		if e.Player() && strings.EqualFold(e.Name, name) {
+			return *e, true
+		}
+	}
+	return Entity{}, false
+}
+
+// Players returns all players within view of the bot, including the bot itself.
+func (r *EntityRegistry) Players() []Entity {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	players := make([]Entity, 0, len(r.names))
+	for _, e := range r.entities {
+		if e.Player() {
+			players = append(players, *e)
+		}
+	}
+	return players
+}
+
+// Online returns the names of all players in the player list, whether they are within view or not.
+func (r *EntityRegistry) Online() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.names))
+	for _, name := range r.names {
+		names = append(names, name)
+	}
+	return names
+}
+
+// registerEntityFuncs registers the functions querying the EntityRegistry in the VM of the session passed.
+// Functions taking a player name default to the player of the session if none is passed.
+func (client *Client) registerEntityFuncs(s *Session) {
+	lookup := func(vm *ligo.VM, fn string, variable []ligo.Variable) (Entity, bool) {
+		name := s.Player
+		if len(variable) > 0 {
+			if variable[0].Type != ligo.TypeString {
+				vm.Throw(fmt.Sprintf("%s : expected a player name, got type %s", fn, variable[0].GetTypeString()))
+				return Entity{}, false
+			}
+			name = variable[0].Value.(string)
+		}
+		e, ok := client.entities.Player(name)
+		if !ok {
+			vm.Throw(fmt.Sprintf("%s : player %s is not within view of the bot", fn, name))
+		}
+		return e, ok
+	}
+	// (position [player]) returns the block position of a player.
+	s.vm.Funcs["position"] = func(vm *ligo.VM, variable ...ligo.Variable) ligo.Variable {
+		e, ok := lookup(vm, "position", variable)
+		if !ok {
+			return ligo.Variable{Type: ligo.TypeNil}
+		}
+		return vectorVariable(blockVector(e.Position))
+	}
+	// (rotation [player]) returns the pitch, yaw and head yaw of a player.
+	s.vm.Funcs["rotation"] = func(vm *ligo.VM, variable ...ligo.Variable) ligo.Variable {
+		e, ok := lookup(vm, "rotation", variable)
+		if !ok {
+			return ligo.Variable{Type: ligo.TypeNil}
+		}
+		return vectorVariable(function.Vector{float64(e.Rotation[0]), float64(e.Rotation[1]), float64(e.Rotation[2])})
+	}
+	// (dimension [player]) returns the dimension of a player: 0 for the overworld, 1 for the nether and 2 for
+	// the end.
+	s.vm.Funcs["dimension"] = func(vm *ligo.VM, variable ...ligo.Variable) ligo.Variable {
+		e, ok := lookup(vm, "dimension", variable)
+		if !ok {
+			return ligo.Variable{Type: ligo.TypeNil}
+		}
+		return ligo.Variable{Type: ligo.TypeInt, Value: int64(e.Dimension)}
+	}
+	// (players) returns the names of all players online.
+	s.vm.Funcs["players"] = func(vm *ligo.VM, variable ...ligo.Variable) ligo.Variable {
+		var names []ligo.Variable
+		for _, name := range client.entities.Online() {
+			names = append(names, ligo.Variable{Type: ligo.TypeString, Value: name})
+		}
+		return ligo.Variable{Type: ligo.TypeArray, Value: names}
+	}
+}
+
+// blockVector returns the position of the block that the position passed is in.
+func blockVector(pos mgl32.Vec3) function.Vector {
+	return function.Vector{
+		math.Floor(float64(pos[0])),
+		math.Floor(float64(pos[1])),
+		math.Floor(float64(pos[2])),
+	}
+}
+
+// vectorVariable returns an array variable holding the components of the vector passed as floats.
+func vectorVariable(v function.Vector) ligo.Variable {
+	arr := make([]ligo.Variable, len(v))
+	for i, f := range v {
+		arr[i] = ligo.Variable{Type: ligo.TypeFloat, Value: f}
+	}
+	return ligo.Variable{Type: ligo.TypeArray, Value: arr}
+}
@@ -0,0 +1,120 @@
+package minecraft
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/google/uuid"
+	"phoenix/minecraft"
+	"phoenix/minecraft/protocol"
+	"phoenix/minecraft/protocol/packet"
+	"sync"
+	"testing"
+)
+
+// testRegistry returns an EntityRegistry in which the bot has spawned with runtime ID 1.
+func testRegistry() *EntityRegistry {
+	r := NewEntityRegistry()
+	r.Spawn("Bot", minecraft.GameData{EntityRuntimeID: 1, EntityUniqueID: 1, PlayerPosition: mgl32.Vec3{0, 64 + playerEyeHeight, 0}})
+	return r
+}
+
+func TestEntityRegistryAddMove(t *testing.T) {
+	r := testRegistry()
+	r.HandlePacket(&packet.AddPlayer{EntityRuntimeID: 2, EntityUniqueID: 20, Username: "Steve", Position: mgl32.Vec3{10, 70 + playerEyeHeight, 10}})
+	r.HandlePacket(&packet.AddActor{EntityRuntimeID: 3, EntityUniqueID: 30, EntityType: "minecraft:zombie", Position: mgl32.Vec3{5, 64, 5}})
+
+	steve, ok := r.Player("steve")
+	if !ok || steve.RuntimeID != 2 || steve.Position != (mgl32.Vec3{10, 70, 10}) {
+		t.Fatalf("looked up %+v (%v), expected Steve at 10 70 10", steve, ok)
+	}
+	if _, ok := r.Player("Zombie"); ok {
+		t.Fatal("non-player entity returned as a player")
+	}
+	if bot, ok := r.Player("Bot"); !ok || bot.Position != (mgl32.Vec3{0, 64, 0}) {
+		t.Fatalf("looked up bot %+v (%v), expected it at its spawn position", bot, ok)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		pk       packet.Packet
+		position mgl32.Vec3
+	}{
+		{"MovePlayer", &packet.MovePlayer{EntityRuntimeID: 2, Position: mgl32.Vec3{1, 65 + playerEyeHeight, 1}, Yaw: 90}, mgl32.Vec3{1, 65, 1}},
+		{"MoveActorAbsolute", &packet.MoveActorAbsolute{EntityRuntimeID: 2, Position: mgl32.Vec3{2, 66 + playerEyeHeight, 2}}, mgl32.Vec3{2, 66, 2}},
+		{"MoveActorDelta", &packet.MoveActorDelta{EntityRuntimeID: 2, Flags: packet.MoveActorDeltaFlagHasX, Position: mgl32.Vec3{8, 0, 0}}, mgl32.Vec3{8, 66, 2}},
+		{"unknown runtime ID", &packet.MovePlayer{EntityRuntimeID: 99, Position: mgl32.Vec3{50, 50, 50}}, mgl32.Vec3{8, 66, 2}},
+	} {
+		r.HandlePacket(tc.pk)
+		if steve, _ := r.Player("Steve"); steve.Position != tc.position {
+			t.Errorf("%v: Steve at %v, expected %v", tc.name, steve.Position, tc.position)
+		}
+	}
+	if len(r.Players()) != 2 {
+		t.Fatalf("got players %+v, expected the bot and Steve", r.Players())
+	}
+}
+
+func TestEntityRegistryRemove(t *testing.T) {
+	r := testRegistry()
+	r.HandlePacket(&packet.AddPlayer{EntityRuntimeID: 2, EntityUniqueID: 20, Username: "Steve"})
+	r.HandlePacket(&packet.AddPlayer{EntityRuntimeID: 3, EntityUniqueID: 30, Username: "Alex"})
+
+	// Removing an unknown unique ID, or a runtime ID used as a unique ID, must not remove anything.
+	r.HandlePacket(&packet.RemoveActor{EntityUniqueID: 99})
+	r.HandlePacket(&packet.RemoveActor{EntityUniqueID: 2})
+	if len(r.Players()) != 3 {
+		t.Fatalf("got %v players after removing unknown IDs, expected 3", len(r.Players()))
+	}
+	r.HandlePacket(&packet.RemoveActor{EntityUniqueID: 20})
+	if _, ok := r.Player("Steve"); ok {
+		t.Fatal("Steve found after being removed")
+	}
+	if _, ok := r.Player("Alex"); !ok {
+		t.Fatal("Alex not found after removing Steve")
+	}
+
+	r.HandlePacket(&packet.ChangeDimension{Dimension: packet.DimensionNether})
+	if _, ok := r.Player("Alex"); ok {
+		t.Fatal("Alex found after the bot changed dimension")
+	}
+	if bot, ok := r.Player("Bot"); !ok || bot.Dimension != packet.DimensionNether {
+		t.Fatalf("looked up bot %+v (%v), expected it in the nether", bot, ok)
+	}
+}
+
+func TestEntityRegistryOnline(t *testing.T) {
+	r := testRegistry()
+	steve, alex := uuid.New(), uuid.New()
+	r.HandlePacket(&packet.PlayerList{ActionType: packet.PlayerListActionAdd, Entries: []protocol.PlayerListEntry{{UUID: steve, Username: "Steve"}, {UUID: alex, Username: "Alex"}}})
+	r.HandlePacket(&packet.PlayerList{ActionType: packet.PlayerListActionRemove, Entries: []protocol.PlayerListEntry{{UUID: steve}, {UUID: uuid.New()}}})
+	if online := r.Online(); len(online) != 1 || online[0] != "Alex" {
+		t.Fatalf("got players online %v, expected [Alex]", online)
+	}
+}
+
+func TestEntityRegistryConcurrent(t *testing.T) {
+	r := testRegistry()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			id := uint64(i + 2)
+			for j := 0; j < 100; j++ {
+				r.HandlePacket(&packet.AddPlayer{EntityRuntimeID: id, EntityUniqueID: int64(id), Username: "Player"})
+				r.HandlePacket(&packet.MovePlayer{EntityRuntimeID: id, Position: mgl32.Vec3{float32(j), 0, 0}})
+				r.HandlePacket(&packet.RemoveActor{EntityUniqueID: int64(id)})
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				r.Player("Player")
+				r.Players()
+			}
+		}()
+	}
+	wg.Wait()
+	if players := r.Players(); len(players) != 1 || players[0].Name != "Bot" {
+		t.Fatalf("got players %+v after all were removed, expected only the bot", players)
+	}
+}
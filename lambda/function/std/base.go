@@ -313,7 +313,7 @@ func vmArrayAppend(vm *ligo.VM, a ...ligo.Variable) ligo.Variable {
 		str := a[0].Value.(string)
 		for _, val := range a[1:] {
 			if val.Type == ligo.TypeInt {
-				str += string(val.Value.(int64))
+				str += string(rune(val.Value.(int64)))
 				continue
 			}
 			if val.Type == ligo.TypeString {
@@ -0,0 +1,152 @@
+package function
+
+import (
+	"fmt"
+	"math"
+)
+
+// Directions maps direction names to unit vectors. North is towards negative Z, as it is in game.
+var Directions = map[string]Vector{
+	"north": {0, 0, -1},
+	"south": {0, 0, 1},
+	"east":  {1, 0, 0},
+	"west":  {-1, 0, 0},
+	"up":    {0, 1, 0},
+	"down":  {0, -1, 0},
+}
+
+// Direction returns the unit vector of the direction name passed.
+func Direction(name string) (Vector, error) {
+	if d, ok := Directions[name]; ok {
+		return Vector{d[0], d[1], d[2]}, nil
+	}
+	return nil, fmt.Errorf("unknown direction %q, expected north, south, east, west, up or down", name)
+}
+
+// NewSubSpace returns the cuboid with the two corners passed. The corners may be in any order and are both
+// included in the cuboid.
+func NewSubSpace(begin, end Vector) SubSpace {
+	s := SubSpace{begin: make(Vector, 3), end: make(Vector, 3)}
+	for i := 0; i < 3; i++ {
+		s.begin[i] = math.Min(begin[i], end[i])
+		s.end[i] = math.Max(begin[i], end[i])
+	}
+	return s
+}
+
+// Min returns the corner of the cuboid with the lowest coordinates.
+func (s SubSpace) Min() Vector {
+	return Vector{s.begin[0], s.begin[1], s.begin[2]}
+}
+
+// Max returns the corner of the cuboid with the highest coordinates.
+func (s SubSpace) Max() Vector {
+	return Vector{s.end[0], s.end[1], s.end[2]}
+}
+
+// Size returns the amount of blocks the cuboid spans on each axis.
+func (s SubSpace) Size() Vector {
+	return Vector{s.end[0] - s.begin[0] + 1, s.end[1] - s.begin[1] + 1, s.end[2] - s.begin[2] + 1}
+}
+
+// Volume returns the amount of blocks in the cuboid.
+func (s SubSpace) Volume() float64 {
+	size := s.Size()
+	return size[0] * size[1] * size[2]
+}
+
+// Contains checks if the position passed is within the cuboid.
+func (s SubSpace) Contains(v Vector) bool {
+	for i := 0; i < 3; i++ {
+		if v[i] < s.begin[i] || v[i] > s.end[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Expand grows the cuboid by n blocks in the direction passed, moving the face that the direction points at.
+func (s SubSpace) Expand(n float64, dir Vector) SubSpace {
+	begin, end := s.Min(), s.Max()
+	for i := 0; i < 3; i++ {
+		if dir[i] > 0 {
+			end[i] += dir[i] * n
+		} else if dir[i] < 0 {
+			begin[i] += dir[i] * n
+		}
+	}
+	return NewSubSpace(begin, end)
+}
+
+// Contract shrinks the cuboid by n blocks in the direction passed, moving the face opposite of the direction
+// along it. A cuboid is never contracted to less than a single block thick.
+func (s SubSpace) Contract(n float64, dir Vector) SubSpace {
+	begin, end := s.Min(), s.Max()
+	for i := 0; i < 3; i++ {
+		if dir[i] > 0 {
+			begin[i] = math.Min(begin[i]+dir[i]*n, end[i])
+		} else if dir[i] < 0 {
+			end[i] = math.Max(end[i]+dir[i]*n, begin[i])
+		}
+	}
+	return NewSubSpace(begin, end)
+}
+
+// Shift moves the whole cuboid by n blocks in the direction passed.
+func (s SubSpace) Shift(n float64, dir Vector) SubSpace {
+	begin, end := s.Min(), s.Max()
+	for i := 0; i < 3; i++ {
+		begin[i] += dir[i] * n
+		end[i] += dir[i] * n
+	}
+	return NewSubSpace(begin, end)
+}
+
+// Split splits the cuboid into cuboids no longer than max blocks on any axis. Commands such as /fill and
+// /clone refuse regions holding more than 32768 blocks, so these are typically split with a max of 32.
+func (s SubSpace) Split(max float64) []SubSpace {
+	var parts []SubSpace
+	for x := s.begin[0]; x <= s.end[0]; x += max {
+		for y := s.begin[1]; y <= s.end[1]; y += max {
+			for z := s.begin[2]; z <= s.end[2]; z += max {
+				parts = append(parts, NewSubSpace(
+					Vector{x, y, z},
+					Vector{math.Min(x+max-1, s.end[0]), math.Min(y+max-1, s.end[1]), math.Min(z+max-1, s.end[2])},
+				))
+			}
+		}
+	}
+	return parts
+}
+
+// Walls returns the four vertical faces of the cuboid as separate cuboids. Faces may overlap at the corners.
+func (s SubSpace) Walls() []SubSpace {
+	begin, end := s.begin, s.end
+	return []SubSpace{
+		NewSubSpace(Vector{begin[0], begin[1], begin[2]}, Vector{end[0], end[1], begin[2]}),
+		NewSubSpace(Vector{begin[0], begin[1], end[2]}, Vector{end[0], end[1], end[2]}),
+		NewSubSpace(Vector{begin[0], begin[1], begin[2]}, Vector{begin[0], end[1], end[2]}),
+		NewSubSpace(Vector{end[0], begin[1], begin[2]}, Vector{end[0], end[1], end[2]}),
+	}
+}
+
+// Edges returns points along the twelve edges of the cuboid, at most step blocks apart. The points are on
+// the outer boundary of the blocks, so that they outline the cuboid when particles are shown at them.
+func (s SubSpace) Edges(step float64) []Vector {
+	lo := s.Min()
+	hi := Vector{s.end[0] + 1, s.end[1] + 1, s.end[2] + 1}
+	var points []Vector
+	for axis := 0; axis < 3; axis++ {
+		a, b := (axis+1)%3, (axis+2)%3
+		for _, ca := range []float64{lo[a], hi[a]} {
+			for _, cb := range []float64{lo[b], hi[b]} {
+				for t := lo[axis]; t <= hi[axis]; t += step {
+					p := make(Vector, 3)
+					p[axis], p[a], p[b] = t, ca, cb
+					points = append(points, p)
+				}
+			}
+		}
+	}
+	return points
+}
@@ -0,0 +1,115 @@
+package function
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewSubSpace(t *testing.T) {
+	s := NewSubSpace(Vector{5, -2, 3}, Vector{1, 4, 3})
+	if min, max := s.Min(), s.Max(); !reflect.DeepEqual(min, Vector{1, -2, 3}) || !reflect.DeepEqual(max, Vector{5, 4, 3}) {
+		t.Fatalf("got corners %v %v, expected [1 -2 3] [5 4 3]", min, max)
+	}
+	if size := s.Size(); !reflect.DeepEqual(size, Vector{5, 7, 1}) || s.Volume() != 35 {
+		t.Fatalf("got size %v and volume %v, expected [5 7 1] and 35", size, s.Volume())
+	}
+	for _, tc := range []struct {
+		v        Vector
+		expected bool
+	}{
+		{Vector{1, -2, 3}, true},
+		{Vector{5, 4, 3}, true},
+		{Vector{3, 0, 3}, true},
+		{Vector{0, 0, 3}, false},
+		{Vector{3, 5, 3}, false},
+		{Vector{3, 0, 4}, false},
+	} {
+		if s.Contains(tc.v) != tc.expected {
+			t.Errorf("Contains(%v) = %v, expected %v", tc.v, !tc.expected, tc.expected)
+		}
+	}
+}
+
+func TestSubSpaceTransform(t *testing.T) {
+	s := NewSubSpace(Vector{0, 0, 0}, Vector{3, 3, 3})
+	for _, tc := range []struct {
+		name     string
+		f        func(SubSpace, float64, Vector) SubSpace
+		n        float64
+		dir      string
+		min, max Vector
+	}{
+		{"expand up", SubSpace.Expand, 2, "up", Vector{0, 0, 0}, Vector{3, 5, 3}},
+		{"expand north", SubSpace.Expand, 2, "north", Vector{0, 0, -2}, Vector{3, 3, 3}},
+		{"expand west", SubSpace.Expand, 1, "west", Vector{-1, 0, 0}, Vector{3, 3, 3}},
+		{"contract up", SubSpace.Contract, 2, "up", Vector{0, 2, 0}, Vector{3, 3, 3}},
+		{"contract north", SubSpace.Contract, 1, "north", Vector{0, 0, 0}, Vector{3, 3, 2}},
+		{"contract past size", SubSpace.Contract, 10, "east", Vector{3, 0, 0}, Vector{3, 3, 3}},
+		{"shift south", SubSpace.Shift, 4, "south", Vector{0, 0, 4}, Vector{3, 3, 7}},
+		{"shift down", SubSpace.Shift, 1, "down", Vector{0, -1, 0}, Vector{3, 2, 3}},
+	} {
+		dir, err := Direction(tc.dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := tc.f(s, tc.n, dir)
+		if !reflect.DeepEqual(res.Min(), tc.min) || !reflect.DeepEqual(res.Max(), tc.max) {
+			t.Errorf("%v: got %v %v, expected %v %v", tc.name, res.Min(), res.Max(), tc.min, tc.max)
+		}
+	}
+	if !reflect.DeepEqual(s.Max(), Vector{3, 3, 3}) {
+		t.Fatalf("transforms changed the original cuboid to end at %v", s.Max())
+	}
+	if _, err := Direction("left"); err == nil {
+		t.Fatal("unknown direction accepted")
+	}
+}
+
+func TestSubSpaceSplit(t *testing.T) {
+	s := NewSubSpace(Vector{0, 0, 0}, Vector{69, 9, 31})
+	parts := s.Split(32)
+	if len(parts) != 3 {
+		t.Fatalf("split into %v parts, expected 3", len(parts))
+	}
+	var volume float64
+	for _, part := range parts {
+		if size := part.Size(); size[0] > 32 || size[1] > 32 || size[2] > 32 {
+			t.Errorf("part %v %v is larger than 32 blocks", part.Min(), part.Max())
+		}
+		if !s.Contains(part.Min()) || !s.Contains(part.Max()) {
+			t.Errorf("part %v %v is outside of the cuboid", part.Min(), part.Max())
+		}
+		volume += part.Volume()
+	}
+	if volume != s.Volume() {
+		t.Fatalf("parts have a volume of %v, expected %v", volume, s.Volume())
+	}
+}
+
+func TestSubSpaceWallsEdges(t *testing.T) {
+	s := NewSubSpace(Vector{0, 0, 0}, Vector{4, 2, 6})
+	walls := s.Walls()
+	if len(walls) != 4 {
+		t.Fatalf("got %v walls, expected 4", len(walls))
+	}
+	for _, wall := range walls {
+		if size := wall.Size(); size[1] != 3 || (size[0] != 1 && size[2] != 1) {
+			t.Errorf("wall %v %v is not a full height, single block thick face", wall.Min(), wall.Max())
+		}
+	}
+	for _, p := range s.Edges(1) {
+		onBoundary := 0
+		for i, hi := range []float64{5, 3, 7} {
+			if p[i] == 0 || p[i] == hi {
+				onBoundary++
+			}
+		}
+		if onBoundary < 2 {
+			t.Fatalf("edge point %v is not on an edge of the cuboid", p)
+		}
+	}
+	// Each of the twelve edges has a point at every block boundary along it.
+	if n := len(s.Edges(1)); n != 4*(6+4+8) {
+		t.Fatalf("got %v edge points, expected %v", n, 4*(6+4+8))
+	}
+}
@@ -52,8 +52,66 @@ type config struct {
 		Auth bool
 		Operator string
 	}
+	// Reconnect holds the settings of reconnecting once the connection to the server is lost. The delay
+	// between attempts starts at MinDelay and doubles after every failed attempt, up to MaxDelay. Both are
+	// durations such as "1s" or "2m", defaulting to 1s and 1m. MaxAttempts is the amount of consecutive
+	// failed attempts after which the bot gives up, or 0 to never give up.
+	Reconnect struct {
+		Disabled    bool
+		MinDelay    string
+		MaxDelay    string
+		MaxAttempts int
+	}
+	// Accounts holds the Xbox Live accounts that the bots log in with if User.Auth is set. Their tokens are
+	// saved in TokenFile, by default "tokens.json" next to the config, so that logging in using a device code
+	// is only needed the first time an account is used. Bot is the name of the account of the bot, "default"
+	// if empty, Crew lists the account of every crew bot and Proxy is the account the proxy logs in with.
+	Accounts struct {
+		TokenFile string
+		Bot       string
+		Crew      []string
+		Proxy     string
+	}
+	// Crew lists the names of additional bots that join the server to place the blocks of builds in parallel
+	// with the bot. Builds are split by chunk columns between the bots, and the blocks of a bot that loses its
+	// connection are placed by the others. If User.Auth is set, the crew bots log in with Accounts.Crew
+	// instead. Crew bots must be allowed to run commands, just like the bot.
+	Crew struct {
+		Bots []string
+	}
+	// Packs holds the settings of the resource packs that servers send. If Cache is set, it is a directory in
+	// which the packs are saved, so that they are not downloaded again every time the bots join.
+	Packs struct {
+		Cache string
+	}
+	// Access lists the players allowed to use the REPL by role. User.Operator is always an operator.
+	// Permissions maps function names to the minimum role ("viewer", "builder" or "operator") needed to
+	// call them.
+	Access struct {
+		Operators   []string
+		Builders    []string
+		Viewers     []string
+		Permissions map[string]string
+	}
+	// Selection holds the settings of the selection tool. Wand is the item used to select positions by
+	// clicking blocks, by default minecraft:wooden_axe.
+	Selection struct {
+		Wand string
+	}
+	// Proxy holds the settings of the proxy that players may join the server through. If Address is set, the
+	// bot listens on it and connects the players joining to the server, so that it sees the packets their
+	// clients send, such as the clicks with the selection wand. If User.Auth is set, the proxy logs in to the
+	// server with the account Accounts.Proxy, which should be the account of the player using it.
+	Proxy struct {
+		Address string
+	}
+	// Debug holds settings for debugging. Capture is a path that the packets of the connection are recorded
+	// to. Replay is the path of a capture that is replayed instead of connecting to the remote address, so
+	// that a recorded session may be reproduced offline.
 	Debug struct{
 		Enabled bool
+		Capture string
+		Replay  string
 	}
 	Lib struct {
 		Std bool
@@ -0,0 +1,305 @@
+package minecraft
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"phoenix/lambda/function"
+	"phoenix/ligo"
+	"phoenix/minecraft/protocol"
+	"strings"
+)
+
+// selectionParticle is the particle used to outline the selection.
+const selectionParticle = "minecraft:villager_happy"
+
+// errNoSelection is thrown by functions that operate on the selection if either of its positions is unset.
+var errNoSelection = errors.New("no region selected: set both positions using pos1 and pos2 first")
+
+// Selection is a cuboid region selected by a player, WorldEdit style, by setting its two corners. A Selection
+// is not safe for concurrent use: The selection of a Session is guarded by the lock of the Session.
+type Selection struct {
+	pos1, pos2 function.Vector
+}
+
+// Region returns the region between the two positions of the selection.
+func (sel *Selection) Region() (function.SubSpace, error) {
+	if sel.pos1 == nil || sel.pos2 == nil {
+		return function.SubSpace{}, errNoSelection
+	}
+	return function.NewSubSpace(sel.pos1, sel.pos2), nil
+}
+
+// set replaces the selection with the region passed.
+func (sel *Selection) set(region function.SubSpace) {
+	sel.pos1, sel.pos2 = region.Min(), region.Max()
+}
+
+// showSelection outlines the selection of the session passed with particles.
+func (client *Client) showSelection(s *Session) {
+	region, err := s.selection.Region()
+	if err != nil {
+		return
+	}
+	size := region.Size()
+	// Keep the amount of particles for large selections reasonable by spacing them out further.
+	step := 1.0
+	for (size[0]+size[1]+size[2])*4/step > 256 {
+		step *= 2
+	}
+	for _, p := range region.Edges(step) {
+		_ = client.SendCommandNoCallback(fmt.Sprintf("particle %s %v %v %v", selectionParticle, p[0], p[1], p[2]))
+	}
+}
+
+// regionJob returns a build job placing the block passed at every position in the regions passed. Positions
+// shared by several regions are placed once.
+func regionJob(name string, block Block, regions ...function.SubSpace) *buildJob {
+	job := &buildJob{name: name, undoable: true}
+	seen := make(map[protocol.BlockPos]struct{})
+	for _, region := range regions {
+		lo, hi := blockPos(region.Min()), blockPos(region.Max())
+		for x := lo[0]; x <= hi[0]; x++ {
+			for y := lo[1]; y <= hi[1]; y++ {
+				for z := lo[2]; z <= hi[2]; z++ {
+					pos := protocol.BlockPos{x, y, z}
+					if _, ok := seen[pos]; ok {
+						continue
+					}
+					seen[pos] = struct{}{}
+					job.blocks = append(job.blocks, placement{pos: pos, block: block.String()})
+				}
+			}
+		}
+	}
+	return job
+}
+
+// cloneJob returns a build job placing the blocks of the clipboard passed with its origin at each of the
+// positions passed.
+func cloneJob(name string, cb *Clipboard, origins ...protocol.BlockPos) *buildJob {
+	job := &buildJob{name: name, undoable: true}
+	for _, origin := range origins {
+		for _, v := range cb.Voxels {
+			job.blocks = append(job.blocks, placement{
+				pos:   protocol.BlockPos{origin[0] + v.Pos[0], origin[1] + v.Pos[1], origin[2] + v.Pos[2]},
+				block: v.Block.String(),
+			})
+		}
+	}
+	return job
+}
+
+// sameBlock checks if the block names passed refer to the same block, regardless of whether they carry the
+// minecraft: namespace.
+func sameBlock(a, b string) bool {
+	return strings.TrimPrefix(a, "minecraft:") == strings.TrimPrefix(b, "minecraft:")
+}
+
+// registerSelectionFuncs registers the selection functions and the builders operating on the selection in
+// the VM of the session passed.
+func (client *Client) registerSelectionFuncs(s *Session) {
+	setPos := func(name string, pos *function.Vector) ligo.InBuilt {
+		return func(vm *ligo.VM, variable ...ligo.Variable) ligo.Variable {
+			var v function.Vector
+			switch len(variable) {
+			case 0:
+				e, ok := client.entities.Player(s.Player)
+				if !ok {
+					return vm.Throw(fmt.Sprintf("%s : player %s is not within view of the bot", name, s.Player))
+				}
+				v = blockVector(e.Position)
+			case 3:
+				f, err := floatArgs(variable)
+				if err != nil {
+					return vm.Throw(fmt.Sprintf("%s : %s", name, err))
+				}
+				v = function.Vector{math.Floor(f[0]), math.Floor(f[1]), math.Floor(f[2])}
+			default:
+				return vm.Throw(fmt.Sprintf("%s : expected no arguments or x y z, got %d argument(s)", name, len(variable)))
+			}
+			*pos = v
+			client.showSelection(s)
+			return vectorVariable(v)
+		}
+	}
+	// (pos1 [x y z]) and (pos2 [x y z]) set a corner of the selection to the block at the position passed,
+	// or to the block the player is in if none is passed.
+	s.vm.Funcs["pos1"] = setPos("pos1", &s.selection.pos1)
+	s.vm.Funcs["pos2"] = setPos("pos2", &s.selection.pos2)
+
+	// (sel) returns the two corners of the selection. (desel) clears it.
+	s.vm.Funcs["sel"] = func(vm *ligo.VM, variable ...ligo.Variable) ligo.Variable {
+		region, err := s.selection.Region()
+		if err != nil {
+			return ligo.Variable{Type: ligo.TypeNil}
+		}
+		return ligo.Variable{Type: ligo.TypeArray, Value: []ligo.Variable{vectorVariable(region.Min()), vectorVariable(region.Max())}}
+	}
+	s.vm.Funcs["desel"] = func(vm *ligo.VM, variable ...ligo.Variable) ligo.Variable {
+		s.selection = Selection{}
+		return ligo.Variable{Type: ligo.TypeNil}
+	}
+	s.vm.Funcs["show"] = func(vm *ligo.VM, variable ...ligo.Variable) ligo.Variable {
+		client.showSelection(s)
+		return ligo.Variable{Type: ligo.TypeNil}
+	}
+
+	// (expand n direction), (contract n direction) and (shift n direction) change the selection.
+	transform := func(name string, f func(region function.SubSpace, n float64, dir function.Vector) function.SubSpace) ligo.InBuilt {
+		return func(vm *ligo.VM, variable ...ligo.Variable) ligo.Variable {
+			region, n, dir, err := regionArgs(s, variable)
+			if err != nil {
+				return vm.Throw(fmt.Sprintf("%s : %s", name, err))
+			}
+			s.selection.set(f(region, n, dir))
+			client.showSelection(s)
+			return ligo.Variable{Type: ligo.TypeNil}
+		}
+	}
+	s.vm.Funcs["expand"] = transform("expand", function.SubSpace.Expand)
+	s.vm.Funcs["contract"] = transform("contract", function.SubSpace.Contract)
+	s.vm.Funcs["shift"] = transform("shift", function.SubSpace.Shift)
+
+	// The builders below place their blocks one after another in the background, like plot, so that the
+	// blocks they replace can be undone and failures are reported.
+
+	// (fill [block data]) fills the selection with a block, by default the block set in the session.
+	s.vm.Funcs["fill"] = func(vm *ligo.VM, variable ...ligo.Variable) ligo.Variable {
+		region, err := s.selection.Region()
+		if err != nil {
+			return vm.Throw(fmt.Sprintf("fill : %s", err))
+		}
+		block, err := blockArgs(vm, variable)
+		if err != nil {
+			return vm.Throw(fmt.Sprintf("fill : %s", err))
+		}
+		if err := client.build(s, regionJob("fill", block, region)); err != nil {
+			return vm.Throw(fmt.Sprintf("fill : %s", err))
+		}
+		return ligo.Variable{Type: ligo.TypeNil}
+	}
+	// (replace from) replaces all blocks of one type in the selection with the session's block.
+	s.vm.Funcs["replace"] = func(vm *ligo.VM, variable ...ligo.Variable) ligo.Variable {
+		region, err := s.selection.Region()
+		if err != nil {
+			return vm.Throw(fmt.Sprintf("replace : %s", err))
+		}
+		if len(variable) != 1 || variable[0].Type != ligo.TypeString {
+			return vm.Throw("replace : expected the name of the block to replace")
+		}
+		from := variable[0].Value.(string)
+		to, _ := blockArgs(vm, nil)
+		lo := blockPos(region.Min())
+		client.exportRegion(s, "replace", region, func(cb *Clipboard) error {
+			job := &buildJob{name: "replace", undoable: true}
+			for _, v := range cb.Voxels {
+				if sameBlock(v.Block.Name, from) {
+					job.blocks = append(job.blocks, placement{pos: protocol.BlockPos{lo[0] + v.Pos[0], lo[1] + v.Pos[1], lo[2] + v.Pos[2]}, block: to.String()})
+				}
+			}
+			return client.build(s, job)
+		})
+		return ligo.Variable{Type: ligo.TypeNil}
+	}
+	// (walls [block data]) builds the four vertical faces of the selection.
+	s.vm.Funcs["walls"] = func(vm *ligo.VM, variable ...ligo.Variable) ligo.Variable {
+		region, err := s.selection.Region()
+		if err != nil {
+			return vm.Throw(fmt.Sprintf("walls : %s", err))
+		}
+		block, err := blockArgs(vm, variable)
+		if err != nil {
+			return vm.Throw(fmt.Sprintf("walls : %s", err))
+		}
+		if err := client.build(s, regionJob("walls", block, region.Walls()...)); err != nil {
+			return vm.Throw(fmt.Sprintf("walls : %s", err))
+		}
+		return ligo.Variable{Type: ligo.TypeNil}
+	}
+	// (clone) clones the selection so that its lowest corner ends up at the pointer of the space.
+	s.vm.Funcs["clone"] = func(vm *ligo.VM, variable ...ligo.Variable) ligo.Variable {
+		region, err := s.selection.Region()
+		if err != nil {
+			return vm.Throw(fmt.Sprintf("clone : %s", err))
+		}
+		pointer := blockPos(vm.Vars["space"].Value.(*function.Space).GetPointer())
+		client.exportRegion(s, "clone", region, func(cb *Clipboard) error {
+			return client.build(s, cloneJob("clone", cb, pointer))
+		})
+		return ligo.Variable{Type: ligo.TypeNil}
+	}
+	// (stack n direction) repeats the selection n times in a direction, directly adjacent to each other.
+	s.vm.Funcs["stack"] = func(vm *ligo.VM, variable ...ligo.Variable) ligo.Variable {
+		region, n, dir, err := regionArgs(s, variable)
+		if err != nil {
+			return vm.Throw(fmt.Sprintf("stack : %s", err))
+		}
+		lo, size := region.Min(), region.Size()
+		var origins []protocol.BlockPos
+		for i := 1.0; i <= n; i++ {
+			origins = append(origins, blockPos(function.Vector{lo[0] + dir[0]*size[0]*i, lo[1] + dir[1]*size[1]*i, lo[2] + dir[2]*size[2]*i}))
+		}
+		client.exportRegion(s, "stack", region, func(cb *Clipboard) error {
+			return client.build(s, cloneJob("stack", cb, origins...))
+		})
+		return ligo.Variable{Type: ligo.TypeNil}
+	}
+}
+
+// regionArgs parses the 'n direction' arguments of functions such as expand and stack, and returns them
+// together with the current selection.
+func regionArgs(s *Session, variable []ligo.Variable) (function.SubSpace, float64, function.Vector, error) {
+	region, err := s.selection.Region()
+	if err != nil {
+		return region, 0, nil, err
+	}
+	if len(variable) != 2 || variable[1].Type != ligo.TypeString {
+		return region, 0, nil, errors.New("expected an amount and a direction")
+	}
+	n, err := floatArgs(variable[:1])
+	if err != nil {
+		return region, 0, nil, err
+	}
+	dir, err := function.Direction(variable[1].Value.(string))
+	if err != nil {
+		return region, 0, nil, err
+	}
+	return region, n[0], dir, nil
+}
+
+// blockArgs parses the optional 'block [data]' arguments of functions such as fill. If no block is passed,
+// the block and data variables of the VM are used.
+func blockArgs(vm *ligo.VM, variable []ligo.Variable) (Block, error) {
+	block := Block{name: vm.Vars["block"].Value.(string), data: byte(vm.Vars["data"].Value.(int64))}
+	if len(variable) == 0 {
+		return block, nil
+	}
+	if variable[0].Type != ligo.TypeString {
+		return block, fmt.Errorf("expected a block name, got type %s", variable[0].GetTypeString())
+	}
+	block.name, block.data = variable[0].Value.(string), 0
+	if len(variable) > 1 {
+		if variable[1].Type != ligo.TypeInt {
+			return block, fmt.Errorf("expected block data of type int, got type %s", variable[1].GetTypeString())
+		}
+		block.data = byte(variable[1].Value.(int64))
+	}
+	return block, nil
+}
+
+// floatArgs converts int and float variables to float64s.
+func floatArgs(variable []ligo.Variable) ([]float64, error) {
+	res := make([]float64, 0, len(variable))
+	for i, v := range variable {
+		switch v.Type {
+		case ligo.TypeInt:
+			res = append(res, float64(v.Value.(int64)))
+		case ligo.TypeFloat:
+			res = append(res, v.Value.(float64))
+		default:
+			return nil, fmt.Errorf("expected a number at argument %d, got type %s", i+1, v.GetTypeString())
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,161 @@
+package minecraft
+
+import (
+	"errors"
+	"phoenix/lambda/function"
+	"phoenix/ligo"
+	"phoenix/minecraft/protocol"
+	"phoenix/minecraft/protocol/packet"
+	"reflect"
+	"testing"
+)
+
+// testSession returns an operator session of a client that is not connected to a server. The commands sent
+// by the client are discarded.
+func testSession(t *testing.T) *Session {
+	t.Helper()
+	access, err := NewAccessList(nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &Client{
+		access:   access,
+		sessions: make(map[string]*Session),
+		entities: NewEntityRegistry(),
+		commands: newCommander(func(packet.Packet) error { return nil }),
+	}
+	t.Cleanup(client.commands.Close)
+	s := client.newSession("Operator", RoleOperator)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestSelectionRegion(t *testing.T) {
+	var sel Selection
+	if _, err := sel.Region(); !errors.Is(err, errNoSelection) {
+		t.Fatalf("empty selection returned %v, expected %v", err, errNoSelection)
+	}
+	sel.pos1 = function.Vector{4, 10, -3}
+	if _, err := sel.Region(); !errors.Is(err, errNoSelection) {
+		t.Fatalf("selection with one position returned %v, expected %v", err, errNoSelection)
+	}
+	sel.pos2 = function.Vector{0, 12, 5}
+	region, err := sel.Region()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(region.Min(), function.Vector{0, 10, -3}) || !reflect.DeepEqual(region.Max(), function.Vector{4, 12, 5}) {
+		t.Fatalf("got region %v %v, expected [0 10 -3] [4 12 5]", region.Min(), region.Max())
+	}
+}
+
+func TestSelectionFuncs(t *testing.T) {
+	s := testSession(t)
+	if _, err := s.Eval(`(pos1 0 0 0)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Eval(`(pos2 3 3 3)`); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		line     string
+		min, max function.Vector
+	}{
+		{`(expand 2 "up")`, function.Vector{0, 0, 0}, function.Vector{3, 5, 3}},
+		{`(contract 1 "up")`, function.Vector{0, 1, 0}, function.Vector{3, 5, 3}},
+		{`(shift 5 "west")`, function.Vector{-5, 1, 0}, function.Vector{-2, 5, 3}},
+		{`(expand 1 "north")`, function.Vector{-5, 1, -1}, function.Vector{-2, 5, 3}},
+	} {
+		if _, err := s.Eval(tc.line); err != nil {
+			t.Fatalf("%v: %v", tc.line, err)
+		}
+		region, err := s.selection.Region()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(region.Min(), tc.min) || !reflect.DeepEqual(region.Max(), tc.max) {
+			t.Errorf("%v: got selection %v %v, expected %v %v", tc.line, region.Min(), region.Max(), tc.min, tc.max)
+		}
+	}
+
+	v, err := s.Eval(`(sel)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if corners, ok := v.Value.([]ligo.Variable); !ok || len(corners) != 2 {
+		t.Fatalf("(sel) returned %+v, expected the two corners", v)
+	}
+	if _, err := s.Eval(`(desel)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.selection.Region(); !errors.Is(err, errNoSelection) {
+		t.Fatalf("selection after (desel) returned %v, expected %v", err, errNoSelection)
+	}
+	if _, err := s.Eval(`(expand 1 "up")`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.selection.Region(); !errors.Is(err, errNoSelection) {
+		t.Fatalf("expanding an empty selection selected a region: %v", err)
+	}
+}
+
+// TestSelectionFloor checks that positions passed to pos1 and pos2 select the blocks they are in.
+func TestSelectionFloor(t *testing.T) {
+	s := testSession(t)
+	if _, err := s.Eval(`(pos1 1.5 64 2.7)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Eval(`(pos2 -0.5 63.9 -3)`); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s.selection.pos1, function.Vector{1, 64, 2}) || !reflect.DeepEqual(s.selection.pos2, function.Vector{-1, 63, -3}) {
+		t.Fatalf("got positions %v and %v, expected [1 64 2] and [-1 63 -3]", s.selection.pos1, s.selection.pos2)
+	}
+}
+
+func TestRegionJob(t *testing.T) {
+	region := function.NewSubSpace(function.Vector{0, 0, 0}, function.Vector{3, 1, 2})
+	block := Block{name: "stone", data: 1}
+	for _, tc := range []struct {
+		name    string
+		regions []function.SubSpace
+		blocks  int
+	}{
+		{"fill", []function.SubSpace{region}, 4 * 2 * 3},
+		// The walls share the blocks at the corners, which are placed once.
+		{"walls", region.Walls(), 4*2*3 - 2*1*2},
+	} {
+		job := regionJob(tc.name, block, tc.regions...)
+		if len(job.blocks) != tc.blocks {
+			t.Errorf("%v: got %d blocks, expected %d", tc.name, len(job.blocks), tc.blocks)
+		}
+		if !job.undoable {
+			t.Errorf("%v: job cannot be undone", tc.name)
+		}
+		for _, p := range job.blocks {
+			if !region.Contains(function.Vector{float64(p.pos[0]), float64(p.pos[1]), float64(p.pos[2])}) || p.block != "stone 1" {
+				t.Fatalf("%v: got placement %v outside the region or of another block", tc.name, p)
+			}
+		}
+	}
+}
+
+func TestCloneJob(t *testing.T) {
+	cb := &Clipboard{Size: protocol.BlockPos{2, 1, 1}, Voxels: []Voxel{
+		{Pos: protocol.BlockPos{0, 0, 0}, Block: BlockState{Name: "minecraft:stone"}},
+		{Pos: protocol.BlockPos{1, 0, 0}, Block: BlockState{Name: "minecraft:air"}},
+	}}
+	job := cloneJob("stack", cb, protocol.BlockPos{2, 0, 0}, protocol.BlockPos{4, 0, 0})
+	expected := []placement{
+		{pos: protocol.BlockPos{2, 0, 0}, block: "minecraft:stone"},
+		{pos: protocol.BlockPos{3, 0, 0}, block: "minecraft:air"},
+		{pos: protocol.BlockPos{4, 0, 0}, block: "minecraft:stone"},
+		{pos: protocol.BlockPos{5, 0, 0}, block: "minecraft:air"},
+	}
+	if !reflect.DeepEqual(job.blocks, expected) || !job.undoable {
+		t.Fatalf("got job %+v, expected the blocks %v", job, expected)
+	}
+	if !sameBlock("dirt", "minecraft:dirt") || sameBlock("dirt", "minecraft:grass") {
+		t.Fatal("block names compared incorrectly")
+	}
+}
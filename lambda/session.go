@@ -0,0 +1,170 @@
+package minecraft
+
+import (
+	"fmt"
+	"github.com/pterm/pterm"
+	"phoenix/lambda/function"
+	"phoenix/lambda/function/generator"
+	"phoenix/lambda/function/std"
+	"phoenix/ligo"
+	"sync"
+)
+
+// maxHistory is the amount of evaluated lines a Session remembers.
+const maxHistory = 100
+
+// Session is the REPL state of a single player: Each player that is allowed to use the REPL gets a VM of
+// their own, so that variables, the space, pointer and selected block of one player never affect another.
+type Session struct {
+	// Player is the name of the player owning the session. Commands run on behalf of the session, such as
+	// (get), target this player.
+	Player string
+	// Role is the role the player had when the session was created.
+	Role Role
+
+	mu      sync.Mutex
+	vm      *ligo.VM
+	space   *function.Space
+	history []string
+	// selection is the region selected by the player, used by builders such as fill and stack. It is guarded
+	// by mu: It is only accessed by functions of the VM, which run while Eval holds mu.
+	selection Selection
+
+	// builds holds the build jobs queued by the session, run one by one by the build loop of the session.
+	builds chan *buildJob
+	// stop is closed when the session is closed, cancelling the build running and dropping queued builds.
+	stop chan struct{}
+	// buildMu guards the undo stack and clipboard, which are also changed from the build loop and exports,
+	// and closed, which is set once builds is closed.
+	buildMu   sync.Mutex
+	undo      []undoEntry
+	clipboard *Clipboard
+	closed    bool
+}
+
+// Space returns the space the session plots in.
+func (s *Session) Space() *function.Space {
+	return s.space
+}
+
+// History returns a copy of the lines evaluated in the session, oldest first.
+func (s *Session) History() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.history...)
+}
+
+// Close closes the session: The build it is running is cancelled, builds queued are dropped and the build
+// loop of the session stops. Builds can no longer be queued in the session once it is closed.
+func (s *Session) Close() {
+	s.buildMu.Lock()
+	defer s.buildMu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.stop)
+	close(s.builds)
+}
+
+// Eval evaluates a line in the session's VM and records it in the history. Evaluations of the same session
+// never run simultaneously.
+func (s *Session) Eval(line string) (ligo.Variable, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.history = append(s.history, line)
+	if len(s.history) > maxHistory {
+		s.history = s.history[len(s.history)-maxHistory:]
+	}
+	return s.vm.Eval(line)
+}
+
+// newSession creates a session for the player passed with a fresh VM holding the libraries and scripts set
+// in the config, and the client's builtin functions. Functions the role passed may not call are replaced.
+func (client *Client) newSession(player string, role Role) *Session {
+	s := &Session{
+		Player: player,
+		Role:   role,
+		vm:     ligo.NewVM(),
+		space:  function.NewSpace(),
+		builds: make(chan *buildJob, buildQueueSize),
+		stop:   make(chan struct{}),
+	}
+	go client.buildLoop(s)
+	s.vm.Vars["space"] = ligo.Variable{
+		Type:  ligo.TypeStruct,
+		Value: s.space,
+	}
+	if client.lib.Std {
+		std.StdInit(s.vm)
+	}
+	// Register the Generator Plugin
+	generator.PluginInit(s.vm)
+	if err := LoadScript(s.vm, client.lib.Script); err != nil {
+		pterm.Error.Println(err)
+	}
+	defaultConfig(s.vm)
+	client.registerFuncs(s)
+	s.vm.Funcs["history"] = func(vm *ligo.VM, variable ...ligo.Variable) ligo.Variable {
+		var lines []ligo.Variable
+		for _, line := range s.History() {
+			lines = append(lines, ligo.Variable{Type: ligo.TypeString, Value: line})
+		}
+		return ligo.Variable{Type: ligo.TypeArray, Value: lines}
+	}
+	client.access.restrict(s.vm, role)
+	return s
+}
+
+// session returns the session of the player passed, creating one if the player does not yet have one. If the
+// role of the player changed since the session was created, the old session is closed and a new session is
+// created. Player names are matched case-insensitively, like the roles of the AccessList.
+func (client *Client) session(player string, role Role) *Session {
+	client.sessionMu.Lock()
+	defer client.sessionMu.Unlock()
+
+	key := playerKey(player)
+	old, ok := client.sessions[key]
+	if ok && old.Role == role {
+		return old
+	}
+	if ok {
+		old.Close()
+	}
+	s := client.newSession(player, role)
+	client.sessions[key] = s
+	pterm.Info.Println(fmt.Sprintf("Created %s session for %s", role, player))
+	return s
+}
+
+// closeSessions closes the sessions of all players and the console session.
+func (client *Client) closeSessions() {
+	client.sessionMu.Lock()
+	defer client.sessionMu.Unlock()
+
+	for player, s := range client.sessions {
+		s.Close()
+		delete(client.sessions, player)
+	}
+	if client.console != nil {
+		client.console.Close()
+	}
+}
+
+// handleChat evaluates a chat message sent by the player passed in the player's session, provided the player
+// has a role that allows using the REPL.
+func (client *Client) handleChat(player, message string) {
+	role := client.access.Role(player)
+	if role == RoleNone {
+		return
+	}
+	s := client.session(player, role)
+	pterm.Info.Println(fmt.Sprintf("[%s/%s] %s", player, role, message))
+	value, err := s.Eval(message)
+	if err != nil {
+		pterm.Error.Println(fmt.Sprintf("[%s/%s] %s", player, role, err))
+	} else {
+		pterm.Info.Println(fmt.Sprintf("[%s/%s] ==> ", player, role), value.Value)
+	}
+}
@@ -0,0 +1,36 @@
+package minecraft
+
+import (
+	"phoenix/minecraft/protocol/packet"
+	"testing"
+)
+
+// TestSessionPlayerName checks that names of the same player differing only in case share a session, as they
+// share a role.
+func TestSessionPlayerName(t *testing.T) {
+	access, err := NewAccessList([]string{"Steve"}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &Client{access: access, sessions: make(map[string]*Session), entities: NewEntityRegistry()}
+	client.commands = newCommander(func(packet.Packet) error { return nil })
+	t.Cleanup(client.commands.Close)
+	t.Cleanup(client.closeSessions)
+
+	if role := access.Role("steve"); role != RoleOperator {
+		t.Fatalf("steve has role %v, expected %v", role, RoleOperator)
+	}
+	s := client.session("Steve", RoleOperator)
+	if other := client.session("steve", RoleOperator); other != s {
+		t.Fatal("steve got a session other than Steve")
+	}
+	if other := client.session("STEVE", RoleOperator); other != s {
+		t.Fatal("STEVE got a session other than Steve")
+	}
+	if len(client.sessions) != 1 {
+		t.Fatalf("client holds %d sessions, expected 1", len(client.sessions))
+	}
+	if other := client.session("Alex", RoleOperator); other == s {
+		t.Fatal("Alex got the session of Steve")
+	}
+}
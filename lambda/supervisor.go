@@ -0,0 +1,274 @@
+package minecraft
+
+import (
+	"errors"
+	"fmt"
+	"github.com/pterm/pterm"
+	"net"
+	"phoenix/minecraft"
+	"phoenix/minecraft/protocol/packet"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultMinReconnectDelay and defaultMaxReconnectDelay are the delays used between reconnection attempts
+	// if the config does not set them.
+	defaultMinReconnectDelay = time.Second
+	defaultMaxReconnectDelay = time.Minute
+	// stableConnection is the time a connection must last after spawning for the delay between reconnection
+	// attempts to be reset.
+	stableConnection = time.Minute
+	// resumeOverlap is the amount of blocks a build job steps back when it resumes after the connection was
+	// lost. Commands are buffered before they are sent, so the blocks placed right before the connection was
+	// lost may never have reached the server. Placing a block twice has no effect.
+	resumeOverlap = 256
+)
+
+var (
+	// ErrNotConnected is returned when a packet is written while the client is not connected to the server.
+	ErrNotConnected = errors.New("client is not connected to the server")
+	// ErrGaveUp is returned when waiting for a connection after the client stopped reconnecting.
+	ErrGaveUp = errors.New("client stopped reconnecting to the server")
+)
+
+// reconnectPolicy specifies how a supervisor reconnects after the connection is lost.
+type reconnectPolicy struct {
+	// disabled stops the supervisor once the first connection is lost.
+	disabled bool
+	// minDelay is the delay before the first reconnection attempt. It doubles after every failed attempt, up
+	// to maxDelay.
+	minDelay, maxDelay time.Duration
+	// maxAttempts is the amount of consecutive failed attempts after which the supervisor gives up, or 0 to
+	// never give up.
+	maxAttempts int
+}
+
+// reconnectPolicyFrom returns the reconnectPolicy set in the config, with defaults for the fields left empty.
+func reconnectPolicyFrom(disabled bool, minDelay, maxDelay string, maxAttempts int) (reconnectPolicy, error) {
+	p := reconnectPolicy{disabled: disabled, minDelay: defaultMinReconnectDelay, maxDelay: defaultMaxReconnectDelay, maxAttempts: maxAttempts}
+	var err error
+	if minDelay != "" {
+		if p.minDelay, err = time.ParseDuration(minDelay); err != nil {
+			return p, fmt.Errorf("reconnect: min delay: %w", err)
+		}
+	}
+	if maxDelay != "" {
+		if p.maxDelay, err = time.ParseDuration(maxDelay); err != nil {
+			return p, fmt.Errorf("reconnect: max delay: %w", err)
+		}
+	}
+	if p.minDelay <= 0 || p.maxDelay < p.minDelay {
+		return p, fmt.Errorf("reconnect: delays must be positive and min delay (%s) may not exceed max delay (%s)", p.minDelay, p.maxDelay)
+	}
+	return p, nil
+}
+
+// delay returns the delay before the reconnection attempt following the amount of failed attempts passed.
+func (p reconnectPolicy) delay(failed int) time.Duration {
+	d := p.minDelay
+	for i := 1; i < failed && d < p.maxDelay; i++ {
+		d *= 2
+	}
+	if d > p.maxDelay {
+		d = p.maxDelay
+	}
+	return d
+}
+
+// supervisor keeps a Client connected to a server. It dials the server, spawns the bot and passes the packets
+// read to the handlers of the client, and dials the server again if the connection is lost, waiting longer
+// after every failed attempt. The sessions of the client, holding the VMs, spaces and build jobs, outlive the
+// connections, so that players can continue where they were and build jobs resume once reconnected.
+// The server is left when it sends a Disconnect packet, and the supervisor reconnects as usual. A Transfer
+// packet makes the supervisor connect to the server it holds right away.
+type supervisor struct {
+	client *Client
+	dialer minecraft.Dialer
+	policy reconnectPolicy
+	// spawned is called every time the bot spawned, after the client was given the new connection.
+	spawned func(conn *minecraft.Conn)
+
+	network, address string
+	// crew marks the supervisor of a crew bot, for which only the packets needed to send commands are handled.
+	crew bool
+	// transferred is set when the server transferred the bot to another address, which is then dialed
+	// without delay.
+	transferred bool
+}
+
+// run connects to the server and keeps reconnecting until the policy says to stop. It returns the error of
+// the last connection or dial attempt.
+func (s *supervisor) run() error {
+	defer s.client.stop()
+	failed := 0
+	for {
+		var spawnedAt time.Time
+		conn, err := s.dialer.Dial(s.network, s.address)
+		if err == nil {
+			spawnedAt, err = s.serve(conn)
+		}
+		if !spawnedAt.IsZero() && time.Since(spawnedAt) >= stableConnection {
+			failed = 0
+		}
+		if s.policy.disabled {
+			return err
+		}
+		if s.transferred {
+			s.transferred = false
+			failed = 0
+			pterm.Info.Println(fmt.Sprintf("Transferred to %s.", s.address))
+			continue
+		}
+		failed++
+		if s.policy.maxAttempts > 0 && failed > s.policy.maxAttempts {
+			pterm.Error.Println(fmt.Sprintf("Giving up after %d failed attempts to reconnect: %s", failed-1, err))
+			return err
+		}
+		delay := s.policy.delay(failed)
+		pterm.Warning.Println(fmt.Sprintf("Connection lost: %s. Reconnecting in %s.", err, delay))
+		time.Sleep(delay)
+	}
+}
+
+// serve spawns the bot over the connection passed and dispatches the packets read from it until it is
+// closed. It returns the time the bot spawned, or the zero time if spawning failed, and the reason the
+// connection was closed.
+func (s *supervisor) serve(conn *minecraft.Conn) (time.Time, error) {
+	defer conn.Close()
+	if err := conn.DoSpawn(); err != nil {
+		return time.Time{}, err
+	}
+	spawnedAt := time.Now()
+	s.client.setConn(conn)
+	defer s.client.lostConn(conn)
+	if s.spawned != nil {
+		s.spawned(conn)
+	}
+
+	d := minecraft.NewDispatcher(conn)
+	if s.crew {
+		s.client.commands.register(d)
+	} else {
+		s.client.register(d)
+	}
+	d.Handle(packet.IDTransfer, func(pk packet.Packet) bool {
+		p := pk.(*packet.Transfer)
+		s.address, s.transferred = net.JoinHostPort(p.Address, strconv.Itoa(int(p.Port))), true
+		_ = conn.Close()
+		return false
+	})
+	return spawnedAt, d.Run()
+}
+
+// connection holds the connection a Client currently uses. It is safe for concurrent use.
+type connection struct {
+	mu   sync.Mutex
+	conn *minecraft.Conn
+	// connected is closed while conn is set, and replaced by a new channel once it is lost.
+	connected chan struct{}
+	// lost is closed once conn is lost, and replaced by a new channel once a new connection is set.
+	lost chan struct{}
+	// stopped is closed once the client stops reconnecting.
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// init initialises the channels of the connection if this was not yet done. mu must be held.
+func (c *connection) init() {
+	if c.connected == nil {
+		c.connected, c.stopped = make(chan struct{}), make(chan struct{})
+		c.lost = make(chan struct{})
+		close(c.lost)
+	}
+}
+
+// setConn makes the client use the connection passed, which has spawned.
+func (client *Client) setConn(conn *minecraft.Conn) {
+	c := &client.connection
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.init()
+	c.conn = conn
+	close(c.connected)
+	c.lost = make(chan struct{})
+}
+
+// lostConn notes that the connection passed was lost, unless the client already uses another connection.
+func (client *Client) lostConn(conn *minecraft.Conn) {
+	c := &client.connection
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.init()
+	if c.conn == conn && conn != nil {
+		c.conn = nil
+		c.connected = make(chan struct{})
+		close(c.lost)
+	}
+}
+
+// stop notes that the client stopped reconnecting, so that waiting for a connection fails with ErrGaveUp.
+func (client *Client) stop() {
+	c := &client.connection
+	c.mu.Lock()
+	c.init()
+	c.mu.Unlock()
+	c.once.Do(func() {
+		close(c.stopped)
+	})
+}
+
+// Conn returns the connection the client currently uses, or nil if it is not connected.
+func (client *Client) Conn() *minecraft.Conn {
+	c := &client.connection
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn
+}
+
+// writePacket writes a packet to the current connection. If the connection turns out to be closed, it is
+// noted as lost. writePacket returns ErrNotConnected if the client is not connected.
+func (client *Client) writePacket(pk packet.Packet) error {
+	conn := client.Conn()
+	if conn == nil {
+		return ErrNotConnected
+	}
+	if err := conn.WritePacket(pk); err != nil {
+		client.lostConn(conn)
+		return err
+	}
+	return nil
+}
+
+// awaitConnection blocks until the client is connected. It returns ErrGaveUp if the client stopped
+// reconnecting.
+func (client *Client) awaitConnection() error {
+	connected, stopped := client.connectionState()
+	select {
+	case <-connected:
+		return nil
+	case <-stopped:
+		return ErrGaveUp
+	}
+}
+
+// connectionLost returns a channel that is closed once the connection the client currently uses is lost. If
+// the client is not connected, the channel returned is already closed.
+func (client *Client) connectionLost() <-chan struct{} {
+	c := &client.connection
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.init()
+	return c.lost
+}
+
+// connectionState returns a channel that is closed once the client is connected and a channel that is closed
+// once it stopped reconnecting.
+func (client *Client) connectionState() (connected, stopped <-chan struct{}) {
+	c := &client.connection
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.init()
+	return c.connected, c.stopped
+}
@@ -0,0 +1,142 @@
+package minecraft
+
+import (
+	"context"
+	"phoenix/internal/testserver"
+	"phoenix/minecraft"
+	"phoenix/minecraft/protocol"
+	"phoenix/minecraft/protocol/login"
+	"testing"
+	"time"
+)
+
+func TestReconnectPolicyDelay(t *testing.T) {
+	p, err := reconnectPolicyFrom(false, "1s", "5s", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for failed, expected := range []time.Duration{time.Second, time.Second, time.Second * 2, time.Second * 4, time.Second * 5, time.Second * 5} {
+		if d := p.delay(failed); d != expected {
+			t.Fatalf("delay after %d failed attempts is %s, expected %s", failed, d, expected)
+		}
+	}
+	if _, err := reconnectPolicyFrom(false, "1m", "1s", 0); err == nil {
+		t.Fatal("policy with min delay above max delay accepted")
+	}
+}
+
+// testSupervisor starts a supervisor for a new client connecting to the server passed, and returns the
+// client and the session of its operator. The supervisor gives up after a single failed reconnection attempt.
+func testSupervisor(t *testing.T, s *testserver.Server) (*Client, *Session, <-chan error) {
+	t.Helper()
+	access, err := NewAccessList([]string{"Operator"}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &Client{bot: "Bot", operator: "Operator", access: access, sessions: make(map[string]*Session), entities: NewEntityRegistry()}
+	client.commands = newCommander(client.writePacket)
+	client.structures = newStructureExporter(client.writePacket)
+	t.Cleanup(client.commands.Close)
+	t.Cleanup(client.closeSessions)
+
+	sup := &supervisor{
+		client:  client,
+		dialer:  minecraft.Dialer{IdentityData: login.IdentityData{DisplayName: "Bot"}},
+		policy:  reconnectPolicy{minDelay: time.Millisecond * 10, maxDelay: time.Millisecond * 10, maxAttempts: 1},
+		network: s.Network(),
+		address: s.Address(),
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- sup.run()
+	}()
+	if err := client.awaitConnection(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	return client, client.session("Operator", RoleOperator), done
+}
+
+// waitFor calls f until it returns true, failing the test if that does not happen within 10 seconds.
+func waitFor(t *testing.T, what string, f func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second * 10)
+	for !f() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+}
+
+// TestSupervisorResumeBuild kicks the bot in the middle of a build job and checks that the bot reconnects and
+// completes the job.
+func TestSupervisorResumeBuild(t *testing.T) {
+	s, err := testserver.New(testserver.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, session, done := testSupervisor(t, s)
+	first := client.Conn()
+
+	const length = 1000
+	job := &buildJob{name: "line"}
+	for x := int32(0); x < length; x++ {
+		job.blocks = append(job.blocks, placement{pos: protocol.BlockPos{x, 10, 0}, block: "gold_block"})
+	}
+	if err := client.build(session, job); err != nil {
+		t.Fatal(err)
+	}
+	count := func() int {
+		return s.World().Count(protocol.BlockPos{0, 10, 0}, protocol.BlockPos{length - 1, 10, 0}, "gold_block")
+	}
+	waitFor(t, "the build to start", func() bool {
+		return count() >= length/4
+	})
+	if !s.Kick("Bot", "Kicked for testing") {
+		t.Fatal("bot not connected")
+	}
+	waitFor(t, "the bot to reconnect", func() bool {
+		conn := client.Conn()
+		return conn != nil && conn != first
+	})
+	waitFor(t, "the build to complete", func() bool {
+		return count() == length
+	})
+
+	_ = s.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second * 10):
+		t.Fatal("supervisor did not give up after the server closed")
+	}
+	if err := client.awaitConnection(); err != ErrGaveUp {
+		t.Fatalf("awaiting connection after giving up returned %v, expected %v", err, ErrGaveUp)
+	}
+}
+
+// TestSupervisorTransfer checks that the bot connects to the server it is transferred to.
+func TestSupervisorTransfer(t *testing.T) {
+	from, err := testserver.New(testserver.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer from.Close()
+	to, err := testserver.New(testserver.Config{Network: from.Network(), Address: "127.0.0.1:19133"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer to.Close()
+	testSupervisor(t, from)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if _, err := from.WaitPlayer(ctx, "Bot"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !from.Transfer("Bot", "127.0.0.1", 19133) {
+		t.Fatal("bot not connected")
+	}
+	if _, err := to.WaitPlayer(ctx, "Bot"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,96 @@
+package minecraft
+
+import (
+	"fmt"
+	"phoenix/lambda/function"
+	"phoenix/minecraft"
+	"phoenix/minecraft/protocol"
+	"phoenix/minecraft/protocol/packet"
+	"phoenix/proxy"
+	"strings"
+)
+
+// defaultWand is the item used to select positions by clicking blocks if none is set in the config.
+const defaultWand = "minecraft:wooden_axe"
+
+// startProxy starts a proxy listening on the address passed, through which players join the server at the
+// network and address passed using the Dialer passed. As the bot sees the packets sent by the clients of
+// these players, they may select positions by clicking blocks with the wand.
+func (client *Client) startProxy(address string, dialer minecraft.Dialer, network, remote string) (*proxy.Proxy, error) {
+	p, err := proxy.Listen("raknet", address, proxy.Config{
+		// The login of players is only verified if the proxy logs in to the server itself, as a server
+		// joined without logging in does not verify players either.
+		Listen:        minecraft.ListenConfig{AuthenticationDisabled: dialer.TokenSource == nil},
+		Dialer:        dialer,
+		RemoteNetwork: network,
+		RemoteAddress: remote,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("start proxy: %w", err)
+	}
+	p.Handle(proxy.ClientToServer, client.handleWand)
+	go func() {
+		_ = p.Serve()
+	}()
+	return p, nil
+}
+
+// handleWand is a proxy.Handler of the packets sent by the clients of players joining through the proxy of
+// the bot. Breaking a block with the wand sets the first position of the selection of the player, and
+// clicking a block with it sets the second. Packets using the wand are dropped, so that the block is not
+// broken or used on the server.
+func (client *Client) handleWand(ps *proxy.Session, pk packet.Packet) packet.Packet {
+	tr, ok := pk.(*packet.InventoryTransaction)
+	if !ok {
+		return pk
+	}
+	data, ok := tr.TransactionData.(*protocol.UseItemTransactionData)
+	if !ok || data.HeldItem.Stack.NetworkID == 0 || data.HeldItem.Stack.NetworkID != wandID(client.wand, ps.Server().GameData().Items) {
+		return pk
+	}
+	if data.ActionType != protocol.UseItemActionBreakBlock && data.ActionType != protocol.UseItemActionClickBlock {
+		return pk
+	}
+	player := ps.Client().IdentityData().DisplayName
+	role := client.access.Role(player)
+	if role == RoleNone || role < client.access.Required("pos1") {
+		return pk
+	}
+	pos := function.Vector{float64(data.BlockPosition[0]), float64(data.BlockPosition[1]), float64(data.BlockPosition[2])}
+	first := data.ActionType == protocol.UseItemActionBreakBlock
+	client.session(player, role).selectPos(client, first, pos)
+
+	msg := fmt.Sprintf("Second position set to %v.", pos)
+	if first {
+		msg = fmt.Sprintf("First position set to %v.", pos)
+	}
+	_ = ps.WriteToClient(&packet.Text{TextType: packet.TextTypeRaw, Message: msg})
+	return nil
+}
+
+// selectPos sets the first or second position of the selection of the session and outlines it. Unlike the
+// functions of the VM, which run while Eval holds the lock of the session, selectPos takes the lock itself.
+func (s *Session) selectPos(client *Client, first bool, pos function.Vector) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if first {
+		s.selection.pos1 = pos
+	} else {
+		s.selection.pos2 = pos
+	}
+	client.showSelection(s)
+}
+
+// wandID returns the network ID of the item with the name passed in the item entries sent by the server, or
+// 0 if the server has no such item.
+func wandID(name string, items []protocol.ItemEntry) int32 {
+	if !strings.Contains(name, ":") {
+		name = "minecraft:" + name
+	}
+	for _, item := range items {
+		if item.Name == name {
+			return int32(item.RuntimeID)
+		}
+	}
+	return 0
+}
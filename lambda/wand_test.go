@@ -0,0 +1,106 @@
+package minecraft
+
+import (
+	"github.com/google/uuid"
+	"phoenix/internal/testserver"
+	"phoenix/lambda/function"
+	"phoenix/minecraft"
+	"phoenix/minecraft/protocol"
+	"phoenix/minecraft/protocol/login"
+	"phoenix/minecraft/protocol/packet"
+	"phoenix/proxy"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestHandleWand checks that players joining through the proxy of the bot select positions by breaking and
+// clicking blocks with the wand, and that other items are left alone.
+func TestHandleWand(t *testing.T) {
+	s, err := testserver.New(testserver.Config{Items: []protocol.ItemEntry{
+		{Name: "minecraft:wooden_axe", RuntimeID: 5},
+		{Name: "minecraft:stick", RuntimeID: 6},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = s.Close()
+	})
+	access, err := NewAccessList(nil, []string{"Builder"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &Client{
+		access:   access,
+		wand:     defaultWand,
+		sessions: make(map[string]*Session),
+		entities: NewEntityRegistry(),
+		commands: newCommander(func(packet.Packet) error { return nil }),
+	}
+	t.Cleanup(client.commands.Close)
+
+	network := "wand-" + uuid.New().String()
+	minecraft.RegisterNetwork(network, minecraft.NewPipe())
+	p, err := proxy.Listen(network, "127.0.0.1:19134", proxy.Config{
+		Listen:        minecraft.ListenConfig{AuthenticationDisabled: true},
+		RemoteNetwork: s.Network(),
+		RemoteAddress: s.Address(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Handle(proxy.ClientToServer, client.handleWand)
+	go func() {
+		_ = p.Serve()
+	}()
+	t.Cleanup(func() {
+		_ = p.Close()
+	})
+	conn, err := minecraft.Dialer{IdentityData: login.IdentityData{DisplayName: "Builder"}}.DialTimeout(network, "127.0.0.1:19134", time.Second*5)
+	if err != nil {
+		t.Fatalf("dial proxy: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	if err := conn.DoSpawnTimeout(time.Second * 5); err != nil {
+		t.Fatalf("spawn: %v", err)
+	}
+
+	use := func(action uint32, item int32, pos protocol.BlockPos) {
+		t.Helper()
+		if err := conn.WritePacket(&packet.InventoryTransaction{TransactionData: &protocol.UseItemTransactionData{
+			ActionType:    action,
+			BlockPosition: pos,
+			HeldItem:      protocol.ItemInstance{Stack: protocol.ItemStack{ItemType: protocol.ItemType{NetworkID: item}, Count: 1}},
+		}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The stick is not the wand, so the transaction reaches the server and no position is set.
+	use(protocol.UseItemActionBreakBlock, 6, protocol.BlockPos{9, 9, 9})
+	use(protocol.UseItemActionBreakBlock, 5, protocol.BlockPos{1, 64, -2})
+	use(protocol.UseItemActionClickBlock, 5, protocol.BlockPos{4, 60, 3})
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	var messages []string
+	for len(messages) < 2 {
+		pk, err := conn.ReadPacket()
+		if err != nil {
+			t.Fatalf("read packet: %v", err)
+		}
+		if text, ok := pk.(*packet.Text); ok {
+			messages = append(messages, text.Message)
+		}
+	}
+	if messages[0] != "First position set to [1 64 -2]." || messages[1] != "Second position set to [4 60 3]." {
+		t.Fatalf("got messages %q", messages)
+	}
+	session := client.session("Builder", RoleBuilder)
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if !reflect.DeepEqual(session.selection.pos1, function.Vector{1, 64, -2}) || !reflect.DeepEqual(session.selection.pos2, function.Vector{4, 60, 3}) {
+		t.Fatalf("got selection %v to %v", session.selection.pos1, session.selection.pos2)
+	}
+}
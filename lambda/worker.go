@@ -1,29 +1,43 @@
 package minecraft
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/pterm/pterm"
 	"os"
 	"path/filepath"
 	"phoenix/lambda/function"
-	"phoenix/lambda/function/generator"
-	"phoenix/lambda/function/std"
 	"phoenix/ligo"
 	"phoenix/minecraft"
 	"phoenix/minecraft/auth"
-	"phoenix/minecraft/protocol/packet"
+	"phoenix/minecraft/capture"
+	"phoenix/minecraft/protocol/login"
+	"phoenix/minecraft/resource"
+	"phoenix/minecraft/version"
+	"time"
 )
 
-type PlotConfig struct {
-	block Block
-}
+const (
+	// defaultTokenFile is the name of the file, next to the config, that the tokens of the accounts are saved
+	// in if the config does not set one.
+	defaultTokenFile = "tokens.json"
+	// defaultAccount is the name of the account that the bot logs in with if the config does not set one.
+	defaultAccount = "default"
+	// tokenRefreshInterval is the interval at which tokens that are about to expire are refreshed.
+	tokenRefreshInterval = time.Minute * 10
+)
 
 type Block struct {
 	name string
 	data byte
 }
 
+// String returns the block as used in commands such as /setblock: Its name followed by its data value.
+func (b Block) String() string {
+	return fmt.Sprintf("%s %d", b.name, b.data)
+}
+
 func (client *Client) GetSpace(name string) *function.Space {
 	return client.spaces[name]
 }
@@ -35,129 +49,216 @@ func Run(path string) {
 	}
 
 	// Init Connection :: Start
-	dialer := func() minecraft.Dialer {
-		if config.User.Auth {
-			return minecraft.Dialer{
-				TokenSource: auth.TokenSource,
-			}
-		} else {
-			return minecraft.Dialer{}
+	var store *auth.TokenStore
+	dialer := minecraft.Dialer{}
+	if config.User.Auth && config.Debug.Replay == "" {
+		tokenFile := config.Accounts.TokenFile
+		if tokenFile == "" {
+			tokenFile = filepath.Join(filepath.Dir(path), defaultTokenFile)
 		}
-	}()
+		var err error
+		if store, err = auth.OpenTokenStore(tokenFile); err != nil {
+			pterm.Error.Println(err)
+			return
+		}
+		account := config.Accounts.Bot
+		if account == "" {
+			account = defaultAccount
+		}
+		dialer.TokenSource = store.Account(account)
+		go refreshTokens(store)
+	}
+	// Servers running other versions of Minecraft are joined using the protocol found in their pong.
+	dialer.Protocols = version.All()
+	var packCache *resource.Cache
+	if config.Packs.Cache != "" {
+		var err error
+		if packCache, err = resource.OpenCache(config.Packs.Cache); err != nil {
+			pterm.Error.Println(err)
+			return
+		}
+		dialer.PackCache = packCache
+	}
+	if config.Debug.Capture != "" {
+		w, err := capture.Create(config.Debug.Capture)
+		if err != nil {
+			pterm.Error.Println(err)
+			return
+		}
+		defer w.Close()
+		dialer.PacketFunc = w.PacketFunc
+	}
 
-	conn, err := dialer.Dial("raknet", config.Connection.RemoteAddress)
+	network, address := "raknet", config.Connection.RemoteAddress
+	policy, err := reconnectPolicyFrom(config.Reconnect.Disabled, config.Reconnect.MinDelay, config.Reconnect.MaxDelay, config.Reconnect.MaxAttempts)
 	if err != nil {
 		pterm.Error.Println(err)
+		return
+	}
+	if config.Debug.Replay != "" {
+		replay, err := startReplay(config.Debug.Replay)
+		if err != nil {
+			pterm.Error.Println(err)
+			return
+		}
+		defer replay.Close()
+		network, address = replay.Network(), replay.Address()
+		// A replay ends for good once all packets were sent, so there is nothing to reconnect to.
+		policy.disabled = true
 	}
-	defer conn.Close()
 	// Init Connection :: End
 
-	// Create a client by conn
+	access, err := NewAccessList(
+		append([]string{config.User.Operator}, config.Access.Operators...),
+		config.Access.Builders,
+		config.Access.Viewers,
+		config.Access.Permissions,
+	)
+	if err != nil {
+		pterm.Error.Println(err)
+		return
+	}
+
+	// Create a client. Its connection is set by the supervisor once the bot spawned.
 	client := &Client{
 		spaces:   make(map[string]*function.Space),
-		vm:       ligo.NewVM(),
 		bot:      config.User.Bot,
 		operator: config.User.Operator,
-		conn:     conn,
-		config: PlotConfig{
-			block: Block{
-				name: "stone",
-				data: 0,
-			},
-		},
-		callbacks: make(map[string]Callback),
-	}
-	client.spaces["overworld"] = function.NewSpace()
-	client.vm.Vars["space"] = ligo.Variable{
-		Type:  ligo.TypeStruct,
-		Value: client.spaces["overworld"],
-	}
-
-	if config.Lib.Std {
-		std.StdInit(client.vm)
-	}
-	// Register the Generator Plugin
-	generator.PluginInit(client.vm)
-	if err := LoadScript(client.vm, config.Lib.Script); err != nil {
-		pterm.Error.Println(err)
+		access:   access,
+		sessions: make(map[string]*Session),
+		entities: NewEntityRegistry(),
+	}
+	client.lib.Std = config.Lib.Std
+	client.lib.Script = config.Lib.Script
+	client.wand = config.Selection.Wand
+	if client.wand == "" {
+		client.wand = defaultWand
 	}
-	defaultConfig(client.vm)
+	client.commands = newCommander(client.writePacket)
+	defer client.commands.Close()
+	client.structures = newStructureExporter(client.writePacket)
 
-	client.operator = config.User.Operator
-	client.bot = config.User.Bot
+	// The console acts on behalf of the operator, but has a session separate from the operator's chat.
+	client.console = client.newSession(client.operator, RoleOperator)
+	defer client.closeSessions()
+	client.spaces["overworld"] = client.console.Space()
 
-	// Basic Functions Init
-	client.Init()
 	client.StartConsole()
 
-	if err := conn.DoSpawn(); err == nil {
+	s := &supervisor{client: client, dialer: dialer, policy: policy, network: network, address: address}
+	s.spawned = func(conn *minecraft.Conn) {
 		pterm.Info.Println(fmt.Sprintf("Bot<%s> successfully spawned.", client.bot))
+		pterm.Debug.Println(fmt.Sprintf("Connected using protocol %d (%s).", conn.Protocol().ID(), conn.Protocol().Ver()))
+		client.entities.Spawn(client.bot, conn.GameData())
 		// Collector : Get Position
-		eval, err := client.vm.Eval(`(get)`)
+		eval, err := client.console.Eval(`(get)`)
 		if err != nil {
 			pterm.Error.Println(err)
 		} else if eval.Value != nil {
 			pterm.Info.Println(eval.Value)
 		}
-	} else {
-		pterm.Error.Println(err)
 	}
+	names, crewDialer := config.Crew.Bots, func(name string) minecraft.Dialer {
+		return minecraft.Dialer{IdentityData: login.IdentityData{DisplayName: name}, Protocols: version.All(), PackCache: packCache}
+	}
+	if store != nil {
+		names, crewDialer = config.Accounts.Crew, func(name string) minecraft.Dialer {
+			return minecraft.Dialer{TokenSource: store.Account(name), Protocols: version.All(), PackCache: packCache}
+		}
+	}
+	if config.Debug.Replay != "" && len(names) != 0 {
+		// A replay only has a single connection.
+		pterm.Warning.Println("Crew bots are not used while a capture is replayed.")
+		names = nil
+	}
+	client.crew = startCrew(names, crewDialer, policy, network, address)
 
-	// You will then want to start a for loop that reads packets from the connection until it is closed.
-	for {
-		// Read a packet from the connection: ReadPacket returns an error if the connection is closed or if
-		// a read timeout is set. You will generally want to return or break if this happens.
-		pk, err := conn.ReadPacket()
+	if config.Proxy.Address != "" {
+		proxyDialer := minecraft.Dialer{Protocols: version.All(), PackCache: packCache}
+		if store != nil {
+			if config.Accounts.Proxy == "" {
+				pterm.Error.Println("An account for the proxy must be set in Accounts.Proxy.")
+				return
+			}
+			proxyDialer.TokenSource = store.Account(config.Accounts.Proxy)
+		}
+		p, err := client.startProxy(config.Proxy.Address, proxyDialer, network, address)
 		if err != nil {
-			break
+			pterm.Error.Println(err)
+			return
 		}
+		defer p.Close()
+		pterm.Info.Println(fmt.Sprintf("Join through %s to select positions using the wand (%s).", config.Proxy.Address, client.wand))
+	}
 
-		// The pk variable is of type packet.Packet, which may be type asserted to gain access to the data
-		// they hold:
-		switch p := pk.(type) {
-		case *packet.Text:
-			if p.TextType == packet.TextTypeChat {
-				if client.operator == p.SourceName {
-					pterm.Info.Println(fmt.Sprintf("[%s] %s", p.SourceName, p.Message))
-					value, err := client.vm.Eval(p.Message)
-					if err != nil {
-						pterm.Error.Println(err)
-					} else {
-						pterm.Info.Println("==> ", value.Value)
-					}
-				}
-			}
+	// Packets are read and passed to the handlers of the client until the supervisor stops reconnecting. The
+	// chunk radius is already requested by the Conn while spawning, so it is not sent again.
+	if err := s.run(); err != nil {
+		pterm.Error.Println(err)
+	}
+}
 
-		case *packet.CommandOutput:
-			callback, ok := client.callbacks[p.CommandOrigin.UUID.String()]
-			// TODO : Handle !ok
-			if ok {
-				delete(client.callbacks, p.CommandOrigin.UUID.String())
-				if len(p.OutputMessages) > 0 {
-					if !p.OutputMessages[0].Success {
-						//pterm.Warning.Println(fmt.Sprintf("Unknown command: %s. Please check that the command exists and that you have permission to use it.", p.OutputMessages[0].Parameters))
-					}
-					err := callback(p)
-					if err != nil {
-						pterm.Warning.Println(err)
-						// TODO : Handle error
-					}
-					continue
-				}
-			}
-		case *packet.StructureTemplateDataResponse:
-			data := p.StructureTemplate
-			pterm.Info.Println(data)
+// startCrew starts a supervisor for a crew bot with each of the names passed, which connect to the address
+// passed in the background using the Dialer returned by dialer for their name.
+func startCrew(names []string, dialer func(name string) minecraft.Dialer, policy reconnectPolicy, network, address string) []*Client {
+	var crew []*Client
+	for _, name := range names {
+		bot := newCrewBot(name)
+		s := &supervisor{
+			client:  bot,
+			dialer:  dialer(name),
+			policy:  policy,
+			network: network,
+			address: address,
+			crew:    true,
 		}
+		s.spawned = func(*minecraft.Conn) {
+			pterm.Info.Println(fmt.Sprintf("Crew Bot<%s> successfully spawned.", bot.bot))
+		}
+		go func() {
+			if err := s.run(); err != nil {
+				pterm.Error.Println(fmt.Sprintf("Crew Bot<%s>: %s", bot.bot, err))
+			}
+		}()
+		crew = append(crew, bot)
+	}
+	return crew
+}
 
-		// Write a packet to the connection: Similarly to ReadPacket, WritePacket will (only) return an error
-		// if the connection is closed.
-		p := &packet.RequestChunkRadius{ChunkRadius: 16}
-		if err := conn.WritePacket(p); err != nil {
-			break
+// refreshTokens refreshes the tokens of all accounts in the store passed every tokenRefreshInterval, so that
+// they are still valid when a bot reconnects.
+func refreshTokens(store *auth.TokenStore) {
+	for range time.Tick(tokenRefreshInterval) {
+		if err := store.Refresh(context.Background(), tokenRefreshInterval*2); err != nil {
+			pterm.Warning.Println(fmt.Sprintf("Refreshing tokens: %s", err))
 		}
+	}
+}
 
+// startReplay starts a server replaying the capture at the path passed.
+func startReplay(path string) (*capture.Server, error) {
+	r, err := capture.Open(path)
+	if err != nil {
+		return nil, err
 	}
+	defer r.Close()
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("read capture %s: %w", path, err)
+	}
+	replay, err := capture.NewServer(records, capture.ReplayConfig{})
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		<-replay.Done()
+		if err := replay.Err(); err != nil {
+			pterm.Error.Println(fmt.Sprintf("Replay of %s failed: %s", path, err))
+			return
+		}
+		pterm.Info.Println(fmt.Sprintf("Replay of %s finished.", path))
+	}()
+	return replay, nil
 }
 
 func defaultConfig(vm *ligo.VM) {
@@ -0,0 +1,122 @@
+package minecraft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/pterm/pterm"
+	"phoenix/lambda/function"
+	"phoenix/minecraft"
+	"phoenix/minecraft/protocol"
+	"phoenix/minecraft/protocol/packet"
+	"sync"
+	"sync/atomic"
+)
+
+// maxStructureRegion is the maximum length on any axis of a region exported in a single structure template
+// request, equal to the maximum size of a structure block.
+const maxStructureRegion = 64
+
+// structureExporter exports regions of the world through StructureTemplateDataRequests, matching the
+// responses to the requests by the structure name. The server only answers these requests if the bot is an
+// operator.
+type structureExporter struct {
+	write func(pk packet.Packet) error
+	count uint64
+
+	mu      sync.Mutex
+	pending map[string]chan *packet.StructureTemplateDataResponse
+}
+
+// newStructureExporter returns a structureExporter writing its requests using the function passed.
+func newStructureExporter(write func(pk packet.Packet) error) *structureExporter {
+	return &structureExporter{write: write, pending: make(map[string]chan *packet.StructureTemplateDataResponse)}
+}
+
+// export requests the structure template of a region no larger than maxStructureRegion on any axis and
+// waits for the response.
+func (e *structureExporter) export(ctx context.Context, region function.SubSpace) (map[string]interface{}, error) {
+	name := fmt.Sprintf("phoenix:export_%d", atomic.AddUint64(&e.count, 1))
+	c := make(chan *packet.StructureTemplateDataResponse, 1)
+	e.mu.Lock()
+	e.pending[name] = c
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		delete(e.pending, name)
+		e.mu.Unlock()
+	}()
+
+	lo, size := region.Min(), region.Size()
+	if err := e.write(&packet.StructureTemplateDataRequest{
+		StructureName: name,
+		Position:      protocol.BlockPos{int32(lo[0]), int32(lo[1]), int32(lo[2])},
+		Settings: protocol.StructureSettings{
+			PaletteName:    "default",
+			IgnoreEntities: true,
+			Size:           protocol.BlockPos{int32(size[0]), int32(size[1]), int32(size[2])},
+			Integrity:      1,
+		},
+		RequestType: packet.StructureTemplateRequestExportFromSave,
+	}); err != nil {
+		return nil, err
+	}
+	select {
+	case resp := <-c:
+		if !resp.Success {
+			return nil, errors.New("server refused to export structure: is the bot an operator?")
+		}
+		return resp.StructureTemplate, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("export structure: %w", ctx.Err())
+	}
+}
+
+// register registers a handler to the Dispatcher passed that delivers StructureTemplateDataResponse packets
+// to the exports awaiting them. Responses that no export awaits are printed.
+func (e *structureExporter) register(d *minecraft.Dispatcher) *minecraft.Registration {
+	return d.Handle(packet.IDStructureTemplateDataResponse, func(pk packet.Packet) bool {
+		if p := pk.(*packet.StructureTemplateDataResponse); !e.handle(p) {
+			pterm.Info.Println(p.StructureTemplate)
+		}
+		return true
+	})
+}
+
+// handle delivers a StructureTemplateDataResponse to the export awaiting it. It returns false if no export
+// with the structure name in the response was pending.
+func (e *structureExporter) handle(pk *packet.StructureTemplateDataResponse) bool {
+	e.mu.Lock()
+	c, ok := e.pending[pk.StructureName]
+	delete(e.pending, pk.StructureName)
+	e.mu.Unlock()
+	if ok {
+		c <- pk
+	}
+	return ok
+}
+
+// ExportRegion reads the blocks in a region of the world into a Clipboard with its origin at the lowest
+// corner of the region. Regions larger than a structure block are exported in several parts. ExportRegion
+// must not be called from the packet loop, as that loop delivers the responses.
+func (client *Client) ExportRegion(ctx context.Context, region function.SubSpace) (*Clipboard, error) {
+	lo := region.Min()
+	cb := &Clipboard{Size: sizeOf(region)}
+	for _, part := range region.Split(maxStructureRegion) {
+		template, err := client.structures.export(ctx, part)
+		if err != nil {
+			return nil, err
+		}
+		p := part.Min()
+		if err := cb.addTemplate(template, protocol.BlockPos{int32(p[0] - lo[0]), int32(p[1] - lo[1]), int32(p[2] - lo[2])}); err != nil {
+			return nil, err
+		}
+	}
+	return cb, nil
+}
+
+// sizeOf returns the size of a region as a BlockPos.
+func sizeOf(region function.SubSpace) protocol.BlockPos {
+	size := region.Size()
+	return protocol.BlockPos{int32(size[0]), int32(size[1]), int32(size[2])}
+}
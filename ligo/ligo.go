@@ -50,7 +50,7 @@ func reformEscapes(str string) string {
 			if !isEscape {
 				isEscape = true
 			} else {
-				ret += string(0x5C)
+				ret += string(rune(0x5C))
 				isEscape = false
 			}
 		default:
@@ -62,7 +62,7 @@ func reformEscapes(str string) string {
 				if !ok {
 					panic("in :\n\t" + str + "\nUnknown Escape sequence. : '\\" + string(val) + "'")
 				}
-				ret += string(num)
+				ret += string(rune(num))
 				isEscape = false
 			}
 		}
@@ -0,0 +1,435 @@
+// Package authtest implements a fake identity provider that issues tokens like the Microsoft Live Connect,
+// XBOX Live and Minecraft services do, so that authenticated logins can be tested without network access.
+//
+// A Server logs every device auth attempt in as the same player right away. The Minecraft login chains it
+// issues are signed by its own root key rather than by Mojang, so a minecraft.Listener must trust that key,
+// using ListenConfig.TrustedKeys, to consider players that logged in at the Server authenticated.
+package authtest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"phoenix/minecraft/auth"
+	"phoenix/minecraft/protocol/login"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// liveTokenLifetime is the time a Live Connect access token issued by a Server is valid for, and
+	// xblTokenLifetime the time device and XBOX Live tokens are valid for.
+	liveTokenLifetime = time.Hour
+	xblTokenLifetime  = time.Hour * 16
+	// chainLifetime is the time the tokens in a Minecraft login chain issued by a Server are valid for.
+	chainLifetime = time.Hour * 24
+	// minecraftRelyingParty is the relying party of the XBOX Live tokens accepted when requesting a chain.
+	minecraftRelyingParty = "https://multiplayer.minecraft.net/"
+	// androidTitleID is the title ID set in the identity data of chains, which is that of Android devices.
+	androidTitleID = "1739947436"
+)
+
+// Server is a fake identity provider running on a local HTTP server. It verifies the requests made to it
+// like the real services do, including the signatures of requests to XBOX Live, and issues tokens for a
+// single player.
+type Server struct {
+	// RootKey is the key that the first token of the Minecraft login chains issued is signed with.
+	RootKey *ecdsa.PrivateKey
+	// Identity is the identity data of the player that logs in at the Server.
+	Identity login.IdentityData
+	// ClockOffset is added to the current time when issuing login chains, to simulate an identity provider of
+	// which the clock is off.
+	ClockOffset time.Duration
+
+	srv *httptest.Server
+
+	mu sync.Mutex
+	// deviceCodes, access and refresh hold the device codes and Live Connect tokens that were issued and not
+	// revoked. The access tokens map to the time they expire.
+	deviceCodes map[string]struct{}
+	access      map[string]time.Time
+	refresh     map[string]struct{}
+	// devices maps device tokens to the proof key they are bound to, and xbl maps XBOX Live tokens to the
+	// relying party they were issued for.
+	devices  map[string]*ecdsa.PublicKey
+	xbl      map[string]string
+	requests map[string]int
+}
+
+// NewServer starts a Server at which devices log in as the player with the display name and XUID passed. The
+// Server must be closed using Close once done.
+func NewServer(displayName, xuid string) *Server {
+	key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	s := &Server{
+		RootKey:     key,
+		Identity:    login.IdentityData{XUID: xuid, Identity: uuid.New().String(), DisplayName: displayName, TitleID: androidTitleID},
+		deviceCodes: make(map[string]struct{}),
+		access:      make(map[string]time.Time),
+		refresh:     make(map[string]struct{}),
+		devices:     make(map[string]*ecdsa.PublicKey),
+		xbl:         make(map[string]string),
+		requests:    make(map[string]int),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth20_connect.srf", s.handleDeviceCode)
+	mux.HandleFunc("/oauth20_token.srf", s.handleToken)
+	mux.HandleFunc("/device/authenticate", s.handleDevice)
+	mux.HandleFunc("/authorize", s.handleAuthorize)
+	mux.HandleFunc("/authentication", s.handleChain)
+	s.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests[r.URL.Path]++
+		s.mu.Unlock()
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	return s
+}
+
+// Provider returns an auth.Provider that requests tokens from the Server.
+func (s *Server) Provider() *auth.Provider {
+	return &auth.Provider{
+		Endpoints: auth.Endpoints{
+			LiveDeviceCode: s.srv.URL + "/oauth20_connect.srf",
+			LiveToken:      s.srv.URL + "/oauth20_token.srf",
+			XBLDevice:      s.srv.URL + "/device/authenticate",
+			XBLAuthorize:   s.srv.URL + "/authorize",
+			MinecraftChain: s.srv.URL + "/authentication",
+		},
+		Client:  s.srv.Client(),
+		RootKey: &s.RootKey.PublicKey,
+	}
+}
+
+// Requests returns the amount of requests made to the endpoint with the URL passed, which is one of the
+// Endpoints of the auth.Provider returned by Provider.
+func (s *Server) Requests(endpoint string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[strings.TrimPrefix(endpoint, s.srv.URL)]
+}
+
+// Revoke revokes all tokens issued so far, as happens when the player changes its password. Logging in again
+// requires device auth.
+func (s *Server) Revoke() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.access = make(map[string]time.Time)
+	s.refresh = make(map[string]struct{})
+	s.devices = make(map[string]*ecdsa.PublicKey)
+	s.xbl = make(map[string]string)
+}
+
+// Close shuts down the Server.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// handleDeviceCode starts device auth. The device code returned may be polled for a token right away.
+func (s *Server) handleDeviceCode(w http.ResponseWriter, r *http.Request) {
+	if r.PostFormValue("response_type") != "device_code" {
+		http.Error(w, "unsupported response type", http.StatusBadRequest)
+		return
+	}
+	code := uuid.New().String()
+	s.mu.Lock()
+	s.deviceCodes[code] = struct{}{}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"user_code":        "FAKECODE",
+		"device_code":      code,
+		"verification_uri": s.srv.URL + "/link",
+		"interval":         1,
+		"expiresIn":        900,
+	})
+}
+
+// handleToken issues a Live Connect token in exchange for a device code or a refresh token. Refresh tokens
+// may only be used once.
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.PostFormValue("grant_type") {
+	case "urn:ietf:params:oauth:grant-type:device_code":
+		code := r.PostFormValue("device_code")
+		if _, ok := s.deviceCodes[code]; !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "expired_token"})
+			return
+		}
+		delete(s.deviceCodes, code)
+	case "refresh_token":
+		token := r.PostFormValue("refresh_token")
+		if _, ok := s.refresh[token]; !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		delete(s.refresh, token)
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+	access, refresh := uuid.New().String(), uuid.New().String()
+	s.access[access] = time.Now().Add(liveTokenLifetime)
+	s.refresh[refresh] = struct{}{}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"user_id":       s.Identity.XUID,
+		"token_type":    "bearer",
+		"scope":         r.PostFormValue("scope"),
+		"access_token":  access,
+		"refresh_token": refresh,
+		"expires_in":    int(liveTokenLifetime / time.Second),
+	})
+}
+
+// handleDevice issues a device token bound to the proof key in the request, which must be signed using it.
+func (s *Server) handleDevice(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Properties struct {
+			ProofKey proofKey
+		}
+	}
+	key, ok := readSigned(w, r, func(body []byte) (*ecdsa.PublicKey, error) {
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return req.Properties.ProofKey.publicKey()
+	})
+	if !ok {
+		return
+	}
+	token := uuid.New().String()
+	s.mu.Lock()
+	s.devices[token] = key
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"IssueInstant": time.Now(),
+		"NotAfter":     time.Now().Add(xblTokenLifetime),
+		"Token":        token,
+	})
+}
+
+// handleAuthorize issues an XBOX Live token in exchange for a Live Connect token and a device token. The
+// request must be signed using the proof key that the device token is bound to.
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		AccessToken  string
+		DeviceToken  string `json:"deviceToken"`
+		RelyingParty string
+		ProofKey     proofKey
+	}
+	key, ok := readSigned(w, r, func(body []byte) (*ecdsa.PublicKey, error) {
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return req.ProofKey.publicKey()
+	})
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if expiry, ok := s.access[strings.TrimPrefix(req.AccessToken, "t=")]; !ok || time.Now().After(expiry) {
+		http.Error(w, "invalid access token", http.StatusUnauthorized)
+		return
+	}
+	if device, ok := s.devices[req.DeviceToken]; !ok || !device.Equal(key) {
+		http.Error(w, "invalid device token", http.StatusUnauthorized)
+		return
+	}
+	token := uuid.New().String()
+	s.xbl[token] = req.RelyingParty
+
+	resp := auth.XBLToken{}
+	resp.AuthorizationToken.Token = token
+	resp.AuthorizationToken.NotAfter = time.Now().Add(xblTokenLifetime)
+	resp.AuthorizationToken.DisplayClaims.UserInfo = append(resp.AuthorizationToken.DisplayClaims.UserInfo, struct {
+		GamerTag string `json:"gtg"`
+		XUID     string `json:"xid"`
+		UserHash string `json:"uhs"`
+	}{GamerTag: s.Identity.DisplayName, XUID: s.Identity.XUID, UserHash: s.userHash()})
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleChain issues a Minecraft login chain for the identity public key in the request, in exchange for an
+// XBOX Live token for the Minecraft relying party.
+func (s *Server) handleChain(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	rp, ok := s.xbl[strings.TrimPrefix(r.Header.Get("Authorization"), "XBL3.0 x="+s.userHash()+";")]
+	s.mu.Unlock()
+	if !ok || rp != minecraftRelyingParty {
+		http.Error(w, "invalid XBOX Live token", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		IdentityPublicKey string `json:"identityPublicKey"`
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := login.ParsePublicKey(req.IdentityPublicKey, new(ecdsa.PublicKey)); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	chain, err := s.chain(req.IdentityPublicKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"chain": chain})
+}
+
+// chain returns a login chain for the identity public key passed. Like the chains Mojang issues, it consists
+// of a token signed by the root key that delegates to an intermediate key, and a token signed by that key
+// holding the identity data of the player.
+func (s *Server) chain(identityPublicKey string) ([]string, error) {
+	intermediate, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	now := time.Now().Add(s.ClockOffset)
+	claims := jwt.Claims{
+		Issuer:    "Mojang",
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now.Add(-time.Minute)),
+		Expiry:    jwt.NewNumericDate(now.Add(chainLifetime)),
+	}
+	first, err := sign(s.RootKey, map[string]interface{}{
+		"iss":                  claims.Issuer,
+		"iat":                  claims.IssuedAt,
+		"nbf":                  claims.NotBefore,
+		"exp":                  claims.Expiry,
+		"certificateAuthority": true,
+		"identityPublicKey":    login.MarshalPublicKey(&intermediate.PublicKey),
+	})
+	if err != nil {
+		return nil, err
+	}
+	second, err := sign(intermediate, map[string]interface{}{
+		"iss":               claims.Issuer,
+		"iat":               claims.IssuedAt,
+		"nbf":               claims.NotBefore,
+		"exp":               claims.Expiry,
+		"randomNonce":       now.UnixNano(),
+		"extraData":         s.Identity,
+		"identityPublicKey": identityPublicKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []string{first, second}, nil
+}
+
+// userHash returns the user hash of the player, which is part of the Authorization header of requests made
+// using an XBOX Live token.
+func (s *Server) userHash() string {
+	return "uhs" + s.Identity.XUID
+}
+
+// sign returns a compact JWT with the claims passed, signed by the key passed, which is set in its x5u header.
+func sign(key *ecdsa.PrivateKey, claims interface{}) (string, error) {
+	signer, err := jose.NewSigner(jose.SigningKey{Key: key, Algorithm: jose.ES384}, &jose.SignerOptions{
+		ExtraHeaders: map[jose.HeaderKey]interface{}{"x5u": login.MarshalPublicKey(&key.PublicKey)},
+	})
+	if err != nil {
+		return "", err
+	}
+	return jwt.Signed(signer).Claims(claims).CompactSerialize()
+}
+
+// proofKey is the JSON web key that requests to XBOX Live are signed with.
+type proofKey struct {
+	Crv, Alg, Use, Kty string
+	X, Y               string
+}
+
+// publicKey returns the P-256 public key described by the proof key.
+func (k proofKey) publicKey() (*ecdsa.PublicKey, error) {
+	if k.Crv != "P-256" || k.Alg != "ES256" || k.Kty != "EC" {
+		return nil, fmt.Errorf("unsupported proof key %v/%v/%v", k.Kty, k.Crv, k.Alg)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("proof key x: %w", err)
+	}
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil {
+		return nil, fmt.Errorf("proof key y: %w", err)
+	}
+	key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	if !key.Curve.IsOnCurve(key.X, key.Y) {
+		return nil, fmt.Errorf("proof key is not on curve P-256")
+	}
+	return key, nil
+}
+
+// readSigned reads the body of a request to XBOX Live and verifies its Signature header using the key that
+// the function passed obtains from the body, and returns that key. If the request is invalid, an error
+// response is written and readSigned returns false.
+func readSigned(w http.ResponseWriter, r *http.Request, key func(body []byte) (*ecdsa.PublicKey, error)) (*ecdsa.PublicKey, bool) {
+	if r.Header.Get("x-xbl-contract-version") != "1" {
+		http.Error(w, "unsupported contract version", http.StatusBadRequest)
+		return nil, false
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	pub, err := key(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	if err := verifySignature(r, body, pub); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return nil, false
+	}
+	return pub, true
+}
+
+// verifySignature verifies the Signature header of a request with the body passed. The signature covers the
+// signature policy, a timestamp, the method, path, Authorization header and body of the request.
+func verifySignature(r *http.Request, body []byte, key *ecdsa.PublicKey) error {
+	sig, err := base64.StdEncoding.DecodeString(r.Header.Get("Signature"))
+	if err != nil {
+		return fmt.Errorf("decode signature: %w", err)
+	}
+	if len(sig) != 12+64 || binary.BigEndian.Uint32(sig[:4]) != 1 {
+		return fmt.Errorf("malformed signature of %v bytes", len(sig))
+	}
+	hash := sha256.New()
+	hash.Write([]byte{0, 0, 0, 1, 0})
+	hash.Write(sig[4:12])
+	hash.Write([]byte{0})
+	for _, part := range []string{r.Method, r.URL.Path + r.URL.RawQuery, r.Header.Get("Authorization"), string(body)} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	rs, ss := new(big.Int).SetBytes(sig[12:44]), new(big.Int).SetBytes(sig[44:])
+	if !ecdsa.Verify(key, hash.Sum(nil), rs, ss) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+// writeJSON writes the value passed as a JSON response with the status passed.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
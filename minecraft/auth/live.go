@@ -4,9 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/microsoft"
 	"io"
-	"net/http"
 	"net/url"
 	"os"
 	"time"
@@ -15,13 +13,20 @@ import (
 // TokenSource holds an oauth2.TokenSource which uses device auth to get a code. The user authenticates using
 // a code. TokenSource prints the authentication code and URL to os.Stdout. To use a different io.Writer, use
 // WriterTokenSource. TokenSource automatically refreshes tokens.
-var TokenSource oauth2.TokenSource = &tokenSource{w: os.Stdout}
+var TokenSource oauth2.TokenSource = &tokenSource{w: os.Stdout, p: defaultProvider}
 
 // WriterTokenSource returns a new oauth2.TokenSource which, like TokenSource, uses device auth to get a code.
 // Unlike TokenSource, WriterTokenSource allows passing an io.Writer to which information on the auth URL and
 // code are printed. WriterTokenSource automatically refreshes tokens.
 func WriterTokenSource(w io.Writer) oauth2.TokenSource {
-	return &tokenSource{w: w}
+	return defaultProvider.TokenSource(w)
+}
+
+// TokenSource returns a new oauth2.TokenSource which, like WriterTokenSource, uses device auth to get a code
+// that is printed to the io.Writer passed. The token source requests tokens from the Endpoints of the
+// Provider.
+func (p *Provider) TokenSource(w io.Writer) oauth2.TokenSource {
+	return &tokenSource{w: w, p: p}
 }
 
 // tokenSource implements the oauth2.TokenSource interface. It provides a method to get an oauth2.Token using
@@ -29,16 +34,17 @@ func WriterTokenSource(w io.Writer) oauth2.TokenSource {
 type tokenSource struct {
 	w io.Writer
 	t *oauth2.Token
+	p *Provider
 }
 
 // Token attempts to return a Live Connect token using the RequestLiveToken function.
 func (src *tokenSource) Token() (*oauth2.Token, error) {
 	if src.t == nil {
-		t, err := RequestLiveTokenWriter(src.w)
+		t, err := src.p.RequestLiveTokenWriter(src.w)
 		src.t = t
 		return t, err
 	}
-	tok, err := refreshToken(src.t)
+	tok, err := src.p.refreshToken(src.t)
 	if err != nil {
 		return nil, err
 	}
@@ -51,7 +57,7 @@ func (src *tokenSource) Token() (*oauth2.Token, error) {
 // refreshes the token everytime it expires. Note that this function must be used over oauth2.ReuseTokenSource
 // due to that function not refreshing with the correct scopes.
 func RefreshTokenSource(t *oauth2.Token) oauth2.TokenSource {
-	return oauth2.ReuseTokenSource(t, &tokenSource{w: os.Stdout, t: t})
+	return oauth2.ReuseTokenSource(t, &tokenSource{w: os.Stdout, t: t, p: defaultProvider})
 }
 
 // RequestLiveToken does a login request for Microsoft Live Connect using device auth. A login URL will be
@@ -65,7 +71,13 @@ func RequestLiveToken() (*oauth2.Token, error) {
 // be printed to the io.Writer passed with a user code which the user must use to submit.
 // Once fully authenticated, an oauth2 token is returned which may be used to login to XBOX Live.
 func RequestLiveTokenWriter(w io.Writer) (*oauth2.Token, error) {
-	d, err := startDeviceAuth()
+	return defaultProvider.RequestLiveTokenWriter(w)
+}
+
+// RequestLiveTokenWriter does a login request for Microsoft Live Connect using device auth, like the
+// RequestLiveTokenWriter function, at the Endpoints of the Provider.
+func (p *Provider) RequestLiveTokenWriter(w io.Writer) (*oauth2.Token, error) {
+	d, err := p.startDeviceAuth()
 	if err != nil {
 		return nil, err
 	}
@@ -74,7 +86,7 @@ func RequestLiveTokenWriter(w io.Writer) (*oauth2.Token, error) {
 	defer ticker.Stop()
 
 	for range ticker.C {
-		t, err := pollDeviceAuth(d.DeviceCode)
+		t, err := p.pollDeviceAuth(d.DeviceCode)
 		if err != nil {
 			return nil, fmt.Errorf("error polling for device auth: %w", err)
 		}
@@ -90,20 +102,20 @@ func RequestLiveTokenWriter(w io.Writer) (*oauth2.Token, error) {
 
 // startDeviceAuth starts the device auth, retrieving a login URI for the user and a code the user needs to
 // enter.
-func startDeviceAuth() (*deviceAuthConnect, error) {
-	resp, err := http.PostForm("https://login.live.com/oauth20_connect.srf", url.Values{
+func (p *Provider) startDeviceAuth() (*deviceAuthConnect, error) {
+	resp, err := p.client().PostForm(p.Endpoints.LiveDeviceCode, url.Values{
 		"client_id":     {"0000000048183522"},
 		"scope":         {"service::user.auth.xboxlive.com::MBI_SSL"},
 		"response_type": {"device_code"},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("POST https://login.live.com/oauth20_connect.srf: %w", err)
+		return nil, fmt.Errorf("POST %v: %w", p.Endpoints.LiveDeviceCode, err)
 	}
 	defer func() {
 		_ = resp.Body.Close()
 	}()
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("POST https://login.live.com/oauth20_connect.srf: %v", resp.Status)
+		return nil, fmt.Errorf("POST %v: %v", p.Endpoints.LiveDeviceCode, resp.Status)
 	}
 	data := new(deviceAuthConnect)
 	return data, json.NewDecoder(resp.Body).Decode(data)
@@ -111,18 +123,18 @@ func startDeviceAuth() (*deviceAuthConnect, error) {
 
 // pollDeviceAuth polls the token endpoint for the device code. A token is returned if the user authenticated
 // successfully. If the user has not yet authenticated, err is nil but the token is nil too.
-func pollDeviceAuth(deviceCode string) (t *oauth2.Token, err error) {
-	resp, err := http.PostForm(microsoft.LiveConnectEndpoint.TokenURL, url.Values{
+func (p *Provider) pollDeviceAuth(deviceCode string) (t *oauth2.Token, err error) {
+	resp, err := p.client().PostForm(p.Endpoints.LiveToken, url.Values{
 		"client_id":   {"0000000048183522"},
 		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
 		"device_code": {deviceCode},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("POST https://login.live.com/oauth20_token.srf: %w", err)
+		return nil, fmt.Errorf("POST %v: %w", p.Endpoints.LiveToken, err)
 	}
 	poll := new(deviceAuthPoll)
 	if err := json.NewDecoder(resp.Body).Decode(poll); err != nil {
-		return nil, fmt.Errorf("POST https://login.live.com/oauth20_token.srf: json decode: %w", err)
+		return nil, fmt.Errorf("POST %v: json decode: %w", p.Endpoints.LiveToken, err)
 	}
 	_ = resp.Body.Close()
 	if poll.Error == "authorization_pending" {
@@ -140,25 +152,28 @@ func pollDeviceAuth(deviceCode string) (t *oauth2.Token, err error) {
 
 // refreshToken refreshes the oauth2.Token passed and returns a new oauth2.Token. An error is returned if
 // refreshing was not successful.
-func refreshToken(t *oauth2.Token) (*oauth2.Token, error) {
+func (p *Provider) refreshToken(t *oauth2.Token) (*oauth2.Token, error) {
 	// This function unfortunately needs to exist because golang.org/x/oauth2 does not pass the scope to this
 	// request, which Microsoft Connect enforces.
-	resp, err := http.PostForm(microsoft.LiveConnectEndpoint.TokenURL, url.Values{
+	resp, err := p.client().PostForm(p.Endpoints.LiveToken, url.Values{
 		"client_id":     {"0000000048183522"},
 		"scope":         {"service::user.auth.xboxlive.com::MBI_SSL"},
 		"grant_type":    {"refresh_token"},
 		"refresh_token": {t.RefreshToken},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("POST https://login.live.com/oauth20_token.srf: %w", err)
+		return nil, fmt.Errorf("POST %v: %w", p.Endpoints.LiveToken, err)
 	}
 	poll := new(deviceAuthPoll)
 	if err := json.NewDecoder(resp.Body).Decode(poll); err != nil {
-		return nil, fmt.Errorf("POST https://login.live.com/oauth20_token.srf: json decode: %w", err)
+		return nil, fmt.Errorf("POST %v: json decode: %w", p.Endpoints.LiveToken, err)
 	}
 	_ = resp.Body.Close()
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("POST https://login.live.com/oauth20_token.srf: refresh error: %v", poll.Error)
+		if poll.Error == "invalid_grant" {
+			return nil, fmt.Errorf("POST %v: refresh error: %v: %w", p.Endpoints.LiveToken, poll.Error, ErrTokenRevoked)
+		}
+		return nil, fmt.Errorf("POST %v: refresh error: %v", p.Endpoints.LiveToken, poll.Error)
 	}
 	return &oauth2.Token{
 		AccessToken:  poll.AccessToken,
@@ -12,19 +12,22 @@ import (
 	"strings"
 )
 
-// minecraftAuthURL is the URL that an authentication request is made to to get an encoded JWT claim chain.
-const minecraftAuthURL = `https://multiplayer.minecraft.net/authentication`
-
 // RequestMinecraftChain requests a fully processed Minecraft JWT chain using the XSTS token passed, and the
 // ECDSA private key of the client. This key will later be used to initialise encryption, and must be saved
 // for when packets need to be decrypted/encrypted.
 func RequestMinecraftChain(ctx context.Context, token *XBLToken, key *ecdsa.PrivateKey) (string, error) {
+	return defaultProvider.RequestMinecraftChain(ctx, token, key)
+}
+
+// RequestMinecraftChain requests a fully processed Minecraft JWT chain, like the RequestMinecraftChain
+// function, at the Endpoints of the Provider.
+func (p *Provider) RequestMinecraftChain(ctx context.Context, token *XBLToken, key *ecdsa.PrivateKey) (string, error) {
 	data, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
 
 	// The body of the requests holds a JSON object with one key in it, the 'identityPublicKey', which holds
 	// the public key data of the private key passed.
 	body := `{"identityPublicKey":"` + base64.StdEncoding.EncodeToString(data) + `"}`
-	request, _ := http.NewRequestWithContext(ctx, "POST", minecraftAuthURL, strings.NewReader(body))
+	request, _ := http.NewRequestWithContext(ctx, "POST", p.Endpoints.MinecraftChain, strings.NewReader(body))
 	request.Header.Set("Content-Type", "application/json")
 
 	// The Authorization header is important in particular. It is composed of the 'uhs' found in the XSTS
@@ -33,16 +36,16 @@ func RequestMinecraftChain(ctx context.Context, token *XBLToken, key *ecdsa.Priv
 	request.Header.Set("User-Agent", "MCPE/Android")
 	request.Header.Set("Client-Version", protocol.CurrentVersion)
 
-	c := &http.Client{}
+	c := p.client()
 	resp, err := c.Do(request)
 	if err != nil {
-		return "", fmt.Errorf("POST %v: %v", minecraftAuthURL, err)
+		return "", fmt.Errorf("POST %v: %v", p.Endpoints.MinecraftChain, err)
 	}
 	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("POST %v: %v", minecraftAuthURL, resp.Status)
+		_ = resp.Body.Close()
+		return "", fmt.Errorf("POST %v: %v", p.Endpoints.MinecraftChain, resp.Status)
 	}
 	data, err = ioutil.ReadAll(resp.Body)
 	_ = resp.Body.Close()
-	c.CloseIdleConnections()
 	return string(data), err
 }
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"golang.org/x/oauth2/microsoft"
+	"net/http"
+)
+
+// Endpoints holds the URLs of the services that a Provider requests tokens from.
+type Endpoints struct {
+	// LiveDeviceCode is the URL at which device auth is started, and LiveToken the URL at which Live Connect
+	// tokens are polled for and refreshed.
+	LiveDeviceCode, LiveToken string
+	// XBLDevice is the URL at which XBOX Live device tokens are requested, and XBLAuthorize the URL at which
+	// XBOX Live tokens are requested using a Live Connect token and a device token.
+	XBLDevice, XBLAuthorize string
+	// MinecraftChain is the URL at which the Minecraft login chain is requested using an XBOX Live token.
+	MinecraftChain string
+}
+
+// DefaultEndpoints holds the URLs of the Microsoft, XBOX Live and Minecraft services.
+var DefaultEndpoints = Endpoints{
+	LiveDeviceCode: "https://login.live.com/oauth20_connect.srf",
+	LiveToken:      microsoft.LiveConnectEndpoint.TokenURL,
+	XBLDevice:      "https://device.auth.xboxlive.com/device/authenticate",
+	XBLAuthorize:   "https://sisu.xboxlive.com/authorize",
+	MinecraftChain: "https://multiplayer.minecraft.net/authentication",
+}
+
+// Provider requests tokens from the services at its Endpoints. The functions and token sources of the auth
+// package use a Provider with the DefaultEndpoints. Providers with other Endpoints may be used to log in at
+// a different identity provider, such as the fake provider of the authtest package in tests.
+type Provider struct {
+	Endpoints Endpoints
+	// Client is the http.Client used for all requests. If nil, requests to XBOX Live use a client that allows
+	// the TLS renegotiation those services need, and other requests use http.DefaultClient.
+	Client *http.Client
+	// RootKey is the key that the Minecraft login chains obtained at Endpoints.MinecraftChain are signed with.
+	// If nil, the chains are expected to be signed by Mojang.
+	RootKey *ecdsa.PublicKey
+}
+
+// defaultProvider is the Provider used by the functions of the auth package.
+var defaultProvider = &Provider{Endpoints: DefaultEndpoints}
+
+// client returns the http.Client used for requests to the Microsoft Live and Minecraft services.
+func (p *Provider) client() *http.Client {
+	if p.Client != nil {
+		return p.Client
+	}
+	return http.DefaultClient
+}
@@ -0,0 +1,405 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/oauth2"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// refreshMargin is the time before a token expires at which it is no longer used, but replaced by a new one.
+const refreshMargin = time.Minute * 5
+
+// ErrTokenRevoked is returned when a refresh token is rejected because it expired or was revoked. The user
+// has to log in using device auth again.
+var ErrTokenRevoked = errors.New("refresh token expired or was revoked")
+
+// XBLTokenSource is an oauth2.TokenSource that also provides XBOX Live tokens itself, for example from a
+// cache. A minecraft.Dialer uses XBLToken rather than RequestXBLToken if its TokenSource implements it.
+type XBLTokenSource interface {
+	oauth2.TokenSource
+	// XBLToken returns an XBOX Live token for the relying party passed.
+	XBLToken(ctx context.Context, relyingParty string) (*XBLToken, error)
+	// InvalidateXBL drops the XBOX Live token for the relying party passed, for example because it was
+	// rejected, so that the next call to XBLToken requests a new one.
+	InvalidateXBL(relyingParty string) error
+}
+
+// TokenStore saves the tokens of one or more named accounts to a file, so that logging in using device auth
+// is only needed the first time an account is used. Next to the Live Connect token and the refresh token
+// that comes with it, the tokens derived from it are saved: The device token, the key it is bound to and the
+// XBOX Live tokens for every relying party, which saves several requests every time a connection is made.
+// Because the tokens grant access to the accounts, the file is only readable by the current user.
+// A TokenStore is safe for concurrent use, but a file must not be used by several processes at once.
+type TokenStore struct {
+	path string
+	w    io.Writer
+	p    *Provider
+
+	mu       sync.Mutex
+	accounts map[string]*storedAccount
+	// locks holds a mutex per account, held while tokens of the account are requested, so that an account
+	// does not request the same token twice at once.
+	locks map[string]*sync.Mutex
+}
+
+// storedAccount holds the tokens of an account in a TokenStore. Its fields are never modified: The tokens of
+// an account are changed by replacing the storedAccount.
+type storedAccount struct {
+	Live *oauth2.Token `json:"live,omitempty"`
+	// ProofKey is the DER encoded private key that the device token and XBOX Live tokens are bound to.
+	ProofKey []byte               `json:"proof_key,omitempty"`
+	Device   *deviceToken         `json:"device,omitempty"`
+	XBL      map[string]*XBLToken `json:"xbl,omitempty"`
+}
+
+// OpenTokenStore opens the TokenStore saved in the file at the path passed. If the file does not exist, it
+// is created once the first token is saved. Device auth codes are printed to os.Stdout. To print them to a
+// different io.Writer, use OpenTokenStoreWriter.
+func OpenTokenStore(path string) (*TokenStore, error) {
+	return OpenTokenStoreWriter(path, os.Stdout)
+}
+
+// OpenTokenStoreWriter opens the TokenStore saved in the file at the path passed, like OpenTokenStore, but
+// prints device auth codes to the io.Writer passed.
+func OpenTokenStoreWriter(path string, w io.Writer) (*TokenStore, error) {
+	return defaultProvider.OpenTokenStore(path, w)
+}
+
+// OpenTokenStore opens the TokenStore saved in the file at the path passed, like OpenTokenStoreWriter. The
+// accounts of the TokenStore request their tokens from the Endpoints of the Provider.
+func (p *Provider) OpenTokenStore(path string, w io.Writer) (*TokenStore, error) {
+	s := &TokenStore{path: path, w: w, p: p, accounts: make(map[string]*storedAccount), locks: make(map[string]*sync.Mutex)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("read token store: %w", err)
+	}
+	var f struct {
+		Accounts map[string]*storedAccount `json:"accounts"`
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("decode token store %v: %w", path, err)
+	}
+	for name, acc := range f.Accounts {
+		if acc != nil {
+			s.accounts[name] = acc
+		}
+	}
+	return s, nil
+}
+
+// Account returns the account with the name passed. If the store holds no tokens for it yet, they are
+// obtained once a token is first requested.
+func (s *TokenStore) Account(name string) *Account {
+	return &Account{s: s, name: name}
+}
+
+// Accounts returns the names of all accounts that the store holds tokens for, sorted alphabetically.
+func (s *TokenStore) Accounts() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.accounts))
+	for name := range s.accounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Refresh refreshes the tokens of all accounts that expire within the duration passed, so that they remain
+// valid until then without the delay of refreshing them when a connection is made. Accounts that would need
+// to log in using device auth again are left alone. The first error encountered is returned after all
+// accounts were refreshed.
+func (s *TokenStore) Refresh(ctx context.Context, within time.Duration) error {
+	var first error
+	for _, name := range s.Accounts() {
+		if err := s.Account(name).refresh(ctx, within); err != nil && first == nil {
+			first = fmt.Errorf("refresh account %v: %w", name, err)
+		}
+	}
+	return first
+}
+
+// get returns the tokens stored for the account passed, or an empty storedAccount if there are none.
+func (s *TokenStore) get(name string) storedAccount {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if acc, ok := s.accounts[name]; ok {
+		return *acc
+	}
+	return storedAccount{}
+}
+
+// update calls f with a copy of the tokens stored for the account passed, stores the copy and saves the
+// store to its file.
+func (s *TokenStore) update(name string, f func(acc *storedAccount)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acc := storedAccount{}
+	if old, ok := s.accounts[name]; ok {
+		acc = *old
+	}
+	f(&acc)
+	s.accounts[name] = &acc
+	return s.save()
+}
+
+// remove drops all tokens of the account passed and saves the store to its file.
+func (s *TokenStore) remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.accounts, name)
+	return s.save()
+}
+
+// lock returns the mutex held while tokens of the account passed are requested.
+func (s *TokenStore) lock(name string) *sync.Mutex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.locks[name]
+	if !ok {
+		l = new(sync.Mutex)
+		s.locks[name] = l
+	}
+	return l
+}
+
+// save writes the store to its file. The file is replaced atomically, so that it is never left half written,
+// and is only readable and writable by the current user. s.mu must be held.
+func (s *TokenStore) save() error {
+	data, err := json.MarshalIndent(map[string]interface{}{"accounts": s.accounts}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode token store: %w", err)
+	}
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("save token store: %w", err)
+	}
+	// TempFile creates files with permissions 0600, which the file keeps once renamed.
+	f, err := ioutil.TempFile(dir, filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("save token store: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(f.Name())
+	}()
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("save token store: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("save token store: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("save token store: %w", err)
+	}
+	if err := os.Rename(f.Name(), s.path); err != nil {
+		return fmt.Errorf("save token store: %w", err)
+	}
+	return nil
+}
+
+// Account is a named account in a TokenStore. It implements XBLTokenSource, so that it may be used as the
+// TokenSource of a minecraft.Dialer. Tokens are refreshed once they are about to expire, and new tokens are
+// saved to the store right away.
+type Account struct {
+	s    *TokenStore
+	name string
+}
+
+// Name returns the name of the account.
+func (a *Account) Name() string {
+	return a.name
+}
+
+// Token returns the Live Connect token of the account. If the account has no token yet, or its refresh token
+// was revoked, the user is asked to log in using device auth.
+func (a *Account) Token() (*oauth2.Token, error) {
+	l := a.s.lock(a.name)
+	l.Lock()
+	defer l.Unlock()
+	return a.liveToken(refreshMargin, true)
+}
+
+// XBLToken returns an XBOX Live token of the account for the relying party passed, requesting a new one if
+// the store holds none or the token held is about to expire.
+func (a *Account) XBLToken(ctx context.Context, relyingParty string) (*XBLToken, error) {
+	l := a.s.lock(a.name)
+	l.Lock()
+	defer l.Unlock()
+	return a.xblToken(ctx, relyingParty, refreshMargin, true)
+}
+
+// InvalidateXBL drops the XBOX Live token of the account for the relying party passed.
+func (a *Account) InvalidateXBL(relyingParty string) error {
+	l := a.s.lock(a.name)
+	l.Lock()
+	defer l.Unlock()
+	return a.s.update(a.name, func(acc *storedAccount) {
+		xbl := make(map[string]*XBLToken, len(acc.XBL))
+		for rp, t := range acc.XBL {
+			if rp != relyingParty {
+				xbl[rp] = t
+			}
+		}
+		acc.XBL = xbl
+	})
+}
+
+// Invalidate drops all tokens of the account from the store, so that the user has to log in using device auth
+// the next time a token is requested. Invalidate does not revoke the tokens themselves.
+func (a *Account) Invalidate() error {
+	l := a.s.lock(a.name)
+	l.Lock()
+	defer l.Unlock()
+	return a.s.remove(a.name)
+}
+
+// liveToken returns a Live Connect token that is valid for at least the duration passed, refreshing the token
+// stored if needed. If refreshing is not possible, the user logs in using device auth if interactive is true.
+// The lock of the account must be held.
+func (a *Account) liveToken(valid time.Duration, interactive bool) (*oauth2.Token, error) {
+	t := a.s.get(a.name).Live
+	if t != nil && t.Expiry.After(time.Now().Add(valid)) {
+		return t, nil
+	}
+	return a.renewLiveToken(interactive)
+}
+
+// renewLiveToken replaces the Live Connect token of the account by a new one, regardless of when the current
+// token expires. The lock of the account must be held.
+func (a *Account) renewLiveToken(interactive bool) (*oauth2.Token, error) {
+	t := a.s.get(a.name).Live
+	if t != nil && t.RefreshToken != "" {
+		refreshed, err := a.s.p.refreshToken(t)
+		if err == nil {
+			if refreshed.RefreshToken == "" {
+				refreshed.RefreshToken = t.RefreshToken
+			}
+			return refreshed, a.s.update(a.name, func(acc *storedAccount) {
+				acc.Live = refreshed
+			})
+		}
+		if !errors.Is(err, ErrTokenRevoked) {
+			return nil, err
+		}
+		// The tokens derived from a revoked token are dropped with it, as they belong to a session that has
+		// ended.
+		if err := a.s.remove(a.name); err != nil {
+			return nil, err
+		}
+	}
+	if !interactive {
+		return nil, fmt.Errorf("account %v must log in again", a.name)
+	}
+	_, _ = fmt.Fprintf(a.s.w, "Log in to account %v.\n", a.name)
+	t, err := a.s.p.RequestLiveTokenWriter(a.s.w)
+	if err != nil {
+		return nil, err
+	}
+	return t, a.s.update(a.name, func(acc *storedAccount) {
+		*acc = storedAccount{Live: t}
+	})
+}
+
+// xblToken returns an XBOX Live token for the relying party passed that is valid for at least the duration
+// passed. The device token and key stored are reused if possible. If XBOX Live rejects the tokens stored,
+// they are renewed once, and the user is only asked to log in if interactive is true. The lock of the account
+// must be held.
+func (a *Account) xblToken(ctx context.Context, relyingParty string, valid time.Duration, interactive bool) (*XBLToken, error) {
+	acc := a.s.get(a.name)
+	if t, ok := acc.XBL[relyingParty]; ok && t.AuthorizationToken.NotAfter.After(time.Now().Add(valid)) {
+		return t, nil
+	}
+	live, err := a.liveToken(refreshMargin, interactive)
+	if err != nil {
+		return nil, err
+	}
+	// Refreshing the Live token may have dropped the other tokens, so the account is read again.
+	acc = a.s.get(a.name)
+
+	var key *ecdsa.PrivateKey
+	if acc.ProofKey != nil {
+		if key, err = x509.ParseECPrivateKey(acc.ProofKey); err != nil {
+			return nil, fmt.Errorf("decode proof key of account %v: %w", a.name, err)
+		}
+	} else {
+		key, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	c := a.s.p.xblClient()
+	defer c.CloseIdleConnections()
+
+	device := acc.Device
+	cached := acc.ProofKey != nil && device != nil && device.NotAfter.After(time.Now().Add(valid))
+	if !cached {
+		if device, err = a.s.p.obtainDeviceToken(ctx, c, key); err != nil {
+			return nil, err
+		}
+	}
+	t, err := a.s.p.obtainXBLToken(ctx, c, key, live, device, relyingParty)
+	if errors.Is(err, errXBLRejected) && cached {
+		// The device token stored may have been revoked before it expired, so a new one is tried once.
+		if device, err = a.s.p.obtainDeviceToken(ctx, c, key); err != nil {
+			return nil, err
+		}
+		t, err = a.s.p.obtainXBLToken(ctx, c, key, live, device, relyingParty)
+	}
+	if errors.Is(err, errXBLRejected) {
+		// The Live Connect token may also have been revoked before it expired, so it is renewed once. Other
+		// errors, such as XBOX Live being unavailable, are returned as is, as a new token would not help.
+		if live, err = a.renewLiveToken(interactive); err != nil {
+			return nil, err
+		}
+		t, err = a.s.p.obtainXBLToken(ctx, c, key, live, device, relyingParty)
+	}
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("encode proof key: %w", err)
+	}
+	return t, a.s.update(a.name, func(acc *storedAccount) {
+		xbl := make(map[string]*XBLToken, len(acc.XBL)+1)
+		for rp, other := range acc.XBL {
+			xbl[rp] = other
+		}
+		xbl[relyingParty] = t
+		acc.ProofKey, acc.Device, acc.XBL = der, device, xbl
+	})
+}
+
+// refresh refreshes the Live Connect token and XBOX Live tokens of the account that expire within the
+// duration passed, without asking the user to log in.
+func (a *Account) refresh(ctx context.Context, within time.Duration) error {
+	if within < refreshMargin {
+		within = refreshMargin
+	}
+	l := a.s.lock(a.name)
+	l.Lock()
+	defer l.Unlock()
+	if _, err := a.liveToken(within, false); err != nil {
+		return err
+	}
+	for relyingParty := range a.s.get(a.name).XBL {
+		if _, err := a.xblToken(ctx, relyingParty, within, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"golang.org/x/oauth2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestTokenStore checks that tokens saved in a TokenStore are used without requesting new ones, survive
+// reopening the store and are dropped when invalidated. None of the tokens expire, so no requests are made.
+func TestTokenStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth", "tokens.json")
+	s, err := OpenTokenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	live := &oauth2.Token{AccessToken: "access", TokenType: "bearer", RefreshToken: "refresh", Expiry: time.Now().Add(time.Hour).Round(0)}
+	xbl := &XBLToken{}
+	xbl.AuthorizationToken.Token = "xsts"
+	xbl.AuthorizationToken.NotAfter = time.Now().Add(time.Hour).Round(0)
+	for _, name := range []string{"main", "alt"} {
+		if err := s.update(name, func(acc *storedAccount) {
+			acc.Live = live
+			acc.XBL = map[string]*XBLToken{"https://multiplayer.minecraft.net/": xbl}
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Fatalf("token store saved with permissions %v, expected %v", perm, os.FileMode(0600))
+		}
+	}
+
+	s, err = OpenTokenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := s.Accounts(); !reflect.DeepEqual(names, []string{"alt", "main"}) {
+		t.Fatalf("store holds accounts %v, expected [alt main]", names)
+	}
+	if err := s.Refresh(context.Background(), time.Minute); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	acc := s.Account("main")
+	tok, err := acc.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.AccessToken != live.AccessToken || tok.RefreshToken != live.RefreshToken || !tok.Expiry.Equal(live.Expiry) {
+		t.Fatalf("got Live token %+v, expected %+v", tok, live)
+	}
+	got, err := acc.XBLToken(context.Background(), "https://multiplayer.minecraft.net/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.AuthorizationToken.Token != "xsts" {
+		t.Fatalf("got XBOX Live token %+v, expected the stored token", got)
+	}
+
+	if err := acc.InvalidateXBL("https://multiplayer.minecraft.net/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Account("alt").Invalidate(); err != nil {
+		t.Fatal(err)
+	}
+	s, err = OpenTokenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := s.Accounts(); !reflect.DeepEqual(names, []string{"main"}) {
+		t.Fatalf("store holds accounts %v after invalidating alt, expected [main]", names)
+	}
+	if acc := s.get("main"); acc.Live == nil || len(acc.XBL) != 0 {
+		t.Fatalf("main has tokens %+v after invalidating its XBOX Live token", acc)
+	}
+}
+
+// TestRefreshXBLRejected checks that refreshing an account only renews its Live Connect token if XBOX Live
+// rejects it, and never asks the user to log in.
+func TestRefreshXBLRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		// renewals is the amount of times the Live Connect token is expected to be renewed.
+		renewals int
+		rejected bool
+	}{
+		{name: "unavailable", status: http.StatusServiceUnavailable},
+		{name: "unauthorized", status: http.StatusUnauthorized, renewals: 1, rejected: true},
+		{name: "forbidden", status: http.StatusForbidden, renewals: 1, rejected: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mu sync.Mutex
+			requests := make(map[string]int)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				requests[r.URL.Path]++
+				mu.Unlock()
+				switch r.URL.Path {
+				case "/token":
+					_ = json.NewEncoder(w).Encode(deviceAuthPoll{TokenType: "bearer", AccessToken: "renewed", RefreshToken: "refresh", ExpiresIn: 3600})
+				case "/device":
+					_ = json.NewEncoder(w).Encode(deviceToken{Token: "device", NotAfter: time.Now().Add(time.Hour)})
+				case "/authorize":
+					w.WriteHeader(test.status)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer srv.Close()
+			p := &Provider{
+				Endpoints: Endpoints{
+					LiveDeviceCode: srv.URL + "/devicecode",
+					LiveToken:      srv.URL + "/token",
+					XBLDevice:      srv.URL + "/device",
+					XBLAuthorize:   srv.URL + "/authorize",
+				},
+				Client: srv.Client(),
+			}
+			out := &bytes.Buffer{}
+			s, err := p.OpenTokenStore(filepath.Join(t.TempDir(), "tokens.json"), out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expired := &XBLToken{}
+			expired.AuthorizationToken.Token = "xsts"
+			expired.AuthorizationToken.NotAfter = time.Now().Add(-time.Minute)
+			if err := s.update("main", func(acc *storedAccount) {
+				acc.Live = &oauth2.Token{AccessToken: "access", TokenType: "bearer", RefreshToken: "refresh", Expiry: time.Now().Add(time.Hour)}
+				acc.XBL = map[string]*XBLToken{"https://multiplayer.minecraft.net/": expired}
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			err = s.Refresh(context.Background(), time.Minute)
+			if err == nil {
+				t.Fatal("refresh succeeded while XBOX Live failed")
+			}
+			if rejected := errors.Is(err, errXBLRejected); rejected != test.rejected {
+				t.Fatalf("refresh returned %v, expected rejected to be %v", err, test.rejected)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if n := requests["/token"]; n != test.renewals {
+				t.Fatalf("Live Connect token renewed %d times, expected %d", n, test.renewals)
+			}
+			if n := requests["/devicecode"]; n != 0 || out.Len() != 0 {
+				t.Fatalf("user asked to log in during refresh: %q", out.String())
+			}
+		})
+	}
+}
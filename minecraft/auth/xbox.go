@@ -11,6 +11,7 @@ import (
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"golang.org/x/oauth2"
@@ -18,6 +19,10 @@ import (
 	"time"
 )
 
+// errXBLRejected is returned when XBOX Live rejects the tokens a request for an XBOX Live token was made
+// with, rather than failing to handle the request.
+var errXBLRejected = errors.New("tokens rejected by XBOX Live")
+
 // XBLToken holds info on the authorization token used for authenticating with XBOX Live.
 type XBLToken struct {
 	AuthorizationToken struct {
@@ -29,6 +34,8 @@ type XBLToken struct {
 			} `json:"xui"`
 		}
 		Token string
+		// NotAfter is the time after which the token is no longer valid.
+		NotAfter time.Time
 	}
 }
 
@@ -40,30 +47,44 @@ func (t XBLToken) SetAuthHeader(r *http.Request) {
 
 // RequestXBLToken requests an XBOX Live auth token using the passed Live token pair.
 func RequestXBLToken(ctx context.Context, liveToken *oauth2.Token, relyingParty string) (*XBLToken, error) {
+	return defaultProvider.RequestXBLToken(ctx, liveToken, relyingParty)
+}
+
+// RequestXBLToken requests an XBOX Live auth token using the passed Live token pair, like the RequestXBLToken
+// function, at the Endpoints of the Provider.
+func (p *Provider) RequestXBLToken(ctx context.Context, liveToken *oauth2.Token, relyingParty string) (*XBLToken, error) {
 	if !liveToken.Valid() {
 		return nil, fmt.Errorf("live token is no longer valid")
 	}
-	c := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				Renegotiation:      tls.RenegotiateOnceAsClient,
-				InsecureSkipVerify: true,
-			},
-		},
-	}
+	c := p.xblClient()
 	defer c.CloseIdleConnections()
 
 	// We first generate an ECDSA private key which will be used to provide a 'ProofKey' to each of the
 	// requests, and to sign these requests.
 	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-	deviceToken, err := obtainDeviceToken(ctx, c, key)
+	deviceToken, err := p.obtainDeviceToken(ctx, c, key)
 	if err != nil {
 		return nil, err
 	}
-	return obtainXBLToken(ctx, c, key, liveToken, deviceToken, relyingParty)
+	return p.obtainXBLToken(ctx, c, key, liveToken, deviceToken, relyingParty)
 }
 
-func obtainXBLToken(ctx context.Context, c *http.Client, key *ecdsa.PrivateKey, liveToken *oauth2.Token, device *deviceToken, relyingParty string) (*XBLToken, error) {
+// xblClient returns the http.Client used for requests to the XBOX Live endpoints.
+func (p *Provider) xblClient() *http.Client {
+	if p.Client != nil {
+		return p.Client
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				Renegotiation:      tls.RenegotiateOnceAsClient,
+				InsecureSkipVerify: true,
+			},
+		},
+	}
+}
+
+func (p *Provider) obtainXBLToken(ctx context.Context, c *http.Client, key *ecdsa.PrivateKey, liveToken *oauth2.Token, device *deviceToken, relyingParty string) (*XBLToken, error) {
 	data, _ := json.Marshal(map[string]interface{}{
 		"AccessToken":       "t=" + liveToken.AccessToken,
 		"AppId":             "0000000048183522",
@@ -81,33 +102,38 @@ func obtainXBLToken(ctx context.Context, c *http.Client, key *ecdsa.PrivateKey,
 			"y":   base64.RawURLEncoding.EncodeToString(key.PublicKey.Y.Bytes()),
 		},
 	})
-	req, _ := http.NewRequestWithContext(ctx, "POST", "https://sisu.xboxlive.com/authorize", bytes.NewReader(data))
+	req, _ := http.NewRequestWithContext(ctx, "POST", p.Endpoints.XBLAuthorize, bytes.NewReader(data))
 	req.Header.Set("x-xbl-contract-version", "1")
 	sign(req, data, key)
 
 	resp, err := c.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("POST %v: %v", "https://sisu.xboxlive.com/authorize", err)
+		return nil, fmt.Errorf("POST %v: %v", p.Endpoints.XBLAuthorize, err)
 	}
 	defer func() {
 		_ = resp.Body.Close()
 	}()
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("POST %v: %v: %w", p.Endpoints.XBLAuthorize, resp.Status, errXBLRejected)
+	}
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("POST %v: %v", "https://sisu.xboxlive.com/authorize", resp.Status)
+		return nil, fmt.Errorf("POST %v: %v", p.Endpoints.XBLAuthorize, resp.Status)
 	}
 	info := new(XBLToken)
 	return info, json.NewDecoder(resp.Body).Decode(info)
 }
 
-// deviceToken is the token obtained by requesting a device token by posting to xblDeviceAuthURL. Its Token
+// deviceToken is the token obtained by requesting a device token by posting to Endpoints.XBLDevice. Its Token
 // field may be used in a request to obtain the XSTS token.
 type deviceToken struct {
 	Token string
+	// NotAfter is the time after which the token is no longer valid.
+	NotAfter time.Time
 }
 
 // obtainDeviceToken sends a POST request to the device auth endpoint using the ECDSA private key passed to
 // sign the request.
-func obtainDeviceToken(ctx context.Context, c *http.Client, key *ecdsa.PrivateKey) (token *deviceToken, err error) {
+func (p *Provider) obtainDeviceToken(ctx context.Context, c *http.Client, key *ecdsa.PrivateKey) (token *deviceToken, err error) {
 	data, _ := json.Marshal(map[string]interface{}{
 		"RelyingParty": "http://auth.xboxlive.com",
 		"TokenType":    "JWT",
@@ -126,19 +152,19 @@ func obtainDeviceToken(ctx context.Context, c *http.Client, key *ecdsa.PrivateKe
 			},
 		},
 	})
-	request, _ := http.NewRequestWithContext(ctx, "POST", "https://device.auth.xboxlive.com/device/authenticate", bytes.NewReader(data))
+	request, _ := http.NewRequestWithContext(ctx, "POST", p.Endpoints.XBLDevice, bytes.NewReader(data))
 	request.Header.Set("x-xbl-contract-version", "1")
 	sign(request, data, key)
 
 	resp, err := c.Do(request)
 	if err != nil {
-		return nil, fmt.Errorf("POST %v: %v", "https://device.auth.xboxlive.com/device/authenticate", err)
+		return nil, fmt.Errorf("POST %v: %v", p.Endpoints.XBLDevice, err)
 	}
 	defer func() {
 		_ = resp.Body.Close()
 	}()
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("POST %v: %v", "https://device.auth.xboxlive.com/device/authenticate", resp.Status)
+		return nil, fmt.Errorf("POST %v: %v", p.Endpoints.XBLDevice, resp.Status)
 	}
 	token = &deviceToken{}
 	return token, json.NewDecoder(resp.Body).Decode(token)
@@ -172,9 +198,12 @@ func sign(request *http.Request, body []byte, key *ecdsa.PrivateKey) {
 	hash.Write(body)
 	hash.Write([]byte{0})
 
-	// Sign the checksum produced, and combine the 'r' and 's' into a single signature.
+	// Sign the checksum produced, and combine the 'r' and 's' into a single signature. Both are padded to 32
+	// bytes, as they are split by their position in the signature.
 	r, s, _ := ecdsa.Sign(rand.Reader, key, hash.Sum(nil))
-	signature := append(r.Bytes(), s.Bytes()...)
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
 
 	// The signature begins with 12 bytes, the first being the signature policy version (0, 0, 0, 1) again,
 	// and the other 8 the timestamp again.
@@ -0,0 +1,130 @@
+package minecraft_test
+
+import (
+	"crypto/ecdsa"
+	"io/ioutil"
+	"path/filepath"
+	"phoenix/minecraft"
+	"phoenix/minecraft/auth/authtest"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// dialAccept dials the Listener passed using the Dialer passed and accepts and starts the game of the
+// connection on the server side. It returns the connections on the client and on the server side, which are
+// closed when the test ends.
+func dialAccept(t *testing.T, listener *minecraft.Listener, network string, dialer minecraft.Dialer) (client, server *minecraft.Conn) {
+	t.Helper()
+	accepted := make(chan *minecraft.Conn, 1)
+	go func() {
+		c, err := listener.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		conn := c.(*minecraft.Conn)
+		if err := conn.StartGameTimeout(minecraft.GameData{}, time.Second*5); err != nil {
+			_ = conn.Close()
+			close(accepted)
+			return
+		}
+		accepted <- conn
+	}()
+	client, err := dialer.DialTimeout(network, pipeAddress, time.Second*5)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	select {
+	case c, ok := <-accepted:
+		if !ok {
+			t.Fatal("accept failed")
+		}
+		t.Cleanup(func() {
+			_ = c.Close()
+		})
+		return client, c
+	case <-time.After(time.Second * 5):
+		t.Fatal("connection not accepted")
+	}
+	return nil, nil
+}
+
+// TestAuthFakeProvider logs in at a Listener trusting a fake identity provider, and checks that the identity
+// issued by the provider is used on both sides, that stored tokens are reused and that revoked tokens are
+// replaced by logging in again.
+func TestAuthFakeProvider(t *testing.T) {
+	fake := authtest.NewServer("Fake Player", "2535400000000001")
+	defer fake.Close()
+	provider := fake.Provider()
+
+	const network = "pipe-auth-fake"
+	listener := listenPipe(t, network, minecraft.ListenConfig{TrustedKeys: []*ecdsa.PublicKey{&fake.RootKey.PublicKey}})
+	store, err := provider.OpenTokenStore(filepath.Join(t.TempDir(), "tokens.json"), ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialer := minecraft.Dialer{TokenSource: store.Account("test"), AuthProvider: provider}
+
+	for i := 0; i < 2; i++ {
+		clientConn, serverConn := dialAccept(t, listener, network, dialer)
+		client, server := clientConn.IdentityData(), serverConn.IdentityData()
+		if server.XUID != fake.Identity.XUID || server.DisplayName != fake.Identity.DisplayName {
+			t.Fatalf("server got identity %+v, expected %+v", server, fake.Identity)
+		}
+		if client.XUID != fake.Identity.XUID || client.DisplayName != fake.Identity.DisplayName {
+			t.Fatalf("client got identity %+v, expected %+v", client, fake.Identity)
+		}
+	}
+	// The second login uses the stored Live and XBOX Live tokens and only requests a new chain.
+	for endpoint, expected := range map[string]int{
+		provider.Endpoints.LiveDeviceCode: 1,
+		provider.Endpoints.XBLDevice:      1,
+		provider.Endpoints.XBLAuthorize:   1,
+		provider.Endpoints.MinecraftChain: 2,
+	} {
+		if n := fake.Requests(endpoint); n != expected {
+			t.Fatalf("%d requests made to %v, expected %d", n, endpoint, expected)
+		}
+	}
+
+	fake.Revoke()
+	if client, _ := dialAccept(t, listener, network, dialer); client.IdentityData().XUID != fake.Identity.XUID {
+		t.Fatalf("client got identity %+v after revoking tokens, expected %+v", client.IdentityData(), fake.Identity)
+	}
+	if n := fake.Requests(provider.Endpoints.LiveDeviceCode); n != 2 {
+		t.Fatalf("%d device logins made after revoking tokens, expected 2", n)
+	}
+}
+
+// TestAuthUntrustedProvider checks that a Listener that does not trust the root key of a fake identity
+// provider rejects clients that logged in at it.
+func TestAuthUntrustedProvider(t *testing.T) {
+	fake := authtest.NewServer("Fake Player", "2535400000000002")
+	defer fake.Close()
+	provider := fake.Provider()
+
+	const network = "pipe-auth-untrusted"
+	rejected := make(chan minecraft.RejectReason, 1)
+	listenPipe(t, network, minecraft.ListenConfig{
+		LoginRejected: func(conn *minecraft.Conn, err *minecraft.LoginError) {
+			rejected <- err.Reason
+		},
+	})
+	var src oauth2.TokenSource = provider.TokenSource(ioutil.Discard)
+	conn, err := minecraft.Dialer{TokenSource: src, AuthProvider: provider}.DialTimeout(network, pipeAddress, time.Second*5)
+	if err == nil {
+		_ = conn.Close()
+		t.Fatal("listener accepted a login chain signed by an untrusted key")
+	}
+	if reason := <-rejected; reason != minecraft.RejectUnauthenticated {
+		t.Fatalf("login rejected for reason %v, expected %v", reason, minecraft.RejectUnauthenticated)
+	}
+	if n := fake.Requests(provider.Endpoints.MinecraftChain); n != 1 {
+		t.Fatalf("%d chains requested, expected 1", n)
+	}
+}
@@ -0,0 +1,102 @@
+// Package capture implements a file format for packet captures of Minecraft connections, along with a
+// Writer that records the packets of a connection using the PacketFunc of a minecraft.Dialer or
+// minecraft.ListenConfig, a Reader for reading captures back, and a replay Server that feeds the packets a
+// server sent in a capture to a client, so that sessions seen on live servers may be reproduced offline.
+//
+// A capture starts with the magic bytes "PHXC" and a little endian uint16 format version, followed by a list
+// of records until the end of the file. Each record is encoded as:
+//
+//	int64     timestamp, in nanoseconds since the Unix epoch
+//	uint32    ID of the connection the packet was sent over, starting at 1
+//	uint8     Direction of the packet
+//	varuint32 packet.Header
+//	uint32    length of the payload
+//	[]byte    payload
+//
+// All fixed size integers are little endian.
+package capture
+
+import (
+	"bytes"
+	"fmt"
+	"phoenix/minecraft/protocol"
+	"phoenix/minecraft/protocol/packet"
+	"time"
+)
+
+const (
+	// magic is written at the very start of every capture.
+	magic = "PHXC"
+	// version is the version of the capture format written.
+	version uint16 = 1
+	// maxPayloadSize is the maximum size of the payload of a record. Larger sizes are rejected when reading,
+	// so that a corrupted capture does not lead to huge allocations.
+	maxPayloadSize = 1 << 25
+)
+
+// Direction is the direction a captured packet was sent in.
+type Direction uint8
+
+const (
+	// ClientToServer is the direction of packets sent by the client to the server.
+	ClientToServer Direction = iota
+	// ServerToClient is the direction of packets sent by the server to the client.
+	ServerToClient
+)
+
+// String ...
+func (d Direction) String() string {
+	switch d {
+	case ClientToServer:
+		return "client->server"
+	case ServerToClient:
+		return "server->client"
+	}
+	return fmt.Sprintf("Direction(%d)", uint8(d))
+}
+
+// Record is a single packet recorded in a capture.
+type Record struct {
+	// Time is the time at which the packet was sent or received.
+	Time time.Time
+	// Conn is the ID of the connection the packet was sent over. A capture may hold the packets of several
+	// connections, for example when recording the connections of a minecraft.Listener.
+	Conn uint32
+	// Direction is the direction the packet was sent in.
+	Direction Direction
+	// Header is the header of the packet, holding its ID.
+	Header packet.Header
+	// Payload is the serialised packet, without its header.
+	Payload []byte
+}
+
+// Decode decodes the payload of the Record into a packet.Packet using the pool passed. Packets with an ID
+// not found in the pool are returned as a *packet.Unknown. shieldID is the runtime ID of the shield item as
+// found in the StartGame packet, which is needed to decode items correctly.
+// Decode returns an error if the payload was invalid or not fully read.
+func (r Record) Decode(pool packet.Pool, shieldID int32) (pk packet.Packet, err error) {
+	if pkFunc, ok := pool[r.Header.PacketID]; ok {
+		pk = pkFunc()
+	} else {
+		pk = &packet.Unknown{PacketID: r.Header.PacketID}
+	}
+	buf := bytes.NewBuffer(r.Payload)
+	defer func() {
+		if recoveredErr := recover(); recoveredErr != nil {
+			err = fmt.Errorf("%T: %v", pk, recoveredErr)
+		}
+	}()
+	pk.Unmarshal(protocol.NewReader(buf, shieldID))
+	if buf.Len() != 0 {
+		return pk, fmt.Errorf("%T: %v unread bytes left: 0x%x", pk, buf.Len(), buf.Bytes())
+	}
+	return pk, nil
+}
+
+// data returns the serialised packet of the Record, including its header, as written to a minecraft.Conn.
+func (r Record) data() []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, len(r.Payload)+5))
+	_ = r.Header.Write(buf)
+	buf.Write(r.Payload)
+	return buf.Bytes()
+}
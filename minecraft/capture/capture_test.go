@@ -0,0 +1,200 @@
+package capture
+
+import (
+	"bytes"
+	"errors"
+	"github.com/google/uuid"
+	"io"
+	"net"
+	"phoenix/internal/testserver"
+	"phoenix/minecraft"
+	"phoenix/minecraft/nbt"
+	"phoenix/minecraft/protocol"
+	"phoenix/minecraft/protocol/login"
+	"phoenix/minecraft/protocol/packet"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadWrite(t *testing.T) {
+	records := []Record{
+		{Time: time.Unix(0, 1), Conn: 1, Direction: ClientToServer, Header: packet.Header{PacketID: packet.IDLogin}, Payload: []byte{1, 2, 3}},
+		{Time: time.Unix(10, 5), Conn: 1, Direction: ServerToClient, Header: packet.Header{PacketID: packet.IDText, SenderSubClient: 1, TargetSubClient: 2}, Payload: []byte{}},
+		{Time: time.Unix(20, 0), Conn: 2, Direction: ServerToClient, Header: packet.Header{PacketID: 1000}, Payload: bytes.Repeat([]byte{0xff}, 300)},
+	}
+	buf := bytes.NewBuffer(nil)
+	w, err := NewWriter(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records {
+		if err := w.WriteRecord(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(records) {
+		t.Fatalf("expected %v records, got %v", len(records), len(got))
+	}
+	for i := range records {
+		if !got[i].Time.Equal(records[i].Time) || got[i].Conn != records[i].Conn || got[i].Direction != records[i].Direction ||
+			got[i].Header != records[i].Header || !bytes.Equal(got[i].Payload, records[i].Payload) {
+			t.Fatalf("record %v: expected %+v, got %+v", i, records[i], got[i])
+		}
+	}
+
+	r, _ = NewReader(bytes.NewReader(data[:len(data)-1]))
+	if _, err := r.ReadAll(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected unexpected EOF for truncated capture, got %v", err)
+	}
+	if _, err := NewReader(bytes.NewReader([]byte("PHXA\x01\x00"))); err == nil {
+		t.Fatal("expected error for invalid magic")
+	}
+}
+
+func TestRecordDecode(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	(&packet.Text{TextType: packet.TextTypeChat, SourceName: "a", Message: "b"}).Marshal(protocol.NewWriter(buf, 0))
+	r := Record{Header: packet.Header{PacketID: packet.IDText}, Payload: buf.Bytes()}
+	pk, err := r.Decode(packet.NewPool(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := pk.(*packet.Text); text.Message != "b" {
+		t.Fatalf("unexpected packet decoded: %+v", text)
+	}
+	r.Payload = r.Payload[:3]
+	if _, err := r.Decode(packet.NewPool(), 0); err == nil {
+		t.Fatal("expected error decoding truncated payload")
+	}
+	r = Record{Header: packet.Header{PacketID: 1000}, Payload: []byte{1, 2}}
+	if pk, err := r.Decode(packet.NewPool(), 0); err != nil || pk.ID() != 1000 {
+		t.Fatalf("expected unknown packet, got %v (%v)", pk, err)
+	}
+}
+
+// TestRecordReplay records a session with a test server, then replays it and checks that the client receives
+// the same packets as during the session.
+func TestRecordReplay(t *testing.T) {
+	s, err := testserver.New(testserver.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	buf := bytes.NewBuffer(nil)
+	w, err := NewWriter(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := minecraft.Dialer{
+		IdentityData: login.IdentityData{DisplayName: "Recorder"},
+		PacketFunc:   w.PacketFunc,
+	}.DialTimeout(s.Network(), s.Address(), time.Second*5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.DoSpawnTimeout(time.Second * 5); err != nil {
+		t.Fatal(err)
+	}
+	id := uuid.New()
+	_ = conn.WritePacket(&packet.CommandRequest{
+		CommandOrigin: protocol.CommandOrigin{Origin: protocol.CommandOriginPlayer, UUID: id},
+		CommandLine:   "tp 1 2 3",
+	})
+	var live []packet.Packet
+	for {
+		pk, err := conn.ReadPacket()
+		if err != nil {
+			t.Fatal(err)
+		}
+		live = append(live, pk)
+		if output, ok := pk.(*packet.CommandOutput); ok && output.CommandOrigin.UUID == id {
+			break
+		}
+	}
+	_ = conn.Close()
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records[0].Direction != ClientToServer || records[0].Header.PacketID != packet.IDLogin {
+		t.Fatalf("expected login packet sent by client first, got %+v", records[0].Header)
+	}
+
+	// The pipe of a replay server must no longer be registered once the server is closed.
+	srv, err := NewServer(records, ReplayConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = srv.Close()
+	var unknown net.UnknownNetworkError
+	if _, err := (minecraft.Dialer{}).DialTimeout(srv.Network(), srv.Address(), time.Second); !errors.As(err, &unknown) {
+		t.Fatalf("expected network of closed replay server to be unregistered, got %v", err)
+	}
+
+	sent := make(chan packet.Packet, 16)
+	replayed, err := Replay(minecraft.Dialer{IdentityData: login.IdentityData{DisplayName: "Replayer"}}, records, ReplayConfig{
+		HandleClient: func(pk packet.Packet) {
+			sent <- pk
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replayed.Close()
+	if replayed.GameData().EntityRuntimeID != conn.GameData().EntityRuntimeID {
+		t.Fatal("client not spawned with recorded game data")
+	}
+	_ = replayed.SetReadDeadline(time.Now().Add(time.Second * 5))
+	for i, expected := range live {
+		pk, err := replayed.ReadPacket()
+		if err != nil {
+			t.Fatalf("read replayed packet %v: %v", i, err)
+		}
+		if biomes, ok := pk.(*packet.BiomeDefinitionList); ok {
+			// The biome definitions are encoded again by the replay server, so only their contents are equal.
+			var a, b map[string]interface{}
+			_ = nbt.UnmarshalEncoding(biomes.SerialisedBiomeDefinitions, &a, nbt.NetworkLittleEndian)
+			_ = nbt.UnmarshalEncoding(expected.(*packet.BiomeDefinitionList).SerialisedBiomeDefinitions, &b, nbt.NetworkLittleEndian)
+			if !reflect.DeepEqual(a, b) {
+				t.Fatal("replayed biome definitions differ from those recorded")
+			}
+			continue
+		}
+		if !reflect.DeepEqual(pk, expected) {
+			t.Fatalf("replayed packet %v: expected %#v, got %#v", i, expected, pk)
+		}
+	}
+
+	_ = replayed.WritePacket(&packet.Text{TextType: packet.TextTypeChat, Message: "replayed"})
+	select {
+	case pk := <-sent:
+		if text, ok := pk.(*packet.Text); !ok || text.Message != "replayed" {
+			t.Fatalf("unexpected packet passed to HandleClient: %#v", pk)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("packet sent by client not passed to HandleClient")
+	}
+}
@@ -0,0 +1,114 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Reader reads the records of a capture.
+type Reader struct {
+	r      *bufio.Reader
+	closer io.Closer
+}
+
+// NewReader returns a Reader that reads a capture from the io.Reader passed. The header of the capture is
+// read and validated immediately. If r is also an io.Closer, it is closed when the Reader is closed.
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := &Reader{r: bufio.NewReader(r)}
+	if closer, ok := r.(io.Closer); ok {
+		reader.closer = closer
+	}
+	var header [len(magic) + 2]byte
+	if _, err := io.ReadFull(reader.r, header[:]); err != nil {
+		return nil, fmt.Errorf("read capture header: %w", err)
+	}
+	if string(header[:len(magic)]) != magic {
+		return nil, fmt.Errorf("read capture header: not a capture file")
+	}
+	if v := binary.LittleEndian.Uint16(header[len(magic):]); v != version {
+		return nil, fmt.Errorf("read capture header: unsupported version %v", v)
+	}
+	return reader, nil
+}
+
+// Open opens the capture file at the path passed and returns a Reader reading from it.
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewReader(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// ReadRecord reads the next Record from the capture. It returns io.EOF if the end of the capture was reached,
+// or io.ErrUnexpectedEOF if the capture ends in the middle of a record.
+func (r *Reader) ReadRecord() (Record, error) {
+	var buf [13]byte
+	if _, err := io.ReadFull(r.r, buf[:]); err != nil {
+		return Record{}, err
+	}
+	rec := Record{
+		Time:      time.Unix(0, int64(binary.LittleEndian.Uint64(buf[:8]))),
+		Conn:      binary.LittleEndian.Uint32(buf[8:12]),
+		Direction: Direction(buf[12]),
+	}
+	if rec.Direction > ServerToClient {
+		return Record{}, fmt.Errorf("read record: invalid direction %v", rec.Direction)
+	}
+	if err := rec.Header.Read(r.r); err != nil {
+		return Record{}, unexpectedEOF(err)
+	}
+	if _, err := io.ReadFull(r.r, buf[:4]); err != nil {
+		return Record{}, unexpectedEOF(err)
+	}
+	l := binary.LittleEndian.Uint32(buf[:4])
+	if l > maxPayloadSize {
+		return Record{}, fmt.Errorf("read record: payload size %v exceeds maximum of %v", l, maxPayloadSize)
+	}
+	rec.Payload = make([]byte, l)
+	if _, err := io.ReadFull(r.r, rec.Payload); err != nil {
+		return Record{}, unexpectedEOF(err)
+	}
+	return rec, nil
+}
+
+// ReadAll reads all remaining records from the capture.
+func (r *Reader) ReadAll() ([]Record, error) {
+	var records []Record
+	for {
+		rec, err := r.ReadRecord()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		} else if err != nil {
+			return records, err
+		}
+		records = append(records, rec)
+	}
+}
+
+// Close closes the underlying reader if it is an io.Closer.
+func (r *Reader) Close() error {
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
+
+// unexpectedEOF turns an io.EOF into io.ErrUnexpectedEOF, as the end of a capture in the middle of a record
+// means the capture was truncated.
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
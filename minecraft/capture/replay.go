@@ -0,0 +1,322 @@
+package capture
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"phoenix/minecraft"
+	"phoenix/minecraft/nbt"
+	"phoenix/minecraft/protocol/packet"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReplayConfig holds settings of a replay Server.
+type ReplayConfig struct {
+	// Conn is the ID of the recorded connection replayed. If zero, the first connection found in the records
+	// is replayed.
+	Conn uint32
+	// Speed is the speed at which packets are replayed, relative to the speed at which they were recorded. A
+	// Speed of 2 replays packets twice as fast. If zero, packets are replayed as fast as possible, which is
+	// what is usually wanted for reproducing a bug.
+	Speed float64
+	// HandleClient is called for every packet the client sends to the Server during the replay. The packets
+	// are otherwise discarded.
+	HandleClient func(pk packet.Packet)
+	// ErrorLog is a logger that errors of the Server are written to. By default, errors are discarded.
+	ErrorLog *log.Logger
+}
+
+// Server is a server that replays the packets a server sent over a recorded connection. The client joining
+// the Server is spawned with the game data of the StartGame packet recorded, after which all packets sent by
+// the recorded server after the login sequence are written to the client in order, exactly as recorded.
+// The creative inventory recorded is not replayed, as the Server sends an empty one while spawning the client.
+// A Server accepts a single client and stops listening once it joined.
+type Server struct {
+	listener *minecraft.Listener
+	network  string
+	address  string
+	cfg      ReplayConfig
+
+	start   *packet.StartGame
+	records []Record
+
+	mu   sync.Mutex
+	conn *minecraft.Conn
+
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+// networkCount is used to register the pipe of each Server under a unique name.
+var networkCount uint64
+
+// NewServer starts a Server replaying the records passed. The Server listens on a minecraft.Pipe registered
+// under a unique name, returned by Server.Network. The Pipe is unregistered once the client joined or the
+// Server is closed.
+// An error is returned if the records hold no StartGame packet for the connection replayed.
+func NewServer(records []Record, cfg ReplayConfig) (*Server, error) {
+	if cfg.ErrorLog == nil {
+		cfg.ErrorLog = log.New(ioutil.Discard, "", 0)
+	}
+	if cfg.Conn == 0 && len(records) != 0 {
+		cfg.Conn = records[0].Conn
+	}
+	rec, err := replayable(records, cfg.Conn)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		network: fmt.Sprintf("replay-%d", atomic.AddUint64(&networkCount, 1)),
+		address: "127.0.0.1:19132",
+		cfg:     cfg,
+		start:   rec.start,
+		records: rec.records,
+		done:    make(chan struct{}),
+	}
+	minecraft.RegisterNetwork(s.network, minecraft.NewPipe())
+	s.listener, err = minecraft.ListenConfig{
+		AuthenticationDisabled: true,
+		StatusProvider:         minecraft.NewStatusProvider(rec.start.WorldName),
+		Biomes:                 rec.biomes,
+		ErrorLog:               cfg.ErrorLog,
+	}.Listen(s.network, s.address)
+	if err != nil {
+		minecraft.UnregisterNetwork(s.network)
+		return nil, err
+	}
+	go s.accept()
+	return s, nil
+}
+
+// Replay starts a Server replaying the records passed and connects to it using the Dialer passed. The
+// minecraft.Conn returned is spawned and reads the packets replayed.
+func Replay(d minecraft.Dialer, records []Record, cfg ReplayConfig) (*minecraft.Conn, error) {
+	s, err := NewServer(records, cfg)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := d.DialTimeout(s.Network(), s.Address(), time.Second*10)
+	if err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	if err := conn.DoSpawnTimeout(time.Second * 10); err != nil {
+		_ = conn.Close()
+		_ = s.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Network returns the name of the network the Server listens on, to be passed to minecraft.Dialer.Dial.
+func (s *Server) Network() string {
+	return s.network
+}
+
+// Address returns the address the Server listens on, to be passed to minecraft.Dialer.Dial.
+func (s *Server) Address() string {
+	return s.address
+}
+
+// Done returns a channel that is closed once all packets were replayed, or once replaying failed. The
+// connection to the client is left open, so that the client may finish handling the packets replayed.
+func (s *Server) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the error that stopped the replay, if any. It should be called after Done is closed.
+func (s *Server) Err() error {
+	return s.err
+}
+
+// Close stops the Server, closing the connection to the client if it joined.
+func (s *Server) Close() error {
+	err := s.stopListening()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		_ = s.conn.Close()
+	}
+	return err
+}
+
+// accept accepts the client of the replay and replays the records to it.
+func (s *Server) accept() {
+	c, err := s.listener.Accept()
+	if err != nil {
+		s.finish(err)
+		return
+	}
+	_ = s.stopListening()
+	conn := c.(*minecraft.Conn)
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+	go s.readClient(conn)
+	s.finish(s.replay(conn))
+}
+
+// stopListening closes the listener of the Server and unregisters the Pipe it listened on. Only one client
+// joins a replay, so this is done as soon as it is accepted.
+func (s *Server) stopListening() error {
+	err := s.listener.Close()
+	minecraft.UnregisterNetwork(s.network)
+	return err
+}
+
+// finish marks the replay as done with the error passed.
+func (s *Server) finish(err error) {
+	s.once.Do(func() {
+		if err != nil {
+			s.cfg.ErrorLog.Printf("replay: %v", err)
+		}
+		s.err = err
+		close(s.done)
+	})
+}
+
+// replay spawns the client passed and writes all records to it.
+func (s *Server) replay(conn *minecraft.Conn) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	if err := conn.StartGameContext(ctx, gameData(s.start)); err != nil {
+		return fmt.Errorf("spawn client: %w", err)
+	}
+	for i, r := range s.records {
+		if s.cfg.Speed > 0 && i > 0 {
+			time.Sleep(time.Duration(float64(r.Time.Sub(s.records[i-1].Time)) / s.cfg.Speed))
+		}
+		if _, err := conn.Write(r.data()); err != nil {
+			return err
+		}
+	}
+	return conn.Flush()
+}
+
+// readClient reads packets sent by the client until the connection is closed, passing them to the
+// HandleClient function of the Server.
+func (s *Server) readClient(conn *minecraft.Conn) {
+	for {
+		pk, err := conn.ReadPacket()
+		if err != nil {
+			return
+		}
+		if s.cfg.HandleClient != nil {
+			s.cfg.HandleClient(pk)
+		}
+	}
+}
+
+// loginPackets holds the IDs of packets sent by a server during the login sequence. These are either handled
+// by a minecraft.Conn itself or, as for NetworkSettings, sent by the Server itself, and are therefore not
+// replayed.
+var loginPackets = map[uint32]bool{
+	packet.IDServerToClientHandshake: true,
+	packet.IDNetworkSettings:         true,
+	packet.IDPlayStatus:              true,
+	packet.IDResourcePacksInfo:       true,
+	packet.IDResourcePackStack:       true,
+	packet.IDResourcePackDataInfo:    true,
+	packet.IDResourcePackChunkData:   true,
+}
+
+// recording holds the parts of a recorded connection needed to replay it.
+type recording struct {
+	// start is the StartGame packet recorded, which the client is spawned with.
+	start *packet.StartGame
+	// biomes are the biome definitions recorded, if any, which the Server sends instead of the defaults.
+	biomes map[string]interface{}
+	// records are the records replayed after the client spawned.
+	records []Record
+}
+
+// replayable finds the StartGame packet sent over the connection with the ID passed and returns it, along
+// with the packets sent by the server that were passed on to the user of the connection when recording.
+// These are all packets other than those of the login sequence. The BiomeDefinitionList packet sent while
+// spawning and the first CreativeContent packet are not replayed either, as the connection of the Server
+// sends these itself.
+func replayable(records []Record, conn uint32) (recording, error) {
+	var (
+		rec      recording
+		spawned  bool
+		radius   bool
+		creative bool
+		pool     = packet.NewPool()
+	)
+	for _, r := range records {
+		if r.Conn != conn || r.Direction != ServerToClient {
+			continue
+		}
+		id := r.Header.PacketID
+		switch {
+		case rec.start == nil && id == packet.IDStartGame:
+			pk, err := r.Decode(pool, 0)
+			if err != nil {
+				return rec, fmt.Errorf("decode StartGame: %w", err)
+			}
+			rec.start = pk.(*packet.StartGame)
+			continue
+		case rec.start == nil:
+			if loginPackets[id] {
+				continue
+			}
+		case id == packet.IDCreativeContent && !creative:
+			creative = true
+			continue
+		case spawned:
+		case id == packet.IDChunkRadiusUpdated && !radius:
+			radius = true
+			continue
+		case id == packet.IDPlayStatus:
+			pk, err := r.Decode(pool, 0)
+			if err == nil && pk.(*packet.PlayStatus).Status == packet.PlayStatusPlayerSpawn {
+				spawned = true
+				continue
+			}
+		case id == packet.IDBiomeDefinitionList:
+			pk, err := r.Decode(pool, 0)
+			if err != nil {
+				return rec, fmt.Errorf("decode BiomeDefinitionList: %w", err)
+			}
+			if err := nbt.UnmarshalEncoding(pk.(*packet.BiomeDefinitionList).SerialisedBiomeDefinitions, &rec.biomes, nbt.NetworkLittleEndian); err != nil {
+				return rec, fmt.Errorf("decode biome definitions: %w", err)
+			}
+			continue
+		}
+		rec.records = append(rec.records, r)
+	}
+	if rec.start == nil {
+		return rec, fmt.Errorf("no StartGame packet recorded for connection %v", conn)
+	}
+	return rec, nil
+}
+
+// gameData returns the minecraft.GameData held by the StartGame packet passed.
+func gameData(pk *packet.StartGame) minecraft.GameData {
+	return minecraft.GameData{
+		Difficulty:                   pk.Difficulty,
+		WorldName:                    pk.WorldName,
+		EntityUniqueID:               pk.EntityUniqueID,
+		EntityRuntimeID:              pk.EntityRuntimeID,
+		PlayerGameMode:               pk.PlayerGameMode,
+		BaseGameVersion:              pk.BaseGameVersion,
+		PlayerPosition:               pk.PlayerPosition,
+		Pitch:                        pk.Pitch,
+		Yaw:                          pk.Yaw,
+		Dimension:                    pk.Dimension,
+		WorldSpawn:                   pk.WorldSpawn,
+		GameRules:                    pk.GameRules,
+		Time:                         pk.Time,
+		ServerBlockStateChecksum:     pk.ServerBlockStateChecksum,
+		CustomBlocks:                 pk.Blocks,
+		Items:                        pk.Items,
+		PlayerMovementSettings:       pk.PlayerMovementSettings,
+		WorldGameMode:                pk.WorldGameMode,
+		ServerAuthoritativeInventory: pk.ServerAuthoritativeInventory,
+		Experiments:                  pk.Experiments,
+	}
+}
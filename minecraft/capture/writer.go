@@ -0,0 +1,145 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"phoenix/minecraft/protocol/packet"
+	"sync"
+	"time"
+)
+
+// Writer writes records to a capture. Packets of connections may be recorded by passing Writer.PacketFunc
+// to the PacketFunc field of a minecraft.Dialer or minecraft.ListenConfig. A Writer is safe for concurrent
+// use.
+type Writer struct {
+	mu     sync.Mutex
+	w      *bufio.Writer
+	closer io.Closer
+	err    error
+
+	// conns maps the source and destination addresses of packets to the connection they were sent over.
+	conns map[[2]string]*connection
+	count uint32
+}
+
+// connection is a connection recorded by a Writer.
+type connection struct {
+	id     uint32
+	client string
+}
+
+// NewWriter returns a Writer that writes a capture to the io.Writer passed. The header of the capture is
+// written immediately. If w is also an io.Closer, it is closed when the Writer is closed.
+func NewWriter(w io.Writer) (*Writer, error) {
+	writer := &Writer{w: bufio.NewWriter(w), conns: make(map[[2]string]*connection)}
+	if closer, ok := w.(io.Closer); ok {
+		writer.closer = closer
+	}
+	if _, err := writer.w.WriteString(magic); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(writer.w, binary.LittleEndian, version); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+// Create creates a capture file at the path passed, truncating it if it already exists, and returns a Writer
+// writing to it.
+func Create(path string) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewWriter(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// PacketFunc records a packet sent from src to dst. Its signature matches that of the PacketFunc fields of
+// minecraft.Dialer and minecraft.ListenConfig, so that it may be passed to them directly.
+// The direction of a packet is derived from the connection it is sent over: As the client always sends the
+// first packet of a connection, the source address of the first packet of a connection is that of the
+// client. Errors writing the record are returned by the next call to Flush or Close.
+func (w *Writer) PacketFunc(header packet.Header, payload []byte, src, dst net.Addr) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	from, to := src.String(), dst.String()
+	conn, ok := w.conns[[2]string{from, to}]
+	if !ok {
+		w.count++
+		conn = &connection{id: w.count, client: from}
+		w.conns[[2]string{from, to}], w.conns[[2]string{to, from}] = conn, conn
+	}
+	dir := ServerToClient
+	if from == conn.client {
+		dir = ClientToServer
+	}
+	w.write(Record{Time: time.Now(), Conn: conn.id, Direction: dir, Header: header, Payload: payload})
+}
+
+// WriteRecord writes a Record to the capture.
+func (w *Writer) WriteRecord(r Record) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.write(r)
+	return w.err
+}
+
+// write writes a Record to the underlying writer. If writing fails, the error is stored and all following
+// records are discarded.
+func (w *Writer) write(r Record) {
+	if w.err != nil {
+		return
+	}
+	var buf [17]byte
+	binary.LittleEndian.PutUint64(buf[:8], uint64(r.Time.UnixNano()))
+	binary.LittleEndian.PutUint32(buf[8:12], r.Conn)
+	buf[12] = byte(r.Direction)
+	if _, err := w.w.Write(buf[:13]); err != nil {
+		w.err = err
+		return
+	}
+	if err := r.Header.Write(w.w); err != nil {
+		w.err = err
+		return
+	}
+	binary.LittleEndian.PutUint32(buf[13:], uint32(len(r.Payload)))
+	if _, err := w.w.Write(buf[13:]); err != nil {
+		w.err = err
+		return
+	}
+	if _, err := w.w.Write(r.Payload); err != nil {
+		w.err = err
+	}
+}
+
+// Flush writes all buffered records to the underlying writer. It returns the first error that occurred
+// while writing records, if any.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	w.err = w.w.Flush()
+	return w.err
+}
+
+// Close flushes the Writer and closes the underlying writer if it is an io.Closer.
+func (w *Writer) Close() error {
+	err := w.Flush()
+	if w.closer != nil {
+		if closeErr := w.closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -7,6 +7,7 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/sandertv/go-raknet"
@@ -16,13 +17,13 @@ import (
 	"io"
 	"log"
 	"net"
+	"os"
 	"phoenix/internal"
 	"phoenix/minecraft/nbt"
 	"phoenix/minecraft/protocol"
 	"phoenix/minecraft/protocol/login"
 	"phoenix/minecraft/protocol/packet"
 	"phoenix/minecraft/resource"
-	"phoenix/minecraft/text"
 	"strings"
 	"sync"
 	"time"
@@ -40,10 +41,20 @@ type Conn struct {
 	conn        net.Conn
 	log         *log.Logger
 	authEnabled bool
-
-	pool packet.Pool
-	enc  *packet.Encoder
-	dec  *packet.Decoder
+	// verifier verifies the login request of a client connecting to a Listener.
+	verifier login.Verifier
+	// policy decides if a client connecting to a Listener may join. It is nil for clients.
+	policy *loginPolicy
+
+	// proto is the Protocol spoken over the connection. Packets read are decoded using its pool and
+	// converted to the latest protocol, while packets written are converted from the latest protocol.
+	proto Protocol
+	pool  packet.Pool
+	enc   *packet.Encoder
+	dec   *packet.Decoder
+	// acceptedProtocols holds the protocols other than the latest that a client connecting to a Listener may
+	// log in with.
+	acceptedProtocols []Protocol
 
 	identityData login.IdentityData
 	clientData   login.ClientData
@@ -68,7 +79,10 @@ type Conn struct {
 	// were not used by the connection yet. These packets are read the first when calling to Read or
 	// ReadPacket after being connected.
 	deferredPackets []*packetData
-	readDeadline    <-chan time.Time
+	// translated holds packets that resulted from converting a single packet read to the latest protocol.
+	// They are returned by the next calls to ReadPacket.
+	translated   []packet.Packet
+	readDeadline <-chan time.Time
 
 	sendMu sync.Mutex
 	// bufferedSend is a slice of byte slices containing packets that are 'written'. They are buffered until
@@ -92,6 +106,8 @@ type Conn struct {
 	// resourcePacks is a slice of resource packs that the listener may hold. Each client will be asked to
 	// download these resource packs upon joining.
 	resourcePacks []*resource.Pack
+	// packCache is the cache that resource packs downloaded by a client are saved to and loaded from, if any.
+	packCache *resource.Cache
 	// biomes is a map of biome definitions that the listener may hold. Each client will be sent these biome
 	// definitions upon joining.
 	biomes map[string]interface{}
@@ -107,6 +123,8 @@ type Conn struct {
 	packetFunc func(header packet.Header, payload []byte, src, dst net.Addr)
 
 	disconnectMessage atomic.String
+	// failure is the error the connection was closed with by fail, if any.
+	failure atomic.Error
 
 	shieldID  atomic.Int32
 	callbacks interface{}
@@ -120,7 +138,8 @@ func newConn(netConn net.Conn, key *ecdsa.PrivateKey, log *log.Logger) *Conn {
 	conn := &Conn{
 		enc:         packet.NewEncoder(netConn),
 		dec:         packet.NewDecoder(netConn),
-		pool:        packet.NewPool(),
+		proto:       DefaultProtocol,
+		pool:        DefaultProtocol.Packets(),
 		salt:        make([]byte, 16),
 		packets:     make(chan *packetData, 8),
 		close:       make(chan struct{}),
@@ -287,16 +306,19 @@ func (conn *Conn) WritePacket(pk packet.Packet) error {
 		internal.BufferPool.Put(buf)
 	}()
 
-	conn.hdr.PacketID = pk.ID()
-	_ = conn.hdr.Write(buf)
-	l := buf.Len()
+	for _, converted := range conn.proto.ConvertFromLatest(pk, conn) {
+		conn.hdr.PacketID = converted.ID()
+		_ = conn.hdr.Write(buf)
+		l := buf.Len()
 
-	pk.Marshal(protocol.NewWriter(buf, conn.shieldID.Load()))
-	if conn.packetFunc != nil {
-		conn.packetFunc(*conn.hdr, buf.Bytes()[l:], conn.LocalAddr(), conn.RemoteAddr())
-	}
+		converted.Marshal(protocol.NewWriter(buf, conn.shieldID.Load()))
+		if conn.packetFunc != nil {
+			conn.packetFunc(*conn.hdr, buf.Bytes()[l:], conn.LocalAddr(), conn.RemoteAddr())
+		}
 
-	conn.bufferedSend = append(conn.bufferedSend, append([]byte(nil), buf.Bytes()...))
+		conn.bufferedSend = append(conn.bufferedSend, append([]byte(nil), buf.Bytes()...))
+		buf.Reset()
+	}
 	return nil
 }
 
@@ -307,14 +329,13 @@ func (conn *Conn) WritePacket(pk packet.Packet) error {
 // If the packet read was not implemented, a *packet.Unknown is returned, containing the raw payload of the
 // packet read.
 func (conn *Conn) ReadPacket() (pk packet.Packet, err error) {
-	if data, ok := conn.takeDeferredPacket(); ok {
-		pk, err := data.decode(conn)
-		if err != nil {
-			conn.log.Println(err)
-			return conn.ReadPacket()
-		}
+	if len(conn.translated) != 0 {
+		pk, conn.translated = conn.translated[0], conn.translated[1:]
 		return pk, nil
 	}
+	if data, ok := conn.takeDeferredPacket(); ok {
+		return conn.readData(data)
+	}
 
 	select {
 	case <-conn.close:
@@ -322,15 +343,29 @@ func (conn *Conn) ReadPacket() (pk packet.Packet, err error) {
 	case <-conn.readDeadline:
 		return nil, conn.wrap(context.DeadlineExceeded, "read packet")
 	case data := <-conn.packets:
-		pk, err := data.decode(conn)
-		if err != nil {
-			conn.log.Println(err)
-			return conn.ReadPacket()
-		}
-		return pk, nil
+		return conn.readData(data)
 	}
 }
 
+// readData decodes the packetData passed and converts it to packets of the latest protocol. The first of
+// these packets is returned, while the rest are returned by the next calls to ReadPacket.
+func (conn *Conn) readData(data *packetData) (packet.Packet, error) {
+	pk, err := data.decode(conn)
+	if err != nil {
+		conn.log.Println(err)
+		return conn.ReadPacket()
+	}
+	conn.translated = conn.proto.ConvertToLatest(pk, conn)
+	return conn.ReadPacket()
+}
+
+// Protocol returns the Protocol spoken over the connection. For a Conn obtained using a Dialer, this is the
+// protocol negotiated with the server. For a Conn obtained using a Listener, this is the protocol that the
+// client logged in with.
+func (conn *Conn) Protocol() Protocol {
+	return conn.proto
+}
+
 // ResourcePacks returns a slice of all resource packs the connection holds. For a Conn obtained using a
 // Listener, this holds all resource packs set to the Listener. For a Conn obtained using Dial, the resource
 // packs include all packs sent by the server connected to.
@@ -340,6 +375,7 @@ func (conn *Conn) ResourcePacks() []*resource.Pack {
 
 // Write writes a slice of serialised packet data to the Conn. The data is buffered until the next 20th of a
 // tick, after which it is flushed to the connection. Write returns the amount of bytes written n.
+// Unlike WritePacket, Write does not convert the data to the protocol spoken over the connection.
 func (conn *Conn) Write(b []byte) (n int, err error) {
 	conn.sendMu.Lock()
 	defer conn.sendMu.Unlock()
@@ -351,6 +387,7 @@ func (conn *Conn) Write(b []byte) (n int, err error) {
 // Read reads a packet from the connection into the byte slice passed, provided the byte slice is big enough
 // to carry the full packet.
 // It is recommended to use ReadPacket() rather than Read() in cases where reading is done directly.
+// The data read is not converted to the latest protocol, as opposed to packets returned by ReadPacket.
 func (conn *Conn) Read(b []byte) (n int, err error) {
 	if data, ok := conn.takeDeferredPacket(); ok {
 		if len(b) < len(data.full) {
@@ -430,15 +467,14 @@ func (conn *Conn) SetDeadline(t time.Time) error {
 // SetReadDeadline sets the read deadline of the Conn to the time passed. The time must be after time.Now().
 // Passing an empty time.Time to the method (time.Time{}) results in the read deadline being cleared.
 func (conn *Conn) SetReadDeadline(t time.Time) error {
+	if t.IsZero() {
+		conn.readDeadline = make(chan time.Time)
+		return nil
+	}
 	if t.Before(time.Now()) {
 		panic(fmt.Errorf("error setting read deadline: time passed is before time.Now()"))
 	}
-	empty := time.Time{}
-	if t == empty {
-		conn.readDeadline = make(chan time.Time)
-	} else {
-		conn.readDeadline = time.After(time.Until(t))
-	}
+	conn.readDeadline = time.After(time.Until(t))
 	return nil
 }
 
@@ -539,7 +575,12 @@ func (conn *Conn) handle(pkData *packetData) error {
 			if err != nil {
 				return err
 			}
-			return conn.handlePacket(pk)
+			for _, converted := range conn.proto.ConvertToLatest(pk, conn) {
+				if err := conn.handlePacket(converted); err != nil {
+					return err
+				}
+			}
+			return nil
 		}
 	}
 	// This is not the packet we expected next in the login sequence. We push it back so that it may
@@ -601,27 +642,40 @@ func (conn *Conn) handleLogin(pk *packet.Login) error {
 		err        error
 		authResult login.AuthResult
 	)
-	conn.identityData, conn.clientData, authResult, err = login.Parse(pk.ConnectionRequest)
+	conn.identityData, conn.clientData, authResult, err = conn.verifier.Parse(pk.ConnectionRequest)
 	if err != nil {
-		return fmt.Errorf("parse login request: %w", err)
+		return rejectRequest(err)
 	}
 
 	// Make sure the player is logged in with XBOX Live when necessary.
 	if !authResult.XBOXLiveAuthenticated && conn.authEnabled {
-		_ = conn.WritePacket(&packet.Disconnect{Message: text.Colourf("<red>You must be logged in with XBOX Live to join.</red>")})
-		return fmt.Errorf("connection %v was not authenticated to XBOX Live", conn.RemoteAddr())
+		return rejectLogin(RejectUnauthenticated, fmt.Errorf("connection %v was not authenticated to XBOX Live", conn.RemoteAddr()))
 	}
-	// Make sure protocol numbers match.
-	if pk.ClientProtocol != protocol.CurrentProtocol {
+	// Make sure the client's protocol is one we accept.
+	proto, ok := findProtocol(pk.ClientProtocol, conn.acceptedProtocols)
+	if !ok {
 		// By default we assume the client is outdated.
 		status := packet.PlayStatusLoginFailedClient
-		if pk.ClientProtocol > protocol.CurrentProtocol {
+		newest := int32(protocol.CurrentProtocol)
+		for _, p := range conn.acceptedProtocols {
+			if p.ID() > newest {
+				newest = p.ID()
+			}
+		}
+		if pk.ClientProtocol > newest {
 			// The server is outdated in this case, so we have to change the status we send.
 			status = packet.PlayStatusLoginFailedServer
 		}
 		_ = conn.WritePacket(&packet.PlayStatus{Status: status})
 		return fmt.Errorf("%v connected with an incompatible protocol: expected protocol = %v, client protocol = %v", conn.identityData.DisplayName, protocol.CurrentProtocol, pk.ClientProtocol)
 	}
+	conn.proto, conn.pool = proto, proto.Packets()
+	// Finally, check if the player may join according to the policy of the Listener.
+	if conn.policy != nil {
+		if err := conn.policy.check(conn.identityData, conn.clientData); err != nil {
+			return err
+		}
+	}
 	if err := conn.enableEncryption(authResult.PublicKey); err != nil {
 		return fmt.Errorf("error enabling encryption: %v", err)
 	}
@@ -732,12 +786,27 @@ func (conn *Conn) handleResourcePacksInfo(pk *packet.ResourcePacksInfo) error {
 	}
 	packsToDownload := make([]string, 0, len(pk.TexturePacks)+len(pk.BehaviourPacks))
 
+	for _, pack := range pk.TexturePacks {
+		if err := resource.ValidateContentKey(pack.ContentKey); err != nil {
+			return fmt.Errorf("texture pack %v has an invalid content key: %w", pack.UUID, err)
+		}
+	}
+	for _, pack := range pk.BehaviourPacks {
+		if err := resource.ValidateContentKey(pack.ContentKey); err != nil {
+			return fmt.Errorf("behaviour pack %v has an invalid content key: %w", pack.UUID, err)
+		}
+	}
 	for _, pack := range pk.TexturePacks {
 		if _, ok := conn.packQueue.downloadingPacks[pack.UUID]; ok {
 			conn.log.Printf("duplicate texture pack entry %v in resource pack info\n", pack.UUID)
 			conn.packQueue.packAmount--
 			continue
 		}
+		if conn.hasPack(pack.UUID, pack.Version, pack.ContentKey, false) {
+			// The pack was found in the pack cache, so it does not need to be downloaded.
+			conn.packQueue.packAmount--
+			continue
+		}
 		// This UUID_Version is a hack Mojang put in place.
 		packsToDownload = append(packsToDownload, pack.UUID+"_"+pack.Version)
 		conn.packQueue.downloadingPacks[pack.UUID] = downloadingPack{
@@ -753,6 +822,10 @@ func (conn *Conn) handleResourcePacksInfo(pk *packet.ResourcePacksInfo) error {
 			conn.packQueue.packAmount--
 			continue
 		}
+		if conn.hasPack(pack.UUID, pack.Version, pack.ContentKey, true) {
+			conn.packQueue.packAmount--
+			continue
+		}
 		// This UUID_Version is a hack Mojang put in place.
 		packsToDownload = append(packsToDownload, pack.UUID+"_"+pack.Version)
 		conn.packQueue.downloadingPacks[pack.UUID] = downloadingPack{
@@ -791,12 +864,12 @@ func (conn *Conn) handleResourcePackStack(pk *packet.ResourcePackStack) error {
 				pk.BehaviourPacks = append(pk.BehaviourPacks[:i], pk.BehaviourPacks[i+1:]...)
 			}
 		}
-		if !conn.hasPack(pack.UUID, pack.Version, false) {
+		if !conn.hasPack(pack.UUID, pack.Version, "", false) {
 			return fmt.Errorf("texture pack {uuid=%v, version=%v} not downloaded", pack.UUID, pack.Version)
 		}
 	}
 	for _, pack := range pk.BehaviourPacks {
-		if !conn.hasPack(pack.UUID, pack.Version, true) {
+		if !conn.hasPack(pack.UUID, pack.Version, "", true) {
 			return fmt.Errorf("behaviour pack {uuid=%v, version=%v} not downloaded", pack.UUID, pack.Version)
 		}
 	}
@@ -806,8 +879,11 @@ func (conn *Conn) handleResourcePackStack(pk *packet.ResourcePackStack) error {
 }
 
 // hasPack checks if the connection has a resource pack downloaded with the UUID and version passed, provided
-// the pack either has or does not have behaviours in it.
-func (conn *Conn) hasPack(uuid string, version string, hasBehaviours bool) bool {
+// the pack either has or does not have behaviours in it. If the connection does not have the pack, but the
+// pack cache does, the pack is loaded from the cache and added to the resource packs of the connection. The
+// content key passed, if not empty, replaces the content key stored in the cache, as the key sent by the
+// server is the one the pack is currently encrypted with.
+func (conn *Conn) hasPack(uuid, version, contentKey string, hasBehaviours bool) bool {
 	conn.packMu.Lock()
 	defer conn.packMu.Unlock()
 
@@ -816,7 +892,24 @@ func (conn *Conn) hasPack(uuid string, version string, hasBehaviours bool) bool
 			return true
 		}
 	}
-	return false
+	if conn.packCache == nil {
+		return false
+	}
+	pack, err := conn.packCache.Load(uuid, version)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			conn.log.Printf("error loading resource pack %v from cache: %v\n", uuid, err)
+		}
+		return false
+	}
+	if pack.HasBehaviours() != hasBehaviours {
+		return false
+	}
+	if contentKey != "" {
+		pack = pack.WithContentKey(contentKey)
+	}
+	conn.resourcePacks = append(conn.resourcePacks, pack)
+	return true
 }
 
 // packChunkSize is the size of a single chunk of data from a resource pack: 512 kB or 0.5 MB
@@ -842,7 +935,7 @@ func (conn *Conn) handleResourcePackClientResponse(pk *packet.ResourcePackClient
 			return err
 		}
 	case packet.PackResponseAllPacksDownloaded:
-		pk := &packet.ResourcePackStack{BaseGameVersion: protocol.CurrentVersion}
+		pk := &packet.ResourcePackStack{BaseGameVersion: conn.proto.Ver()}
 		for _, pack := range conn.resourcePacks {
 			resourcePack := protocol.StackResourcePack{UUID: pack.UUID(), Version: pack.Version()}
 			// If it has behaviours, add it to the behaviour pack list. If not, we add it to the texture packs
@@ -894,7 +987,7 @@ func (conn *Conn) startGame() {
 		ServerAuthoritativeInventory: data.ServerAuthoritativeInventory,
 		Experiments:                  data.Experiments,
 		BaseGameVersion:              data.BaseGameVersion,
-		GameVersion:                  protocol.CurrentVersion,
+		GameVersion:                  conn.proto.Ver(),
 	})
 	conn.expect(packet.IDRequestChunkRadius, packet.IDSetLocalPlayerAsInitialised)
 }
@@ -937,6 +1030,7 @@ func (conn *Conn) handleResourcePackDataInfo(pk *packet.ResourcePackDataInfo) er
 	conn.packQueue.awaitingPacks[id] = &pack
 
 	pack.chunkSize = pk.DataChunkSize
+	pack.checksum = pk.Hash
 
 	// The client calculates the chunk count by itself: You could in theory send a chunk count of 0 even
 	// though there's data, and the client will still download normally.
@@ -963,19 +1057,31 @@ func (conn *Conn) handleResourcePackDataInfo(pk *packet.ResourcePackDataInfo) er
 		conn.packMu.Lock()
 		defer conn.packMu.Unlock()
 
+		// The download cannot be retried, so the connection is closed if the pack is not usable, rather than
+		// waiting for the pack forever.
 		if pack.buf.Len() != int(pack.size) {
-			conn.log.Printf("incorrect resource pack size: expected %v, but got %v\n", pack.size, pack.buf.Len())
+			conn.fail(fmt.Errorf("incorrect size of resource pack %v: expected %v, but got %v", id, pack.size, pack.buf.Len()))
 			return
 		}
 		// First parse the resource pack from the total byte buffer we obtained.
 		newPack, err := resource.FromBytes(pack.buf.Bytes())
 		if err != nil {
-			conn.log.Printf("invalid full resource pack data for UUID %v: %v\n", id, err)
+			conn.fail(fmt.Errorf("invalid full resource pack data for UUID %v: %w", id, err))
 			return
 		}
+		if checksum := newPack.Checksum(); len(pack.checksum) == len(checksum) && !bytes.Equal(pack.checksum, checksum[:]) {
+			conn.fail(fmt.Errorf("checksum of resource pack %v does not match: expected %x, but got %x", id, pack.checksum, checksum))
+			return
+		}
+		newPack = newPack.WithContentKey(pack.contentKey)
+		if conn.packCache != nil {
+			if err := conn.packCache.Store(newPack); err != nil {
+				conn.log.Printf("error saving resource pack %v to cache: %v\n", id, err)
+			}
+		}
 		conn.packQueue.packAmount--
 		// Finally we add the resource to the resource packs slice.
-		conn.resourcePacks = append(conn.resourcePacks, newPack.WithContentKey(pack.contentKey))
+		conn.resourcePacks = append(conn.resourcePacks, newPack)
 		if conn.packQueue.packAmount == 0 {
 			conn.expect(packet.IDResourcePackStack)
 			_ = conn.WritePacket(&packet.ResourcePackClientResponse{Response: packet.PackResponseAllPacksDownloaded})
@@ -1218,9 +1324,20 @@ func (conn *Conn) expect(packetIDs ...uint32) {
 	conn.expectedIDs.Store(packetIDs)
 }
 
+// fail logs the error passed and closes the connection with it, so that operations on the connection, such
+// as a Dial waiting for the connection to log in, return it.
+func (conn *Conn) fail(err error) {
+	conn.log.Printf("error: %v\n", err)
+	conn.failure.Store(err)
+	_ = conn.Close()
+}
+
 // closeErr returns an adequate connection closed error for the op passed. If the connection was closed
 // through a Disconnect packet, the message is contained.
 func (conn *Conn) closeErr(op string) error {
+	if err := conn.failure.Load(); err != nil {
+		return conn.wrap(err, op)
+	}
 	if msg := conn.disconnectMessage.Load(); msg != "" {
 		return conn.wrap(DisconnectError(msg), op)
 	}
@@ -0,0 +1,151 @@
+package minecraft_test
+
+import (
+	"errors"
+	"github.com/go-gl/mathgl/mgl32"
+	"phoenix/minecraft"
+	"phoenix/minecraft/protocol/login"
+	"phoenix/minecraft/protocol/packet"
+	"testing"
+	"time"
+)
+
+// pipeAddress is the address Listeners in tests listen on. Although a Pipe accepts any address, the address
+// must be a valid UDP address, as clients send it in their login request.
+const pipeAddress = "127.0.0.1:19132"
+
+// listenPipe starts a Listener on a new Pipe network registered under the name passed. The Listener is
+// closed when the test ends.
+func listenPipe(t *testing.T, network string, cfg minecraft.ListenConfig) *minecraft.Listener {
+	t.Helper()
+	minecraft.RegisterNetwork(network, minecraft.NewPipe())
+	listener, err := cfg.Listen(network, pipeAddress)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+	return listener
+}
+
+// TestDialListen connects a Dialer to a Listener over a Pipe and runs through the complete login, encryption
+// and spawn sequence, after which packets are exchanged in both directions.
+func TestDialListen(t *testing.T) {
+	listener := listenPipe(t, "pipe-dial-listen", minecraft.ListenConfig{
+		AuthenticationDisabled: true,
+		StatusProvider:         minecraft.NewStatusProvider("Test Server"),
+	})
+	data := minecraft.GameData{
+		WorldName:       "Test World",
+		EntityUniqueID:  1,
+		EntityRuntimeID: 1,
+		PlayerGameMode:  1,
+		PlayerPosition:  mgl32.Vec3{0, 64, 0},
+		Dimension:       0,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		c, err := listener.Accept()
+		if err != nil {
+			errs <- err
+			return
+		}
+		conn := c.(*minecraft.Conn)
+		// The connection is closed when the test ends, so that the client reads the echo before it closes.
+		t.Cleanup(func() {
+			_ = conn.Close()
+		})
+		if name := conn.IdentityData().DisplayName; name != "Tester" {
+			errs <- errors.New("server got unexpected display name " + name)
+			return
+		}
+		if err := conn.StartGameTimeout(data, time.Second*5); err != nil {
+			errs <- err
+			return
+		}
+		for {
+			pk, err := conn.ReadPacket()
+			if err != nil {
+				errs <- err
+				return
+			}
+			if text, ok := pk.(*packet.Text); ok {
+				// Echo the message back to the client.
+				errs <- conn.WritePacket(&packet.Text{TextType: packet.TextTypeChat, SourceName: "Server", Message: text.Message})
+				return
+			}
+		}
+	}()
+
+	conn, err := minecraft.Dialer{IdentityData: login.IdentityData{DisplayName: "Tester"}}.DialTimeout("pipe-dial-listen", pipeAddress, time.Second*5)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.DoSpawnTimeout(time.Second * 5); err != nil {
+		t.Fatalf("spawn: %v", err)
+	}
+	if got := conn.GameData(); got.EntityRuntimeID != data.EntityRuntimeID || got.PlayerPosition != data.PlayerPosition {
+		t.Fatalf("client got game data %+v, expected %+v", got, data)
+	}
+	if err := conn.WritePacket(&packet.Text{TextType: packet.TextTypeChat, SourceName: "Tester", Message: "hello"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("server: %v", err)
+	}
+	for {
+		pk, err := conn.ReadPacket()
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if text, ok := pk.(*packet.Text); ok {
+			if text.Message != "hello" || text.SourceName != "Server" {
+				t.Fatalf("client got unexpected text %+v", text)
+			}
+			return
+		}
+	}
+}
+
+// TestListenAuthRequired checks that a Listener with authentication enabled refuses a Dialer that is not
+// logged in to XBOX Live.
+func TestListenAuthRequired(t *testing.T) {
+	listener := listenPipe(t, "pipe-auth-required", minecraft.ListenConfig{})
+	go func() {
+		if c, err := listener.Accept(); err == nil {
+			_ = c.Close()
+			t.Error("listener accepted a connection that was not authenticated")
+		}
+	}()
+	if _, err := minecraft.DialTimeout("pipe-auth-required", pipeAddress, time.Second*5); err == nil {
+		t.Fatal("dial succeeded without authentication")
+	}
+}
+
+// TestListenServerFull checks that a Listener refuses players once it holds MaximumPlayers connections.
+func TestListenServerFull(t *testing.T) {
+	listener := listenPipe(t, "pipe-server-full", minecraft.ListenConfig{AuthenticationDisabled: true, MaximumPlayers: 1})
+	go func() {
+		for {
+			c, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_ = c.(*minecraft.Conn).StartGameTimeout(minecraft.GameData{}, time.Second*5)
+			}()
+		}
+	}()
+
+	conn, err := minecraft.DialTimeout("pipe-server-full", pipeAddress, time.Second*5)
+	if err != nil {
+		t.Fatalf("first dial: %v", err)
+	}
+	defer conn.Close()
+	if _, err := minecraft.DialTimeout("pipe-server-full", pipeAddress, time.Second*5); err == nil {
+		t.Fatal("second dial succeeded while the server was full")
+	}
+}
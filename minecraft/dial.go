@@ -10,19 +10,18 @@ import (
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/sandertv/go-raknet"
-	"phoenix/internal/resource"
+	skin "phoenix/internal/resource"
 	"phoenix/minecraft/auth"
 	"phoenix/minecraft/protocol"
 	"phoenix/minecraft/protocol/login"
 	"phoenix/minecraft/protocol/packet"
+	"phoenix/minecraft/resource"
 	"golang.org/x/oauth2"
-	"io/ioutil"
 	"log"
 	rand2 "math/rand"
 	"net"
 	"os"
 	"strconv"
-	"strings"
 	"time"
 )
 
@@ -45,9 +44,14 @@ type Dialer struct {
 	// TokenSource is the source for Microsoft Live Connect tokens. If set to a non-nil oauth2.TokenSource,
 	// this field is used to obtain tokens which in turn are used to authenticate to XBOX Live.
 	// The minecraft/auth package provides an oauth2.TokenSource implementation (auth.tokenSource) to use
-	// device auth to login.
+	// device auth to login, and auth.TokenStore provides accounts that save their tokens to a file. If the
+	// TokenSource implements auth.XBLTokenSource, the XBOX Live token is obtained from it too.
 	// If TokenSource is nil, the connection will not use authentication.
 	TokenSource oauth2.TokenSource
+	// AuthProvider is the auth.Provider that the XBOX Live token and Minecraft auth chain are requested from
+	// if TokenSource is set. If nil, the Microsoft, XBOX Live and Minecraft services are used. The
+	// TokenSource should obtain its tokens from the same Provider, for example using Provider.TokenSource.
+	AuthProvider *auth.Provider
 
 	// PacketFunc is called whenever a packet is read from or written to the connection returned when using
 	// Dialer.Dial(). It includes packets that are otherwise covered in the connection sequence, such as the
@@ -65,6 +69,19 @@ type Dialer struct {
 	// the client when an XUID is present without logging in.
 	// For getting this to work with BDS, authentication should be disabled.
 	KeepXBLIdentityData bool
+
+	// Protocols is a slice of protocols that the Dialer may connect with in addition to the latest protocol,
+	// protocol.CurrentProtocol. The protocol is negotiated using the pong of the server: If the protocol
+	// number found in it matches one of these protocols, that protocol is used to log in. In any other case,
+	// the latest protocol is used.
+	// Packets read from and written to the Conn are always those of the latest protocol: They are converted
+	// by the Protocol negotiated.
+	Protocols []Protocol
+
+	// PackCache is the resource.Cache that the resource packs downloaded from servers are saved to. Packs
+	// found in it are not downloaded again when joining a server that sends the same version of the pack. If
+	// nil, packs are downloaded every time a server is joined.
+	PackCache *resource.Cache
 }
 
 // Dial dials a Minecraft connection to the address passed over the network passed. The network is typically
@@ -120,7 +137,7 @@ func (d Dialer) DialContext(ctx context.Context, network, address string) (conn
 
 	var chainData string
 	if d.TokenSource != nil {
-		chainData, err = authChain(ctx, d.TokenSource, key)
+		chainData, err = authChain(ctx, d.authProvider(), d.TokenSource, key)
 		if err != nil {
 			return nil, &net.OpError{Op: "dial", Net: "minecraft", Err: err}
 		}
@@ -129,20 +146,22 @@ func (d Dialer) DialContext(ctx context.Context, network, address string) (conn
 		d.ErrorLog = log.New(os.Stderr, "", log.LstdFlags)
 	}
 	var netConn net.Conn
+	proto := DefaultProtocol
 
-	switch network {
-	case "raknet":
-		// If the network is specifically 'raknet', we use the raknet library to dial a RakNet connection.
-		dialer := raknet.Dialer{ErrorLog: log.New(ioutil.Discard, "", 0)}
+	if n, ok := networkByName(network); ok {
+		// The network was registered, so we first ping the server to find out the port it redirects us to,
+		// after which we dial it.
 		var pong []byte
-		pong, err = dialer.PingContext(ctx, address)
-		if err != nil {
-			break
+		pong, err = n.PingContext(ctx, address)
+		if err == nil {
+			if p, ok := findProtocol(pongProtocol(pong), d.Protocols); ok {
+				proto = p
+			}
+			netConn, err = n.DialContext(ctx, addressWithPongPort(pong, address))
 		}
-		netConn, err = dialer.DialContext(ctx, addressWithPongPort(pong, address))
-	default:
-		// If not set to 'raknet', we fall back to the default net.Dial method to find a proper connection for
-		// the network passed.
+	} else {
+		// If the network is not registered, we fall back to the default net.Dial method to find a proper
+		// connection for the network passed.
 		var d net.Dialer
 		netConn, err = d.DialContext(ctx, network, address)
 	}
@@ -150,15 +169,17 @@ func (d Dialer) DialContext(ctx context.Context, network, address string) (conn
 		return nil, err
 	}
 	conn = newConn(netConn, key, d.ErrorLog)
+	conn.proto, conn.pool = proto, proto.Packets()
 	conn.identityData = d.IdentityData
 	conn.clientData = d.ClientData
 	conn.packetFunc = d.PacketFunc
 	conn.cacheEnabled = d.EnableClientCache
+	conn.packCache = d.PackCache
 
 	// Disable the batch packet limit so that the server can send packets as often as it wants to.
 	conn.dec.DisableBatchPacketLimit()
 
-	defaultClientData(address, conn.identityData.DisplayName, &conn.clientData)
+	defaultClientData(address, conn.identityData.DisplayName, proto, &conn.clientData)
 	defaultIdentityData(&conn.identityData)
 
 	var request []byte
@@ -173,10 +194,14 @@ func (d Dialer) DialContext(ctx context.Context, network, address string) (conn
 	} else {
 		// We login as an Android device and this will show up in the 'titleId' field in the JWT chain, which
 		// we can't edit. We just enforce Android data for logging in.
-		setAndroidData(&conn.clientData)
+		setAndroidData(proto, &conn.clientData)
 
 		request = login.Encode(chainData, conn.clientData, key)
-		identityData, _, _, _ := login.Parse(request)
+		var verifier login.Verifier
+		if root := d.authProvider().RootKey; root != nil {
+			verifier.RootKeys = []*ecdsa.PublicKey{root}
+		}
+		identityData, _, _, _ := verifier.Parse(request)
 		// If we got the identity data from Minecraft auth, we need to make sure we set it in the Conn too, as
 		// we are not aware of the identity data ourselves yet.
 		conn.identityData = identityData
@@ -185,7 +210,7 @@ func (d Dialer) DialContext(ctx context.Context, network, address string) (conn
 	go listenConn(conn, d.ErrorLog, c)
 
 	conn.expect(packet.IDServerToClientHandshake, packet.IDPlayStatus)
-	if err := conn.WritePacket(&packet.Login{ConnectionRequest: request, ClientProtocol: protocol.CurrentProtocol}); err != nil {
+	if err := conn.WritePacket(&packet.Login{ConnectionRequest: request, ClientProtocol: proto.ID()}); err != nil {
 		return nil, err
 	}
 	_ = conn.Flush()
@@ -231,21 +256,59 @@ func listenConn(conn *Conn, logger *log.Logger, c chan struct{}) {
 	}
 }
 
-// authChain requests the Minecraft auth JWT chain using the credentials passed. If successful, an encoded
-// chain ready to be put in a login request is returned.
-func authChain(ctx context.Context, src oauth2.TokenSource, key *ecdsa.PrivateKey) (string, error) {
+// authProvider returns the auth.Provider of the Dialer, or a Provider with the default endpoints if it has
+// none.
+func (d Dialer) authProvider() *auth.Provider {
+	if d.AuthProvider != nil {
+		return d.AuthProvider
+	}
+	return &auth.Provider{Endpoints: auth.DefaultEndpoints}
+}
+
+// authChain requests the Minecraft auth JWT chain from the auth.Provider passed using the credentials
+// passed. If successful, an encoded chain ready to be put in a login request is returned.
+func authChain(ctx context.Context, p *auth.Provider, src oauth2.TokenSource, key *ecdsa.PrivateKey) (string, error) {
+	if xblSrc, ok := src.(auth.XBLTokenSource); ok {
+		// The token source provides the XSTS token itself, possibly from a cache. If the chain cannot be
+		// obtained using it, it may have been revoked, so it is dropped and a new one is tried once.
+		chain, err := cachedAuthChain(ctx, p, xblSrc, key)
+		if err == nil {
+			return chain, nil
+		}
+		if err := xblSrc.InvalidateXBL(minecraftRelyingParty); err != nil {
+			return "", err
+		}
+		return cachedAuthChain(ctx, p, xblSrc, key)
+	}
 	// Obtain the Live token, and using that the XSTS token.
 	liveToken, err := src.Token()
 	if err != nil {
 		return "", fmt.Errorf("error obtaining Live Connect token: %v", err)
 	}
-	xsts, err := auth.RequestXBLToken(ctx, liveToken, "https://multiplayer.minecraft.net/")
+	xsts, err := p.RequestXBLToken(ctx, liveToken, minecraftRelyingParty)
 	if err != nil {
 		return "", fmt.Errorf("error obtaining XBOX Live token: %v", err)
 	}
 
 	// Obtain the raw chain data using the
-	chain, err := auth.RequestMinecraftChain(ctx, xsts, key)
+	chain, err := p.RequestMinecraftChain(ctx, xsts, key)
+	if err != nil {
+		return "", fmt.Errorf("error obtaining Minecraft auth chain: %v", err)
+	}
+	return chain, nil
+}
+
+// minecraftRelyingParty is the relying party of the XSTS token used to obtain the Minecraft auth chain.
+const minecraftRelyingParty = "https://multiplayer.minecraft.net/"
+
+// cachedAuthChain requests the Minecraft auth JWT chain using the XSTS token provided by the
+// auth.XBLTokenSource passed.
+func cachedAuthChain(ctx context.Context, p *auth.Provider, src auth.XBLTokenSource, key *ecdsa.PrivateKey) (string, error) {
+	xsts, err := src.XBLToken(ctx, minecraftRelyingParty)
+	if err != nil {
+		return "", fmt.Errorf("error obtaining XBOX Live token: %v", err)
+	}
+	chain, err := p.RequestMinecraftChain(ctx, xsts, key)
 	if err != nil {
 		return "", fmt.Errorf("error obtaining Minecraft auth chain: %v", err)
 	}
@@ -253,7 +316,8 @@ func authChain(ctx context.Context, src oauth2.TokenSource, key *ecdsa.PrivateKe
 }
 
 // defaultClientData edits the ClientData passed to have defaults set to all fields that were left unchanged.
-func defaultClientData(address, username string, d *login.ClientData) {
+// The game version is set to that of the Protocol passed.
+func defaultClientData(address, username string, proto Protocol, d *login.ClientData) {
 	rand2.Seed(time.Now().Unix())
 
 	d.ServerAddress = address
@@ -262,7 +326,7 @@ func defaultClientData(address, username string, d *login.ClientData) {
 		d.DeviceOS = protocol.DeviceAndroid
 	}
 	if d.GameVersion == "" {
-		d.GameVersion = protocol.CurrentVersion
+		d.GameVersion = proto.Ver()
 	}
 	if d.ClientRandomID == 0 {
 		d.ClientRandomID = rand2.Int63()
@@ -294,17 +358,18 @@ func defaultClientData(address, username string, d *login.ClientData) {
 		d.SkinImageWidth = 64
 	}
 	if d.SkinResourcePatch == "" {
-		d.SkinResourcePatch = base64.StdEncoding.EncodeToString([]byte(resource.DefaultSkinResourcePatch))
+		d.SkinResourcePatch = base64.StdEncoding.EncodeToString([]byte(skin.DefaultSkinResourcePatch))
 	}
 	if d.SkinGeometry == "" {
-		d.SkinGeometry = base64.StdEncoding.EncodeToString([]byte(resource.DefaultSkinGeometry))
+		d.SkinGeometry = base64.StdEncoding.EncodeToString([]byte(skin.DefaultSkinGeometry))
 	}
 }
 
-// setAndroidData ensures the login.ClientData passed matches settings you would see on an Android device.
-func setAndroidData(data *login.ClientData) {
+// setAndroidData ensures the login.ClientData passed matches settings you would see on an Android device
+// running the version of the Protocol passed.
+func setAndroidData(proto Protocol, data *login.ClientData) {
 	data.DeviceOS = protocol.DeviceAndroid
-	data.GameVersion = protocol.CurrentVersion
+	data.GameVersion = proto.Ver()
 }
 
 // clearXBLIdentityData clears data from the login.IdentityData that is only set when a player is logged into
@@ -347,6 +412,20 @@ func splitPong(s string) []string {
 	return append(tokens, string(runes))
 }
 
+// pongProtocol parses the protocol number from the pong passed. If the pong does not hold a valid protocol
+// number, pongProtocol returns 0.
+func pongProtocol(pong []byte) int32 {
+	frag := splitPong(string(pong))
+	if len(frag) < 3 {
+		return 0
+	}
+	id, err := strconv.ParseInt(frag[2], 10, 32)
+	if err != nil {
+		return 0
+	}
+	return int32(id)
+}
+
 // addressWithPongPort parses the redirect IPv4 port from the pong and returns the address passed with the port
 // found if present, or the original address if not.
 func addressWithPongPort(pong []byte, address string) string {
@@ -354,13 +433,16 @@ func addressWithPongPort(pong []byte, address string) string {
 	if len(frag) > 10 {
 		portStr := frag[10]
 		port, err := strconv.Atoi(portStr)
+		if err != nil || port <= 0 {
+			return address
+		}
+		// Remove the port from the address. Addresses without a port, such as those of a Pipe, are left as
+		// they are.
+		host, _, err := net.SplitHostPort(address)
 		if err != nil {
 			return address
 		}
-		// Remove the port from the address.
-		addressParts := strings.Split(address, ":")
-		address = strings.Join(strings.Split(address, ":")[:len(addressParts)-1], ":")
-		return address + ":" + strconv.Itoa(port)
+		return net.JoinHostPort(host, strconv.Itoa(port))
 	}
 	return address
 }
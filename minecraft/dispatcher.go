@@ -0,0 +1,254 @@
+package minecraft
+
+import (
+	"phoenix/minecraft/protocol/packet"
+	"sort"
+	"sync"
+)
+
+// Handler handles a packet read from a Conn. Handlers that are not asynchronous may modify the packet, after
+// which the modified packet is passed to the handlers that follow. If a Handler returns false, the packet is
+// dropped and handlers that follow are not called.
+type Handler func(pk packet.Packet) bool
+
+// HandlerOption changes the way a Handler is registered to a Dispatcher.
+type HandlerOption func(r *Registration)
+
+// Priority sets the priority of a Handler. Handlers with a higher priority are called before those with a
+// lower priority. Handlers with the same priority are called in the order they were registered. The default
+// priority is 0.
+func Priority(priority int) HandlerOption {
+	return func(r *Registration) {
+		r.priority = priority
+	}
+}
+
+// Filter sets a function that decides if a Handler is called for a packet. Packets for which the function
+// returns false skip the Handler and are passed to the handlers that follow.
+func Filter(f func(pk packet.Packet) bool) HandlerOption {
+	return func(r *Registration) {
+		r.filter = f
+	}
+}
+
+// Async makes a Handler run on its own goroutine rather than on the goroutine dispatching packets, so that
+// it may block, for example to wait for a response from the server, without holding up other packets.
+// Packets reach an asynchronous Handler in the order they were read, after all handlers that are not
+// asynchronous have been called for them. An asynchronous Handler cannot drop packets and must not modify
+// them.
+// Once asyncQueueSize packets are waiting to be handled, dispatching blocks until the Handler catches up.
+func Async() HandlerOption {
+	return func(r *Registration) {
+		r.async = true
+	}
+}
+
+// asyncQueueSize is the amount of packets that may wait to be handled by an asynchronous Handler.
+const asyncQueueSize = 256
+
+// Registration is a Handler registered to a Dispatcher. It may be used to remove the Handler again.
+type Registration struct {
+	d       *Dispatcher
+	id      uint32
+	all     bool
+	handler Handler
+
+	priority int
+	filter   func(pk packet.Packet) bool
+	async    bool
+
+	// order is the number of the registration, used to call handlers with the same priority in the order they
+	// were registered.
+	order   uint64
+	queue   chan packet.Packet
+	removed chan struct{}
+	once    sync.Once
+}
+
+// Remove removes the Handler from the Dispatcher. The Handler is not called for packets dispatched after
+// Remove returns. Packets waiting to be handled by an asynchronous Handler are discarded.
+func (r *Registration) Remove() {
+	r.once.Do(func() {
+		r.d.remove(r)
+		if r.async {
+			close(r.removed)
+		}
+	})
+}
+
+// Dispatcher reads packets from a Conn and dispatches them to the handlers registered for their packet ID.
+// Handlers are registered using Handle and HandleAll, which may be called at any time, also from within a
+// Handler.
+type Dispatcher struct {
+	conn *Conn
+
+	mu       sync.RWMutex
+	handlers map[uint32][]*Registration
+	all      []*Registration
+	order    uint64
+
+	close chan struct{}
+	once  sync.Once
+}
+
+// NewDispatcher returns a new Dispatcher that reads packets from the Conn passed once Run is called.
+func NewDispatcher(conn *Conn) *Dispatcher {
+	return &Dispatcher{conn: conn, handlers: make(map[uint32][]*Registration), close: make(chan struct{})}
+}
+
+// Handle registers a Handler for packets with the ID passed, such as packet.IDText. The Registration returned
+// may be used to remove the Handler.
+func (d *Dispatcher) Handle(id uint32, h Handler, opts ...HandlerOption) *Registration {
+	return d.register(&Registration{id: id, handler: h}, opts)
+}
+
+// HandleAll registers a Handler for all packets, regardless of their ID. The Registration returned may be used
+// to remove the Handler.
+func (d *Dispatcher) HandleAll(h Handler, opts ...HandlerOption) *Registration {
+	return d.register(&Registration{all: true, handler: h}, opts)
+}
+
+// Run reads packets from the Conn and dispatches them until reading fails, for example because the Conn was
+// closed, and returns the error. Asynchronous handlers stop when Run returns: Packets still waiting to be
+// handled by them are discarded.
+// Run must not be called on multiple goroutines simultaneously.
+func (d *Dispatcher) Run() error {
+	defer d.once.Do(func() {
+		close(d.close)
+	})
+	for {
+		pk, err := d.conn.ReadPacket()
+		if err != nil {
+			return err
+		}
+		d.Dispatch(pk)
+	}
+}
+
+// Dispatch passes the packet to all handlers registered for it in order of priority, until a Handler drops
+// it. Dispatch reports if the packet passed through all handlers without being dropped.
+// Run calls Dispatch for every packet read. It may also be called directly, for example to feed packets to
+// the handlers in tests.
+func (d *Dispatcher) Dispatch(pk packet.Packet) bool {
+	var async []*Registration
+	for _, r := range d.registrations(pk.ID()) {
+		if r.filter != nil && !r.filter(pk) {
+			continue
+		}
+		if r.async {
+			async = append(async, r)
+			continue
+		}
+		if !r.handler(pk) {
+			return false
+		}
+	}
+	for _, r := range async {
+		select {
+		case r.queue <- pk:
+		case <-r.removed:
+		case <-d.close:
+		}
+	}
+	return true
+}
+
+// registrations returns the handlers for packets with the ID passed, sorted by priority.
+func (d *Dispatcher) registrations(id uint32) []*Registration {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	byID, all := d.handlers[id], d.all
+	if len(all) == 0 {
+		return byID
+	}
+	if len(byID) == 0 {
+		return all
+	}
+	merged := make([]*Registration, 0, len(byID)+len(all))
+	merged = append(append(merged, byID...), all...)
+	sortRegistrations(merged)
+	return merged
+}
+
+// register applies the options to the Registration passed and adds it to the Dispatcher.
+func (d *Dispatcher) register(r *Registration, opts []HandlerOption) *Registration {
+	r.d = d
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.async {
+		r.queue, r.removed = make(chan packet.Packet, asyncQueueSize), make(chan struct{})
+		go r.handleAsync()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.order++
+	r.order = d.order
+	// The slices are copied rather than appended to, so that slices returned by registrations remain
+	// unchanged while they are being iterated over.
+	if r.all {
+		d.all = insertRegistration(d.all, r)
+	} else {
+		d.handlers[r.id] = insertRegistration(d.handlers[r.id], r)
+	}
+	return r
+}
+
+// remove removes the Registration passed from the Dispatcher.
+func (d *Dispatcher) remove(r *Registration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if r.all {
+		d.all = removeRegistration(d.all, r)
+		return
+	}
+	if d.handlers[r.id] = removeRegistration(d.handlers[r.id], r); len(d.handlers[r.id]) == 0 {
+		delete(d.handlers, r.id)
+	}
+}
+
+// handleAsync calls the Handler of an asynchronous Registration for every packet queued, until the
+// Registration is removed or the Dispatcher stops running.
+func (r *Registration) handleAsync() {
+	for {
+		select {
+		case pk := <-r.queue:
+			r.handler(pk)
+		case <-r.removed:
+			return
+		case <-r.d.close:
+			return
+		}
+	}
+}
+
+// insertRegistration returns a copy of the sorted slice passed with the Registration added.
+func insertRegistration(s []*Registration, r *Registration) []*Registration {
+	n := make([]*Registration, 0, len(s)+1)
+	n = append(append(n, s...), r)
+	sortRegistrations(n)
+	return n
+}
+
+// removeRegistration returns a copy of the slice passed without the Registration passed.
+func removeRegistration(s []*Registration, r *Registration) []*Registration {
+	n := make([]*Registration, 0, len(s))
+	for _, other := range s {
+		if other != r {
+			n = append(n, other)
+		}
+	}
+	return n
+}
+
+// sortRegistrations sorts a slice of registrations by descending priority and then by the order in which they
+// were registered.
+func sortRegistrations(s []*Registration) {
+	sort.Slice(s, func(i, j int) bool {
+		if s[i].priority != s[j].priority {
+			return s[i].priority > s[j].priority
+		}
+		return s[i].order < s[j].order
+	})
+}
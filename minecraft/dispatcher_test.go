@@ -0,0 +1,150 @@
+package minecraft_test
+
+import (
+	"phoenix/minecraft"
+	"phoenix/minecraft/protocol/packet"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestDispatcherOrder checks that handlers are called by priority and registration order, that filtered
+// handlers are skipped, and that dropping or modifying a packet affects the handlers that follow.
+func TestDispatcherOrder(t *testing.T) {
+	d := minecraft.NewDispatcher(nil)
+	var calls []string
+	record := func(name string) minecraft.Handler {
+		return func(pk packet.Packet) bool {
+			calls = append(calls, name+":"+pk.(*packet.Text).Message)
+			return true
+		}
+	}
+	d.Handle(packet.IDText, record("low"), minecraft.Priority(-1))
+	d.HandleAll(record("all"))
+	d.Handle(packet.IDText, record("default"))
+	d.Handle(packet.IDText, func(pk packet.Packet) bool {
+		pk.(*packet.Text).Message = "modified"
+		return true
+	}, minecraft.Priority(10))
+	d.Handle(packet.IDText, func(pk packet.Packet) bool {
+		return false
+	}, minecraft.Priority(5), minecraft.Filter(func(pk packet.Packet) bool {
+		return pk.(*packet.Text).TextType == packet.TextTypeWhisper
+	}))
+	d.Handle(packet.IDSetTime, record("time"))
+
+	if !d.Dispatch(&packet.Text{Message: "hi"}) {
+		t.Fatal("chat packet was dropped")
+	}
+	expected := []string{"all:modified", "default:modified", "low:modified"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("handlers called as %v, expected %v", calls, expected)
+	}
+
+	calls = nil
+	if d.Dispatch(&packet.Text{TextType: packet.TextTypeWhisper, Message: "hi"}) {
+		t.Fatal("whisper was not dropped")
+	}
+	if len(calls) != 0 {
+		t.Fatalf("handlers %v called after the packet was dropped", calls)
+	}
+}
+
+// TestDispatcherRemove checks that removed handlers are no longer called, also when removed by a handler
+// while a packet is dispatched.
+func TestDispatcherRemove(t *testing.T) {
+	d := minecraft.NewDispatcher(nil)
+	count := 0
+	var once *minecraft.Registration
+	once = d.Handle(packet.IDText, func(pk packet.Packet) bool {
+		count++
+		once.Remove()
+		return true
+	})
+	removed := d.HandleAll(func(pk packet.Packet) bool {
+		t.Fatal("removed handler was called")
+		return true
+	})
+	removed.Remove()
+	removed.Remove()
+
+	d.Dispatch(&packet.Text{})
+	d.Dispatch(&packet.Text{})
+	if count != 1 {
+		t.Fatalf("handler called %v times, expected 1", count)
+	}
+}
+
+// TestDispatcherAsync checks that asynchronous handlers receive packets in order on another goroutine,
+// without blocking Dispatch while they are busy.
+func TestDispatcherAsync(t *testing.T) {
+	d := minecraft.NewDispatcher(nil)
+	release := make(chan struct{})
+	received := make(chan string, 3)
+	r := d.Handle(packet.IDText, func(pk packet.Packet) bool {
+		<-release
+		received <- pk.(*packet.Text).Message
+		return true
+	}, minecraft.Async())
+	defer r.Remove()
+
+	for _, msg := range []string{"a", "b", "c"} {
+		d.Dispatch(&packet.Text{Message: msg})
+	}
+	close(release)
+	for _, expected := range []string{"a", "b", "c"} {
+		select {
+		case msg := <-received:
+			if msg != expected {
+				t.Fatalf("got %v, expected %v", msg, expected)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatal("asynchronous handler was not called")
+		}
+	}
+}
+
+// TestDispatcherRun checks that Run dispatches packets read from a Conn and returns once the Conn is closed.
+func TestDispatcherRun(t *testing.T) {
+	listener := listenPipe(t, "pipe-dispatcher", minecraft.ListenConfig{AuthenticationDisabled: true})
+	go func() {
+		c, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		conn := c.(*minecraft.Conn)
+		t.Cleanup(func() {
+			_ = conn.Close()
+		})
+		if err := conn.StartGameTimeout(minecraft.GameData{}, time.Second*5); err != nil {
+			return
+		}
+		_ = conn.WritePacket(&packet.Text{TextType: packet.TextTypeRaw, Message: "hello"})
+	}()
+
+	conn, err := minecraft.DialTimeout("pipe-dispatcher", pipeAddress, time.Second*5)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if err := conn.DoSpawnTimeout(time.Second * 5); err != nil {
+		t.Fatalf("spawn: %v", err)
+	}
+	d := minecraft.NewDispatcher(conn)
+	d.Handle(packet.IDText, func(pk packet.Packet) bool {
+		_ = conn.Close()
+		return true
+	})
+	done := make(chan error, 1)
+	go func() {
+		done <- d.Run()
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("Run returned without error")
+		}
+	case <-time.After(time.Second * 5):
+		_ = conn.Close()
+		t.Fatal("Run did not return after the connection was closed")
+	}
+}
@@ -2,7 +2,9 @@ package minecraft
 
 import (
 	"errors"
+	"fmt"
 	"net"
+	"phoenix/minecraft/text"
 )
 
 var (
@@ -36,3 +38,86 @@ type DisconnectError string
 func (d DisconnectError) Error() string {
 	return string(d)
 }
+
+// RejectReason is the reason that a Listener rejected the login of a client for.
+type RejectReason int
+
+const (
+	// RejectInvalidRequest is the reason for rejecting clients of which the login request could not be parsed
+	// or verified.
+	RejectInvalidRequest RejectReason = iota + 1
+	// RejectExpired is the reason for rejecting clients of which the login chain is expired or not yet valid,
+	// even with the ListenConfig.ClockSkew tolerated.
+	RejectExpired
+	// RejectUnauthenticated is the reason for rejecting clients that were not logged in with XBOX Live while
+	// authentication is enabled, or of which the login chain is not signed by any of the trusted keys.
+	RejectUnauthenticated
+	// RejectDenied is the reason for rejecting clients of which the XUID or name is denied.
+	RejectDenied
+	// RejectNotAllowed is the reason for rejecting clients of which neither the XUID nor the name is allowed
+	// while players are only allowed explicitly.
+	RejectNotAllowed
+	// RejectByHook is the reason for rejecting clients that ListenConfig.ApproveLogin did not approve.
+	RejectByHook
+)
+
+// String returns a short description of the RejectReason.
+func (r RejectReason) String() string {
+	switch r {
+	case RejectInvalidRequest:
+		return "invalid login request"
+	case RejectExpired:
+		return "login chain expired"
+	case RejectUnauthenticated:
+		return "not authenticated"
+	case RejectDenied:
+		return "denied"
+	case RejectNotAllowed:
+		return "not allowed"
+	case RejectByHook:
+		return "not approved"
+	}
+	return fmt.Sprintf("RejectReason(%d)", int(r))
+}
+
+// message returns the default message that clients rejected for the RejectReason are disconnected with.
+func (r RejectReason) message() string {
+	switch r {
+	case RejectExpired:
+		return text.Colourf("<red>Your login has expired. Check the clock of your device and try again.</red>")
+	case RejectUnauthenticated:
+		return text.Colourf("<red>You must be logged in with XBOX Live to join.</red>")
+	case RejectDenied, RejectNotAllowed, RejectByHook:
+		return text.Colourf("<red>You are not allowed to join this server.</red>")
+	}
+	return text.Colourf("<red>Your login could not be verified.</red>")
+}
+
+// LoginError is the error that a Listener rejects the login of a client with. The Listener disconnects the
+// client with the Message of the LoginError and writes the error to its ErrorLog.
+type LoginError struct {
+	// Reason is the reason the login was rejected for.
+	Reason RejectReason
+	// Message is the message shown to the client when it is disconnected.
+	Message string
+	// Err is the error that caused the login to be rejected, if any.
+	Err error
+}
+
+// Error returns the reason the login was rejected for and the error that caused it.
+func (e *LoginError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("login rejected: %v", e.Reason)
+	}
+	return fmt.Sprintf("login rejected: %v: %v", e.Reason, e.Err)
+}
+
+// Unwrap returns the error that caused the login to be rejected.
+func (e *LoginError) Unwrap() error {
+	return e.Err
+}
+
+// rejectLogin returns a LoginError with the reason passed, its default message and the error passed.
+func rejectLogin(reason RejectReason, err error) *LoginError {
+	return &LoginError{Reason: reason, Message: reason.message(), Err: err}
+}
@@ -4,16 +4,21 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"github.com/sandertv/go-raknet"
 	"phoenix/minecraft/protocol"
+	"phoenix/minecraft/protocol/login"
 	"phoenix/minecraft/protocol/packet"
 	"phoenix/minecraft/resource"
+	"phoenix/query"
 	"go.uber.org/atomic"
-	"io/ioutil"
 	"log"
 	"net"
 	"os"
+	"sort"
+	"strconv"
+	"sync"
 	"time"
 )
 
@@ -27,6 +32,30 @@ type ListenConfig struct {
 	// verification will be done to ensure that the player connecting is authenticated using their XBOX Live
 	// account.
 	AuthenticationDisabled bool
+	// TrustedKeys are the keys trusted to sign the login chains of players authenticated using XBOX Live. If
+	// empty, only the key Mojang signs chains with is trusted. Other keys may be trusted to accept players
+	// logged in at a different identity provider, such as the fake provider of the auth/authtest package.
+	TrustedKeys []*ecdsa.PublicKey
+	// ClockSkew is the difference between the clock of the Listener and those of clients and the signers of
+	// their login chains that is tolerated when checking if a login chain has expired. If zero, a skew of one
+	// minute is tolerated.
+	ClockSkew time.Duration
+
+	// AllowedXUIDs and AllowedNames hold the XUIDs and names of the players allowed to join. If either is
+	// non-empty, players of which neither the XUID nor the name is in these lists are disconnected during
+	// login. Names are compared case-insensitively.
+	AllowedXUIDs, AllowedNames []string
+	// DeniedXUIDs and DeniedNames hold the XUIDs and names of players that are disconnected during login, even
+	// if they are allowed by AllowedXUIDs or AllowedNames. Names are compared case-insensitively.
+	DeniedXUIDs, DeniedNames []string
+	// ApproveLogin is called with the identity and client data of each client that logged in and passed the
+	// other checks, before it is spawned. If it returns an error, the client is disconnected. If the error is
+	// a *LoginError, the client is disconnected with its message, otherwise with the message of the error.
+	// ApproveLogin is called concurrently for different clients.
+	ApproveLogin func(identity login.IdentityData, client login.ClientData) error
+	// LoginRejected is called with the *LoginError that the login of a client was rejected with, before the
+	// client is disconnected with its message. The message may be changed by LoginRejected.
+	LoginRejected func(conn *Conn, err *LoginError)
 
 	// MaximumPlayers is the maximum amount of players accepted in the server. If non-zero, players that
 	// attempt to join while the server is full will be kicked during login. If zero, the maximum player count
@@ -37,6 +66,11 @@ type ListenConfig struct {
 	// StatusProvider is the ServerStatusProvider of the Listener. When set to nil, the default provider,
 	// ListenerStatusProvider, is used as provider.
 	StatusProvider ServerStatusProvider
+	// QueryAddress is the UDP address on which the Listener answers queries of the UT3 query protocol, as
+	// implemented by the query package, with the status returned by StatusProvider and the names of the
+	// players online. If empty, queries are not answered. The address must differ from the address listened
+	// on by a "raknet" Listener.
+	QueryAddress string
 
 	// ResourcePacks is a slice of resource packs that the listener may hold. Each client will be asked to
 	// download these resource packs upon joining.
@@ -55,6 +89,14 @@ type ListenConfig struct {
 	// Login packet. The function is called with the header of the packet and its raw payload, the address
 	// from which the packet originated, and the destination address.
 	PacketFunc func(header packet.Header, payload []byte, src, dst net.Addr)
+
+	// AcceptedProtocols is a slice of protocols that clients may log in with in addition to the latest
+	// protocol, protocol.CurrentProtocol. Packets of these clients are converted by their Protocol, so that
+	// the Conn returned by Accept always exposes packets of the latest protocol. Clients with a protocol not
+	// found in this slice are disconnected during login.
+	// The pong of the Listener advertises the newest of the protocols accepted, so that Dialers supporting it
+	// negotiate it.
+	AcceptedProtocols []Protocol
 }
 
 // Listener implements a Minecraft listener on top of an unspecific net.Listener. It abstracts away the
@@ -67,25 +109,32 @@ type Listener struct {
 	// playerCount is the amount of players connected to the server. If MaximumPlayers is non-zero and equal
 	// to the playerCount, no more players will be accepted.
 	playerCount atomic.Int32
+	// players maps the *Conn of each logged in player to its display name. It is used to list players in
+	// responses to queries.
+	players sync.Map
+	// query is the query.Responder answering queries sent to the ListenConfig.QueryAddress. It is nil if
+	// QueryAddress is empty.
+	query *query.Responder
 
 	incoming chan *Conn
 	close    chan struct{}
 
-	key *ecdsa.PrivateKey
+	key    *ecdsa.PrivateKey
+	policy *loginPolicy
 }
 
-// Listen announces on the local network address. The network is typically "raknet".
+// Listen announces on the local network address. The network is typically "raknet", but may be any network
+// registered using RegisterNetwork. Networks that are not registered are passed to net.Listen.
 // If the host in the address parameter is empty or a literal unspecified IP address, Listen listens on all
 // available unicast and anycast IP addresses of the local system.
 func (cfg ListenConfig) Listen(network, address string) (*Listener, error) {
 	var netListener net.Listener
 	var err error
 
-	switch network {
-	case "raknet":
-		netListener, err = raknet.ListenConfig{ErrorLog: log.New(ioutil.Discard, "", 0)}.Listen(address)
-	default:
-		// Fall back to the standard net.Listen.
+	if n, ok := networkByName(network); ok {
+		netListener, err = n.Listen(address)
+	} else {
+		// Fall back to the standard net.Listen if the network was not registered.
 		netListener, err = net.Listen(network, address)
 	}
 	if err != nil {
@@ -105,6 +154,13 @@ func (cfg ListenConfig) Listen(network, address string) (*Listener, error) {
 		incoming: make(chan *Conn),
 		close:    make(chan struct{}),
 		key:      key,
+		policy:   newLoginPolicy(cfg),
+	}
+	if cfg.QueryAddress != "" {
+		if listener.query, err = query.Listen(cfg.QueryAddress, listener.queryStat); err != nil {
+			_ = netListener.Close()
+			return nil, err
+		}
 	}
 
 	// Actually start listening.
@@ -112,8 +168,9 @@ func (cfg ListenConfig) Listen(network, address string) (*Listener, error) {
 	return listener, nil
 }
 
-// Listen announces on the local network address. The network must be "tcp", "tcp4", "tcp6", "unix",
-// "unixpacket" or "raknet". A Listener is returned which may be used to accept connections.
+// Listen announces on the local network address. The network must be one registered using RegisterNetwork,
+// such as "raknet" or "pipe", or one supported by net.Listen, such as "tcp" or "unix". A Listener is returned
+// which may be used to accept connections.
 // If the host in the address parameter is empty or a literal unspecified IP address, Listen listens on all
 // available unicast and anycast IP addresses of the local system.
 // Listen has the default values for the fields of Listener filled out. To use different values for these
@@ -138,6 +195,8 @@ func (listener *Listener) Accept() (net.Conn, error) {
 // Disconnect disconnects a Minecraft Conn passed by first sending a disconnect with the message passed, and
 // closing the connection after. If the message passed is empty, the client will be immediately sent to the
 // server list instead of a disconnect screen.
+// Clients of which the login is rejected are disconnected using Disconnect with the message of the
+// *LoginError they were rejected with.
 func (listener *Listener) Disconnect(conn *Conn, message string) error {
 	_ = conn.WritePacket(&packet.Disconnect{
 		HideDisconnectionScreen: message == "",
@@ -151,24 +210,66 @@ func (listener *Listener) Addr() net.Addr {
 	return listener.listener.Addr()
 }
 
+// QueryAddr returns the address on which the listener answers queries, or nil if ListenConfig.QueryAddress
+// was empty.
+func (listener *Listener) QueryAddr() net.Addr {
+	if listener.query == nil {
+		return nil
+	}
+	return listener.query.Addr()
+}
+
 // Close closes the listener and the underlying net.Listener. Pending calls to Accept will fail immediately.
 func (listener *Listener) Close() error {
+	if listener.query != nil {
+		_ = listener.query.Close()
+	}
 	return listener.listener.Close()
 }
 
 // updatePongData updates the pong data of the listener using the current only players, maximum players and
 // server name of the listener, provided the listener isn't currently hijacking the pong of another server.
 func (listener *Listener) updatePongData() {
+	l, ok := listener.listener.(NetworkListener)
+	if !ok {
+		// Listeners of networks that were not registered, such as TCP, cannot be pinged.
+		return
+	}
 	s := listener.status()
+	port := listenerPort(l)
+	id, ver := listener.newestProtocol()
 
-	rakListener := listener.listener.(*raknet.Listener)
-
-	rakListener.PongData([]byte(fmt.Sprintf("MCPE;%v;%v;%v;%v;%v;%v;Minecraft Server;%v;%v;%v;%v;",
-		s.ServerName, protocol.CurrentProtocol, protocol.CurrentVersion, s.PlayerCount, s.MaxPlayers, rakListener.ID(),
-		"Creative", 1, listener.Addr().(*net.UDPAddr).Port, listener.Addr().(*net.UDPAddr).Port,
+	l.PongData([]byte(fmt.Sprintf("MCPE;%v;%v;%v;%v;%v;%v;Minecraft Server;%v;%v;%v;%v;",
+		s.ServerName, id, ver, s.PlayerCount, s.MaxPlayers, l.ID(),
+		"Creative", 1, port, port,
 	)))
 }
 
+// newestProtocol returns the ID and version of the newest protocol accepted by the listener, which is either
+// the latest protocol or one of the AcceptedProtocols.
+func (listener *Listener) newestProtocol() (int32, string) {
+	id, ver := int32(protocol.CurrentProtocol), protocol.CurrentVersion
+	for _, p := range listener.cfg.AcceptedProtocols {
+		if p.ID() > id {
+			id, ver = p.ID(), p.Ver()
+		}
+	}
+	return id, ver
+}
+
+// listenerPort returns the port the listener passed is listening on, or 0 if its address has no port.
+func listenerPort(l net.Listener) int {
+	if addr, ok := l.Addr().(*net.UDPAddr); ok {
+		return addr.Port
+	}
+	_, portStr, err := net.SplitHostPort(l.Addr().String())
+	if err != nil {
+		return 0
+	}
+	port, _ := strconv.Atoi(portStr)
+	return port
+}
+
 // listen starts listening for incoming connections and packets. When a player is fully connected, it submits
 // it to the accepted connections channel so that a call to Accept can pick it up.
 func (listener *Listener) listen() {
@@ -211,6 +312,9 @@ func (listener *Listener) createConn(netConn net.Conn) {
 	conn.biomes = listener.cfg.Biomes
 	conn.gameData.WorldName = listener.status().ServerName
 	conn.authEnabled = !listener.cfg.AuthenticationDisabled
+	conn.verifier = login.Verifier{RootKeys: listener.cfg.TrustedKeys, ClockSkew: listener.cfg.ClockSkew}
+	conn.policy = listener.policy
+	conn.acceptedProtocols = listener.cfg.AcceptedProtocols
 
 	if listener.playerCount.Load() == int32(listener.cfg.MaximumPlayers) && listener.cfg.MaximumPlayers != 0 {
 		// The server was full. We kick the player immediately and close the connection.
@@ -233,11 +337,37 @@ func (listener *Listener) status() ServerStatus {
 	return status
 }
 
+// queryStat returns the query.FullStat that queries sent to the Listener are answered with.
+func (listener *Listener) queryStat() query.FullStat {
+	s := listener.status()
+	stat := query.FullStat{
+		HostName:   s.ServerName,
+		GameType:   "SMP",
+		GameID:     "MINECRAFTPE",
+		Version:    protocol.CurrentVersion,
+		Map:        s.ServerName,
+		NumPlayers: s.PlayerCount,
+		MaxPlayers: s.MaxPlayers,
+		WhiteList:  len(listener.cfg.AllowedXUIDs) != 0 || len(listener.cfg.AllowedNames) != 0,
+		HostPort:   listenerPort(listener.listener),
+	}
+	if host, _, err := net.SplitHostPort(listener.Addr().String()); err == nil {
+		stat.HostIP = host
+	}
+	listener.players.Range(func(_, name interface{}) bool {
+		stat.Players = append(stat.Players, name.(string))
+		return true
+	})
+	sort.Strings(stat.Players)
+	return stat
+}
+
 // handleConn handles an incoming connection of the Listener. It will first attempt to get the connection to
 // log in, after which it will expose packets received to the user.
 func (listener *Listener) handleConn(conn *Conn) {
 	defer func() {
 		_ = conn.Close()
+		listener.players.Delete(conn)
 		listener.playerCount.Add(-1)
 		listener.updatePongData()
 	}()
@@ -254,10 +384,18 @@ func (listener *Listener) handleConn(conn *Conn) {
 		for _, data := range packets {
 			loggedInBefore := conn.loggedIn
 			if err := conn.receive(data); err != nil {
+				var loginErr *LoginError
+				if errors.As(err, &loginErr) {
+					if listener.cfg.LoginRejected != nil {
+						listener.cfg.LoginRejected(conn, loginErr)
+					}
+					_ = listener.Disconnect(conn, loginErr.Message)
+				}
 				listener.cfg.ErrorLog.Printf("error: %v", err)
 				return
 			}
 			if !loggedInBefore && conn.loggedIn {
+				listener.players.Store(conn, conn.identityData.DisplayName)
 				select {
 				case <-listener.close:
 					// The listener was closed while this one was logged in, so the incoming channel will be
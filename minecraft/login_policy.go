@@ -0,0 +1,90 @@
+package minecraft
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/square/go-jose.v2/jwt"
+	"phoenix/minecraft/protocol/login"
+	"strings"
+)
+
+// loginPolicy decides if clients that logged in at a Listener are accepted, using the allow and deny lists
+// and the ApproveLogin function of the ListenConfig of the Listener.
+type loginPolicy struct {
+	allowedXUIDs, allowedNames map[string]struct{}
+	deniedXUIDs, deniedNames   map[string]struct{}
+	approve                    func(identity login.IdentityData, client login.ClientData) error
+}
+
+// newLoginPolicy returns the loginPolicy of the ListenConfig passed.
+func newLoginPolicy(cfg ListenConfig) *loginPolicy {
+	return &loginPolicy{
+		allowedXUIDs: stringSet(cfg.AllowedXUIDs, false),
+		allowedNames: stringSet(cfg.AllowedNames, true),
+		deniedXUIDs:  stringSet(cfg.DeniedXUIDs, false),
+		deniedNames:  stringSet(cfg.DeniedNames, true),
+		approve:      cfg.ApproveLogin,
+	}
+}
+
+// check checks if the client with the identity and client data passed may join. If not, a *LoginError is
+// returned. Denied clients are rejected even if they are also allowed.
+func (p *loginPolicy) check(identity login.IdentityData, client login.ClientData) error {
+	name := strings.ToLower(identity.DisplayName)
+	if contains(p.deniedXUIDs, identity.XUID) || contains(p.deniedNames, name) {
+		return rejectLogin(RejectDenied, fmt.Errorf("%v (XUID %q) is denied", identity.DisplayName, identity.XUID))
+	}
+	if len(p.allowedXUIDs) != 0 || len(p.allowedNames) != 0 {
+		if !contains(p.allowedXUIDs, identity.XUID) && !contains(p.allowedNames, name) {
+			return rejectLogin(RejectNotAllowed, fmt.Errorf("%v (XUID %q) is not allowed", identity.DisplayName, identity.XUID))
+		}
+	}
+	if p.approve == nil {
+		return nil
+	}
+	if err := p.approve(identity, client); err != nil {
+		var loginErr *LoginError
+		if errors.As(err, &loginErr) {
+			return loginErr
+		}
+		return &LoginError{Reason: RejectByHook, Message: err.Error(), Err: err}
+	}
+	return nil
+}
+
+// rejectRequest returns the *LoginError for a login request that failed to parse with the error passed.
+func rejectRequest(err error) *LoginError {
+	err = fmt.Errorf("parse login request: %w", err)
+	switch {
+	case errors.Is(err, login.ErrUntrustedChain):
+		return rejectLogin(RejectUnauthenticated, err)
+	case errors.Is(err, jwt.ErrExpired), errors.Is(err, jwt.ErrNotValidYet), errors.Is(err, jwt.ErrIssuedInTheFuture):
+		return rejectLogin(RejectExpired, err)
+	}
+	return rejectLogin(RejectInvalidRequest, err)
+}
+
+// stringSet returns a set holding the strings passed, which are converted to lower case if lower is true.
+// If no strings are passed, stringSet returns nil.
+func stringSet(values []string, lower bool) map[string]struct{} {
+	if len(values) == 0 {
+		return nil
+	}
+	m := make(map[string]struct{}, len(values))
+	for _, v := range values {
+		if lower {
+			v = strings.ToLower(v)
+		}
+		m[v] = struct{}{}
+	}
+	return m
+}
+
+// contains checks if the set passed holds the non-empty value passed.
+func contains(set map[string]struct{}, v string) bool {
+	if v == "" {
+		return false
+	}
+	_, ok := set[v]
+	return ok
+}
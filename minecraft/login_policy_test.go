@@ -0,0 +1,102 @@
+package minecraft_test
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"io/ioutil"
+	"phoenix/minecraft"
+	"phoenix/minecraft/auth/authtest"
+	"phoenix/minecraft/protocol/login"
+	"phoenix/minecraft/text"
+	"testing"
+	"time"
+)
+
+// dialRejected dials the Listener passed using the Dialer passed and checks that the client is disconnected
+// during login with the message passed.
+func dialRejected(t *testing.T, network string, dialer minecraft.Dialer, message string) {
+	t.Helper()
+	conn, err := dialer.DialTimeout(network, pipeAddress, time.Second*5)
+	if err == nil {
+		_ = conn.Close()
+		t.Fatalf("login of %v was not rejected", dialer.IdentityData.DisplayName)
+	}
+	var disconnect minecraft.DisconnectError
+	if !errors.As(err, &disconnect) {
+		t.Fatalf("login of %v failed without disconnect: %v", dialer.IdentityData.DisplayName, err)
+	}
+	if string(disconnect) != message {
+		t.Fatalf("login of %v rejected with message %q, expected %q", dialer.IdentityData.DisplayName, disconnect, message)
+	}
+}
+
+// TestLoginPolicy checks that clients are accepted or rejected according to the allow and deny lists and the
+// ApproveLogin function of a Listener, and that the rejections are passed to the client.
+func TestLoginPolicy(t *testing.T) {
+	const network = "pipe-login-policy"
+	const maintenance = "The server is in maintenance."
+	rejected := make(chan minecraft.RejectReason, 4)
+	listener := listenPipe(t, network, minecraft.ListenConfig{
+		AuthenticationDisabled: true,
+		AllowedNames:           []string{"tester", "Griefer", "Maintainer"},
+		DeniedNames:            []string{"griefer"},
+		LoginRejected: func(conn *minecraft.Conn, err *minecraft.LoginError) {
+			rejected <- err.Reason
+		},
+		ApproveLogin: func(identity login.IdentityData, client login.ClientData) error {
+			if identity.DisplayName == "Maintainer" {
+				return errors.New(maintenance)
+			}
+			return nil
+		},
+	})
+
+	dial := func(name string) minecraft.Dialer {
+		return minecraft.Dialer{IdentityData: login.IdentityData{DisplayName: name}}
+	}
+	if _, server := dialAccept(t, listener, network, dial("Tester")); server.IdentityData().DisplayName != "Tester" {
+		t.Fatalf("server got display name %v, expected Tester", server.IdentityData().DisplayName)
+	}
+	denied := text.Colourf("<red>You are not allowed to join this server.</red>")
+	for _, c := range []struct {
+		name, message string
+		reason        minecraft.RejectReason
+	}{
+		{name: "Griefer", message: denied, reason: minecraft.RejectDenied},
+		{name: "Stranger", message: denied, reason: minecraft.RejectNotAllowed},
+		{name: "Maintainer", message: maintenance, reason: minecraft.RejectByHook},
+	} {
+		dialRejected(t, network, dial(c.name), c.message)
+		if reason := <-rejected; reason != c.reason {
+			t.Fatalf("login of %v rejected for reason %v, expected %v", c.name, reason, c.reason)
+		}
+	}
+}
+
+// TestLoginClockSkew checks that login chains issued by an identity provider with a clock that is ahead are
+// only accepted if the Listener tolerates the skew.
+func TestLoginClockSkew(t *testing.T) {
+	fake := authtest.NewServer("Fake Player", "2535400000000003")
+	defer fake.Close()
+	fake.ClockOffset = time.Minute * 3
+	provider := fake.Provider()
+	dialer := minecraft.Dialer{TokenSource: provider.TokenSource(ioutil.Discard), AuthProvider: provider}
+	trusted := []*ecdsa.PublicKey{&fake.RootKey.PublicKey}
+
+	rejected := make(chan minecraft.RejectReason, 1)
+	listenPipe(t, "pipe-login-skew", minecraft.ListenConfig{
+		TrustedKeys: trusted,
+		LoginRejected: func(conn *minecraft.Conn, err *minecraft.LoginError) {
+			rejected <- err.Reason
+		},
+	})
+	dialRejected(t, "pipe-login-skew", dialer, text.Colourf("<red>Your login has expired. Check the clock of your device and try again.</red>"))
+	if reason := <-rejected; reason != minecraft.RejectExpired {
+		t.Fatalf("login rejected for reason %v, expected %v", reason, minecraft.RejectExpired)
+	}
+
+	listener := listenPipe(t, "pipe-login-skew-tolerated", minecraft.ListenConfig{TrustedKeys: trusted, ClockSkew: time.Minute * 5})
+	if _, server := dialAccept(t, listener, "pipe-login-skew-tolerated", dialer); server.IdentityData().XUID != fake.Identity.XUID {
+		t.Fatalf("server got identity %+v, expected %+v", server.IdentityData(), fake.Identity)
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"go/ast"
 	"io"
 	"reflect"
-	"strings"
 	"sync"
 )
 
@@ -67,10 +66,13 @@ func (d *Decoder) Decode(v interface{}) error {
 // that the matching TAG_Compound in the NBT has, in order to prevent the loss of data. For varying data, the
 // data should be decoded into a map.
 // Nil maps and slices are initialised and filled out automatically by Unmarshal.
+// Values implementing Unmarshaler are passed the Tag read for them, and values of a Tag type are set to the
+// Tag read if it has that type.
 //
 // Unmarshal accepts struct fields with the 'nbt' struct tag. The 'nbt' struct tag allows setting the name of
 // a field that some tag should be decoded in. Setting the struct tag to '-' means that field will never be
-// filled by the decoding of the data passed.
+// filled by the decoding of the data passed. The options ',inline', ',type=<type>' and ',default=<SNBT>'
+// are described in the package documentation, along with the errors they may cause.
 func Unmarshal(data []byte, v interface{}) error {
 	return UnmarshalEncoding(data, v, NetworkLittleEndian)
 }
@@ -96,13 +98,23 @@ var int64Type = reflect.TypeOf(int64(0))
 // are put back into the pool, but are re-used simply so that they need not to be re-allocated each operation.
 var fieldMapPool = sync.Pool{
 	New: func() interface{} {
-		return map[string]reflect.Value{}
+		return map[string]structField{}
 	},
 }
 
+// structField is a field of a struct that a TAG_Compound is decoded into, along with the options set in its
+// struct tag.
+type structField struct {
+	val  reflect.Value
+	opts fieldTag
+}
+
 // unmarshalTag decodes a tag from the decoder's input stream into the reflect.Value passed, assuming the tag
 // has the type and name passed.
 func (d *Decoder) unmarshalTag(val reflect.Value, tagType byte, tagName string) error {
+	if ok, err := d.decodesItself(val, tagType, tagName); ok {
+		return err
+	}
 	switch tagType {
 	default:
 		return UnknownTagError{Off: d.r.off, TagType: tagType, Op: "Match"}
@@ -251,14 +263,21 @@ func (d *Decoder) unmarshalTag(val reflect.Value, tagType byte, tagName string)
 		if err != nil {
 			return err
 		}
-		value := reflect.New(reflect.ArrayOf(int(length), int32Type)).Elem()
+		if length < 0 {
+			return InvalidArraySizeError{Off: d.r.off, Op: "Int32Array", NBTLength: int(length)}
+		}
+		// The values are read before the array is created, so that no huge array is allocated if the length
+		// is larger than the data available.
+		values := make([]int32, 0, minLength(length))
 		for i := int32(0); i < length; i++ {
 			v, err := d.Encoding.Int32(d.r)
 			if err != nil {
 				return err
 			}
-			value.Index(int(i)).SetInt(int64(v))
+			values = append(values, v)
 		}
+		value := reflect.New(reflect.ArrayOf(int(length), int32Type)).Elem()
+		reflect.Copy(value, reflect.ValueOf(values))
 		if val.Kind() != reflect.Array || val.Type().Elem().Kind() != reflect.Int32 {
 			if val.Kind() == reflect.Interface && val.NumMethod() == 0 {
 				// Empty interface.
@@ -277,14 +296,19 @@ func (d *Decoder) unmarshalTag(val reflect.Value, tagType byte, tagName string)
 		if err != nil {
 			return err
 		}
-		value := reflect.New(reflect.ArrayOf(int(length), int64Type)).Elem()
+		if length < 0 {
+			return InvalidArraySizeError{Off: d.r.off, Op: "Int64Array", NBTLength: int(length)}
+		}
+		values := make([]int64, 0, minLength(length))
 		for i := int32(0); i < length; i++ {
 			v, err := d.Encoding.Int64(d.r)
 			if err != nil {
 				return err
 			}
-			value.Index(int(i)).SetInt(v)
+			values = append(values, v)
 		}
+		value := reflect.New(reflect.ArrayOf(int(length), int64Type)).Elem()
+		reflect.Copy(value, reflect.ValueOf(values))
 		if val.Kind() != reflect.Array || val.Type().Elem().Kind() != reflect.Int64 {
 			if val.Kind() == reflect.Interface && val.NumMethod() == 0 {
 				// Empty interface.
@@ -311,6 +335,9 @@ func (d *Decoder) unmarshalTag(val reflect.Value, tagType byte, tagName string)
 		if err != nil {
 			return err
 		}
+		if length < 0 {
+			return InvalidArraySizeError{Off: d.r.off, Op: "List", NBTLength: int(length)}
+		}
 		valType := val.Type()
 		if val.Kind() != reflect.Slice && val.Kind() != reflect.Interface {
 			return InvalidTypeError{Off: d.r.off, FieldType: val.Type(), Field: tagName, TagType: tagType}
@@ -318,18 +345,20 @@ func (d *Decoder) unmarshalTag(val reflect.Value, tagType byte, tagName string)
 		if val.Kind() == reflect.Interface {
 			valType = reflect.SliceOf(valType)
 		}
-		v := reflect.MakeSlice(valType, int(length), int(length))
-		if length != 0 {
-			for i := 0; i < int(length); i++ {
-				if err := d.unmarshalTag(v.Index(i), listType, ""); err != nil {
-					// An error occurred during the decoding of one of the elements of the TAG_List, meaning it
-					// either had an invalid type or the NBT was invalid.
-					if _, ok := err.(InvalidTypeError); ok {
-						return InvalidTypeError{Off: d.r.off, FieldType: valType.Elem(), Field: fmt.Sprintf("%v[%v]", tagName, i), TagType: listType}
-					}
-					return err
+		// The slice is grown while the elements are read, so that no huge slice is allocated if the length is
+		// larger than the data available.
+		v := reflect.MakeSlice(valType, 0, minLength(length))
+		for i := 0; i < int(length); i++ {
+			elem := reflect.New(valType.Elem()).Elem()
+			if err := d.unmarshalTag(elem, listType, ""); err != nil {
+				// An error occurred during the decoding of one of the elements of the TAG_List, meaning it
+				// either had an invalid type or the NBT was invalid.
+				if _, ok := err.(InvalidTypeError); ok {
+					return InvalidTypeError{Off: d.r.off, FieldType: valType.Elem(), Field: fmt.Sprintf("%v[%v]", tagName, i), TagType: listType}
 				}
+				return err
 			}
+			v = reflect.Append(v, elem)
 		}
 		val.Set(v)
 		d.depth--
@@ -342,8 +371,13 @@ func (d *Decoder) unmarshalTag(val reflect.Value, tagType byte, tagName string)
 		case reflect.Struct:
 			// We first fetch a fields map from the sync.Pool. These maps already have a base size obtained
 			// from when they were used, meaning we don't have to re-allocate each element.
-			fields := fieldMapPool.Get().(map[string]reflect.Value)
-			d.populateFields(val, fields)
+			fields := fieldMapPool.Get().(map[string]structField)
+			// rest is a map inlined in the struct, if any, which holds all tags that the struct has no
+			// field for.
+			var rest reflect.Value
+			if err := d.populateFields(val, fields, &rest); err != nil {
+				return err
+			}
 			for {
 				nestedTagType, nestedTagName, err := d.tag()
 				if err != nil {
@@ -358,11 +392,19 @@ func (d *Decoder) unmarshalTag(val reflect.Value, tagType byte, tagName string)
 				}
 				field, ok := fields[nestedTagName]
 				if ok {
-					if err = d.unmarshalTag(field, nestedTagType, nestedTagName); err != nil {
+					if err = d.unmarshalField(field.val, nestedTagType, nestedTagName, field.opts); err != nil {
 						return err
 					}
 					continue
 				}
+				if rest.IsValid() {
+					value := reflect.New(rest.Type().Elem()).Elem()
+					if err := d.unmarshalTag(value, nestedTagType, nestedTagName); err != nil {
+						return err
+					}
+					rest.SetMapIndex(reflect.ValueOf(nestedTagName), value)
+					continue
+				}
 				// We return an error if the struct does not have one of the fields found in the compound. It
 				// is rather important no data is lost during the decoding.
 				return UnexpectedNamedTagError{Off: d.r.off, TagName: tagName + "." + nestedTagName, TagType: nestedTagType}
@@ -407,9 +449,19 @@ func (d *Decoder) unmarshalTag(val reflect.Value, tagType byte, tagName string)
 	return nil
 }
 
+// minLength returns the capacity to allocate for a list or array with the length passed, which is at most
+// 1024 elements, as the length read may be larger than the data available.
+func minLength(length int32) int {
+	if length > 1024 {
+		return 1024
+	}
+	return int(length)
+}
+
 // populateFields populates the map passed with the fields of the reflect representation of a struct passed.
-// It takes into consideration the nbt struct field tag.
-func (d *Decoder) populateFields(val reflect.Value, m map[string]reflect.Value) {
+// It takes into consideration the nbt struct field tag: Fields with a default value are set to it, and the
+// fields of inlined structs are added to the map. If a map is inlined, rest is set to it.
+func (d *Decoder) populateFields(val reflect.Value, m map[string]structField, rest *reflect.Value) error {
 	for i := 0; i < val.NumField(); i++ {
 		fieldType := val.Type().Field(i)
 		if !ast.IsExported(fieldType.Name) {
@@ -417,23 +469,58 @@ func (d *Decoder) populateFields(val reflect.Value, m map[string]reflect.Value)
 			continue
 		}
 		field := val.Field(i)
-		name := fieldType.Name
-		if fieldType.Anonymous {
-			// We got an anonymous struct field, so we decode that into the same level.
-			d.populateFields(field, m)
+		opts, err := parseFieldTag(fieldType)
+		if err != nil {
+			return err
+		}
+		if opts.skip {
 			continue
 		}
-		if tag, ok := fieldType.Tag.Lookup("nbt"); ok {
-			if tag == "-" {
-				continue
+		if opts.inline {
+			// We got an anonymous struct field or one with the ',inline' option, so we decode that into the
+			// same level.
+			if field.Kind() == reflect.Ptr {
+				if field.IsNil() {
+					field.Set(reflect.New(field.Type().Elem()))
+				}
+				field = field.Elem()
+			}
+			switch {
+			case field.Kind() == reflect.Struct:
+				if err := d.populateFields(field, m, rest); err != nil {
+					return err
+				}
+			case field.Kind() == reflect.Map && field.Type().Key().Kind() == reflect.String:
+				if field.IsNil() {
+					field.Set(reflect.MakeMap(field.Type()))
+				}
+				*rest = field
+			default:
+				return IncompatibleTypeError{ValueName: fieldType.Name, Type: fieldType.Type}
 			}
-			tag = strings.TrimSuffix(tag, ",omitempty")
-			if tag != "" {
-				name = tag
+			continue
+		}
+		if opts.hasDefault {
+			if err := opts.setDefault(field); err != nil {
+				return err
 			}
 		}
-		m[name] = field
+		m[opts.name] = structField{val: field, opts: opts}
+	}
+	return nil
+}
+
+// unmarshalField decodes a tag with the type and name passed into the value of a struct field, taking the
+// options of its struct tag into consideration.
+func (d *Decoder) unmarshalField(val reflect.Value, tagType byte, tagName string, opts fieldTag) error {
+	if opts.tagType == 0 {
+		return d.unmarshalTag(val, tagType, tagName)
+	}
+	tag, err := d.readTag(tagType, tagName)
+	if err != nil {
+		return err
 	}
+	return d.setForced(val, tag, tagName)
 }
 
 // tag reads a tag from the decoder, and its name if the tag type is not a TAG_End.
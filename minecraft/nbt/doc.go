@@ -21,12 +21,42 @@
 //   []<type>: TAG_List
 //   struct{...}: TAG_Compound
 //   map[string]<type/interface{}>: TAG_Compound
+//   nbt.Tag: the tag itself (see below)
+//
+// Types that implement nbt.Marshaler or nbt.Unmarshaler encode or decode themselves, by returning or
+// accepting the nbt.Tag they are encoded as. This works the same for all encodings.
 //
 // Structures decoded or encoded may have struct field tags in a comparable way to the JSON standard library.
-// The 'nbt' struct tag may be filled out the following ways:
+// The 'nbt' struct tag holds the name of the field, followed by options separated by commas, such as
+// 'nbt:"Count,type=byte,omitempty"'. It may be filled out the following ways:
 //   '-': Ignores the field completely when encoding and decoding.
+//   'name': Encodes/decodes the field with a different name than its usual name.
 //   ',omitempty': Doesn't encode the field if its value is the same as the default value.
-//   'name(,omitempty)': Encodes/decodes the field with a different name than its usual name.
-// If no 'nbt' struct tag is present for a field, the name of the field will be used to encode/decode the
-// struct. Note that this package, unlike the JSON standard library package, is case sensitive when decoding.
+//   ',inline': Encodes/decodes the fields of a struct, or the entries of a map, in the same TAG_Compound as
+//              the other fields. Tags that no other field has are decoded into an inlined map.
+//   ',type=<type>': Encodes the field as a specific tag type: byte, short, int, long, float, double, string,
+//                   bytearray, intarray or longarray. Numbers and booleans may be encoded as any number
+//                   type that can hold their value, and slices or arrays as the array type of their element.
+//                   When decoding, any number tag is converted to the type of the field.
+//   ',default=<SNBT>': Sets the field to a default value, written in SNBT, if the TAG_Compound decoded does
+//                      not have its tag. With ',omitempty', the field is not encoded if it has this value.
+//                      This option must come last, as the value may hold commas itself.
+// Embedded structs are encoded as if they had the ',inline' option, unless their struct tag has a name. If
+// no 'nbt' struct tag is present for a field, the name of the field will be used to encode/decode the struct.
+// Note that this package, unlike the JSON standard library package, is case sensitive when decoding.
+//
+// An IncompatibleTypeError is returned if a struct tag has an unknown option or type, or if a value cannot
+// be encoded as the type set in its struct tag. An InvalidTypeError is returned if a tag cannot be decoded
+// into the type of a field, including tags that a field with a forced type cannot hold. Errors returned by
+// MarshalNBT and UnmarshalNBT methods are returned as they are, and an invalid default value results in an
+// InvalidSNBTError.
+//
+// Values may also be encoded to and decoded from SNBT, the text format of NBT used in the arguments of
+// commands, using nbt.MarshalSNBT() and nbt.UnmarshalSNBT(). These use the same conversion between Go types
+// and NBT tags.
+//
+// NBT that must be edited without losing the exact types of tags or the order of tags in compounds, such as
+// that of .mcstructure files, may be decoded into a tree of tags using nbt.UnmarshalTag() and encoded again
+// using nbt.MarshalTag(). Large NBT may be read and written one token at a time using nbt.NewTokenReader()
+// and nbt.NewTokenWriter().
 package nbt
@@ -5,7 +5,6 @@ import (
 	"io"
 	"math"
 	"reflect"
-	"strings"
 	"sync"
 )
 
@@ -45,6 +44,16 @@ func NewEncoderWithEncoding(w io.Writer, encoding Encoding) *Encoder {
 // docs for the conversion from Go types to NBT tags and special struct tags.
 func (e *Encoder) Encode(v interface{}) error {
 	val := reflect.ValueOf(v)
+	if !val.IsValid() {
+		return IncompatibleTypeError{ValueName: "nil"}
+	}
+	if val.Kind() != reflect.Ptr {
+		// The value is copied so that it is addressable, which allows calling MarshalNBT methods with a
+		// pointer receiver on it and its fields.
+		ptr := reflect.New(val.Type())
+		ptr.Elem().Set(val)
+		val = ptr
+	}
 	return e.marshal(val, "")
 }
 
@@ -70,10 +79,13 @@ func (e *Encoder) Encode(v interface{}) error {
 //   struct{...}: TAG_Compound
 //   map[string]<type/interface{}>: TAG_Compound
 //
+// Values implementing Marshaler, and values that are a Tag, are encoded as the Tag they return or are.
+//
 // Marshal accepts struct fields with the 'nbt' struct tag. The 'nbt' struct tag allows setting the name of
 // a field that some tag should be decoded in. Setting the struct tag to '-' means that field will never be
 // filled by the decoding of the data passed. Suffixing the 'nbt' struct tag with ',omitempty' will prevent
-// the field from being encoded if it is equal to its default value.
+// the field from being encoded if it is equal to its default value. The options ',inline', ',type=<type>'
+// and ',default=<SNBT>' are described in the package documentation, along with the errors they may cause.
 func Marshal(v interface{}) ([]byte, error) {
 	return MarshalEncoding(v, NetworkLittleEndian)
 }
@@ -103,6 +115,15 @@ var bufferPool = sync.Pool{
 // name and payload. An error is returned if any values in the reflect.Value found were not representable
 // with an NBT tag.
 func (e *Encoder) marshal(val reflect.Value, tagName string) error {
+	if tag, ok, err := tagOf(val, tagName); ok {
+		if err != nil {
+			return err
+		}
+		if err := e.writeTag(byte(tag.Type()), tagName); err != nil {
+			return err
+		}
+		return e.tokens().payload(tag, tagName)
+	}
 	if val.Kind() == reflect.Interface {
 		val = val.Elem()
 	}
@@ -208,6 +229,22 @@ func (e *Encoder) encode(val reflect.Value, tagName string) error {
 				elemType = val.Index(0).Elem().Type()
 			}
 		}
+		if encodesItself(elemType) {
+			// The type of the elements is only known once they are encoded, so they are encoded as a List.
+			list := &List{Tags: make([]Tag, val.Len())}
+			for i := range list.Tags {
+				tag, _, err := tagOf(val.Index(i), tagName)
+				if err != nil {
+					return err
+				}
+				list.Tags[i] = tag
+			}
+			if len(list.Tags) != 0 {
+				list.ElemType = list.Tags[0].Type()
+			}
+			e.depth--
+			return e.tokens().payload(list, tagName)
+		}
 
 		listType := tagFromType(elemType)
 		if listType == math.MaxUint8 {
@@ -258,38 +295,83 @@ func (e *Encoder) writeStructValues(val reflect.Value) error {
 	for i := 0; i < val.NumField(); i++ {
 		fieldType := val.Type().Field(i)
 		fieldValue := val.Field(i)
-		tag := fieldType.Tag.Get("nbt")
-		if fieldType.PkgPath != "" || tag == "-" {
-			// Either the PkgPath was not empty, meaning we're dealing with an unexported field, or the
-			// tag was '-', meaning we should skip it.
+		if fieldType.PkgPath != "" {
+			// The PkgPath was not empty, meaning we're dealing with an unexported field.
+			continue
+		}
+		opts, err := parseFieldTag(fieldType)
+		if err != nil {
+			return err
+		}
+		if opts.skip {
 			continue
 		}
-		if fieldType.Anonymous {
-			// The field was anonymous, so we write that in the same compound tag as this one.
-			if err := e.writeStructValues(fieldValue); err != nil {
+		if opts.inline {
+			// The field was anonymous or had the ',inline' option, so we write its values in the same
+			// compound tag as this one.
+			if err := e.writeInline(fieldValue, opts.name); err != nil {
 				return err
 			}
 			continue
 		}
-		tagName := fieldType.Name
-		if strings.HasSuffix(tag, ",omitempty") {
-			tag = strings.TrimSuffix(tag, ",omitempty")
-			if reflect.DeepEqual(fieldValue.Interface(), reflect.Zero(fieldValue.Type()).Interface()) {
-				// The tag had the ',omitempty' tag, meaning it should be omitted if it has the zero
-				// value. If this is reached, that was the case, and we skip it.
+		if opts.omitEmpty {
+			empty, err := opts.isEmpty(fieldValue)
+			if err != nil {
+				return err
+			}
+			if empty {
+				// The tag had the ',omitempty' option, meaning it should be omitted if it has the zero
+				// or default value. If this is reached, that was the case, and we skip it.
 				continue
 			}
 		}
-		if tag != "" {
-			tagName = tag
+		if opts.tagType != 0 {
+			tag, err := forcedTag(fieldValue, opts.tagType, opts.name)
+			if err != nil {
+				return err
+			}
+			if err := e.writeTag(opts.tagType, opts.name); err != nil {
+				return err
+			}
+			if err := e.tokens().payload(tag, opts.name); err != nil {
+				return err
+			}
+			continue
 		}
-		if err := e.marshal(fieldValue, tagName); err != nil {
+		if err := e.marshal(fieldValue, opts.name); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// writeInline writes the values of a struct or map inlined in another struct to the io.Writer of the
+// encoder, without opening a new compound tag.
+func (e *Encoder) writeInline(val reflect.Value, tagName string) error {
+	if val.Kind() == reflect.Interface || val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return nil
+		}
+		val = val.Elem()
+	}
+	switch val.Kind() {
+	case reflect.Struct:
+		return e.writeStructValues(val)
+	case reflect.Map:
+		if val.Type().Key().Kind() != reflect.String {
+			return IncompatibleTypeError{Type: val.Type(), ValueName: tagName}
+		}
+		iter := val.MapRange()
+		for iter.Next() {
+			if err := e.marshal(iter.Value(), iter.Key().String()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return IncompatibleTypeError{Type: val.Type(), ValueName: tagName}
+}
+
 // writeTag writes a single tag to the io.Writer held by the Encoder. The tag type and the name are written.
 func (e *Encoder) writeTag(tagType byte, tagName string) error {
 	if e.depth >= maximumNestingDepth {
@@ -153,3 +153,15 @@ type MaximumBytesReadError struct {
 func (err MaximumBytesReadError) Error() string {
 	return fmt.Sprintf("nbt: limit of bytes read %v with NetworkLittleEndian format exhausted", maximumNetworkOffset)
 }
+
+// InvalidSNBTError is returned by UnmarshalSNBT if the text passed is not valid SNBT. Off is the offset in
+// bytes in the text at which the problem was found.
+type InvalidSNBTError struct {
+	Off int64
+	Err error
+}
+
+// Error ...
+func (err InvalidSNBTError) Error() string {
+	return fmt.Sprintf("nbt: invalid SNBT at offset %v: %v", err.Off, err.Err)
+}
@@ -0,0 +1,271 @@
+package nbt
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// fieldTag holds the options set in the 'nbt' struct tag of a struct field. See the doc.go file for the
+// options that may be set.
+type fieldTag struct {
+	// name is the name of the tag that the field is encoded as.
+	name string
+	// skip is true if the field is never encoded or decoded.
+	skip bool
+	// omitEmpty is true if the field is not encoded if it has its zero value or its default value.
+	omitEmpty bool
+	// inline is true if the fields of the field, which is a struct or map, are encoded in the compound of the
+	// struct holding the field.
+	inline bool
+	// tagType is the tag type that the field is forced to be encoded as, or 0 if it is not forced.
+	tagType byte
+	// def is the default value of the field, written in SNBT, and hasDefault is true if the field has one.
+	def        string
+	hasDefault bool
+}
+
+// tagTypeNames maps the names that may be used in the 'type=' option of a struct tag to their tag type.
+var tagTypeNames = map[string]byte{
+	"byte":      tagByte,
+	"short":     tagInt16,
+	"int":       tagInt32,
+	"long":      tagInt64,
+	"float":     tagFloat32,
+	"double":    tagFloat64,
+	"string":    tagString,
+	"bytearray": tagByteArray,
+	"intarray":  tagInt32Array,
+	"longarray": tagInt64Array,
+}
+
+// parseFieldTag parses the 'nbt' struct tag of the struct field passed. An IncompatibleTypeError is returned
+// if the struct tag has an unknown option or an unknown tag type.
+func parseFieldTag(field reflect.StructField) (fieldTag, error) {
+	opts := fieldTag{name: field.Name}
+	tag := field.Tag.Get("nbt")
+	if tag == "-" {
+		opts.skip = true
+		return opts, nil
+	}
+	// The default value is always the last option, so that it may hold commas itself.
+	if i := strings.Index(tag, ",default="); i != -1 {
+		opts.def, opts.hasDefault = tag[i+len(",default="):], true
+		tag = tag[:i]
+	}
+	options := strings.Split(tag, ",")
+	if options[0] != "" {
+		opts.name = options[0]
+	}
+	for _, option := range options[1:] {
+		switch {
+		case option == "omitempty":
+			opts.omitEmpty = true
+		case option == "inline":
+			opts.inline = true
+		case strings.HasPrefix(option, "type="):
+			tagType, ok := tagTypeNames[strings.TrimPrefix(option, "type=")]
+			if !ok {
+				return opts, IncompatibleTypeError{ValueName: field.Name + " (" + option + ")", Type: field.Type}
+			}
+			opts.tagType = tagType
+		default:
+			return opts, IncompatibleTypeError{ValueName: field.Name + " (unknown option " + option + ")", Type: field.Type}
+		}
+	}
+	if field.Anonymous && options[0] == "" {
+		// Embedded structs without a name are encoded in the same compound as the struct embedding them.
+		opts.inline = true
+	}
+	return opts, nil
+}
+
+// isEmpty checks if the value of the field passed is empty, meaning it is equal to its default value, or to
+// its zero value if it has no default value.
+func (opts fieldTag) isEmpty(val reflect.Value) (bool, error) {
+	empty := reflect.Zero(val.Type())
+	if opts.hasDefault {
+		empty = reflect.New(val.Type()).Elem()
+		if err := opts.setDefault(empty); err != nil {
+			return false, err
+		}
+	}
+	return reflect.DeepEqual(val.Interface(), empty.Interface()), nil
+}
+
+// setDefault decodes the default value of the field, written in SNBT, into the value passed.
+func (opts fieldTag) setDefault(val reflect.Value) error {
+	buf := bytes.NewBuffer(nil)
+	p := &snbtParser{s: opts.def, buf: buf, w: &offsetWriter{Writer: buf, WriteByte: buf.WriteByte}}
+	if err := p.root(); err != nil {
+		return err
+	}
+	d := &Decoder{Encoding: LittleEndian, r: &offsetReader{Reader: buf, ReadByte: buf.ReadByte, Next: buf.Next}}
+	tagType, _, err := d.tag()
+	if err != nil {
+		return err
+	}
+	return d.unmarshalField(val, tagType, opts.name, opts)
+}
+
+// forcedTag returns the tag of the type passed that a value is encoded as, for fields with a forced tag
+// type. Numbers and booleans may be encoded as any numeric tag that can hold their value, strings as a
+// TAG_String, and slices and arrays as the array tag of their element type. An IncompatibleTypeError is
+// returned if the value cannot be encoded as the tag type.
+func forcedTag(val reflect.Value, tagType byte, name string) (Tag, error) {
+	incompatible := IncompatibleTypeError{ValueName: name + " (as " + tagName(tagType) + ")", Type: val.Type()}
+	switch tagType {
+	case tagByte, tagInt16, tagInt32, tagInt64, tagFloat32, tagFloat64:
+		var i int64
+		var f float64
+		unsigned := false
+		switch val.Kind() {
+		case reflect.Bool:
+			if val.Bool() {
+				i, f = 1, 1
+			}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			i = val.Int()
+			f = float64(i)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if val.Uint() > math.MaxInt64 {
+				return nil, incompatible
+			}
+			i = int64(val.Uint())
+			f = float64(i)
+			unsigned = true
+		case reflect.Float32, reflect.Float64:
+			f = val.Float()
+			i = int64(f)
+			if tagType != tagFloat32 && tagType != tagFloat64 && float64(i) != f {
+				return nil, incompatible
+			}
+		default:
+			return nil, incompatible
+		}
+		switch tagType {
+		case tagByte:
+			// TAG_Byte values are signed, but unsigned Go values, such as bytes, are written as they are.
+			if (unsigned && i > math.MaxUint8) || (!unsigned && (i < math.MinInt8 || i > math.MaxInt8)) {
+				return nil, incompatible
+			}
+			return Byte(i), nil
+		case tagInt16:
+			if i < math.MinInt16 || i > math.MaxInt16 {
+				return nil, incompatible
+			}
+			return Short(i), nil
+		case tagInt32:
+			if i < math.MinInt32 || i > math.MaxInt32 {
+				return nil, incompatible
+			}
+			return Int(i), nil
+		case tagInt64:
+			return Long(i), nil
+		case tagFloat32:
+			return Float(f), nil
+		}
+		return Double(f), nil
+	case tagString:
+		if val.Kind() != reflect.String {
+			return nil, incompatible
+		}
+		return String(val.String()), nil
+	case tagByteArray, tagInt32Array, tagInt64Array:
+		if val.Kind() != reflect.Slice && val.Kind() != reflect.Array {
+			return nil, incompatible
+		}
+		n := val.Len()
+		switch elem := val.Type().Elem().Kind(); {
+		case tagType == tagByteArray && elem == reflect.Uint8:
+			v := make(ByteArray, n)
+			for i := range v {
+				v[i] = byte(val.Index(i).Uint())
+			}
+			return v, nil
+		case tagType == tagInt32Array && elem == reflect.Int32:
+			v := make(IntArray, n)
+			for i := range v {
+				v[i] = int32(val.Index(i).Int())
+			}
+			return v, nil
+		case tagType == tagInt64Array && elem == reflect.Int64:
+			v := make(LongArray, n)
+			for i := range v {
+				v[i] = val.Index(i).Int()
+			}
+			return v, nil
+		}
+	}
+	return nil, incompatible
+}
+
+// setForced sets a value of a field with a forced tag type to the tag passed. Numeric tags may be decoded
+// into any number or boolean that can hold their value, and array tags into slices or arrays of their element
+// type. An InvalidTypeError is returned if the tag cannot be decoded into the value.
+func (d *Decoder) setForced(val reflect.Value, tag Tag, name string) error {
+	invalid := InvalidTypeError{Off: d.r.off, Field: name, TagType: byte(tag.Type()), FieldType: val.Type()}
+	var i int64
+	var f float64
+	switch v := tag.(type) {
+	case Byte:
+		i, f = int64(int8(v)), float64(int8(v))
+	case Short:
+		i, f = int64(v), float64(v)
+	case Int:
+		i, f = int64(v), float64(v)
+	case Long:
+		i, f = int64(v), float64(v)
+	case Float:
+		i, f = int64(v), float64(v)
+	case Double:
+		i, f = int64(v), float64(v)
+	case String:
+		if val.Kind() != reflect.String {
+			return invalid
+		}
+		val.SetString(string(v))
+		return nil
+	case ByteArray, IntArray, LongArray:
+		arr := reflect.ValueOf(v)
+		if (val.Kind() != reflect.Slice && val.Kind() != reflect.Array) || val.Type().Elem().Kind() != arr.Type().Elem().Kind() {
+			return invalid
+		}
+		if val.Kind() == reflect.Slice {
+			val.Set(reflect.MakeSlice(val.Type(), arr.Len(), arr.Len()))
+		} else if val.Len() != arr.Len() {
+			return InvalidArraySizeError{Off: d.r.off, Op: "Forced", GoLength: val.Len(), NBTLength: arr.Len()}
+		}
+		for j := 0; j < arr.Len(); j++ {
+			val.Index(j).Set(arr.Index(j).Convert(val.Type().Elem()))
+		}
+		return nil
+	default:
+		return invalid
+	}
+	isFloat := tag.Type() == TypeFloat || tag.Type() == TypeDouble
+	switch val.Kind() {
+	case reflect.Bool:
+		val.SetBool(f != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if (isFloat && float64(i) != f) || val.OverflowInt(i) {
+			return invalid
+		}
+		val.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if tag.Type() == TypeByte {
+			// TAG_Byte values are signed, but are decoded into unsigned values as they are.
+			i = int64(byte(i))
+		}
+		if (isFloat && float64(i) != f) || i < 0 || val.OverflowUint(uint64(i)) {
+			return invalid
+		}
+		val.SetUint(uint64(i))
+	case reflect.Float32, reflect.Float64:
+		val.SetFloat(f)
+	default:
+		return invalid
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package nbt
+
+import "reflect"
+
+// Marshaler is implemented by types that encode themselves to NBT, such as types that are not otherwise
+// representable with an NBT tag. MarshalNBT returns the tag that the value is encoded as. The tag is encoded
+// with the Encoding of the Encoder, so MarshalNBT works the same for all encodings.
+//
+// If MarshalNBT returns an error, encoding stops and that error is returned by Marshal. If it returns a nil
+// tag, an IncompatibleTypeError is returned.
+type Marshaler interface {
+	MarshalNBT() (Tag, error)
+}
+
+// Unmarshaler is implemented by types that decode themselves from NBT. UnmarshalNBT is called with the tag
+// read for the value, which is independent of the Encoding of the Decoder. It must copy any data of the tag
+// it wishes to keep after returning.
+//
+// If UnmarshalNBT returns an error, decoding stops and that error is returned by Unmarshal. Implementations
+// should return an InvalidTypeError if the tag passed is not of a type they can decode: The decoder fills out
+// its Off, Field, TagType and FieldType if they are not set.
+type Unmarshaler interface {
+	UnmarshalNBT(tag Tag) error
+}
+
+var (
+	marshalerType   = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	tagInterface    = reflect.TypeOf((*Tag)(nil)).Elem()
+)
+
+// encodesItself checks if values of the type passed are encoded as a Tag, either because they implement
+// Marshaler, or because they are a Tag.
+func encodesItself(t reflect.Type) bool {
+	return t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType) || t.Implements(tagInterface)
+}
+
+// tagOf returns the tag that a value implementing Marshaler, or a value that is a Tag, is encoded as. It
+// returns false if the value is neither.
+func tagOf(val reflect.Value, name string) (Tag, bool, error) {
+	if val.Kind() == reflect.Interface {
+		if val.IsNil() {
+			return nil, false, nil
+		}
+		val = val.Elem()
+	}
+	var m Marshaler
+	switch {
+	case val.Type().Implements(marshalerType):
+		if val.Kind() == reflect.Ptr && val.IsNil() {
+			return nil, true, IncompatibleTypeError{ValueName: name, Type: val.Type()}
+		}
+		m = val.Interface().(Marshaler)
+	case val.Kind() != reflect.Ptr && val.CanAddr() && reflect.PtrTo(val.Type()).Implements(marshalerType):
+		m = val.Addr().Interface().(Marshaler)
+	case val.Type().Implements(tagInterface):
+		if val.Kind() == reflect.Ptr && val.IsNil() {
+			return nil, true, IncompatibleTypeError{ValueName: name, Type: val.Type()}
+		}
+		return val.Interface().(Tag), true, nil
+	default:
+		return nil, false, nil
+	}
+	tag, err := m.MarshalNBT()
+	if err != nil {
+		return nil, true, err
+	}
+	if tag == nil {
+		return nil, true, IncompatibleTypeError{ValueName: name, Type: val.Type()}
+	}
+	return tag, true, nil
+}
+
+// decodesItself checks if the value passed implements Unmarshaler or holds a Tag, and decodes the tag with
+// the type and name passed into it if so. It returns false if the value does neither, in which case the tag
+// was not read.
+func (d *Decoder) decodesItself(val reflect.Value, tagType byte, tagName string) (bool, error) {
+	var u Unmarshaler
+	switch t := val.Type(); {
+	case t.Kind() == reflect.Ptr && t.Implements(unmarshalerType):
+		if val.IsNil() {
+			val.Set(reflect.New(t.Elem()))
+		}
+		u = val.Interface().(Unmarshaler)
+	case t.Kind() != reflect.Ptr && t.Kind() != reflect.Interface && val.CanAddr() && reflect.PtrTo(t).Implements(unmarshalerType):
+		u = val.Addr().Interface().(Unmarshaler)
+	case t == tagInterface || (t.Kind() != reflect.Interface && t.Implements(tagInterface)):
+		tag, err := d.readTag(tagType, tagName)
+		if err != nil {
+			return true, err
+		}
+		if !reflect.TypeOf(tag).AssignableTo(t) {
+			return true, InvalidTypeError{Off: d.r.off, Field: tagName, TagType: tagType, FieldType: t}
+		}
+		val.Set(reflect.ValueOf(tag))
+		return true, nil
+	default:
+		return false, nil
+	}
+	tag, err := d.readTag(tagType, tagName)
+	if err != nil {
+		return true, err
+	}
+	err = u.UnmarshalNBT(tag)
+	if typeErr, ok := err.(InvalidTypeError); ok {
+		if typeErr.Off == 0 {
+			typeErr.Off = d.r.off
+		}
+		if typeErr.Field == "" {
+			typeErr.Field = tagName
+		}
+		if typeErr.TagType == tagEnd {
+			typeErr.TagType = tagType
+		}
+		if typeErr.FieldType == nil {
+			typeErr.FieldType = val.Type()
+		}
+		return true, typeErr
+	}
+	return true, err
+}
+
+// readTag reads the payload of a tag with the type and name passed, which were already read, into a Tag.
+func (d *Decoder) readTag(tagType byte, tagName string) (Tag, error) {
+	r := &TokenReader{Encoding: d.Encoding, r: d.r}
+	t, err := r.token(tagType, tagName)
+	if err != nil {
+		return nil, err
+	}
+	return r.tagFrom(t)
+}
+
+// tokens returns a TokenWriter that writes to the output stream of the Encoder.
+func (e *Encoder) tokens() *TokenWriter {
+	return &TokenWriter{Encoding: e.Encoding, w: e.w}
+}
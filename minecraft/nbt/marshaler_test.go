@@ -0,0 +1,175 @@
+package nbt
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// vec3 is a vector encoded as a list of three floats.
+type vec3 [3]float32
+
+// MarshalNBT ...
+func (v vec3) MarshalNBT() (Tag, error) {
+	return &List{ElemType: TypeFloat, Tags: []Tag{Float(v[0]), Float(v[1]), Float(v[2])}}, nil
+}
+
+// UnmarshalNBT ...
+func (v *vec3) UnmarshalNBT(tag Tag) error {
+	l, ok := tag.(*List)
+	if !ok || l.ElemType != TypeFloat || len(l.Tags) != 3 {
+		return InvalidTypeError{}
+	}
+	for i, f := range l.Tags {
+		v[i] = float32(f.(Float))
+	}
+	return nil
+}
+
+// id is an identifier encoded as a string with a prefix.
+type id struct{ name string }
+
+var errEmptyID = errors.New("empty id")
+
+// MarshalNBT ...
+func (i *id) MarshalNBT() (Tag, error) {
+	if i.name == "" {
+		return nil, errEmptyID
+	}
+	return String("minecraft:" + i.name), nil
+}
+
+// UnmarshalNBT ...
+func (i *id) UnmarshalNBT(tag Tag) error {
+	s, ok := tag.(String)
+	if !ok || len(s) < len("minecraft:") {
+		return InvalidTypeError{}
+	}
+	i.name = string(s[len("minecraft:"):])
+	return nil
+}
+
+// TestMarshaler encodes and decodes values implementing Marshaler and Unmarshaler with every encoding.
+func TestMarshaler(t *testing.T) {
+	type entity struct {
+		ID     id
+		Pos    vec3
+		Path   []vec3
+		Extra  *Compound
+		Custom Tag
+	}
+	extra := NewCompound()
+	extra.Set("b", Byte(1))
+	extra.Set("a", Short(2))
+	v := entity{ID: id{"zombie"}, Pos: vec3{1, 2.5, -3}, Path: []vec3{{1, 1, 1}, {2, 2, 2}}, Extra: extra, Custom: IntArray{1}}
+
+	text, err := MarshalSNBT(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = `{ID:"minecraft:zombie",Pos:[1.0f,2.5f,-3.0f],Path:[[1.0f,1.0f,1.0f],[2.0f,2.0f,2.0f]],Extra:{b:1b,a:2s},Custom:[I;1]}`
+	if text != expected {
+		t.Fatalf("marshalled to %v, expected %v", text, expected)
+	}
+	for _, encoding := range []Encoding{LittleEndian, BigEndian, NetworkLittleEndian} {
+		data, err := MarshalEncoding(&v, encoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded entity
+		if err := UnmarshalEncoding(data, &decoded, encoding); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded, v) {
+			t.Fatalf("decoded %+v, expected %+v", decoded, v)
+		}
+	}
+
+	if _, err := Marshal(entity{}); !errors.Is(err, errEmptyID) {
+		t.Fatalf("marshalling an empty id returned %v, expected %v", err, errEmptyID)
+	}
+	var typeErr InvalidTypeError
+	if err := UnmarshalSNBT(`{Pos:[1,2,3]}`, &v); !errors.As(err, &typeErr) || typeErr.Field != "Pos" || typeErr.TagType != tagSlice || typeErr.FieldType != reflect.TypeOf(v.Pos) {
+		t.Fatalf("unmarshalling a list of ints into vec3 returned %#v", err)
+	}
+	if err := UnmarshalSNBT(`{Extra:[I;1]}`, &v); !errors.As(err, &typeErr) || typeErr.Field != "Extra" {
+		t.Fatalf("unmarshalling an int array into a *Compound returned %#v", err)
+	}
+}
+
+// TestStructTagOptions encodes and decodes structs with the options of the 'nbt' struct tag.
+func TestStructTagOptions(t *testing.T) {
+	type Position struct {
+		X, Y, Z int32
+	}
+	type block struct {
+		Position
+		Meta     Position          `nbt:"meta"`
+		Count    int               `nbt:"Count,type=byte"`
+		Flag     bool              `nbt:"flag,type=short"`
+		Scale    float32           `nbt:"scale,type=double,omitempty,default=1.0d"`
+		Ticks    int32             `nbt:"ticks,default=20"`
+		Name     string            `nbt:"name,omitempty,default=\"a,b\""`
+		Data     []int32           `nbt:"data,type=intarray"`
+		States   map[string]string `nbt:",inline"`
+		Ignored  int               `nbt:"-"`
+		internal int
+	}
+	v := block{Position: Position{1, 2, 3}, Meta: Position{4, 5, 6}, Count: -2, Flag: true, Scale: 1, Ticks: 5,
+		Name: "a,b", Data: []int32{7, 8}, States: map[string]string{"facing": "north"}, Ignored: 9, internal: 10}
+	text, err := MarshalSNBT(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = `{X:1,Y:2,Z:3,meta:{X:4,Y:5,Z:6},Count:-2b,flag:1s,ticks:5,data:[I;7,8],facing:"north"}`
+	if text != expected {
+		t.Fatalf("marshalled to %v, expected %v", text, expected)
+	}
+
+	var decoded block
+	if err := UnmarshalSNBT(text, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	v.Ignored, v.internal = 0, 0
+	if !reflect.DeepEqual(decoded, v) {
+		t.Fatalf("decoded %+v, expected %+v", decoded, v)
+	}
+
+	decoded = block{}
+	if err := UnmarshalSNBT(`{Count:3,flag:0b,scale:2.5f,extra:"x"}`, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Count != 3 || decoded.Flag || decoded.Scale != 2.5 || decoded.Ticks != 20 || decoded.Name != "a,b" || decoded.States["extra"] != "x" {
+		t.Fatalf("decoded %+v, expected tags converted, defaults set and unknown tags in States", decoded)
+	}
+
+	if _, err := Marshal(block{Count: 200}); !errors.As(err, &IncompatibleTypeError{}) {
+		t.Fatalf("marshalling 200 as a TAG_Byte returned %v, expected an IncompatibleTypeError", err)
+	}
+	var small struct {
+		A int8 `nbt:"a,type=int"`
+	}
+	if err := UnmarshalSNBT(`{a:300}`, &small); !errors.As(err, &InvalidTypeError{}) {
+		t.Fatalf("unmarshalling 300 into an int8 returned %v, expected an InvalidTypeError", err)
+	}
+	if err := UnmarshalSNBT(`{data:[L;1L]}`, &decoded); !errors.As(err, &InvalidTypeError{}) {
+		t.Fatalf("unmarshalling a long array into a field of type intarray returned %v, expected an InvalidTypeError", err)
+	}
+
+	var invalidType struct {
+		A int `nbt:"a,type=number"`
+	}
+	if _, err := Marshal(invalidType); !errors.As(err, &IncompatibleTypeError{}) {
+		t.Fatalf("marshalling a field with an unknown type returned %v, expected an IncompatibleTypeError", err)
+	}
+	var invalidDefault struct {
+		A int32 `nbt:"a,default={"`
+	}
+	if err := UnmarshalSNBT(`{}`, &invalidDefault); !errors.As(err, &InvalidSNBTError{}) {
+		t.Fatalf("unmarshalling into a field with an invalid default returned %v, expected an InvalidSNBTError", err)
+	}
+	var withoutRest struct{ A int32 }
+	if err := UnmarshalSNBT(`{A:1,B:2}`, &withoutRest); !errors.As(err, &UnexpectedNamedTagError{}) {
+		t.Fatalf("unmarshalling an unknown tag returned %v, expected an UnexpectedNamedTagError", err)
+	}
+}
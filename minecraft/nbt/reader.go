@@ -1,6 +1,7 @@
 package nbt
 
 import (
+	"bytes"
 	"io"
 )
 
@@ -42,9 +43,11 @@ func newOffsetReader(r io.Reader) *offsetReader {
 		}
 	} else {
 		reader.Next = func(n int) []byte {
-			data := make([]byte, n)
-			_, _ = io.ReadAtLeast(reader, data, n)
-			return data
+			// The data is copied into a buffer that grows as data is read, so that no huge slice is allocated
+			// if n is larger than the data available.
+			buf := bytes.NewBuffer(nil)
+			_, _ = io.CopyN(buf, reader, int64(n))
+			return buf.Bytes()
 		}
 	}
 	return reader
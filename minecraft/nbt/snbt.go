@@ -0,0 +1,536 @@
+package nbt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MarshalSNBT encodes an object to its SNBT (stringified NBT) representation, which is the text format used
+// for NBT in the arguments of commands, such as '{CustomName:"Chest",Items:[{Count:1b,Slot:0b}]}'. Go values
+// are converted to NBT tags the same way as Marshal converts them. The SNBT returned is compact: It holds no
+// whitespace outside of strings.
+//
+// Tags are written with the suffix of their type, so that UnmarshalSNBT reads them as the same tag: TAG_Byte
+// is written as '1b', TAG_Short as '2s', TAG_Int as '3', TAG_Long as '4L', TAG_Float as '1.5f' and
+// TAG_Double as '2.5d'. TAG_ByteArray, TAG_IntArray and TAG_LongArray are written as '[B;1b,2b]', '[I;1,2]'
+// and '[L;1L,2L]'. TAG_Byte values are written as signed numbers, as Minecraft interprets them.
+// Floating point values that are NaN or infinite cannot be represented in SNBT, and result in an error.
+func MarshalSNBT(v interface{}) (string, error) {
+	data, err := MarshalEncoding(v, LittleEndian)
+	if err != nil {
+		return "", err
+	}
+	buf := bytes.NewBuffer(data)
+	r := &offsetReader{Reader: buf, ReadByte: buf.ReadByte, Next: buf.Next}
+	tagType, err := r.ReadByte()
+	if err != nil {
+		return "", BufferOverrunError{Op: "ReadTag"}
+	}
+	if _, err := LittleEndian.String(r); err != nil {
+		return "", err
+	}
+	b := &strings.Builder{}
+	if err := writeSNBT(b, r, tagType); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// UnmarshalSNBT decodes SNBT text, as used in the arguments of commands, into a pointer to a Go value passed.
+// The tags read from the text are decoded into the Go value the same way as Unmarshal decodes them, and the
+// errors Unmarshal returns for Go values that cannot hold the tags are returned by UnmarshalSNBT too.
+//
+// Numbers are read as the tag of their suffix: 'b' for TAG_Byte, 's' for TAG_Short, 'L' for TAG_Long, 'f'
+// for TAG_Float and 'd' for TAG_Double. The suffixes are case insensitive. Integers without a suffix are read
+// as TAG_Int, and numbers with a decimal point but without a suffix as TAG_Double. The values true and false
+// are read as the TAG_Byte 1b and 0b. Other text without quotes, such as stone, is read as a TAG_String, as
+// are numbers that do not fit in the tag of their suffix. Text without quotes may only hold letters, digits
+// and the characters '.', '_', '+' and '-': Other text, such as minecraft:stone, must be quoted.
+// Lists must hold tags of a single type. An InvalidSNBTError is returned if the text is not valid SNBT.
+func UnmarshalSNBT(text string, v interface{}) error {
+	buf := bytes.NewBuffer(make([]byte, 0, len(text)))
+	p := &snbtParser{s: text, buf: buf, w: &offsetWriter{Writer: buf, WriteByte: buf.WriteByte}}
+	if err := p.root(); err != nil {
+		return err
+	}
+	return UnmarshalEncoding(buf.Bytes(), v, LittleEndian)
+}
+
+// writeSNBT reads the payload of a tag with the type passed from the offsetReader, which holds NBT in the
+// LittleEndian encoding, and writes its SNBT representation to the strings.Builder.
+func writeSNBT(b *strings.Builder, r *offsetReader, tagType byte) error {
+	switch tagType {
+	case tagByte:
+		v, err := r.ReadByte()
+		if err != nil {
+			return BufferOverrunError{Op: "Byte"}
+		}
+		b.WriteString(strconv.Itoa(int(int8(v))) + "b")
+	case tagInt16:
+		v, err := LittleEndian.Int16(r)
+		if err != nil {
+			return err
+		}
+		b.WriteString(strconv.Itoa(int(v)) + "s")
+	case tagInt32:
+		v, err := LittleEndian.Int32(r)
+		if err != nil {
+			return err
+		}
+		b.WriteString(strconv.Itoa(int(v)))
+	case tagInt64:
+		v, err := LittleEndian.Int64(r)
+		if err != nil {
+			return err
+		}
+		b.WriteString(strconv.FormatInt(v, 10) + "L")
+	case tagFloat32:
+		v, err := LittleEndian.Float32(r)
+		if err != nil {
+			return err
+		}
+		return writeSNBTFloat(b, float64(v), 32, "f")
+	case tagFloat64:
+		v, err := LittleEndian.Float64(r)
+		if err != nil {
+			return err
+		}
+		return writeSNBTFloat(b, v, 64, "d")
+	case tagString:
+		v, err := LittleEndian.String(r)
+		if err != nil {
+			return err
+		}
+		b.WriteString(quoteSNBT(v))
+	case tagByteArray, tagInt32Array, tagInt64Array:
+		length, err := LittleEndian.Int32(r)
+		if err != nil {
+			return err
+		}
+		prefix, elemType := "[B;", byte(tagByte)
+		if tagType == tagInt32Array {
+			prefix, elemType = "[I;", tagInt32
+		} else if tagType == tagInt64Array {
+			prefix, elemType = "[L;", tagInt64
+		}
+		b.WriteString(prefix)
+		for i := int32(0); i < length; i++ {
+			if i != 0 {
+				b.WriteByte(',')
+			}
+			if err := writeSNBT(b, r, elemType); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(']')
+	case tagSlice:
+		elemType, err := r.ReadByte()
+		if err != nil {
+			return BufferOverrunError{Op: "List"}
+		}
+		length, err := LittleEndian.Int32(r)
+		if err != nil {
+			return err
+		}
+		b.WriteByte('[')
+		for i := int32(0); i < length; i++ {
+			if i != 0 {
+				b.WriteByte(',')
+			}
+			if err := writeSNBT(b, r, elemType); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(']')
+	case tagStruct:
+		b.WriteByte('{')
+		for i := 0; ; i++ {
+			nestedType, err := r.ReadByte()
+			if err != nil {
+				return BufferOverrunError{Op: "ReadTag"}
+			}
+			if nestedType == tagEnd {
+				break
+			}
+			name, err := LittleEndian.String(r)
+			if err != nil {
+				return err
+			}
+			if i != 0 {
+				b.WriteByte(',')
+			}
+			if unquotedSNBT.MatchString(name) {
+				b.WriteString(name)
+			} else {
+				b.WriteString(quoteSNBT(name))
+			}
+			b.WriteByte(':')
+			if err := writeSNBT(b, r, nestedType); err != nil {
+				return err
+			}
+		}
+		b.WriteByte('}')
+	default:
+		return UnknownTagError{Off: r.off, Op: "SNBT", TagType: tagType}
+	}
+	return nil
+}
+
+// writeSNBTFloat writes a floating point value with the bit size and suffix passed. The value always has a
+// decimal point or an exponent, so that it is clear it is not an integer.
+func writeSNBTFloat(b *strings.Builder, v float64, bitSize int, suffix string) error {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Errorf("nbt: floating point value %v cannot be represented in SNBT", v)
+	}
+	s := strconv.FormatFloat(v, 'g', -1, bitSize)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	b.WriteString(s + suffix)
+	return nil
+}
+
+// quoteSNBT quotes a string for SNBT. Double quotes are used, unless the string holds double quotes but no
+// single quotes, in which case single quotes are used so that fewer characters need to be escaped.
+func quoteSNBT(s string) string {
+	quote := byte('"')
+	if strings.IndexByte(s, '"') != -1 && strings.IndexByte(s, '\'') == -1 {
+		quote = '\''
+	}
+	b := make([]byte, 0, len(s)+2)
+	b = append(b, quote)
+	for i := 0; i < len(s); i++ {
+		if s[i] == quote || s[i] == '\\' {
+			b = append(b, '\\')
+		}
+		b = append(b, s[i])
+	}
+	return string(append(b, quote))
+}
+
+var (
+	// unquotedSNBT matches text that may be written without quotes in SNBT.
+	unquotedSNBT = regexp.MustCompile(`^[A-Za-z0-9._+\-]+$`)
+	// integerSNBT matches integers in SNBT, optionally with the suffix of their type.
+	integerSNBT = regexp.MustCompile(`^([-+]?(?:0|[1-9][0-9]*))([bBsSlL]?)$`)
+	// floatSNBT matches floating point values in SNBT with the suffix of their type.
+	floatSNBT = regexp.MustCompile(`^([-+]?(?:[0-9]+\.?|[0-9]*\.[0-9]+)(?:[eE][-+]?[0-9]+)?)([fFdD])$`)
+	// doubleSNBT matches floating point values in SNBT without a suffix, which are TAG_Doubles.
+	doubleSNBT = regexp.MustCompile(`^[-+]?(?:[0-9]+\.|[0-9]*\.[0-9]+)(?:[eE][-+]?[0-9]+)?$`)
+)
+
+// snbtParser parses SNBT text and writes the tags it holds to a buffer in the LittleEndian encoding. Types
+// and lengths of tags are only known after their values are parsed, so space is reserved for them and they
+// are filled out afterwards.
+type snbtParser struct {
+	s     string
+	off   int
+	depth int
+
+	buf *bytes.Buffer
+	w   *offsetWriter
+}
+
+// root parses the root tag of the SNBT text, which must be followed by nothing but whitespace.
+func (p *snbtParser) root() error {
+	pos := p.buf.Len()
+	_ = p.w.WriteByte(tagEnd)
+	if err := LittleEndian.WriteString(p.w, ""); err != nil {
+		return err
+	}
+	tagType, err := p.value()
+	if err != nil {
+		return err
+	}
+	p.buf.Bytes()[pos] = tagType
+	if p.skipSpace(); p.off != len(p.s) {
+		return p.errorf("unexpected %q after value", p.s[p.off])
+	}
+	return nil
+}
+
+// value parses the next value in the text and writes its payload. It returns the type of the tag written.
+func (p *snbtParser) value() (byte, error) {
+	if p.depth >= maximumNestingDepth {
+		return 0, MaximumDepthReachedError{}
+	}
+	p.skipSpace()
+	if p.off == len(p.s) {
+		return 0, p.errorf("expected value, got end of text")
+	}
+	switch c := p.s[p.off]; c {
+	case '{':
+		return tagStruct, p.compound()
+	case '[':
+		if p.off+2 < len(p.s) && p.s[p.off+2] == ';' {
+			switch p.s[p.off+1] {
+			case 'B':
+				return tagByteArray, p.array(tagByte)
+			case 'I':
+				return tagInt32Array, p.array(tagInt32)
+			case 'L':
+				return tagInt64Array, p.array(tagInt64)
+			}
+		}
+		return tagSlice, p.list()
+	case '"', '\'':
+		s, err := p.quoted()
+		if err != nil {
+			return 0, err
+		}
+		return tagString, LittleEndian.WriteString(p.w, s)
+	}
+	start := p.off
+	token := p.unquoted()
+	if token == "" {
+		return 0, p.errorf("expected value, got %q", p.s[p.off])
+	}
+	return p.scalar(token, start)
+}
+
+// scalar writes the tag held by a token without quotes, which is a number, a boolean or a string.
+func (p *snbtParser) scalar(token string, start int) (byte, error) {
+	if strings.EqualFold(token, "true") {
+		return tagByte, p.w.WriteByte(1)
+	} else if strings.EqualFold(token, "false") {
+		return tagByte, p.w.WriteByte(0)
+	}
+	if m := integerSNBT.FindStringSubmatch(token); m != nil {
+		tagType := tagInt32
+		switch m[2] {
+		case "b", "B":
+			tagType = tagByte
+		case "s", "S":
+			tagType = tagInt16
+		case "l", "L":
+			tagType = tagInt64
+		}
+		if v, err := parseSNBTInt(m[1], tagType); err == nil {
+			return tagType, p.writeInt(tagType, v)
+		}
+	} else if m := floatSNBT.FindStringSubmatch(token); m != nil {
+		if m[2] == "f" || m[2] == "F" {
+			if v, err := strconv.ParseFloat(m[1], 32); err == nil {
+				return tagFloat32, LittleEndian.WriteFloat32(p.w, float32(v))
+			}
+		} else if v, err := strconv.ParseFloat(m[1], 64); err == nil {
+			return tagFloat64, LittleEndian.WriteFloat64(p.w, v)
+		}
+	} else if doubleSNBT.MatchString(token) {
+		if v, err := strconv.ParseFloat(token, 64); err == nil {
+			return tagFloat64, LittleEndian.WriteFloat64(p.w, v)
+		}
+	}
+	// Anything else, including numbers that do not fit in the tag of their suffix, is a string.
+	if err := LittleEndian.WriteString(p.w, token); err != nil {
+		p.off = start
+		return 0, p.errorf("%v", err)
+	}
+	return tagString, nil
+}
+
+// compound parses a TAG_Compound in the form {key:value,...}.
+func (p *snbtParser) compound() error {
+	p.depth++
+	p.off++
+	for i := 0; ; i++ {
+		if p.skipSpace(); p.consume('}') {
+			break
+		}
+		if i != 0 && !p.consume(',') {
+			return p.errorf("expected ',' or '}' in compound")
+		}
+		p.skipSpace()
+		var name string
+		if p.off < len(p.s) && (p.s[p.off] == '"' || p.s[p.off] == '\'') {
+			var err error
+			if name, err = p.quoted(); err != nil {
+				return err
+			}
+		} else if name = p.unquoted(); name == "" {
+			return p.errorf("expected key in compound")
+		}
+		if p.skipSpace(); !p.consume(':') {
+			return p.errorf("expected ':' after key %q", name)
+		}
+		pos := p.buf.Len()
+		_ = p.w.WriteByte(tagEnd)
+		if err := LittleEndian.WriteString(p.w, name); err != nil {
+			return p.errorf("%v", err)
+		}
+		tagType, err := p.value()
+		if err != nil {
+			return err
+		}
+		p.buf.Bytes()[pos] = tagType
+	}
+	p.depth--
+	return p.w.WriteByte(tagEnd)
+}
+
+// list parses a TAG_List in the form [value,...]. All values in the list must be of the same type.
+func (p *snbtParser) list() error {
+	p.depth++
+	p.off++
+	pos := p.buf.Len()
+	_ = p.w.WriteByte(tagEnd)
+	_ = LittleEndian.WriteInt32(p.w, 0)
+
+	var listType byte
+	n := 0
+	for ; ; n++ {
+		if p.skipSpace(); p.consume(']') {
+			break
+		}
+		if n != 0 && !p.consume(',') {
+			return p.errorf("expected ',' or ']' in list")
+		}
+		start := p.off
+		tagType, err := p.value()
+		if err != nil {
+			return err
+		}
+		if n != 0 && tagType != listType {
+			p.off = start
+			return p.errorf("cannot add %v to list of %v", tagName(tagType), tagName(listType))
+		}
+		listType = tagType
+	}
+	p.buf.Bytes()[pos] = listType
+	binary.LittleEndian.PutUint32(p.buf.Bytes()[pos+1:], uint32(n))
+	p.depth--
+	return nil
+}
+
+// array parses a TAG_ByteArray, TAG_IntArray or TAG_LongArray in the form [B;1b,...], [I;1,...] or
+// [L;1L,...]. Elements may be written either with or without the suffix of the element type.
+func (p *snbtParser) array(elemType byte) error {
+	p.off += 3
+	pos := p.buf.Len()
+	_ = LittleEndian.WriteInt32(p.w, 0)
+
+	n := 0
+	for ; ; n++ {
+		if p.skipSpace(); p.consume(']') {
+			break
+		}
+		if n != 0 && !p.consume(',') {
+			return p.errorf("expected ',' or ']' in array")
+		}
+		p.skipSpace()
+		start := p.off
+		m := integerSNBT.FindStringSubmatch(p.unquoted())
+		if m == nil || (m[2] != "" && suffixType(m[2]) != elemType) {
+			p.off = start
+			return p.errorf("expected %v in array", tagName(elemType))
+		}
+		v, err := parseSNBTInt(m[1], elemType)
+		if err != nil {
+			p.off = start
+			return p.errorf("%v out of range for %v", m[1], tagName(elemType))
+		}
+		if err := p.writeInt(elemType, v); err != nil {
+			return err
+		}
+	}
+	binary.LittleEndian.PutUint32(p.buf.Bytes()[pos:], uint32(n))
+	return nil
+}
+
+// suffixType returns the integer tag type of the SNBT suffix passed.
+func suffixType(suffix string) byte {
+	switch strings.ToLower(suffix) {
+	case "b":
+		return tagByte
+	case "s":
+		return tagInt16
+	case "l":
+		return tagInt64
+	}
+	return tagInt32
+}
+
+// parseSNBTInt parses an integer that must fit in the integer tag type passed.
+func parseSNBTInt(s string, tagType byte) (int64, error) {
+	bitSize := map[byte]int{tagByte: 8, tagInt16: 16, tagInt32: 32, tagInt64: 64}[tagType]
+	return strconv.ParseInt(s, 10, bitSize)
+}
+
+// writeInt writes an integer as the payload of the integer tag type passed.
+func (p *snbtParser) writeInt(tagType byte, v int64) error {
+	switch tagType {
+	case tagByte:
+		return p.w.WriteByte(byte(v))
+	case tagInt16:
+		return LittleEndian.WriteInt16(p.w, int16(v))
+	case tagInt32:
+		return LittleEndian.WriteInt32(p.w, int32(v))
+	default:
+		return LittleEndian.WriteInt64(p.w, v)
+	}
+}
+
+// quoted parses a string between single or double quotes. Backslashes escape the quote and backslashes.
+func (p *snbtParser) quoted() (string, error) {
+	quote := p.s[p.off]
+	start := p.off
+	p.off++
+	b := &strings.Builder{}
+	for p.off < len(p.s) {
+		c := p.s[p.off]
+		p.off++
+		switch c {
+		case quote:
+			return b.String(), nil
+		case '\\':
+			if p.off == len(p.s) || (p.s[p.off] != quote && p.s[p.off] != '\\') {
+				p.off--
+				return "", p.errorf("invalid escape sequence in string")
+			}
+			c = p.s[p.off]
+			p.off++
+		}
+		b.WriteByte(c)
+	}
+	p.off = start
+	return "", p.errorf("string is not terminated")
+}
+
+// unquoted returns the text without quotes at the current offset, consisting of letters, digits and the
+// characters '.', '_', '+' and '-'. An empty string is returned if there is no such text.
+func (p *snbtParser) unquoted() string {
+	start := p.off
+	for ; p.off < len(p.s); p.off++ {
+		c := p.s[p.off]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '+' || c == '-') {
+			break
+		}
+	}
+	return p.s[start:p.off]
+}
+
+// consume skips the character passed if it is at the current offset, and reports if it did.
+func (p *snbtParser) consume(c byte) bool {
+	if p.off < len(p.s) && p.s[p.off] == c {
+		p.off++
+		return true
+	}
+	return false
+}
+
+// skipSpace skips any whitespace at the current offset.
+func (p *snbtParser) skipSpace() {
+	for p.off < len(p.s) && (p.s[p.off] == ' ' || p.s[p.off] == '\t' || p.s[p.off] == '\n' || p.s[p.off] == '\r') {
+		p.off++
+	}
+}
+
+// errorf returns an InvalidSNBTError at the current offset.
+func (p *snbtParser) errorf(format string, a ...interface{}) error {
+	return InvalidSNBTError{Off: int64(p.off), Err: fmt.Errorf(format, a...)}
+}
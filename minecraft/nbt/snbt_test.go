@@ -0,0 +1,103 @@
+package nbt
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// TestUnmarshalSNBT decodes SNBT with every kind of tag into a map and checks the types of the values.
+func TestUnmarshalSNBT(t *testing.T) {
+	var m map[string]interface{}
+	text := `{ Count: 1b, Damage:2s, 'id': "minecraft:stone", Slot:-3, Time:4L, x:1.5f, y:2.5, z:3d, on:true,
+		name: stone, big: 300b, "a key": 'say "hi"', esc:"a\"b\\c",
+		Bytes:[B;1b,-2b], Ints:[I; 1, 2 ,3], Longs:[L;1L,2], Empty:[I;],
+		List:[{a:1},{b:2}], Nested:[[1s],[]], Strings:["a",b]}`
+	if err := UnmarshalSNBT(text, &m); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"Count": byte(1), "Damage": int16(2), "id": "minecraft:stone", "Slot": int32(-3), "Time": int64(4),
+		"x": float32(1.5), "y": 2.5, "z": 3.0, "on": byte(1), "name": "stone", "big": "300b",
+		"a key": `say "hi"`, "esc": `a"b\c`,
+		"Bytes": [2]byte{1, 254}, "Ints": [3]int32{1, 2, 3}, "Longs": [2]int64{1, 2}, "Empty": [0]int32{},
+		"List":    []interface{}{map[string]interface{}{"a": int32(1)}, map[string]interface{}{"b": int32(2)}},
+		"Nested":  []interface{}{[]interface{}{int16(1)}, []interface{}{}},
+		"Strings": []interface{}{"a", "b"},
+	}
+	for k, v := range expected {
+		if !reflect.DeepEqual(m[k], v) {
+			t.Errorf("%v: got %#v, expected %#v", k, m[k], v)
+		}
+	}
+	if len(m) != len(expected) {
+		t.Errorf("got %v tags, expected %v", len(m), len(expected))
+	}
+}
+
+// TestSNBTRoundTrip encodes a struct to SNBT and checks that it is decoded to the same struct again.
+func TestSNBTRoundTrip(t *testing.T) {
+	type item struct {
+		Name  string `nbt:"Name"`
+		Count byte
+		Tags  []string
+	}
+	type chest struct {
+		CustomName string
+		Lock       bool
+		Pos        [3]int32
+		Seed       int64
+		Scale      float32
+		Angle      float64
+		Items      []item
+	}
+	v := chest{CustomName: `It's "mine"`, Lock: true, Pos: [3]int32{1, -64, 3}, Seed: -5, Scale: 2, Angle: 0.25,
+		Items: []item{{Name: "minecraft:diamond", Count: 200, Tags: []string{}}}}
+	text, err := MarshalSNBT(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = `{CustomName:"It's \"mine\"",Lock:1b,Pos:[I;1,-64,3],Seed:-5L,Scale:2.0f,Angle:0.25d,Items:[{Name:"minecraft:diamond",Count:-56b,Tags:[]}]}`
+	if text != expected {
+		t.Fatalf("marshalled to %v, expected %v", text, expected)
+	}
+	var decoded chest
+	if err := UnmarshalSNBT(text, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, v) {
+		t.Fatalf("decoded %+v, expected %+v", decoded, v)
+	}
+}
+
+// TestUnmarshalSNBTInvalid checks that invalid SNBT results in an InvalidSNBTError at the right offset.
+func TestUnmarshalSNBTInvalid(t *testing.T) {
+	for text, off := range map[string]int64{
+		``:                    0,
+		`{a:1`:                4,
+		`{a:1,}`:              5,
+		`{a 1}`:               3,
+		`[1,2s]`:              3,
+		`[I;1,2b]`:            5,
+		`[B;128]`:             3,
+		`"abc`:                0,
+		`"a\nb"`:              2,
+		`{a:1} x`:             6,
+		`{a:[1,2,]}`:          8,
+		`{:1}`:                1,
+		`{a:1}}`:              5,
+		`[L;1,x]`:             5,
+		`{a:{b:{c:1}`:         11,
+		`{a:minecraft:stone}`: 12,
+	} {
+		var v interface{}
+		var snbtErr InvalidSNBTError
+		if err := UnmarshalSNBT(text, &v); !errors.As(err, &snbtErr) || snbtErr.Off != off {
+			t.Errorf("%q: got error %v, expected an InvalidSNBTError at offset %v", text, err, off)
+		}
+	}
+	var v struct{ A int16 }
+	if err := UnmarshalSNBT(`{A:1}`, &v); !errors.As(err, &InvalidTypeError{}) {
+		t.Errorf("decoding TAG_Int into int16 returned %v, expected an InvalidTypeError", err)
+	}
+}
@@ -0,0 +1,510 @@
+package nbt
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+)
+
+// Token is a token read by a TokenReader or written by a TokenWriter. It is one of StartCompound,
+// EndCompound, StartList, EndList or Value.
+type Token interface{}
+
+// StartCompound is the token that starts a TAG_Compound. It is followed by the tokens of the tags in the
+// compound and an EndCompound.
+type StartCompound struct {
+	// Name is the name of the compound. It is empty for compounds in lists.
+	Name string
+}
+
+// EndCompound is the token that ends a TAG_Compound.
+type EndCompound struct{}
+
+// StartList is the token that starts a TAG_List. It is followed by the tokens of Len tags of the type
+// ElemType and an EndList.
+type StartList struct {
+	// Name is the name of the list. It is empty for lists in lists.
+	Name string
+	// ElemType is the type of the tags in the list.
+	ElemType TagType
+	// Len is the amount of tags in the list.
+	Len int
+}
+
+// EndList is the token that ends a TAG_List.
+type EndList struct{}
+
+// Value is the token of any tag that is not a TAG_Compound or TAG_List. A TokenWriter also accepts a Value
+// holding a *Compound or *List, and writes the whole tag.
+type Value struct {
+	// Name is the name of the tag. It is empty for tags in lists.
+	Name string
+	// Tag is the tag itself.
+	Tag Tag
+}
+
+// tokenFrame is a TAG_Compound or TAG_List that a TokenReader or TokenWriter is in.
+type tokenFrame struct {
+	tagType   byte
+	elemType  byte
+	remaining int
+}
+
+// TokenReader reads NBT from an input stream one token at a time, so that large NBT, such as that of a
+// .mcstructure file, may be processed without decoding all of it, and so that no type information or
+// ordering of tags is lost. A TokenReader reads the NBT exactly as it is, without Go types to decode into.
+type TokenReader struct {
+	// Encoding is the variant of NBT read.
+	Encoding Encoding
+
+	r     *offsetReader
+	stack []tokenFrame
+}
+
+// NewTokenReader returns a TokenReader that reads NBT with the encoding passed from the input stream reader.
+func NewTokenReader(r io.Reader, encoding Encoding) *TokenReader {
+	return &TokenReader{Encoding: encoding, r: newOffsetReader(r)}
+}
+
+// Token reads the next token from the input stream. Once the root tag has been read completely, the next
+// call to Token reads the root tag that follows it, if any. io.EOF is returned if the input stream ends
+// before a new root tag.
+func (r *TokenReader) Token() (Token, error) {
+	if len(r.stack) >= maximumNestingDepth {
+		return nil, MaximumDepthReachedError{}
+	}
+	if r.r.off >= maximumNetworkOffset && r.Encoding == NetworkLittleEndian {
+		return nil, MaximumBytesReadError{}
+	}
+	if len(r.stack) == 0 {
+		tagType, err := r.r.ReadByte()
+		if err == io.EOF {
+			return nil, io.EOF
+		} else if err != nil {
+			return nil, BufferOverrunError{Op: "ReadTag"}
+		}
+		if tagType == tagEnd {
+			return nil, UnexpectedTagError{Off: r.r.off, TagType: tagEnd}
+		}
+		name, err := r.Encoding.String(r.r)
+		if err != nil {
+			return nil, err
+		}
+		return r.token(tagType, name)
+	}
+	top := &r.stack[len(r.stack)-1]
+	if top.tagType == tagSlice {
+		if top.remaining == 0 {
+			r.stack = r.stack[:len(r.stack)-1]
+			return EndList{}, nil
+		}
+		top.remaining--
+		return r.token(top.elemType, "")
+	}
+	tagType, err := r.r.ReadByte()
+	if err != nil {
+		return nil, BufferOverrunError{Op: "ReadTag"}
+	}
+	if tagType == tagEnd {
+		r.stack = r.stack[:len(r.stack)-1]
+		return EndCompound{}, nil
+	}
+	name, err := r.Encoding.String(r.r)
+	if err != nil {
+		return nil, err
+	}
+	return r.token(tagType, name)
+}
+
+// ReadTag reads the next tag from the input stream as a whole, including all tags nested in it if it is a
+// TAG_Compound or TAG_List, and returns it with its name. ReadTag may be called after reading the first tokens
+// of the NBT with Token, so that only the tags of interest are read into a tree.
+func (r *TokenReader) ReadTag() (string, Tag, error) {
+	t, err := r.Token()
+	if err != nil {
+		return "", nil, err
+	}
+	tag, err := r.tagFrom(t)
+	if err != nil {
+		return "", nil, err
+	}
+	return tokenName(t), tag, nil
+}
+
+// tokenName returns the name of the tag started by the token passed.
+func tokenName(t Token) string {
+	switch t := t.(type) {
+	case Value:
+		return t.Name
+	case StartCompound:
+		return t.Name
+	case StartList:
+		return t.Name
+	}
+	return ""
+}
+
+// tagFrom returns the tag started by the token passed, which was just read, reading all tags nested in it.
+func (r *TokenReader) tagFrom(t Token) (Tag, error) {
+	switch t := t.(type) {
+	case Value:
+		return t.Tag, nil
+	case StartCompound:
+		return r.readCompound()
+	case StartList:
+		return r.readList(t)
+	}
+	// Tokens ending a compound or list cannot start a tag.
+	return nil, UnexpectedTagError{Off: r.r.off, TagType: tagEnd}
+}
+
+// readCompound reads the tags of a compound of which the StartCompound token was read.
+func (r *TokenReader) readCompound() (*Compound, error) {
+	c := NewCompound()
+	for {
+		t, err := r.Token()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := t.(EndCompound); ok {
+			return c, nil
+		}
+		nested, err := r.tagFrom(t)
+		if err != nil {
+			return nil, err
+		}
+		c.Set(tokenName(t), nested)
+	}
+}
+
+// readList reads the tags of a list of which the StartList token passed was read.
+func (r *TokenReader) readList(start StartList) (*List, error) {
+	l := &List{ElemType: start.ElemType}
+	if start.Len != 0 {
+		l.Tags = make([]Tag, 0, minLength(int32(start.Len)))
+	}
+	for {
+		t, err := r.Token()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := t.(EndList); ok {
+			return l, nil
+		}
+		nested, err := r.tagFrom(t)
+		if err != nil {
+			return nil, err
+		}
+		l.Tags = append(l.Tags, nested)
+	}
+}
+
+// token returns the token of a tag with the type and name passed, of which the payload is read next.
+func (r *TokenReader) token(tagType byte, name string) (Token, error) {
+	switch tagType {
+	case tagStruct:
+		r.stack = append(r.stack, tokenFrame{tagType: tagStruct})
+		return StartCompound{Name: name}, nil
+	case tagSlice:
+		elemType, err := r.r.ReadByte()
+		if err != nil {
+			return nil, BufferOverrunError{Op: "List"}
+		}
+		if !tagExists(elemType) {
+			return nil, UnknownTagError{Off: r.r.off, Op: "List", TagType: elemType}
+		}
+		length, err := r.Encoding.Int32(r.r)
+		if err != nil {
+			return nil, err
+		}
+		if length < 0 {
+			return nil, InvalidArraySizeError{Off: r.r.off, Op: "List", NBTLength: int(length)}
+		}
+		r.stack = append(r.stack, tokenFrame{tagType: tagSlice, elemType: elemType, remaining: int(length)})
+		return StartList{Name: name, ElemType: TagType(elemType), Len: int(length)}, nil
+	}
+	tag, err := r.payload(tagType)
+	if err != nil {
+		return nil, err
+	}
+	return Value{Name: name, Tag: tag}, nil
+}
+
+// payload reads the payload of a tag that is not a TAG_Compound or TAG_List.
+func (r *TokenReader) payload(tagType byte) (Tag, error) {
+	switch tagType {
+	case tagByte:
+		v, err := r.r.ReadByte()
+		if err != nil {
+			return nil, BufferOverrunError{Op: "Byte"}
+		}
+		return Byte(v), nil
+	case tagInt16:
+		v, err := r.Encoding.Int16(r.r)
+		return Short(v), err
+	case tagInt32:
+		v, err := r.Encoding.Int32(r.r)
+		return Int(v), err
+	case tagInt64:
+		v, err := r.Encoding.Int64(r.r)
+		return Long(v), err
+	case tagFloat32:
+		v, err := r.Encoding.Float32(r.r)
+		return Float(v), err
+	case tagFloat64:
+		v, err := r.Encoding.Float64(r.r)
+		return Double(v), err
+	case tagString:
+		v, err := r.Encoding.String(r.r)
+		return String(v), err
+	case tagByteArray:
+		length, err := r.Encoding.Int32(r.r)
+		if err != nil {
+			return nil, err
+		}
+		data, err := consumeN(int(length), r.r)
+		if err != nil {
+			return nil, BufferOverrunError{Op: "ByteArray"}
+		}
+		return ByteArray(append([]byte(nil), data...)), nil
+	case tagInt32Array:
+		length, err := r.Encoding.Int32(r.r)
+		if err != nil {
+			return nil, err
+		}
+		if length < 0 {
+			return nil, InvalidArraySizeError{Off: r.r.off, Op: "Int32Array", NBTLength: int(length)}
+		}
+		values := make(IntArray, 0, minLength(length))
+		for i := int32(0); i < length; i++ {
+			v, err := r.Encoding.Int32(r.r)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	case tagInt64Array:
+		length, err := r.Encoding.Int32(r.r)
+		if err != nil {
+			return nil, err
+		}
+		if length < 0 {
+			return nil, InvalidArraySizeError{Off: r.r.off, Op: "Int64Array", NBTLength: int(length)}
+		}
+		values := make(LongArray, 0, minLength(length))
+		for i := int32(0); i < length; i++ {
+			v, err := r.Encoding.Int64(r.r)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	case tagEnd:
+		return nil, UnexpectedTagError{Off: r.r.off, TagType: tagEnd}
+	}
+	return nil, UnknownTagError{Off: r.r.off, Op: "Match", TagType: tagType}
+}
+
+// TokenWriter writes NBT to an output stream one token at a time. It checks that the tokens written form
+// valid NBT: Tags in a list must have the element type of the list, and a list must hold exactly as many
+// tags as its StartList specified.
+type TokenWriter struct {
+	// Encoding is the variant of NBT written.
+	Encoding Encoding
+
+	w     *offsetWriter
+	stack []tokenFrame
+}
+
+// NewTokenWriter returns a TokenWriter that writes NBT with the encoding passed to the output stream writer.
+func NewTokenWriter(w io.Writer, encoding Encoding) *TokenWriter {
+	return &TokenWriter{Encoding: encoding, w: NewEncoder(w).w}
+}
+
+// WriteToken writes a token to the output stream. An UnexpectedTagError is returned if the token is not
+// valid in the place it is written in, such as an EndCompound in a list or a TAG_Int in a list of
+// TAG_Strings.
+func (w *TokenWriter) WriteToken(t Token) error {
+	switch t := t.(type) {
+	case StartCompound:
+		if err := w.header(tagStruct, t.Name); err != nil {
+			return err
+		}
+		w.stack = append(w.stack, tokenFrame{tagType: tagStruct})
+	case StartList:
+		if err := w.header(tagSlice, t.Name); err != nil {
+			return err
+		}
+		if err := w.startList(t.ElemType, t.Len); err != nil {
+			return err
+		}
+	case EndCompound:
+		if len(w.stack) == 0 || w.stack[len(w.stack)-1].tagType != tagStruct {
+			return UnexpectedTagError{Off: w.w.off, TagType: tagEnd}
+		}
+		w.stack = w.stack[:len(w.stack)-1]
+		if err := w.w.WriteByte(tagEnd); err != nil {
+			return FailedWriteError{Off: w.w.off, Op: "WriteTag", Err: err}
+		}
+	case EndList:
+		if len(w.stack) == 0 || w.stack[len(w.stack)-1].tagType != tagSlice {
+			return UnexpectedTagError{Off: w.w.off, TagType: tagEnd}
+		}
+		if remaining := w.stack[len(w.stack)-1].remaining; remaining != 0 {
+			return InvalidArraySizeError{Off: w.w.off, Op: "EndList", NBTLength: remaining}
+		}
+		w.stack = w.stack[:len(w.stack)-1]
+	case Value:
+		if t.Tag == nil {
+			return IncompatibleTypeError{ValueName: t.Name}
+		}
+		if err := w.header(byte(t.Tag.Type()), t.Name); err != nil {
+			return err
+		}
+		return w.payload(t.Tag, t.Name)
+	default:
+		return IncompatibleTypeError{ValueName: "token", Type: reflect.TypeOf(t)}
+	}
+	return nil
+}
+
+// WriteTag writes a tag with the name passed as a whole, including all tags nested in it. It is equivalent
+// to writing a Value token holding the tag.
+func (w *TokenWriter) WriteTag(name string, tag Tag) error {
+	return w.WriteToken(Value{Name: name, Tag: tag})
+}
+
+// header writes the type and name of a tag, or, in a list, checks if the tag has the element type of the
+// list.
+func (w *TokenWriter) header(tagType byte, name string) error {
+	if len(w.stack) >= maximumNestingDepth {
+		return MaximumDepthReachedError{}
+	}
+	if !tagExists(tagType) || tagType == tagEnd {
+		return UnknownTagError{Off: w.w.off, Op: "WriteTag", TagType: tagType}
+	}
+	if len(w.stack) != 0 {
+		if top := &w.stack[len(w.stack)-1]; top.tagType == tagSlice {
+			if tagType != top.elemType || top.remaining == 0 {
+				return UnexpectedTagError{Off: w.w.off, TagType: tagType}
+			}
+			top.remaining--
+			return nil
+		}
+	}
+	if err := w.w.WriteByte(tagType); err != nil {
+		return FailedWriteError{Off: w.w.off, Op: "WriteTag", Err: err}
+	}
+	return w.Encoding.WriteString(w.w, name)
+}
+
+// startList writes the element type and length of a list and enters it.
+func (w *TokenWriter) startList(elemType TagType, length int) error {
+	if !tagExists(byte(elemType)) {
+		return UnknownTagError{Off: w.w.off, Op: "WriteList", TagType: byte(elemType)}
+	}
+	if length < 0 {
+		return InvalidArraySizeError{Off: w.w.off, Op: "WriteList", NBTLength: length}
+	}
+	if err := w.w.WriteByte(byte(elemType)); err != nil {
+		return FailedWriteError{Off: w.w.off, Op: "WriteList", Err: err}
+	}
+	if err := w.Encoding.WriteInt32(w.w, int32(length)); err != nil {
+		return err
+	}
+	w.stack = append(w.stack, tokenFrame{tagType: tagSlice, elemType: byte(elemType), remaining: length})
+	return nil
+}
+
+// payload writes the payload of the tag passed, including all tags nested in it.
+func (w *TokenWriter) payload(tag Tag, name string) error {
+	switch v := tag.(type) {
+	case Byte:
+		return w.w.WriteByte(byte(v))
+	case Short:
+		return w.Encoding.WriteInt16(w.w, int16(v))
+	case Int:
+		return w.Encoding.WriteInt32(w.w, int32(v))
+	case Long:
+		return w.Encoding.WriteInt64(w.w, int64(v))
+	case Float:
+		return w.Encoding.WriteFloat32(w.w, float32(v))
+	case Double:
+		return w.Encoding.WriteFloat64(w.w, float64(v))
+	case String:
+		return w.Encoding.WriteString(w.w, string(v))
+	case ByteArray:
+		if err := w.Encoding.WriteInt32(w.w, int32(len(v))); err != nil {
+			return err
+		}
+		if _, err := w.w.Write(v); err != nil {
+			return FailedWriteError{Off: w.w.off, Op: "WriteByteArray", Err: err}
+		}
+	case IntArray:
+		if err := w.Encoding.WriteInt32(w.w, int32(len(v))); err != nil {
+			return err
+		}
+		for _, x := range v {
+			if err := w.Encoding.WriteInt32(w.w, x); err != nil {
+				return err
+			}
+		}
+	case LongArray:
+		if err := w.Encoding.WriteInt32(w.w, int32(len(v))); err != nil {
+			return err
+		}
+		for _, x := range v {
+			if err := w.Encoding.WriteInt64(w.w, x); err != nil {
+				return err
+			}
+		}
+	case *List:
+		if err := w.startList(v.ElemType, len(v.Tags)); err != nil {
+			return err
+		}
+		for _, elem := range v.Tags {
+			if err := w.WriteToken(Value{Tag: elem}); err != nil {
+				return err
+			}
+		}
+		return w.WriteToken(EndList{})
+	case *Compound:
+		w.stack = append(w.stack, tokenFrame{tagType: tagStruct})
+		for _, n := range v.names {
+			if err := w.WriteToken(Value{Name: n, Tag: v.tags[n]}); err != nil {
+				return err
+			}
+		}
+		return w.WriteToken(EndCompound{})
+	default:
+		return IncompatibleTypeError{ValueName: name, Type: reflect.TypeOf(tag)}
+	}
+	return nil
+}
+
+// UnmarshalTag decodes a slice of NBT data with the encoding passed into a tree of tags, and returns the name
+// and the root tag. Unlike Unmarshal, UnmarshalTag keeps the exact type of every tag and the order of the
+// tags in compounds, so that the tag returned is encoded to the same data by MarshalTag.
+func UnmarshalTag(data []byte, encoding Encoding) (string, Tag, error) {
+	buf := bytes.NewBuffer(data)
+	r := &TokenReader{Encoding: encoding, r: &offsetReader{Reader: buf, ReadByte: buf.ReadByte, Next: buf.Next}}
+	name, tag, err := r.ReadTag()
+	if err == io.EOF {
+		err = BufferOverrunError{Op: "ReadTag"}
+	}
+	return name, tag, err
+}
+
+// MarshalTag encodes a tree of tags with the name of the root tag passed to NBT with the encoding passed.
+func MarshalTag(name string, tag Tag, encoding Encoding) ([]byte, error) {
+	b := bufferPool.Get().(*bytes.Buffer)
+	err := (&TokenWriter{Encoding: encoding, w: &offsetWriter{Writer: b, WriteByte: b.WriteByte}}).WriteTag(name, tag)
+	data := append([]byte(nil), b.Bytes()...)
+
+	// Make sure to reset the buffer before putting it back in the pool.
+	b.Reset()
+	bufferPool.Put(b)
+	return data, err
+}
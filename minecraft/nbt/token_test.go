@@ -0,0 +1,177 @@
+package nbt
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testStructure returns a tree of tags laid out like a .mcstructure file.
+func testStructure() *Compound {
+	palette := NewCompound()
+	palette.Set("name", String("minecraft:stone"))
+	palette.Set("states", NewCompound())
+	palette.Set("version", Int(17959425))
+
+	structure := NewCompound()
+	structure.Set("block_indices", &List{ElemType: TypeList, Tags: []Tag{
+		&List{ElemType: TypeInt, Tags: []Tag{Int(0), Int(-1)}},
+		&List{ElemType: TypeInt, Tags: []Tag{Int(-1), Int(-1)}},
+	}})
+	structure.Set("entities", &List{})
+	structure.Set("palette", &List{ElemType: TypeCompound, Tags: []Tag{palette}})
+
+	root := NewCompound()
+	root.Set("format_version", Int(1))
+	root.Set("size", &List{ElemType: TypeInt, Tags: []Tag{Int(2), Int(1), Int(1)}})
+	root.Set("structure", structure)
+	root.Set("structure_world_origin", &List{ElemType: TypeInt, Tags: []Tag{Int(0), Int(-60), Int(0)}})
+	root.Set("flags", Byte(1))
+	root.Set("seed", Long(-3))
+	root.Set("scale", Float(0.5))
+	root.Set("integrity", Double(100))
+	root.Set("short", Short(7))
+	root.Set("bytes", ByteArray{1, 2, 3})
+	root.Set("ints", IntArray{4, 5})
+	root.Set("longs", LongArray{6})
+	return root
+}
+
+// TestTagRoundTrip encodes a tree of tags with every encoding and checks that it is decoded to the same tree,
+// and encoded to the same data again.
+func TestTagRoundTrip(t *testing.T) {
+	for _, encoding := range []Encoding{LittleEndian, BigEndian, NetworkLittleEndian} {
+		data, err := MarshalTag("", testStructure(), encoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name, tag, err := UnmarshalTag(data, encoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != "" || !reflect.DeepEqual(tag, testStructure()) {
+			t.Fatalf("decoded tag %q %+v, expected %+v", name, tag, testStructure())
+		}
+		again, err := MarshalTag(name, tag, encoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(again, data) {
+			t.Fatalf("encoded decoded tag to %x, expected %x", again, data)
+		}
+	}
+	if _, _, err := UnmarshalTag([]byte{tagStruct, 0, 0, tagByte, 0}, LittleEndian); err == nil {
+		t.Fatal("decoded truncated NBT without error")
+	}
+}
+
+// TestTokenEdit edits NBT by copying its tokens, replacing one tag and leaving out another, and checks that
+// everything else is left as it was.
+func TestTokenEdit(t *testing.T) {
+	data, _ := MarshalTag("", testStructure(), LittleEndian)
+	r := NewTokenReader(bytes.NewReader(data), LittleEndian)
+	buf := bytes.NewBuffer(nil)
+	w := NewTokenWriter(buf, LittleEndian)
+	for {
+		tok, err := r.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if start, ok := tok.(StartList); ok && start.Name == "entities" {
+			// Skip the entities list and all tokens in it.
+			for depth := 1; depth != 0; {
+				tok, err := r.Token()
+				if err != nil {
+					t.Fatal(err)
+				}
+				switch tok.(type) {
+				case StartList, StartCompound:
+					depth++
+				case EndList, EndCompound:
+					depth--
+				}
+			}
+			continue
+		}
+		if v, ok := tok.(Value); ok && v.Name == "format_version" {
+			tok = Value{Name: v.Name, Tag: Int(2)}
+		}
+		if err := w.WriteToken(tok); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, tag, err := UnmarshalTag(buf.Bytes(), LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := testStructure()
+	expected.Set("format_version", Int(2))
+	structure, _ := expected.Get("structure")
+	structure.(*Compound).Delete("entities")
+	if !reflect.DeepEqual(tag, expected) {
+		t.Fatalf("edited tag is %+v, expected %+v", tag, expected)
+	}
+	if names := strings.Join(tag.(*Compound).Names(), ","); !strings.HasPrefix(names, "format_version,size,structure,") {
+		t.Fatalf("edited tag has tags in order %v", names)
+	}
+}
+
+// TestTagFromMarshal checks that NBT encoded with Marshal is decoded to tags of the exact types and in the
+// order of the struct fields.
+func TestTagFromMarshal(t *testing.T) {
+	data, err := MarshalEncoding(struct {
+		B bool
+		S int16
+		L []int64
+	}{B: true, S: 3, L: []int64{1}}, LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, tag, err := UnmarshalTag(data, LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := NewCompound()
+	expected.Set("B", Byte(1))
+	expected.Set("S", Short(3))
+	expected.Set("L", &List{ElemType: TypeLong, Tags: []Tag{Long(1)}})
+	if !reflect.DeepEqual(tag, expected) {
+		t.Fatalf("decoded %+v, expected %+v", tag, expected)
+	}
+	dump, err := Dump(data, LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "TAG_Compound({\n\t'B': TAG_Byte(0x01),\n\t'S': TAG_Short(3),\n\t'L': TAG_List<TAG_Long>({\n\t\t1,\n\t}),\n})"; dump != expected {
+		t.Fatalf("dumped %q, expected %q", dump, expected)
+	}
+}
+
+// TestTokenWriterInvalid checks that the TokenWriter refuses tokens that do not form valid NBT.
+func TestTokenWriterInvalid(t *testing.T) {
+	for name, tokens := range map[string][]Token{
+		"wrong list element type": {StartList{ElemType: TypeInt, Len: 1}, Value{Tag: Short(1)}},
+		"too many list elements":  {StartList{ElemType: TypeInt, Len: 1}, Value{Tag: Int(1)}, Value{Tag: Int(2)}},
+		"too few list elements":   {StartList{ElemType: TypeInt, Len: 2}, Value{Tag: Int(1)}, EndList{}},
+		"end compound in list":    {StartList{ElemType: TypeCompound, Len: 1}, EndCompound{}},
+		"end list in compound":    {StartCompound{}, EndList{}},
+		"end compound at root":    {EndCompound{}},
+		"mixed list":              {Value{Tag: &List{ElemType: TypeInt, Tags: []Tag{Int(1), String("a")}}}},
+	} {
+		w := NewTokenWriter(io.Discard, LittleEndian)
+		var err error
+		for _, tok := range tokens {
+			if err = w.WriteToken(tok); err != nil {
+				break
+			}
+		}
+		if !errors.As(err, &UnexpectedTagError{}) && !errors.As(err, &InvalidArraySizeError{}) {
+			t.Errorf("%v: got error %v, expected an UnexpectedTagError or InvalidArraySizeError", name, err)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package nbt
+
+import "fmt"
+
+// TagType is the type of an NBT tag, such as TypeCompound for a TAG_Compound.
+type TagType byte
+
+const (
+	TypeEnd       = TagType(tagEnd)
+	TypeByte      = TagType(tagByte)
+	TypeShort     = TagType(tagInt16)
+	TypeInt       = TagType(tagInt32)
+	TypeLong      = TagType(tagInt64)
+	TypeFloat     = TagType(tagFloat32)
+	TypeDouble    = TagType(tagFloat64)
+	TypeByteArray = TagType(tagByteArray)
+	TypeString    = TagType(tagString)
+	TypeList      = TagType(tagSlice)
+	TypeCompound  = TagType(tagStruct)
+	TypeIntArray  = TagType(tagInt32Array)
+	TypeLongArray = TagType(tagInt64Array)
+)
+
+// String returns the name of the tag type, such as TAG_Compound.
+func (t TagType) String() string {
+	if !tagExists(byte(t)) {
+		return fmt.Sprintf("TAG_Unknown(%v)", byte(t))
+	}
+	return tagName(byte(t))
+}
+
+// Tag is a single NBT tag in a tree of tags. Unlike the Go values that Marshal and Unmarshal work with, a
+// tree of tags holds the exact type of every tag and the order of the tags in compounds, so that NBT read
+// into a tree and written again is the same as the original. Trees of tags are read and written using
+// UnmarshalTag and MarshalTag, or using a TokenReader and TokenWriter.
+//
+// Tag is implemented by Byte, Short, Int, Long, Float, Double, ByteArray, String, *List, *Compound, IntArray
+// and LongArray.
+type Tag interface {
+	// Type returns the type of the tag.
+	Type() TagType
+}
+
+type (
+	// Byte is a TAG_Byte.
+	Byte byte
+	// Short is a TAG_Short.
+	Short int16
+	// Int is a TAG_Int.
+	Int int32
+	// Long is a TAG_Long.
+	Long int64
+	// Float is a TAG_Float.
+	Float float32
+	// Double is a TAG_Double.
+	Double float64
+	// ByteArray is a TAG_ByteArray.
+	ByteArray []byte
+	// String is a TAG_String.
+	String string
+	// IntArray is a TAG_IntArray.
+	IntArray []int32
+	// LongArray is a TAG_LongArray.
+	LongArray []int64
+)
+
+// Type ...
+func (Byte) Type() TagType { return TypeByte }
+
+// Type ...
+func (Short) Type() TagType { return TypeShort }
+
+// Type ...
+func (Int) Type() TagType { return TypeInt }
+
+// Type ...
+func (Long) Type() TagType { return TypeLong }
+
+// Type ...
+func (Float) Type() TagType { return TypeFloat }
+
+// Type ...
+func (Double) Type() TagType { return TypeDouble }
+
+// Type ...
+func (ByteArray) Type() TagType { return TypeByteArray }
+
+// Type ...
+func (String) Type() TagType { return TypeString }
+
+// Type ...
+func (IntArray) Type() TagType { return TypeIntArray }
+
+// Type ...
+func (LongArray) Type() TagType { return TypeLongArray }
+
+// List is a TAG_List. All tags in a List must have the element type of the List. Empty lists typically have
+// TypeEnd as their element type.
+type List struct {
+	// ElemType is the type of the tags in the List.
+	ElemType TagType
+	// Tags holds the tags in the List.
+	Tags []Tag
+}
+
+// Type ...
+func (*List) Type() TagType { return TypeList }
+
+// Compound is a TAG_Compound. It holds tags by their name and keeps the order in which the tags were added,
+// so that a Compound is written in the same order as it was read. The zero value of Compound is an empty
+// Compound ready to use.
+type Compound struct {
+	names []string
+	tags  map[string]Tag
+}
+
+// NewCompound returns an empty Compound.
+func NewCompound() *Compound {
+	return &Compound{tags: make(map[string]Tag)}
+}
+
+// Type ...
+func (*Compound) Type() TagType { return TypeCompound }
+
+// Len returns the amount of tags in the Compound.
+func (c *Compound) Len() int {
+	return len(c.names)
+}
+
+// Names returns the names of the tags in the Compound, in the order in which they were added.
+func (c *Compound) Names() []string {
+	return append([]string(nil), c.names...)
+}
+
+// Get returns the tag with the name passed. If the Compound has no tag with that name, false is returned.
+func (c *Compound) Get(name string) (Tag, bool) {
+	tag, ok := c.tags[name]
+	return tag, ok
+}
+
+// Set sets the tag with the name passed. If the Compound already has a tag with that name, the tag is
+// replaced and keeps its position. Otherwise it is added after all other tags.
+func (c *Compound) Set(name string, tag Tag) {
+	if c.tags == nil {
+		c.tags = make(map[string]Tag)
+	}
+	if _, ok := c.tags[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.tags[name] = tag
+}
+
+// Delete removes the tag with the name passed from the Compound, if it has one.
+func (c *Compound) Delete(name string) {
+	if _, ok := c.tags[name]; !ok {
+		return
+	}
+	delete(c.tags, name)
+	for i, n := range c.names {
+		if n == name {
+			c.names = append(c.names[:i], c.names[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package minecraft
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// Network represents an implementation of a transport that Minecraft connections may be established over.
+// The transport must preserve packet boundaries: Each call to Write on one end of a connection must result in
+// exactly one call to Read on the other end returning the same data.
+// Networks are registered using RegisterNetwork and selected by name in calls such as Dialer.Dial and
+// ListenConfig.Listen. The "raknet" and "pipe" networks are registered by default.
+type Network interface {
+	// DialContext attempts to dial a connection to the address passed. The connection must be established
+	// before the context passed is cancelled.
+	DialContext(ctx context.Context, address string) (net.Conn, error)
+	// PingContext sends a ping to the address passed and returns the pong data of the server, formatted as a
+	// RakNet unconnected pong.
+	PingContext(ctx context.Context, address string) (pong []byte, err error)
+	// Listen announces on the address passed and returns a NetworkListener that may be used to accept
+	// connections.
+	Listen(address string) (NetworkListener, error)
+}
+
+// NetworkListener represents a listener of a Network. Besides accepting connections, it answers pings with
+// pong data set by the Listener.
+type NetworkListener interface {
+	net.Listener
+	// ID returns a unique ID of the listener, which is included in its pong data.
+	ID() int64
+	// PongData sets the data returned to pings sent to the listener.
+	PongData(data []byte)
+}
+
+// networks holds all networks registered using RegisterNetwork.
+var networks sync.Map
+
+// RegisterNetwork registers a Network under the name passed, so that it may be used in calls such as
+// Dialer.Dial and ListenConfig.Listen. A Network registered with the same name as an existing one replaces
+// it.
+func RegisterNetwork(name string, network Network) {
+	networks.Store(name, network)
+}
+
+// UnregisterNetwork removes the Network registered under the name passed, so that the name can no longer be
+// used in calls such as Dialer.Dial and ListenConfig.Listen. Connections and listeners already using the
+// Network are not closed. UnregisterNetwork does nothing if no Network is registered under the name.
+func UnregisterNetwork(name string) {
+	networks.Delete(name)
+}
+
+// networkByName returns the Network registered under the name passed, or false if no such network exists.
+func networkByName(name string) (Network, bool) {
+	n, ok := networks.Load(name)
+	if !ok {
+		return nil, false
+	}
+	return n.(Network), true
+}
+
+// init registers the networks implemented in this package.
+func init() {
+	RegisterNetwork("raknet", RakNet{})
+	RegisterNetwork("pipe", NewPipe())
+}
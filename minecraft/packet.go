@@ -37,13 +37,18 @@ func (p *packetData) decode(conn *Conn) (pk packet.Packet, err error) {
 	if !ok {
 		// No packet with the ID. This may be a custom packet of some sorts.
 		pk = &packet.Unknown{PacketID: p.h.PacketID}
+	} else {
+		pk = pkFunc()
 	}
-	pk = pkFunc()
 
 	r := protocol.NewReader(p.payload, conn.shieldID.Load())
 	defer func() {
 		if recoveredErr := recover(); recoveredErr != nil {
-			err = fmt.Errorf("%T: %w", pk, recoveredErr.(error))
+			if e, ok := recoveredErr.(error); ok {
+				err = fmt.Errorf("%T: %w", pk, e)
+				return
+			}
+			err = fmt.Errorf("%T: %v", pk, recoveredErr)
 		}
 	}()
 	pk.Unmarshal(r)
@@ -0,0 +1,314 @@
+package minecraft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// pipeBufferSize is the amount of packets that may be written to one end of a pipe connection before writes
+// block until the other end reads them.
+const pipeBufferSize = 256
+
+// Pipe is an in-memory Network. Connections dialed over a Pipe are connected directly to a listener of the
+// same Pipe in the same process, without any networking involved, while preserving packet boundaries. Pipe is
+// mainly useful for testing Dialers and Listeners in a single process.
+// A Pipe is registered under the name "pipe" by default. Separate Pipes have separate address spaces.
+// Any string may be used as address, but as a Dialer sends the address it dialed in its login request, which
+// a Listener validates, addresses used with Dialers should have the form of a UDP address, like
+// "127.0.0.1:19132".
+type Pipe struct {
+	mu        sync.Mutex
+	listeners map[string]*pipeListener
+	count     uint64
+}
+
+// NewPipe returns a new Pipe without any listeners.
+func NewPipe() *Pipe {
+	return &Pipe{listeners: make(map[string]*pipeListener)}
+}
+
+// DialContext connects to the listener of the Pipe listening on the address passed.
+func (p *Pipe) DialContext(ctx context.Context, address string) (net.Conn, error) {
+	l, err := p.listener(address)
+	if err != nil {
+		return nil, err
+	}
+	local := pipeAddr(fmt.Sprintf("pipe-client-%d", atomic.AddUint64(&p.count, 1)))
+	client, server := newPipeConns(local, l.addr)
+	select {
+	case l.incoming <- server:
+		return client, nil
+	case <-l.closed:
+		return nil, &net.OpError{Op: "dial", Net: "pipe", Addr: l.addr, Err: net.ErrClosed}
+	case <-ctx.Done():
+		return nil, &net.OpError{Op: "dial", Net: "pipe", Addr: l.addr, Err: ctx.Err()}
+	}
+}
+
+// PingContext returns the pong data of the listener of the Pipe listening on the address passed.
+func (p *Pipe) PingContext(_ context.Context, address string) ([]byte, error) {
+	l, err := p.listener(address)
+	if err != nil {
+		return nil, err
+	}
+	return l.pong.Load().([]byte), nil
+}
+
+// Listen listens on the address passed. If the address is empty, a unique address is chosen. Listen returns
+// an error if another listener of the Pipe is already listening on the address.
+func (p *Pipe) Listen(address string) (NetworkListener, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if address == "" {
+		address = fmt.Sprintf("pipe-server-%d", atomic.AddUint64(&p.count, 1))
+	}
+	if _, ok := p.listeners[address]; ok {
+		return nil, &net.OpError{Op: "listen", Net: "pipe", Addr: pipeAddr(address), Err: fmt.Errorf("address already in use")}
+	}
+	l := &pipeListener{
+		pipe:     p,
+		addr:     pipeAddr(address),
+		id:       rand.Int63(),
+		incoming: make(chan *pipeConn),
+		closed:   make(chan struct{}),
+	}
+	l.pong.Store([]byte{})
+	p.listeners[address] = l
+	return l, nil
+}
+
+// listener returns the listener listening on the address passed.
+func (p *Pipe) listener(address string) (*pipeListener, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	l, ok := p.listeners[address]
+	if !ok {
+		return nil, &net.OpError{Op: "dial", Net: "pipe", Addr: pipeAddr(address), Err: fmt.Errorf("connection refused")}
+	}
+	return l, nil
+}
+
+// pipeAddr is the net.Addr of one end of a pipe connection or a pipe listener.
+type pipeAddr string
+
+// Network ...
+func (pipeAddr) Network() string {
+	return "pipe"
+}
+
+// String ...
+func (a pipeAddr) String() string {
+	return string(a)
+}
+
+// pipeListener is the NetworkListener of a Pipe.
+type pipeListener struct {
+	pipe     *Pipe
+	addr     pipeAddr
+	id       int64
+	pong     atomic.Value
+	incoming chan *pipeConn
+	once     sync.Once
+	closed   chan struct{}
+}
+
+// Accept waits for a connection to be dialed to the listener and returns it.
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.incoming:
+		return conn, nil
+	case <-l.closed:
+		return nil, &net.OpError{Op: "accept", Net: "pipe", Addr: l.addr, Err: net.ErrClosed}
+	}
+}
+
+// Close stops the listener, so that its address may be listened on again. Connections already accepted are
+// not closed.
+func (l *pipeListener) Close() error {
+	l.once.Do(func() {
+		close(l.closed)
+		l.pipe.mu.Lock()
+		delete(l.pipe.listeners, string(l.addr))
+		l.pipe.mu.Unlock()
+	})
+	return nil
+}
+
+// Addr ...
+func (l *pipeListener) Addr() net.Addr {
+	return l.addr
+}
+
+// ID ...
+func (l *pipeListener) ID() int64 {
+	return l.id
+}
+
+// PongData ...
+func (l *pipeListener) PongData(data []byte) {
+	l.pong.Store(append([]byte(nil), data...))
+}
+
+// pipeConn is one end of a pipe connection. Every Write results in one packet read by the other end.
+type pipeConn struct {
+	local, remote pipeAddr
+
+	in, out chan []byte
+	// closed is shared by both ends: Closing one end of a connection closes the other end too.
+	closed *pipeClosed
+
+	mu       sync.Mutex
+	deadline time.Time
+	// changed is closed and replaced when the read deadline is changed, so that pending reads pick up the
+	// new deadline.
+	changed chan struct{}
+}
+
+// pipeClosed is closed when either end of a pipe connection is closed.
+type pipeClosed struct {
+	once sync.Once
+	c    chan struct{}
+}
+
+// newPipeConns returns both ends of a new pipe connection between the two addresses passed.
+func newPipeConns(client, server pipeAddr) (*pipeConn, *pipeConn) {
+	a, b := make(chan []byte, pipeBufferSize), make(chan []byte, pipeBufferSize)
+	closed := &pipeClosed{c: make(chan struct{})}
+	return &pipeConn{local: client, remote: server, in: a, out: b, closed: closed, changed: make(chan struct{})},
+		&pipeConn{local: server, remote: client, in: b, out: a, closed: closed, changed: make(chan struct{})}
+}
+
+// ReadPacket reads the next packet written by the other end of the connection. Packets written before the
+// connection was closed may still be read after closing.
+func (c *pipeConn) ReadPacket() ([]byte, error) {
+	select {
+	case b := <-c.in:
+		return b, nil
+	default:
+	}
+	for {
+		c.mu.Lock()
+		deadline, changed := c.deadline, c.changed
+		c.mu.Unlock()
+		b, err := c.readUntil(deadline, changed)
+		if err != errDeadlineChanged {
+			return b, err
+		}
+	}
+}
+
+// readUntil waits for the next packet until the deadline passed. If the deadline of the connection is
+// changed before then, readUntil returns errDeadlineChanged so that the read may be retried with the new
+// deadline.
+func (c *pipeConn) readUntil(deadline time.Time, changed <-chan struct{}) ([]byte, error) {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		t := time.NewTimer(time.Until(deadline))
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case b := <-c.in:
+		return b, nil
+	case <-c.closed.c:
+		select {
+		case b := <-c.in:
+			return b, nil
+		default:
+			return nil, c.opError("read", net.ErrClosed)
+		}
+	case <-timeout:
+		return nil, c.opError("read", pipeTimeoutError{})
+	case <-changed:
+		return nil, errDeadlineChanged
+	}
+}
+
+// Read reads the next packet into b. If b is too small to hold the packet, io.ErrShortBuffer is returned and
+// the packet is lost.
+func (c *pipeConn) Read(b []byte) (int, error) {
+	data, err := c.ReadPacket()
+	if err != nil {
+		return 0, err
+	}
+	if len(data) > len(b) {
+		return 0, c.opError("read", io.ErrShortBuffer)
+	}
+	return copy(b, data), nil
+}
+
+// Write writes b as a single packet to the other end of the connection.
+func (c *pipeConn) Write(b []byte) (int, error) {
+	select {
+	case <-c.closed.c:
+		return 0, c.opError("write", net.ErrClosed)
+	default:
+	}
+	select {
+	case c.out <- append([]byte(nil), b...):
+		return len(b), nil
+	case <-c.closed.c:
+		return 0, c.opError("write", net.ErrClosed)
+	}
+}
+
+// Close closes both ends of the connection.
+func (c *pipeConn) Close() error {
+	c.closed.once.Do(func() {
+		close(c.closed.c)
+	})
+	return nil
+}
+
+// LocalAddr ...
+func (c *pipeConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+// RemoteAddr ...
+func (c *pipeConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// SetDeadline sets the read deadline of the connection. Writes never time out.
+func (c *pipeConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline of the connection. Reads already waiting for a packet use the new
+// deadline as well.
+func (c *pipeConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	close(c.changed)
+	c.changed = make(chan struct{})
+	return nil
+}
+
+// SetWriteDeadline is a stub function to implement net.Conn. It has no functionality.
+func (c *pipeConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+// opError wraps an error in a net.OpError for the connection.
+func (c *pipeConn) opError(op string, err error) error {
+	return &net.OpError{Op: op, Net: "pipe", Source: c.local, Addr: c.remote, Err: err}
+}
+
+// errDeadlineChanged is returned by pipeConn.readUntil if the read deadline is changed while waiting.
+var errDeadlineChanged = errors.New("deadline changed")
+
+// pipeTimeoutError is returned when a read deadline of a pipe connection passes.
+type pipeTimeoutError struct{}
+
+func (pipeTimeoutError) Error() string   { return "i/o timeout" }
+func (pipeTimeoutError) Timeout() bool   { return true }
+func (pipeTimeoutError) Temporary() bool { return true }
@@ -0,0 +1,117 @@
+package minecraft_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"phoenix/minecraft"
+	"testing"
+	"time"
+)
+
+// TestPipe checks that a Pipe preserves packet boundaries and closes both ends of a connection together.
+func TestPipe(t *testing.T) {
+	pipe := minecraft.NewPipe()
+	l, err := pipe.Listen("server")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	if _, err := pipe.Listen("server"); err == nil {
+		t.Fatal("listening twice on the same address succeeded")
+	}
+	l.PongData([]byte("pong"))
+	if pong, err := pipe.PingContext(context.Background(), "server"); err != nil || string(pong) != "pong" {
+		t.Fatalf("ping: got %q, %v", pong, err)
+	}
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, _ := l.Accept()
+		accepted <- c
+	}()
+	client, err := pipe.DialContext(context.Background(), "server")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	server := <-accepted
+
+	packets := [][]byte{{1, 2, 3}, {4}, bytes.Repeat([]byte{5}, 4096)}
+	for _, p := range packets {
+		if _, err := client.Write(p); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	buf := make([]byte, 8192)
+	for _, p := range packets {
+		n, err := server.Read(buf)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if !bytes.Equal(buf[:n], p) {
+			t.Fatalf("read %v bytes, expected packet of %v bytes", n, len(p))
+		}
+	}
+
+	_ = server.SetReadDeadline(time.Now().Add(time.Millisecond * 10))
+	var netErr net.Error
+	if _, err := server.Read(buf); !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+
+	// Packets written before closing must still arrive.
+	_, _ = server.Write([]byte{6})
+	_ = server.Close()
+	if n, err := client.Read(buf); err != nil || n != 1 {
+		t.Fatalf("read after close: %v", err)
+	}
+	if _, err := client.Read(buf); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("expected closed error, got %v", err)
+	}
+	if _, err := client.Write([]byte{7}); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("expected closed error, got %v", err)
+	}
+
+	_ = l.Close()
+	if _, err := pipe.DialContext(context.Background(), "server"); err == nil {
+		t.Fatal("dial succeeded after listener was closed")
+	}
+}
+
+// TestPipeDeadline checks that setting the read deadline of a pipe connection affects reads already waiting.
+func TestPipeDeadline(t *testing.T) {
+	pipe := minecraft.NewPipe()
+	l, err := pipe.Listen("server")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		_, _ = l.Accept()
+	}()
+	client, err := pipe.DialContext(context.Background(), "server")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer client.Close()
+
+	read := make(chan error, 1)
+	go func() {
+		_, err := client.Read(make([]byte, 16))
+		read <- err
+	}()
+	// Give the read time to start waiting without a deadline.
+	time.Sleep(time.Millisecond * 20)
+	_ = client.SetDeadline(time.Now().Add(time.Millisecond * 10))
+
+	select {
+	case err := <-read:
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			t.Fatalf("expected timeout error, got %v", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("pending read did not time out after setting the deadline")
+	}
+}
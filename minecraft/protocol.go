@@ -0,0 +1,63 @@
+package minecraft
+
+import (
+	"phoenix/minecraft/protocol"
+	"phoenix/minecraft/protocol/packet"
+)
+
+// Protocol represents the network protocol of a specific version of Minecraft. Conns always expose packets
+// of the latest protocol, as implemented in the packet package, to the user. A Protocol translates between
+// those packets and the packets of the version it represents, so that a Conn can speak to clients and
+// servers of older or newer versions.
+type Protocol interface {
+	// ID returns the protocol number of the version, such as 475. It is the number sent in the Login packet
+	// and in the pong of a server.
+	ID() int32
+	// Ver returns the Minecraft version the protocol belongs to, such as "1.18.0".
+	Ver() string
+	// Packets returns the packet ID table of the protocol: A packet.Pool holding all packets of the version,
+	// indexed by their ID. Packets read from a Conn are decoded using this pool.
+	Packets() packet.Pool
+	// ConvertToLatest converts a packet read from the connection, which was obtained from the Pool returned
+	// by Packets, to zero or more packets of the latest protocol.
+	ConvertToLatest(pk packet.Packet, conn *Conn) []packet.Packet
+	// ConvertFromLatest converts a packet of the latest protocol, which is about to be written to the
+	// connection, to zero or more packets of this protocol.
+	ConvertFromLatest(pk packet.Packet, conn *Conn) []packet.Packet
+}
+
+// DefaultProtocol is the Protocol of the latest version supported, protocol.CurrentProtocol. It does not
+// translate packets in any way.
+var DefaultProtocol Protocol = proto{}
+
+// proto is the Protocol implementation of protocol.CurrentProtocol.
+type proto struct{}
+
+// ID ...
+func (proto) ID() int32 { return protocol.CurrentProtocol }
+
+// Ver ...
+func (proto) Ver() string { return protocol.CurrentVersion }
+
+// Packets ...
+func (proto) Packets() packet.Pool { return packet.NewPool() }
+
+// ConvertToLatest ...
+func (proto) ConvertToLatest(pk packet.Packet, _ *Conn) []packet.Packet { return []packet.Packet{pk} }
+
+// ConvertFromLatest ...
+func (proto) ConvertFromLatest(pk packet.Packet, _ *Conn) []packet.Packet { return []packet.Packet{pk} }
+
+// findProtocol looks for a Protocol with the ID passed in the slice of protocols. DefaultProtocol is returned
+// if the ID is that of the latest protocol. If no protocol matched, findProtocol returns false.
+func findProtocol(id int32, protocols []Protocol) (Protocol, bool) {
+	if id == protocol.CurrentProtocol {
+		return DefaultProtocol, true
+	}
+	for _, p := range protocols {
+		if p.ID() == id {
+			return p, true
+		}
+	}
+	return nil, false
+}
@@ -175,6 +175,7 @@ func CommandMessage(r *Reader, x *CommandOutputMessage) {
 	r.Bool(&x.Success)
 	r.String(&x.Message)
 	r.Varuint32(&count)
+	r.LimitLength(count)
 	x.Parameters = make([]string, count)
 	for i := uint32(0); i < count; i++ {
 		r.String(&x.Parameters[i])
@@ -220,9 +221,11 @@ func CommandData(r *Reader, x *Command, enums []CommandEnum, suffixes []string)
 		x.Aliases = enums[aliasOffset].Options
 	}
 	r.Varuint32(&overloadCount)
+	r.LimitLength(overloadCount)
 	x.Overloads = make([]CommandOverload, overloadCount)
 	for i := uint32(0); i < overloadCount; i++ {
 		r.Varuint32(&paramCount)
+		r.LimitLength(paramCount)
 		x.Overloads[i].Parameters = make([]CommandParameter, paramCount)
 		for j := uint32(0); j < paramCount; j++ {
 			CommandParam(r, &x.Overloads[i].Parameters[j], enums, suffixes)
@@ -75,6 +75,7 @@ func ItemEnchants(r *Reader, x *ItemEnchantments) {
 	r.Int32(&x.Slot)
 	for i := 0; i < 3; i++ {
 		r.Varuint32(&l)
+		r.LimitLength(l)
 		x.Enchantments[i] = make([]EnchantmentInstance, l)
 		for j := uint32(0); j < l; j++ {
 			Enchant(r, &x.Enchantments[i][j])
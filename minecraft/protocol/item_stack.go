@@ -26,45 +26,8 @@ func WriteStackRequest(w *Writer, x *ItemStackRequest) {
 	w.Varint32(&x.RequestID)
 	w.Varuint32(&l)
 	for _, action := range x.Actions {
-		var id byte
-		switch action.(type) {
-		case *TakeStackRequestAction:
-			id = StackRequestActionTake
-		case *PlaceStackRequestAction:
-			id = StackRequestActionPlace
-		case *SwapStackRequestAction:
-			id = StackRequestActionSwap
-		case *DropStackRequestAction:
-			id = StackRequestActionDrop
-		case *DestroyStackRequestAction:
-			id = StackRequestActionDestroy
-		case *ConsumeStackRequestAction:
-			id = StackRequestActionConsume
-		case *CreateStackRequestAction:
-			id = StackRequestActionCreate
-		case *LabTableCombineStackRequestAction:
-			id = StackRequestActionLabTableCombine
-		case *BeaconPaymentStackRequestAction:
-			id = StackRequestActionBeaconPayment
-		case *MineBlockStackRequestAction:
-			id = StackRequestActionMineBlock
-		case *CraftRecipeStackRequestAction:
-			id = StackRequestActionCraftRecipe
-		case *AutoCraftRecipeStackRequestAction:
-			id = StackRequestActionCraftRecipeAuto
-		case *CraftCreativeStackRequestAction:
-			id = StackRequestActionCraftCreative
-		case *CraftRecipeOptionalStackRequestAction:
-			id = StackRequestActionCraftRecipeOptional
-		case *CraftGrindstoneRecipeStackRequestAction:
-			id = StackRequestActionCraftGrindstone
-		case *CraftLoomRecipeStackRequestAction:
-			id = StackRequestActionCraftLoom
-		case *CraftNonImplementedStackRequestAction:
-			id = StackRequestActionCraftNonImplementedDeprecated
-		case *CraftResultsDeprecatedStackRequestAction:
-			id = StackRequestActionCraftResultsDeprecated
-		default:
+		id, ok := StackRequestActionID(action)
+		if !ok {
 			w.UnknownEnumOption(fmt.Sprintf("%T", action), "stack request action type")
 		}
 		w.Uint8(&id)
@@ -89,45 +52,8 @@ func StackRequest(r *Reader, x *ItemStackRequest) {
 		var id uint8
 		r.Uint8(&id)
 
-		var action StackRequestAction
-		switch id {
-		case StackRequestActionTake:
-			action = &TakeStackRequestAction{}
-		case StackRequestActionPlace:
-			action = &PlaceStackRequestAction{}
-		case StackRequestActionSwap:
-			action = &SwapStackRequestAction{}
-		case StackRequestActionDrop:
-			action = &DropStackRequestAction{}
-		case StackRequestActionDestroy:
-			action = &DestroyStackRequestAction{}
-		case StackRequestActionConsume:
-			action = &ConsumeStackRequestAction{}
-		case StackRequestActionCreate:
-			action = &CreateStackRequestAction{}
-		case StackRequestActionLabTableCombine:
-			action = &LabTableCombineStackRequestAction{}
-		case StackRequestActionBeaconPayment:
-			action = &BeaconPaymentStackRequestAction{}
-		case StackRequestActionMineBlock:
-			action = &MineBlockStackRequestAction{}
-		case StackRequestActionCraftRecipe:
-			action = &CraftRecipeStackRequestAction{}
-		case StackRequestActionCraftRecipeAuto:
-			action = &AutoCraftRecipeStackRequestAction{}
-		case StackRequestActionCraftCreative:
-			action = &CraftCreativeStackRequestAction{}
-		case StackRequestActionCraftRecipeOptional:
-			action = &CraftRecipeOptionalStackRequestAction{}
-		case StackRequestActionCraftGrindstone:
-			action = &CraftGrindstoneRecipeStackRequestAction{}
-		case StackRequestActionCraftLoom:
-			action = &CraftLoomRecipeStackRequestAction{}
-		case StackRequestActionCraftNonImplementedDeprecated:
-			action = &CraftNonImplementedStackRequestAction{}
-		case StackRequestActionCraftResultsDeprecated:
-			action = &CraftResultsDeprecatedStackRequestAction{}
-		default:
+		action, ok := NewStackRequestAction(id)
+		if !ok {
 			r.UnknownEnumOption(id, "stack request action type")
 			return
 		}
@@ -144,6 +70,94 @@ func StackRequest(r *Reader, x *ItemStackRequest) {
 	}
 }
 
+// StackRequestActionID returns the ID of the type of the StackRequestAction passed. It returns false if the
+// action is not of one of the concrete types in this package.
+func StackRequestActionID(action StackRequestAction) (byte, bool) {
+	switch action.(type) {
+	case *TakeStackRequestAction:
+		return StackRequestActionTake, true
+	case *PlaceStackRequestAction:
+		return StackRequestActionPlace, true
+	case *SwapStackRequestAction:
+		return StackRequestActionSwap, true
+	case *DropStackRequestAction:
+		return StackRequestActionDrop, true
+	case *DestroyStackRequestAction:
+		return StackRequestActionDestroy, true
+	case *ConsumeStackRequestAction:
+		return StackRequestActionConsume, true
+	case *CreateStackRequestAction:
+		return StackRequestActionCreate, true
+	case *LabTableCombineStackRequestAction:
+		return StackRequestActionLabTableCombine, true
+	case *BeaconPaymentStackRequestAction:
+		return StackRequestActionBeaconPayment, true
+	case *MineBlockStackRequestAction:
+		return StackRequestActionMineBlock, true
+	case *CraftRecipeStackRequestAction:
+		return StackRequestActionCraftRecipe, true
+	case *AutoCraftRecipeStackRequestAction:
+		return StackRequestActionCraftRecipeAuto, true
+	case *CraftCreativeStackRequestAction:
+		return StackRequestActionCraftCreative, true
+	case *CraftRecipeOptionalStackRequestAction:
+		return StackRequestActionCraftRecipeOptional, true
+	case *CraftGrindstoneRecipeStackRequestAction:
+		return StackRequestActionCraftGrindstone, true
+	case *CraftLoomRecipeStackRequestAction:
+		return StackRequestActionCraftLoom, true
+	case *CraftNonImplementedStackRequestAction:
+		return StackRequestActionCraftNonImplementedDeprecated, true
+	case *CraftResultsDeprecatedStackRequestAction:
+		return StackRequestActionCraftResultsDeprecated, true
+	}
+	return 0, false
+}
+
+// NewStackRequestAction returns a new StackRequestAction of the type with the ID passed. It returns false if
+// the ID is not one of the StackRequestAction constants.
+func NewStackRequestAction(id byte) (StackRequestAction, bool) {
+	switch id {
+	case StackRequestActionTake:
+		return &TakeStackRequestAction{}, true
+	case StackRequestActionPlace:
+		return &PlaceStackRequestAction{}, true
+	case StackRequestActionSwap:
+		return &SwapStackRequestAction{}, true
+	case StackRequestActionDrop:
+		return &DropStackRequestAction{}, true
+	case StackRequestActionDestroy:
+		return &DestroyStackRequestAction{}, true
+	case StackRequestActionConsume:
+		return &ConsumeStackRequestAction{}, true
+	case StackRequestActionCreate:
+		return &CreateStackRequestAction{}, true
+	case StackRequestActionLabTableCombine:
+		return &LabTableCombineStackRequestAction{}, true
+	case StackRequestActionBeaconPayment:
+		return &BeaconPaymentStackRequestAction{}, true
+	case StackRequestActionMineBlock:
+		return &MineBlockStackRequestAction{}, true
+	case StackRequestActionCraftRecipe:
+		return &CraftRecipeStackRequestAction{}, true
+	case StackRequestActionCraftRecipeAuto:
+		return &AutoCraftRecipeStackRequestAction{}, true
+	case StackRequestActionCraftCreative:
+		return &CraftCreativeStackRequestAction{}, true
+	case StackRequestActionCraftRecipeOptional:
+		return &CraftRecipeOptionalStackRequestAction{}, true
+	case StackRequestActionCraftGrindstone:
+		return &CraftGrindstoneRecipeStackRequestAction{}, true
+	case StackRequestActionCraftLoom:
+		return &CraftLoomRecipeStackRequestAction{}, true
+	case StackRequestActionCraftNonImplementedDeprecated:
+		return &CraftNonImplementedStackRequestAction{}, true
+	case StackRequestActionCraftResultsDeprecated:
+		return &CraftResultsDeprecatedStackRequestAction{}, true
+	}
+	return nil, false
+}
+
 const (
 	ItemStackResponseStatusOK = iota
 	ItemStackResponseStatusError
@@ -215,6 +229,7 @@ func StackResponse(r *Reader, x *ItemStackResponse) {
 		return
 	}
 	r.Varuint32(&l)
+	r.LimitLength(l)
 
 	x.ContainerInfo = make([]StackResponseContainerInfo, l)
 	for i := uint32(0); i < l; i++ {
@@ -237,6 +252,7 @@ func StackContainerInfo(r *Reader, x *StackResponseContainerInfo) {
 	var l uint32
 	r.Uint8(&x.ContainerID)
 	r.Varuint32(&l)
+	r.LimitLength(l)
 
 	x.SlotInfo = make([]StackResponseSlotInfo, l)
 	for i := uint32(0); i < l; i++ {
@@ -564,7 +580,7 @@ func (c *CraftRecipeOptionalStackRequestAction) Unmarshal(r *Reader) {
 		r.Uint8(&c.UnknownBytes[i])
 	}
 	if !bytes.Equal(c.UnknownBytes[:], zeroBytes) {
-		panic(fmt.Sprintf("craft recipe optional stack request action unknown bytes are not all 0: %x", c.UnknownBytes))
+		r.panicf("craft recipe optional stack request action unknown bytes are not all 0: %x", c.UnknownBytes)
 	}
 }
 
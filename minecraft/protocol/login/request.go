@@ -7,6 +7,7 @@ import (
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"gopkg.in/square/go-jose.v2"
 	"gopkg.in/square/go-jose.v2/jwt"
@@ -38,6 +39,51 @@ func init() {
 // mojangKey holds the parsed Mojang ecdsa.PublicKey.
 var mojangKey = new(ecdsa.PublicKey)
 
+// MojangKey returns the ecdsa.PublicKey that Mojang signs the login chains of players logged in with XBOX
+// Live with.
+func MojangKey() *ecdsa.PublicKey {
+	key := *mojangKey
+	return &key
+}
+
+// Verifier verifies login requests. The zero value of a Verifier verifies requests like Parse does.
+type Verifier struct {
+	// RootKeys are the keys trusted to sign the login chains of players logged in with XBOX Live. If empty,
+	// only the Mojang key, as returned by MojangKey, is trusted. Requests with a chain signed by any other key
+	// are parsed, but not considered authenticated.
+	RootKeys []*ecdsa.PublicKey
+	// ClockSkew is the difference between the clocks of the client, the signer of the chain and the Verifier
+	// that is tolerated when checking if the tokens of the request are valid. If zero, a skew of one minute
+	// is tolerated.
+	ClockSkew time.Duration
+}
+
+// ErrUntrustedChain is returned by Verifier.Parse if a request holds XBOX Live identity data in a chain that
+// is not signed by any of the root keys trusted.
+var ErrUntrustedChain = errors.New("login chain is not signed by a trusted key")
+
+// leeway returns the leeway to use when validating the times of tokens in a request.
+func (v Verifier) leeway() time.Duration {
+	if v.ClockSkew == 0 {
+		return jwt.DefaultLeeway
+	}
+	return v.ClockSkew
+}
+
+// trusted checks if the key passed is one of the root keys trusted by the Verifier.
+func (v Verifier) trusted(key *ecdsa.PublicKey) bool {
+	roots := v.RootKeys
+	if len(roots) == 0 {
+		roots = []*ecdsa.PublicKey{mojangKey}
+	}
+	for _, root := range roots {
+		if bytes.Equal(key.X.Bytes(), root.X.Bytes()) && bytes.Equal(key.Y.Bytes(), root.Y.Bytes()) {
+			return true
+		}
+	}
+	return false
+}
+
 // AuthResult is returned by a call to Parse. It holds the ecdsa.PublicKey of the client and a bool that
 // indicates if the player was logged in with XBOX Live.
 type AuthResult struct {
@@ -51,7 +97,16 @@ type AuthResult struct {
 // Parse returns IdentityData and ClientData, of which IdentityData cannot under any circumstance be edited by
 // the client. Rather, it is obtained from an authentication endpoint. The ClientData can, however, be edited
 // freely by the client.
+// Parse is the equivalent of Verifier{}.Parse(request).
 func Parse(request []byte) (IdentityData, ClientData, AuthResult, error) {
+	return Verifier{}.Parse(request)
+}
+
+// Parse parses and verifies the login request passed, like the Parse function. The request is only
+// considered authenticated by XBOX Live if its chain is signed by one of the RootKeys of the Verifier. If the
+// chain is signed by another key, but holds an XUID anyway, an error wrapping ErrUntrustedChain is returned.
+// Errors of tokens that are expired or not yet valid wrap jwt.ErrExpired and jwt.ErrNotValidYet.
+func (v Verifier) Parse(request []byte) (IdentityData, ClientData, AuthResult, error) {
 	var (
 		iData IdentityData
 		cData ClientData
@@ -84,7 +139,7 @@ func Parse(request []byte) (IdentityData, ClientData, AuthResult, error) {
 		if err := parseFullClaim(req.Chain[0], key, &identityClaims); err != nil {
 			return iData, cData, res, err
 		}
-		if err := identityClaims.Validate(jwt.Expected{Time: t}); err != nil {
+		if err := identityClaims.Validate(jwt.Expected{Time: t}, v.leeway()); err != nil {
 			return iData, cData, res, fmt.Errorf("validate token 0: %w", err)
 		}
 	case 3:
@@ -94,23 +149,26 @@ func Parse(request []byte) (IdentityData, ClientData, AuthResult, error) {
 		if err := parseFullClaim(req.Chain[0], key, &c); err != nil {
 			return iData, cData, res, fmt.Errorf("parse token 0: %w", err)
 		}
-		if err := c.Validate(jwt.Expected{Time: t}); err != nil {
+		if err := c.ValidateWithLeeway(jwt.Expected{Time: t}, v.leeway()); err != nil {
 			return iData, cData, res, fmt.Errorf("validate token 0: %w", err)
 		}
-		authenticated = bytes.Equal(key.X.Bytes(), mojangKey.X.Bytes()) && bytes.Equal(key.Y.Bytes(), mojangKey.Y.Bytes())
+		authenticated = v.trusted(key)
 
 		if err := parseFullClaim(req.Chain[1], key, &c); err != nil {
 			return iData, cData, res, fmt.Errorf("parse token 1: %w", err)
 		}
-		if err := c.Validate(jwt.Expected{Time: t, Issuer: iss}); err != nil {
+		if err := c.ValidateWithLeeway(jwt.Expected{Time: t, Issuer: iss}, v.leeway()); err != nil {
 			return iData, cData, res, fmt.Errorf("validate token 1: %w", err)
 		}
 		if err := parseFullClaim(req.Chain[2], key, &identityClaims); err != nil {
 			return iData, cData, res, fmt.Errorf("parse token 2: %w", err)
 		}
-		if err := identityClaims.Validate(jwt.Expected{Time: t, Issuer: iss}); err != nil {
+		if err := identityClaims.Validate(jwt.Expected{Time: t, Issuer: iss}, v.leeway()); err != nil {
 			return iData, cData, res, fmt.Errorf("validate token 2: %w", err)
 		}
+		if !authenticated && identityClaims.ExtraData.XUID != "" {
+			return iData, cData, res, fmt.Errorf("identity data of %v: %w", identityClaims.ExtraData.DisplayName, ErrUntrustedChain)
+		}
 		if authenticated != (identityClaims.ExtraData.XUID != "") {
 			return iData, cData, res, fmt.Errorf("identity data must have an XUID when logged into XBOX Live only")
 		}
@@ -288,9 +346,9 @@ type identityClaims struct {
 }
 
 // Validate validates the identity claims held by the struct and returns an error if any illegal data was
-// encountered.
-func (c identityClaims) Validate(e jwt.Expected) error {
-	if err := c.Claims.Validate(e); err != nil {
+// encountered. The times of the claims are validated with the leeway passed.
+func (c identityClaims) Validate(e jwt.Expected, leeway time.Duration) error {
+	if err := c.Claims.ValidateWithLeeway(e, leeway); err != nil {
 		return err
 	}
 	return c.ExtraData.Validate()
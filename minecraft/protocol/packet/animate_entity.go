@@ -56,8 +56,10 @@ func (pk *AnimateEntity) Unmarshal(r *protocol.Reader) {
 	r.String(&pk.StopCondition)
 	r.Int32(&pk.StopConditionVersion)
 	r.String(&pk.Controller)
+	r.Float32(&pk.BlendOutTime)
 	var count uint32
 	r.Varuint32(&count)
+	r.LimitLength(count)
 	pk.EntityRuntimeIDs = make([]uint64, count)
 	for i := uint32(0); i < count; i++ {
 		r.Varuint64(&pk.EntityRuntimeIDs[i])
@@ -89,6 +89,7 @@ func (pk *AvailableCommands) Unmarshal(r *protocol.Reader) {
 
 	// First we read all the enum values.
 	r.Varuint32(&count)
+	r.LimitLength(count)
 	enumValues := make([]string, count)
 	for i := uint32(0); i < count; i++ {
 		r.String(&enumValues[i])
@@ -96,6 +97,7 @@ func (pk *AvailableCommands) Unmarshal(r *protocol.Reader) {
 
 	// Then we read all suffixes.
 	r.Varuint32(&count)
+	r.LimitLength(count)
 	suffixes := make([]string, count)
 	for i := uint32(0); i < count; i++ {
 		r.String(&suffixes[i])
@@ -103,11 +105,13 @@ func (pk *AvailableCommands) Unmarshal(r *protocol.Reader) {
 
 	// After that we create all enums, which are composed of pointers to the enum values above.
 	r.Varuint32(&count)
+	r.LimitLength(count)
 	enums := make([]protocol.CommandEnum, count)
 	var optionCount uint32
 	for i := uint32(0); i < count; i++ {
 		r.String(&enums[i].Type)
 		r.Varuint32(&optionCount)
+		r.LimitLength(optionCount)
 		enums[i].Options = make([]string, optionCount)
 		for j := uint32(0); j < optionCount; j++ {
 			enumOption(r, &enums[i].Options[j], enumValues)
@@ -117,6 +121,7 @@ func (pk *AvailableCommands) Unmarshal(r *protocol.Reader) {
 	// We read all the commands, which will have their enums and suffixes set automatically. We don't yet set
 	// the dynamic enums as we haven't read them yet.
 	r.Varuint32(&count)
+	r.LimitLength(count)
 	pk.Commands = make([]protocol.Command, count)
 	for i := uint32(0); i < count; i++ {
 		protocol.CommandData(r, &pk.Commands[i], enums, suffixes)
@@ -124,6 +129,7 @@ func (pk *AvailableCommands) Unmarshal(r *protocol.Reader) {
 
 	// We first read all soft enums of the packet.
 	r.Varuint32(&count)
+	r.LimitLength(count)
 	softEnums := make([]protocol.CommandEnum, count)
 	for i := uint32(0); i < count; i++ {
 		softEnums[i].Dynamic = true
@@ -131,6 +137,7 @@ func (pk *AvailableCommands) Unmarshal(r *protocol.Reader) {
 
 		var optionCount uint32
 		r.Varuint32(&optionCount)
+		r.LimitLength(optionCount)
 		softEnums[i].Options = make([]string, optionCount)
 		for j := uint32(0); j < optionCount; j++ {
 			r.String(&softEnums[i].Options[j])
@@ -152,6 +159,7 @@ func (pk *AvailableCommands) Unmarshal(r *protocol.Reader) {
 	}
 
 	r.Varuint32(&count)
+	r.LimitLength(count)
 	pk.Constraints = make([]protocol.CommandEnumConstraint, count)
 	for i := uint32(0); i < count; i++ {
 		protocol.EnumConstraint(r, &pk.Constraints[i], enums, enumValues)
@@ -98,7 +98,7 @@ func (pk *ClientBoundMapItemData) Marshal(w *protocol.Writer) {
 		for _, obj := range pk.TrackedObjects {
 			protocol.MapTrackedObj(w, &obj)
 		}
-		l = uint32(len(pk.TrackedObjects))
+		l = uint32(len(pk.Decorations))
 		w.Varuint32(&l)
 		for _, decoration := range pk.Decorations {
 			protocol.MapDeco(w, &decoration)
@@ -142,6 +142,7 @@ func (pk *ClientBoundMapItemData) Unmarshal(r *protocol.Reader) {
 	var count uint32
 	if pk.UpdateFlags&MapUpdateFlagInitialisation != 0 {
 		r.Varuint32(&count)
+		r.LimitLength(count)
 		pk.MapsIncludedIn = make([]int64, count)
 		for i := uint32(0); i < count; i++ {
 			r.Varint64(&pk.MapsIncludedIn[i])
@@ -152,11 +153,13 @@ func (pk *ClientBoundMapItemData) Unmarshal(r *protocol.Reader) {
 	}
 	if pk.UpdateFlags&MapUpdateFlagDecoration != 0 {
 		r.Varuint32(&count)
+		r.LimitLength(count)
 		pk.TrackedObjects = make([]protocol.MapTrackedObject, count)
 		for i := uint32(0); i < count; i++ {
 			protocol.MapTrackedObj(r, &pk.TrackedObjects[i])
 		}
 		r.Varuint32(&count)
+		r.LimitLength(count)
 		pk.Decorations = make([]protocol.MapDecoration, count)
 		for i := uint32(0); i < count; i++ {
 			protocol.MapDeco(r, &pk.Decorations[i])
@@ -168,6 +171,7 @@ func (pk *ClientBoundMapItemData) Unmarshal(r *protocol.Reader) {
 		r.Varint32(&pk.XOffset)
 		r.Varint32(&pk.YOffset)
 		r.Varuint32(&count)
+		r.LimitLength(count)
 
 		r.LimitInt32(pk.Width, 0, math.MaxInt16)
 		r.LimitInt32(pk.Height, 0, math.MaxInt16)
@@ -39,6 +39,8 @@ func (pk *ClientCacheBlobStatus) Unmarshal(r *protocol.Reader) {
 	r.Varuint32(&missCount)
 	r.Varuint32(&hitCount)
 
+	r.LimitUint32(missCount, 4096)
+	r.LimitUint32(hitCount, 4096)
 	r.LimitUint32(missCount+hitCount, 4096)
 
 	pk.MissHashes = make([]uint64, missCount)
@@ -31,6 +31,7 @@ func (pk *ClientCacheMissResponse) Marshal(w *protocol.Writer) {
 func (pk *ClientCacheMissResponse) Unmarshal(r *protocol.Reader) {
 	var count uint32
 	r.Varuint32(&count)
+	r.LimitLength(count)
 	pk.Blobs = make([]protocol.CacheBlob, count)
 	for i := uint32(0); i < count; i++ {
 		protocol.Blob(r, &pk.Blobs[i])
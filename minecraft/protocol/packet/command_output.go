@@ -65,6 +65,7 @@ func (pk *CommandOutput) Unmarshal(r *protocol.Reader) {
 	r.Uint8(&pk.OutputType)
 	r.Varuint32(&pk.SuccessCount)
 	r.Varuint32(&count)
+	r.LimitLength(count)
 	pk.OutputMessages = make([]protocol.CommandOutputMessage, count)
 	for i := uint32(0); i < count; i++ {
 		protocol.CommandMessage(r, &pk.OutputMessages[i])
@@ -79,6 +79,7 @@ func (pk *CraftingData) Marshal(w *protocol.Writer) {
 func (pk *CraftingData) Unmarshal(r *protocol.Reader) {
 	var length uint32
 	r.Varuint32(&length)
+	r.LimitLength(length)
 	pk.Recipes = make([]protocol.Recipe, length)
 	for i := uint32(0); i < length; i++ {
 		var recipeType int32
@@ -110,16 +111,20 @@ func (pk *CraftingData) Unmarshal(r *protocol.Reader) {
 		pk.Recipes[i] = recipe
 	}
 	r.Varuint32(&length)
+	r.LimitLength(length)
 	pk.PotionRecipes = make([]protocol.PotionRecipe, length)
 	for i := uint32(0); i < length; i++ {
 		protocol.PotRecipe(r, &pk.PotionRecipes[i])
 	}
 	r.Varuint32(&length)
+	r.LimitLength(length)
 	pk.PotionContainerChangeRecipes = make([]protocol.PotionContainerChangeRecipe, length)
 	for i := uint32(0); i < length; i++ {
 		protocol.PotContainerChangeRecipe(r, &pk.PotionContainerChangeRecipes[i])
 	}
 	r.Varuint32(&length)
+	r.LimitLength(length)
+	pk.MaterialReducers = make([]protocol.MaterialReducer, length)
 	for i := uint32(0); i < length; i++ {
 		r.MaterialReducer(&pk.MaterialReducers[i])
 	}
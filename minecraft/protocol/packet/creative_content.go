@@ -32,6 +32,7 @@ func (pk *CreativeContent) Marshal(w *protocol.Writer) {
 func (pk *CreativeContent) Unmarshal(r *protocol.Reader) {
 	var count uint32
 	r.Varuint32(&count)
+	r.LimitLength(count)
 	pk.Items = make([]protocol.CreativeItem, count)
 	for i := 0; i < int(count); i++ {
 		protocol.CreativeEntry(r, &pk.Items[i])
@@ -63,7 +63,6 @@ func (pk *EducationSettings) Marshal(w *protocol.Writer) {
 
 	w.Bool(&hasExternalLinkSettings)
 	if hasExternalLinkSettings {
-		w.Bool(&hasExternalLinkSettings)
 		w.String(&pk.ExternalLinkSettings.URL)
 		w.String(&pk.ExternalLinkSettings.DisplayName)
 	}
@@ -82,6 +81,7 @@ func (pk *EducationSettings) Unmarshal(r *protocol.Reader) {
 	var hasAgentCapabilities bool
 	r.Bool(&hasAgentCapabilities)
 	if hasAgentCapabilities {
+		pk.AgentCapabilities = new(bool)
 		r.Bool(pk.AgentCapabilities)
 	}
 
@@ -94,6 +94,7 @@ func (pk *EducationSettings) Unmarshal(r *protocol.Reader) {
 	var hasExternalLinkSettings bool
 	r.Bool(&hasExternalLinkSettings)
 	if hasExternalLinkSettings {
+		pk.ExternalLinkSettings = &protocol.EducationExternalLinkSettings{}
 		r.String(&pk.ExternalLinkSettings.URL)
 		r.String(&pk.ExternalLinkSettings.DisplayName)
 	}
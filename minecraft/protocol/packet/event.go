@@ -118,6 +118,8 @@ func (pk *Event) Unmarshal(r *protocol.Reader) {
 		pk.EventData = &protocol.MovementCorrectedEventData{}
 	case EventTypeExtractHoney:
 		pk.EventData = &protocol.ExtractHoneyEventData{}
+	default:
+		r.UnknownEnumOption(pk.EventType, "event type")
 	}
 
 	pk.EventData.Unmarshal(r)
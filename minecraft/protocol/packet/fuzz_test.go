@@ -0,0 +1,34 @@
+//go:build go1.18
+// +build go1.18
+
+package packet
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// FuzzUnmarshal decodes packets from random data, of which the packet ID is read first, and checks that
+// malformed data results in an error rather than a panic or a huge allocation.
+func FuzzUnmarshal(f *testing.F) {
+	fill := &filler{r: rand.New(rand.NewSource(5))}
+	for _, id := range ids() {
+		for _, b := range encodings(fill, id, 3) {
+			buf := bytes.NewBuffer(nil)
+			_ = (&Header{PacketID: id}).Write(buf)
+			f.Add(append(buf.Bytes(), b...))
+		}
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		buf := bytes.NewBuffer(data)
+		header := &Header{}
+		if err := header.Read(buf); err != nil {
+			return
+		}
+		if _, ok := NewPool()[header.PacketID]; !ok {
+			return
+		}
+		checkMalformed(t, header.PacketID, buf.Bytes())
+	})
+}
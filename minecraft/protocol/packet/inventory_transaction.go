@@ -85,6 +85,7 @@ func (pk *InventoryTransaction) Unmarshal(r *protocol.Reader) {
 	r.Varint32(&pk.LegacyRequestID)
 	if pk.LegacyRequestID != 0 {
 		r.Varuint32(&length)
+		r.LimitLength(length)
 
 		pk.LegacySetItemSlots = make([]protocol.LegacySetItemSlot, length)
 		for i := uint32(0); i < length; i++ {
@@ -28,6 +28,7 @@ func (pk *ItemComponent) Marshal(w *protocol.Writer) {
 func (pk *ItemComponent) Unmarshal(r *protocol.Reader) {
 	var count uint32
 	r.Varuint32(&count)
+	r.LimitLength(count)
 	pk.Items = make([]protocol.ItemComponentEntry, count)
 	for i := uint32(0); i < count; i++ {
 		protocol.ItemComponents(r, &pk.Items[i])
@@ -33,6 +33,7 @@ func (pk *ItemStackResponse) Marshal(w *protocol.Writer) {
 func (pk *ItemStackResponse) Unmarshal(r *protocol.Reader) {
 	var count uint32
 	r.Varuint32(&count)
+	r.LimitLength(count)
 	pk.Responses = make([]protocol.ItemStackResponse, count)
 	for i := uint32(0); i < count; i++ {
 		protocol.StackResponse(r, &pk.Responses[i])
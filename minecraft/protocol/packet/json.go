@@ -0,0 +1,676 @@
+package packet
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+	"phoenix/minecraft/protocol"
+	"reflect"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// EncodeJSON encodes a packet to JSON. The JSON produced is an object with the ID and the name of the packet
+// and the packet itself as fields, for example:
+//
+//	{"id":9,"name":"Text","packet":{"TextType":1,"NeedsTranslation":false,...}}
+//
+// Fields of packets and nested types are encoded in the order they are declared. Values that JSON has no
+// type information for are encoded so that they may be decoded into exactly the same value again:
+//   - Values of interface{} fields, such as those found in NBT data, entity metadata and game rules, are
+//     encoded as an object {"type":"int32","value":1}, where type is one of bool, byte, int16, int32, int64,
+//     uint32, uint64, float32, float64, string, list, compound, byte_array, int32_array, int64_array,
+//     block_pos and vec3.
+//   - Values of other interface types, such as protocol.Recipe, are encoded as an object with the name of the
+//     concrete type, for example {"type":"ShapedRecipe","value":{...}}.
+//   - []byte is encoded as a base64 string, while strings that are not valid UTF-8 are encoded as an object
+//     {"bytes":"<base64>"}. The floats NaN, +Inf and -Inf are encoded as strings.
+//
+// Map keys cannot be encoded that way, so EncodeJSON returns an error for maps with keys that are not valid
+// UTF-8.
+//
+// A packet encoded using EncodeJSON may be decoded using DecodeJSON, after which it serialises to the same
+// binary data as the original packet.
+func EncodeJSON(pk Packet) ([]byte, error) {
+	v := reflect.ValueOf(pk)
+	if pk == nil || v.Kind() != reflect.Ptr || v.IsNil() {
+		return nil, fmt.Errorf("encode packet JSON: packet must be a non-nil pointer, got %T", pk)
+	}
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString(`{"id":`)
+	buf.WriteString(strconv.FormatUint(uint64(pk.ID()), 10))
+	buf.WriteString(`,"name":`)
+	writeJSONString(buf, v.Elem().Type().Name())
+	buf.WriteString(`,"packet":`)
+	if err := encodeJSONValue(buf, v.Elem()); err != nil {
+		return nil, fmt.Errorf("encode packet JSON: %T%w", pk, pathError("", err))
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// DecodeJSON decodes a packet encoded using EncodeJSON. The packet is created using the pool passed, or as a
+// *Unknown packet if the pool holds no packet with the ID found. An error is returned if the JSON is not
+// valid, if the name of the packet does not match the packet with its ID, or if any of the fields have a
+// type different from those of the packet.
+func DecodeJSON(data []byte, pool Pool) (Packet, error) {
+	var envelope struct {
+		ID     *uint32
+		Name   string
+		Packet json.RawMessage
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, fmt.Errorf("decode packet JSON: %w", err)
+	}
+	if envelope.ID == nil {
+		return nil, fmt.Errorf("decode packet JSON: missing packet ID")
+	}
+	var pk Packet = &Unknown{PacketID: *envelope.ID}
+	if pkFunc, ok := pool[*envelope.ID]; ok {
+		pk = pkFunc()
+	}
+	v := reflect.ValueOf(pk).Elem()
+	if name := v.Type().Name(); envelope.Name != "" && envelope.Name != name {
+		return nil, fmt.Errorf("decode packet JSON: packet with ID %v is %v, not %v", *envelope.ID, name, envelope.Name)
+	}
+	dec := json.NewDecoder(bytes.NewReader(envelope.Packet))
+	dec.UseNumber()
+	var x interface{}
+	if err := dec.Decode(&x); err != nil {
+		return nil, fmt.Errorf("decode packet JSON: %w", err)
+	}
+	if err := decodeJSONValue(x, v); err != nil {
+		return nil, fmt.Errorf("decode packet JSON: %T%w", pk, pathError("", err))
+	}
+	if u, ok := pk.(*Unknown); ok {
+		// The ID of an unknown packet is part of the envelope, not of the packet encoded.
+		u.PacketID = *envelope.ID
+	}
+	return pk, nil
+}
+
+// jsonPathError is an error that occurred while encoding or decoding a value at a path in a packet.
+type jsonPathError struct {
+	path string
+	err  error
+}
+
+// Error ...
+func (e *jsonPathError) Error() string {
+	return e.path + ": " + e.err.Error()
+}
+
+// Unwrap ...
+func (e *jsonPathError) Unwrap() error {
+	return e.err
+}
+
+// pathError prefixes the path passed to the error passed, so that the location of the error in a packet may
+// be found.
+func pathError(path string, err error) error {
+	if e, ok := err.(*jsonPathError); ok {
+		return &jsonPathError{path: path + e.path, err: e.err}
+	}
+	return &jsonPathError{path: path, err: err}
+}
+
+// jsonTypes holds the concrete types of values that may be found in interface{} fields, indexed by the name
+// they are encoded with. Arrays with an element of byte, int32 or int64 are encoded as byte_array,
+// int32_array and int64_array respectively.
+var jsonTypes = map[string]reflect.Type{
+	"bool":      reflect.TypeOf(false),
+	"byte":      reflect.TypeOf(byte(0)),
+	"int16":     reflect.TypeOf(int16(0)),
+	"int32":     reflect.TypeOf(int32(0)),
+	"int64":     reflect.TypeOf(int64(0)),
+	"uint32":    reflect.TypeOf(uint32(0)),
+	"uint64":    reflect.TypeOf(uint64(0)),
+	"float32":   reflect.TypeOf(float32(0)),
+	"float64":   reflect.TypeOf(float64(0)),
+	"string":    reflect.TypeOf(""),
+	"list":      reflect.TypeOf([]interface{}(nil)),
+	"compound":  reflect.TypeOf(map[string]interface{}(nil)),
+	"block_pos": reflect.TypeOf(protocol.BlockPos{}),
+	"vec3":      reflect.TypeOf(mgl32.Vec3{}),
+}
+
+// jsonArrayTypes holds the element types of arrays found in interface{} fields, indexed by the name they are
+// encoded with.
+var jsonArrayTypes = map[string]reflect.Type{
+	"byte_array":  reflect.TypeOf(byte(0)),
+	"int32_array": reflect.TypeOf(int32(0)),
+	"int64_array": reflect.TypeOf(int64(0)),
+}
+
+// jsonImplementations holds the concrete types of values of interface types other than interface{}, such as
+// protocol.Recipe. They are indexed by the interface type and by their type name. As these interfaces all
+// have the same methods, the implementations are grouped explicitly, so that a recipe may not be decoded as
+// inventory transaction data.
+var jsonImplementations = map[reflect.Type]map[string]reflect.Type{}
+
+func init() {
+	for iface, values := range map[interface{}][]interface{}{
+		(*protocol.Recipe)(nil): {
+			&protocol.ShapelessRecipe{}, &protocol.ShapedRecipe{}, &protocol.FurnaceRecipe{}, &protocol.FurnaceDataRecipe{},
+			&protocol.MultiRecipe{}, &protocol.ShulkerBoxRecipe{}, &protocol.ShapelessChemistryRecipe{},
+			&protocol.ShapedChemistryRecipe{},
+		},
+		(*protocol.InventoryTransactionData)(nil): {
+			&protocol.NormalTransactionData{}, &protocol.MismatchTransactionData{}, &protocol.UseItemTransactionData{},
+			&protocol.UseItemOnEntityTransactionData{}, &protocol.ReleaseItemTransactionData{},
+		},
+		(*protocol.StackRequestAction)(nil): {
+			&protocol.TakeStackRequestAction{}, &protocol.PlaceStackRequestAction{}, &protocol.SwapStackRequestAction{},
+			&protocol.DropStackRequestAction{}, &protocol.DestroyStackRequestAction{}, &protocol.ConsumeStackRequestAction{},
+			&protocol.CreateStackRequestAction{}, &protocol.LabTableCombineStackRequestAction{},
+			&protocol.BeaconPaymentStackRequestAction{}, &protocol.MineBlockStackRequestAction{},
+			&protocol.CraftRecipeStackRequestAction{}, &protocol.AutoCraftRecipeStackRequestAction{},
+			&protocol.CraftCreativeStackRequestAction{}, &protocol.CraftRecipeOptionalStackRequestAction{},
+			&protocol.CraftGrindstoneRecipeStackRequestAction{}, &protocol.CraftLoomRecipeStackRequestAction{},
+			&protocol.CraftNonImplementedStackRequestAction{}, &protocol.CraftResultsDeprecatedStackRequestAction{},
+		},
+		(*protocol.EventData)(nil): {
+			&protocol.AchievementAwardedEventData{}, &protocol.EntityInteractEventData{}, &protocol.PortalBuiltEventData{},
+			&protocol.PortalUsedEventData{}, &protocol.MobKilledEventData{}, &protocol.CauldronUsedEventData{},
+			&protocol.PlayerDiedEventData{}, &protocol.BossKilledEventData{}, &protocol.AgentCommandEventData{},
+			&protocol.PatternRemovedEventData{}, &protocol.SlashCommandExecutedEventData{},
+			&protocol.FishBucketedEventData{}, &protocol.MobBornEventData{}, &protocol.PetDiedEventData{},
+			&protocol.CauldronInteractEventData{}, &protocol.ComposterInteractEventData{}, &protocol.BellUsedEventData{},
+			&protocol.EntityDefinitionTriggerEventData{}, &protocol.RaidUpdateEventData{},
+			&protocol.MovementAnomalyEventData{}, &protocol.MovementCorrectedEventData{},
+			&protocol.ExtractHoneyEventData{},
+		},
+	} {
+		implementations := map[string]reflect.Type{}
+		for _, v := range values {
+			t := reflect.TypeOf(v)
+			implementations[t.Elem().Name()] = t
+		}
+		jsonImplementations[reflect.TypeOf(iface).Elem()] = implementations
+	}
+}
+
+var (
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// encodeJSONValue writes the JSON representation of the value passed to buf.
+func encodeJSONValue(buf *bytes.Buffer, v reflect.Value) error {
+	t := v.Type()
+	if t.Kind() != reflect.Ptr && t.Kind() != reflect.Interface && t.Implements(textMarshalerType) && reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		writeJSONString(buf, string(text))
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		buf.WriteString(strconv.FormatBool(v.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		buf.WriteString(strconv.FormatInt(v.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		buf.WriteString(strconv.FormatUint(v.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		switch {
+		case math.IsNaN(f):
+			buf.WriteString(`"NaN"`)
+		case math.IsInf(f, 1):
+			buf.WriteString(`"+Inf"`)
+		case math.IsInf(f, -1):
+			buf.WriteString(`"-Inf"`)
+		default:
+			buf.WriteString(strconv.FormatFloat(f, 'g', -1, t.Bits()))
+		}
+	case reflect.String:
+		if s := v.String(); utf8.ValidString(s) {
+			writeJSONString(buf, s)
+		} else {
+			buf.WriteString(`{"bytes":"` + base64.StdEncoding.EncodeToString([]byte(s)) + `"}`)
+		}
+	case reflect.Slice:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			buf.WriteString(`"` + base64.StdEncoding.EncodeToString(v.Bytes()) + `"`)
+			return nil
+		}
+		return encodeJSONList(buf, v)
+	case reflect.Array:
+		return encodeJSONList(buf, v)
+	case reflect.Map:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		return encodeJSONMap(buf, v)
+	case reflect.Struct:
+		buf.WriteByte('{')
+		first := true
+		if err := encodeJSONFields(buf, v, &first); err != nil {
+			return err
+		}
+		buf.WriteByte('}')
+	case reflect.Ptr:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		return encodeJSONValue(buf, v.Elem())
+	case reflect.Interface:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		return encodeJSONInterface(buf, v)
+	default:
+		return fmt.Errorf("cannot encode value of type %v", t)
+	}
+	return nil
+}
+
+// encodeJSONList writes the elements of a slice or array as a JSON array to buf.
+func encodeJSONList(buf *bytes.Buffer, v reflect.Value) error {
+	buf.WriteByte('[')
+	for i := 0; i < v.Len(); i++ {
+		if i != 0 {
+			buf.WriteByte(',')
+		}
+		if err := encodeJSONValue(buf, v.Index(i)); err != nil {
+			return pathError("["+strconv.Itoa(i)+"]", err)
+		}
+	}
+	buf.WriteByte(']')
+	return nil
+}
+
+// encodeJSONMap writes a map as a JSON object to buf. Keys are sorted, so that the JSON produced is the same
+// for equal maps.
+func encodeJSONMap(buf *bytes.Buffer, v reflect.Value) error {
+	keys := make([]string, 0, v.Len())
+	values := make(map[string]reflect.Value, v.Len())
+	for iter := v.MapRange(); iter.Next(); {
+		var key string
+		switch k := iter.Key(); k.Kind() {
+		case reflect.String:
+			if key = k.String(); !utf8.ValidString(key) {
+				return fmt.Errorf("cannot encode map key %q: not valid UTF-8", key)
+			}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			key = strconv.FormatInt(k.Int(), 10)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			key = strconv.FormatUint(k.Uint(), 10)
+		default:
+			return fmt.Errorf("cannot encode map key of type %v", k.Type())
+		}
+		keys = append(keys, key)
+		values[key] = iter.Value()
+	}
+	sort.Strings(keys)
+	buf.WriteByte('{')
+	for i, key := range keys {
+		if i != 0 {
+			buf.WriteByte(',')
+		}
+		writeJSONString(buf, key)
+		buf.WriteByte(':')
+		if err := encodeJSONValue(buf, values[key]); err != nil {
+			return pathError("["+strconv.Quote(key)+"]", err)
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// encodeJSONFields writes the exported fields of a struct to buf. The fields of embedded structs are written
+// as if they were fields of the struct itself.
+func encodeJSONFields(buf *bytes.Buffer, v reflect.Value, first *bool) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if err := encodeJSONFields(buf, v.Field(i), first); err != nil {
+				return err
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if !*first {
+			buf.WriteByte(',')
+		}
+		*first = false
+		writeJSONString(buf, field.Name)
+		buf.WriteByte(':')
+		if err := encodeJSONValue(buf, v.Field(i)); err != nil {
+			return pathError("."+field.Name, err)
+		}
+	}
+	return nil
+}
+
+// encodeJSONInterface writes the non-nil value of an interface field to buf, along with the name of its
+// concrete type.
+func encodeJSONInterface(buf *bytes.Buffer, v reflect.Value) error {
+	elem := v.Elem()
+	var name string
+	if v.NumMethod() == 0 {
+		for n, t := range jsonTypes {
+			if t == elem.Type() {
+				name = n
+			}
+		}
+		if elem.Kind() == reflect.Array && elem.Type().Name() == "" {
+			for n, t := range jsonArrayTypes {
+				if t == elem.Type().Elem() {
+					name = n
+				}
+			}
+		}
+	} else if elem.Kind() == reflect.Ptr {
+		if t, ok := jsonImplementations[v.Type()][elem.Type().Elem().Name()]; ok && t == elem.Type() {
+			name = t.Elem().Name()
+		}
+	}
+	if name == "" {
+		return fmt.Errorf("cannot encode value of type %v in %v field", elem.Type(), v.Type())
+	}
+	buf.WriteString(`{"type":`)
+	writeJSONString(buf, name)
+	buf.WriteString(`,"value":`)
+	if err := encodeJSONValue(buf, elem); err != nil {
+		return err
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// writeJSONString writes a string as a quoted JSON string to buf.
+func writeJSONString(buf *bytes.Buffer, s string) {
+	b, _ := json.Marshal(s)
+	buf.Write(b)
+}
+
+// decodeJSONValue decodes a value as produced by json.Decoder with UseNumber into the value passed, which
+// must be settable.
+func decodeJSONValue(x interface{}, v reflect.Value) error {
+	t := v.Type()
+	if t.Kind() != reflect.Ptr && t.Kind() != reflect.Interface && t.Implements(textMarshalerType) && reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		s, ok := x.(string)
+		if !ok {
+			return jsonTypeError(x, t)
+		}
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	if x == nil {
+		// Null is only used for nil values, so we set the zero value.
+		v.Set(reflect.Zero(t))
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		b, ok := x.(bool)
+		if !ok {
+			return jsonTypeError(x, t)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := x.(json.Number)
+		if !ok {
+			return jsonTypeError(x, t)
+		}
+		i, err := strconv.ParseInt(string(n), 10, t.Bits())
+		if err != nil {
+			return fmt.Errorf("invalid %v: %w", t, err)
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := x.(json.Number)
+		if !ok {
+			return jsonTypeError(x, t)
+		}
+		i, err := strconv.ParseUint(string(n), 10, t.Bits())
+		if err != nil {
+			return fmt.Errorf("invalid %v: %w", t, err)
+		}
+		v.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		switch x := x.(type) {
+		case json.Number:
+			var err error
+			if f, err = strconv.ParseFloat(string(x), t.Bits()); err != nil {
+				return fmt.Errorf("invalid %v: %w", t, err)
+			}
+		case string:
+			switch x {
+			case "NaN":
+				f = math.NaN()
+			case "+Inf":
+				f = math.Inf(1)
+			case "-Inf":
+				f = math.Inf(-1)
+			default:
+				return fmt.Errorf("invalid %v %q", t, x)
+			}
+		default:
+			return jsonTypeError(x, t)
+		}
+		v.SetFloat(f)
+	case reflect.String:
+		switch x := x.(type) {
+		case string:
+			v.SetString(x)
+		case map[string]interface{}:
+			s, ok := x["bytes"].(string)
+			if !ok || len(x) != 1 {
+				return jsonTypeError(x, t)
+			}
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return fmt.Errorf("invalid string bytes: %w", err)
+			}
+			v.SetString(string(b))
+		default:
+			return jsonTypeError(x, t)
+		}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			s, ok := x.(string)
+			if !ok {
+				return jsonTypeError(x, t)
+			}
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return fmt.Errorf("invalid %v: %w", t, err)
+			}
+			v.SetBytes(b)
+			return nil
+		}
+		list, ok := x.([]interface{})
+		if !ok {
+			return jsonTypeError(x, t)
+		}
+		v.Set(reflect.MakeSlice(t, len(list), len(list)))
+		return decodeJSONList(list, v)
+	case reflect.Array:
+		list, ok := x.([]interface{})
+		if !ok {
+			return jsonTypeError(x, t)
+		}
+		if len(list) != v.Len() {
+			return fmt.Errorf("expected %v elements for %v, got %v", v.Len(), t, len(list))
+		}
+		return decodeJSONList(list, v)
+	case reflect.Map:
+		m, ok := x.(map[string]interface{})
+		if !ok {
+			return jsonTypeError(x, t)
+		}
+		return decodeJSONMap(m, v)
+	case reflect.Struct:
+		m, ok := x.(map[string]interface{})
+		if !ok {
+			return jsonTypeError(x, t)
+		}
+		n, err := decodeJSONFields(m, v)
+		if err != nil {
+			return err
+		}
+		if n != len(m) {
+			for key := range m {
+				if f, ok := t.FieldByName(key); !ok || f.PkgPath != "" {
+					return fmt.Errorf("unknown field %v of %v", key, t)
+				}
+			}
+		}
+	case reflect.Ptr:
+		elem := reflect.New(t.Elem())
+		if err := decodeJSONValue(x, elem.Elem()); err != nil {
+			return err
+		}
+		v.Set(elem)
+	case reflect.Interface:
+		return decodeJSONInterface(x, v)
+	default:
+		return fmt.Errorf("cannot decode value of type %v", t)
+	}
+	return nil
+}
+
+// decodeJSONList decodes the elements of a JSON array into the slice or array passed, which must have the
+// same length.
+func decodeJSONList(list []interface{}, v reflect.Value) error {
+	for i, elem := range list {
+		if err := decodeJSONValue(elem, v.Index(i)); err != nil {
+			return pathError("["+strconv.Itoa(i)+"]", err)
+		}
+	}
+	return nil
+}
+
+// decodeJSONMap decodes a JSON object into the map passed, converting keys to the key type of the map.
+func decodeJSONMap(m map[string]interface{}, v reflect.Value) error {
+	t := v.Type()
+	v.Set(reflect.MakeMapWithSize(t, len(m)))
+	for key, x := range m {
+		k := reflect.New(t.Key()).Elem()
+		switch k.Kind() {
+		case reflect.String:
+			k.SetString(key)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			i, err := strconv.ParseInt(key, 10, k.Type().Bits())
+			if err != nil {
+				return fmt.Errorf("invalid map key %q: %w", key, err)
+			}
+			k.SetInt(i)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			i, err := strconv.ParseUint(key, 10, k.Type().Bits())
+			if err != nil {
+				return fmt.Errorf("invalid map key %q: %w", key, err)
+			}
+			k.SetUint(i)
+		default:
+			return fmt.Errorf("cannot decode map key of type %v", k.Type())
+		}
+		elem := reflect.New(t.Elem()).Elem()
+		if err := decodeJSONValue(x, elem); err != nil {
+			return pathError("["+strconv.Quote(key)+"]", err)
+		}
+		v.SetMapIndex(k, elem)
+	}
+	return nil
+}
+
+// decodeJSONFields decodes the fields of a JSON object into the exported fields of the struct passed,
+// including those of embedded structs. Fields missing are left unchanged. decodeJSONFields returns the
+// amount of fields decoded.
+func decodeJSONFields(m map[string]interface{}, v reflect.Value) (int, error) {
+	t := v.Type()
+	n := 0
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			c, err := decodeJSONFields(m, v.Field(i))
+			if err != nil {
+				return n, err
+			}
+			n += c
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		x, ok := m[field.Name]
+		if !ok {
+			continue
+		}
+		n++
+		if err := decodeJSONValue(x, v.Field(i)); err != nil {
+			return n, pathError("."+field.Name, err)
+		}
+	}
+	return n, nil
+}
+
+// decodeJSONInterface decodes an object holding the type and value of an interface field into the interface
+// value passed.
+func decodeJSONInterface(x interface{}, v reflect.Value) error {
+	m, ok := x.(map[string]interface{})
+	if !ok {
+		return jsonTypeError(x, v.Type())
+	}
+	name, _ := m["type"].(string)
+	var t reflect.Type
+	if v.NumMethod() == 0 {
+		if elem, ok := jsonArrayTypes[name]; ok {
+			list, ok := m["value"].([]interface{})
+			if !ok {
+				return jsonTypeError(m["value"], reflect.SliceOf(elem))
+			}
+			t = reflect.ArrayOf(len(list), elem)
+		} else {
+			t = jsonTypes[name]
+		}
+	} else {
+		t = jsonImplementations[v.Type()][name]
+	}
+	if t == nil || !t.Implements(v.Type()) {
+		return fmt.Errorf("unknown type %q for %v field", name, v.Type())
+	}
+	value := reflect.New(t).Elem()
+	if err := decodeJSONValue(m["value"], value); err != nil {
+		return err
+	}
+	v.Set(value)
+	return nil
+}
+
+// jsonTypeError returns an error for a JSON value that cannot be decoded into a value of the type passed.
+func jsonTypeError(x interface{}, t reflect.Type) error {
+	kind := "object"
+	switch x.(type) {
+	case nil:
+		kind = "null"
+	case bool:
+		kind = "bool"
+	case json.Number:
+		kind = "number"
+	case string:
+		kind = "string"
+	case []interface{}:
+		kind = "array"
+	}
+	return fmt.Errorf("cannot decode JSON %v into %v", kind, t)
+}
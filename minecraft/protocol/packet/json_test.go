@@ -0,0 +1,136 @@
+package packet
+
+import (
+	"bytes"
+	"github.com/go-gl/mathgl/mgl32"
+	"math"
+	"math/rand"
+	"phoenix/minecraft/protocol"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// checkJSON checks that the packet passed survives a round trip through JSON, by comparing the binary
+// representation of the packet before and after. As NBT compounds are encoded in the order of map iteration,
+// the packets are decoded again if the binary representations differ.
+func checkJSON(t *testing.T, pk Packet, expected []byte) {
+	t.Helper()
+	data, err := EncodeJSON(pk)
+	if err != nil {
+		t.Fatalf("encode %T: %v", pk, err)
+	}
+	decoded, err := DecodeJSON(data, NewPool())
+	if err != nil {
+		t.Fatalf("decode %T: %v\n%s", pk, err, data)
+	}
+	b, err := marshal(decoded)
+	if err != nil {
+		t.Fatalf("marshal decoded %T: %v", pk, err)
+	}
+	if bytes.Equal(b, expected) {
+		return
+	}
+	a, c := NewPool()[pk.ID()](), NewPool()[pk.ID()]()
+	if unmarshal(a, expected) != nil || unmarshal(c, b) != nil || !reflect.DeepEqual(a, c) {
+		t.Fatalf("%T differs after JSON round trip:\n%s\nexpected %x\ngot      %x", pk, data, expected, b)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	f := &filler{r: rand.New(rand.NewSource(1))}
+	for id, pkFunc := range NewPool() {
+		pk := pkFunc()
+		t.Run(reflect.TypeOf(pk).Elem().Name(), func(t *testing.T) {
+			if b, err := marshal(pk); err == nil {
+				checkJSON(t, pk, b)
+			}
+			// Packets are filled with random values, after which they are encoded and decoded, so that only
+			// values that are actually encoded are compared.
+			for i, passed := 0, 0; i < 200 && passed < 20; i++ {
+				filled := pkFunc()
+				f.fill(reflect.ValueOf(filled).Elem())
+				b, err := marshal(filled)
+				if err != nil {
+					continue
+				}
+				decoded := NewPool()[id]()
+				if unmarshal(decoded, b) != nil {
+					continue
+				}
+				if b, err = marshal(decoded); err != nil {
+					continue
+				}
+				checkJSON(t, decoded, b)
+				passed++
+			}
+		})
+	}
+}
+
+func TestJSONNested(t *testing.T) {
+	pk := &AddActor{
+		EntityRuntimeID: 5,
+		EntityType:      "minecraft:pig",
+		EntityMetadata: map[uint32]interface{}{
+			0: byte(1), 1: int16(-2), 2: int32(3), 3: float32(0.5), 4: "name", 5: protocol.BlockPos{1, 2, 3},
+			6: int64(math.MaxInt64), 7: mgl32.Vec3{1, float32(math.Inf(1)), 3},
+			8: map[string]interface{}{"list": []interface{}{int32(1), int32(2)}, "bytes": [2]byte{1, 2}, "longs": [1]int64{-1}},
+		},
+	}
+	data, err := EncodeJSON(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{`"id":13`, `"name":"AddActor"`, `"6":{"type":"int64","value":9223372036854775807}`, `"+Inf"`,
+		`"bytes":{"type":"byte_array","value":[1,2]}`, `"5":{"type":"block_pos","value":[1,2,3]}`} {
+		if !strings.Contains(string(data), s) {
+			t.Fatalf("expected %s in JSON, got %s", s, data)
+		}
+	}
+	b, err := marshal(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkJSON(t, pk, b)
+
+	tx := &InventoryTransaction{TransactionData: &protocol.UseItemTransactionData{
+		ActionType: protocol.UseItemActionClickBlock, BlockPosition: protocol.BlockPos{1, 2, 3},
+		HeldItem: protocol.ItemInstance{Stack: protocol.ItemStack{ItemType: protocol.ItemType{NetworkID: 5}, Count: 1,
+			NBTData: map[string]interface{}{"Damage": int32(3)}}},
+	}}
+	if b, err = marshal(tx); err != nil {
+		t.Fatal(err)
+	}
+	checkJSON(t, tx, b)
+}
+
+func TestJSONErrors(t *testing.T) {
+	for _, data := range []string{
+		`{"name":"Text","packet":{}}`,
+		`{"id":9,"name":"Disconnect","packet":{}}`,
+		`{"id":9,"packet":{"Unknown":1}}`,
+		`{"id":9,"packet":{"TextType":"chat"}}`,
+		`{"id":9,"packet":{"TextType":256}}`,
+		`{"id":13,"packet":{"EntityMetadata":{"1":{"type":"complex128","value":1}}}}`,
+		`{"id":13,"packet":{"EntityMetadata":{"x":{"type":"byte","value":1}}}}`,
+		`{"id":30,"packet":{"TransactionData":{"type":"ShapedRecipe","value":{}}}}`,
+	} {
+		if _, err := DecodeJSON([]byte(data), NewPool()); err == nil {
+			t.Errorf("expected error decoding %s", data)
+		}
+	}
+	if _, err := EncodeJSON(&AddActor{EntityMetadata: map[uint32]interface{}{1: complex64(1)}}); err == nil {
+		t.Error("expected error encoding unsupported metadata type")
+	}
+	if _, err := EncodeJSON(&BlockActorData{NBTData: map[string]interface{}{"\xff": int32(1)}}); err == nil {
+		t.Error("expected error encoding map key that is not valid UTF-8")
+	}
+	pk, err := DecodeJSON([]byte(`{"id":1000,"name":"Unknown","packet":{"PacketID":0,"Payload":"AQI="}}`), NewPool())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := pk.(*Unknown); u.PacketID != 1000 || !bytes.Equal(u.Payload, []byte{1, 2}) {
+		t.Fatalf("unexpected unknown packet %+v", u)
+	}
+}
@@ -62,6 +62,7 @@ func (pk *LevelChunk) Unmarshal(r *protocol.Reader) {
 	if pk.CacheEnabled {
 		var count uint32
 		r.Varuint32(&count)
+		r.LimitLength(count)
 		pk.BlobHashes = make([]uint64, count)
 		for i := uint32(0); i < count; i++ {
 			r.Uint64(&pk.BlobHashes[i])
@@ -0,0 +1,374 @@
+package packet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"phoenix/minecraft/protocol"
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+	"unicode/utf8"
+)
+
+// filler fills values with random data, so that packets may be tested with more than just their zero value.
+type filler struct {
+	r     *rand.Rand
+	depth int
+}
+
+// fill fills the value passed, which must be settable, with random data.
+func (f *filler) fill(v reflect.Value) {
+	f.depth++
+	defer func() { f.depth-- }()
+
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(f.r.Intn(2) == 1)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// Small values are most likely to be valid values of enums.
+		if f.r.Intn(4) == 0 {
+			v.SetInt(f.r.Int63() >> (64 - v.Type().Bits()))
+		} else {
+			v.SetInt(int64(f.r.Intn(4)))
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if f.r.Intn(4) == 0 {
+			v.SetUint(f.r.Uint64() >> (64 - v.Type().Bits()))
+		} else {
+			v.SetUint(uint64(f.r.Intn(4)))
+		}
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat([]float64{0, 1.5, -3.25, f.r.Float64() * 1000, math.MaxFloat32}[f.r.Intn(5)])
+	case reflect.String:
+		v.SetString([]string{"", "minecraft:stone", "§aé", "\xff\xfe", `"quoted"`}[f.r.Intn(5)])
+	case reflect.Slice:
+		n := 0
+		if f.depth < 8 {
+			n = f.r.Intn(3)
+		}
+		v.Set(reflect.MakeSlice(v.Type(), n, n))
+		for i := 0; i < n; i++ {
+			f.fill(v.Index(i))
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			f.fill(v.Index(i))
+		}
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+		if f.depth >= 8 {
+			return
+		}
+		for i := f.r.Intn(3); i > 0; i-- {
+			key, value := reflect.New(v.Type().Key()).Elem(), reflect.New(v.Type().Elem()).Elem()
+			f.fill(key)
+			if key.Kind() == reflect.String && !utf8.ValidString(key.String()) {
+				// Map keys must be valid UTF-8 to be encoded to JSON.
+				continue
+			}
+			f.fill(value)
+			v.SetMapIndex(key, value)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" || v.Type().Field(i).Anonymous {
+				f.fill(v.Field(i))
+			}
+		}
+	case reflect.Ptr:
+		if f.r.Intn(3) != 0 {
+			v.Set(reflect.New(v.Type().Elem()))
+			f.fill(v.Elem())
+		}
+	case reflect.Interface:
+		v.Set(f.interfaceValue(v.Type()))
+	}
+}
+
+// interfaceValue returns a random value of a type that implements the interface type passed.
+func (f *filler) interfaceValue(t reflect.Type) reflect.Value {
+	var types []reflect.Type
+	if t.NumMethod() == 0 {
+		types = []reflect.Type{jsonTypes["byte"], jsonTypes["int16"], jsonTypes["int32"], jsonTypes["int64"],
+			jsonTypes["float32"], jsonTypes["string"], jsonTypes["block_pos"], jsonTypes["vec3"], jsonTypes["bool"],
+			reflect.ArrayOf(3, jsonArrayTypes["int32_array"])}
+		if f.depth < 6 {
+			types = append(types, jsonTypes["compound"], jsonTypes["list"])
+		}
+	} else {
+		for _, impl := range jsonImplementations[t] {
+			types = append(types, impl)
+		}
+		// Sort the types so that the values filled only depend on the seed of the filler.
+		sort.Slice(types, func(i, j int) bool {
+			return types[i].String() < types[j].String()
+		})
+	}
+	v := reflect.New(types[f.r.Intn(len(types))]).Elem()
+	f.fill(v)
+	if v.Kind() == reflect.Slice {
+		// Lists in NBT must hold values of a single type.
+		for i := 0; i < v.Len(); i++ {
+			v.Index(i).Set(reflect.ValueOf(int32(i)))
+		}
+	}
+	return v
+}
+
+// marshal encodes the packet passed to its binary representation. It returns an error if encoding panicked.
+func marshal(pk Packet) (b []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	buf := bytes.NewBuffer(nil)
+	pk.Marshal(protocol.NewWriter(buf, 0))
+	return buf.Bytes(), nil
+}
+
+// unmarshal decodes the binary representation of a packet into the packet passed.
+func unmarshal(pk Packet, b []byte) error {
+	return unmarshalBuffer(pk, bytes.NewBuffer(b))
+}
+
+// panicError is returned by unmarshalBuffer if decoding a packet panicked with a value other than an error
+// of the protocol.Reader, such as an index out of range. These panics are bugs in the packet.
+type panicError struct {
+	v     interface{}
+	stack []byte
+}
+
+// Error ...
+func (err panicError) Error() string {
+	return fmt.Sprintf("panic: %v\n%s", err.v, err.stack)
+}
+
+// unmarshalBuffer decodes a packet from the buffer passed into the packet passed. The protocol.Reader
+// panics with an error on invalid data, which is returned. Any other panic is returned as a panicError.
+func unmarshalBuffer(pk Packet, buf *bytes.Buffer) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok {
+				if _, ok := e.(runtime.Error); !ok {
+					err = e
+					return
+				}
+			}
+			stack := make([]byte, 4096)
+			err = panicError{v: r, stack: stack[:runtime.Stack(stack, false)]}
+		}
+	}()
+	pk.Unmarshal(protocol.NewReader(buf, 0))
+	return nil
+}
+
+// decode decodes the binary representation of a packet with the ID passed. An error is returned if decoding
+// failed or if not all bytes were read.
+func decode(id uint32, b []byte) (Packet, error) {
+	pk := NewPool()[id]()
+	buf := bytes.NewBuffer(b)
+	if err := unmarshalBuffer(pk, buf); err != nil {
+		return pk, err
+	}
+	if buf.Len() != 0 {
+		return pk, fmt.Errorf("%v unread bytes left: 0x%x", buf.Len(), buf.Bytes())
+	}
+	return pk, nil
+}
+
+// encodings returns the binary representations of the zero value of the packet with the ID passed and of
+// up to n values filled with random data by the filler passed. Values that cannot be encoded, such as those
+// with unknown enum values, are skipped.
+func encodings(f *filler, id uint32, n int) [][]byte {
+	var all [][]byte
+	for i := 0; i < n*10 && len(all) < n; i++ {
+		pk := NewPool()[id]()
+		if i > 0 {
+			f.fill(reflect.ValueOf(pk).Elem())
+			if e, ok := pk.(*Event); ok {
+				// The event type must match the type of the event data, which is filled independently.
+				e.EventType, _ = eventType(e.EventData)
+			}
+		}
+		if b, err := marshal(pk); err == nil {
+			all = append(all, b)
+		}
+	}
+	return all
+}
+
+// eventType returns the event type matching the concrete type of the event data passed. It returns false if
+// the event data is of a type without an event type.
+func eventType(data protocol.EventData) (int32, bool) {
+	switch data.(type) {
+	case *protocol.AchievementAwardedEventData:
+		return EventTypeAchievementAwarded, true
+	case *protocol.EntityInteractEventData:
+		return EventTypeEntityInteract, true
+	case *protocol.PortalBuiltEventData:
+		return EventTypePortalBuilt, true
+	case *protocol.PortalUsedEventData:
+		return EventTypePortalUsed, true
+	case *protocol.MobKilledEventData:
+		return EventTypeMobKilled, true
+	case *protocol.CauldronUsedEventData:
+		return EventTypeCauldronUsed, true
+	case *protocol.PlayerDiedEventData:
+		return EventTypePlayerDied, true
+	case *protocol.BossKilledEventData:
+		return EventTypeBossKilled, true
+	case *protocol.AgentCommandEventData:
+		return EventTypeAgentCommand, true
+	case *protocol.PatternRemovedEventData:
+		return EventTypePatternRemoved, true
+	case *protocol.SlashCommandExecutedEventData:
+		return EventTypeSlashCommandExecuted, true
+	case *protocol.FishBucketedEventData:
+		return EventTypeFishBucketed, true
+	case *protocol.MobBornEventData:
+		return EventTypeMobBorn, true
+	case *protocol.PetDiedEventData:
+		return EventTypePetDied, true
+	case *protocol.CauldronInteractEventData:
+		return EventTypeCauldronInteract, true
+	case *protocol.ComposterInteractEventData:
+		return EventTypeComposterInteract, true
+	case *protocol.BellUsedEventData:
+		return EventTypeBellUsed, true
+	case *protocol.EntityDefinitionTriggerEventData:
+		return EventTypeEntityDefinitionTrigger, true
+	case *protocol.RaidUpdateEventData:
+		return EventTypeRaidUpdate, true
+	case *protocol.MovementAnomalyEventData:
+		return EventTypeMovementAnomaly, true
+	case *protocol.MovementCorrectedEventData:
+		return EventTypeMovementCorrected, true
+	case *protocol.ExtractHoneyEventData:
+		return EventTypeExtractHoney, true
+	}
+	return 0, false
+}
+
+// ids returns the IDs of all packets in the Pool in ascending order.
+func ids() []uint32 {
+	var all []uint32
+	for id := range NewPool() {
+		all = append(all, id)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i] < all[j]
+	})
+	return all
+}
+
+// TestRoundTrip checks for every packet that decoding the binary representation of a packet, and encoding
+// the packet decoded again, produces the same binary representation without any bytes left. Random values
+// that are encoded without error, but that are rejected when decoded, such as out of range indices, are
+// skipped, as the packets do not validate all values when encoding.
+func TestRoundTrip(t *testing.T) {
+	f := &filler{r: rand.New(rand.NewSource(2))}
+	for _, id := range ids() {
+		id := id
+		t.Run(reflect.TypeOf(NewPool()[id]()).Elem().Name(), func(t *testing.T) {
+			passed := 0
+			for _, b := range encodings(f, id, 50) {
+				pk, buf := NewPool()[id](), bytes.NewBuffer(b)
+				if err := unmarshalBuffer(pk, buf); errors.As(err, &panicError{}) {
+					t.Fatalf("decode %x: %v", b, err)
+				} else if err != nil {
+					continue
+				}
+				if buf.Len() != 0 {
+					t.Fatalf("decode %x: %v unread bytes left: 0x%x", b, buf.Len(), buf.Bytes())
+				}
+				// Values that are lost when decoding, such as slices that are not filled, change the length
+				// of the encoded packet. The enum values and suffixes of AvailableCommands are collected from
+				// the commands when encoding, so these may be written without being used by any command.
+				if encoded, err := marshal(pk); id != IDAvailableCommands && (err != nil || len(encoded) != len(b)) {
+					t.Fatalf("round trip of %x:\ngot %x (%v)", b, encoded, err)
+				}
+				passed++
+				checkRoundTrip(t, pk)
+			}
+			if passed == 0 {
+				t.Fatal("no values could be encoded and decoded")
+			}
+		})
+	}
+}
+
+// checkRoundTrip checks that encoding the packet passed and decoding it again results in the same packet.
+func checkRoundTrip(t *testing.T, pk Packet) {
+	t.Helper()
+	b, err := marshal(pk)
+	if err != nil {
+		t.Fatalf("encode %#v: %v", pk, err)
+	}
+	decoded, err := decode(pk.ID(), b)
+	if err != nil {
+		t.Fatalf("decode %x: %v", b, err)
+	}
+	if !reflect.DeepEqual(decoded, pk) {
+		t.Fatalf("round trip of %x:\nexpected %#v\ngot      %#v", b, pk, decoded)
+	}
+	encoded, err := marshal(decoded)
+	if err != nil {
+		t.Fatalf("encode %#v: %v", decoded, err)
+	}
+	// NBT compounds are encoded in the order of map iteration, so only the lengths are compared.
+	if len(encoded) != len(b) {
+		t.Fatalf("round trip of %#v:\nexpected %x\ngot      %x", pk, b, encoded)
+	}
+}
+
+// maxAllocation returns the maximum number of bytes decoding a packet from len bytes may allocate.
+func maxAllocation(len int) uint64 {
+	return 16<<20 + uint64(len)*1024
+}
+
+// checkMalformed decodes the data passed as a packet with the ID passed. It fails the test if decoding
+// panicked with anything other than an error of the protocol.Reader, or if it allocated more memory than
+// maxAllocation allows.
+func checkMalformed(t *testing.T, id uint32, data []byte) {
+	t.Helper()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := decode(id, data)
+	runtime.ReadMemStats(&after)
+	if errors.As(err, &panicError{}) {
+		t.Fatalf("decode %x as %T: %v", data, NewPool()[id](), err)
+	}
+	if n := after.TotalAlloc - before.TotalAlloc; n > maxAllocation(len(data)) {
+		t.Fatalf("decode %x as %T allocated %v bytes", data, NewPool()[id](), n)
+	}
+}
+
+// TestMalformed checks that decoding truncated and corrupted packets results in an error rather than a
+// panic or a huge allocation.
+func TestMalformed(t *testing.T) {
+	f := &filler{r: rand.New(rand.NewSource(3))}
+	r := rand.New(rand.NewSource(4))
+	for _, id := range ids() {
+		id := id
+		t.Run(reflect.TypeOf(NewPool()[id]()).Elem().Name(), func(t *testing.T) {
+			for _, b := range encodings(f, id, 10) {
+				for i := 0; i < len(b); i++ {
+					checkMalformed(t, id, b[:i])
+				}
+				for i := 0; i < 20 && len(b) > 0; i++ {
+					corrupted := append([]byte(nil), b...)
+					for j := r.Intn(4); j >= 0; j-- {
+						corrupted[r.Intn(len(corrupted))] = byte(r.Intn(256))
+					}
+					checkMalformed(t, id, corrupted)
+				}
+				checkMalformed(t, id, append(b, 0xff, 0xff, 0xff, 0xff, 0x0f))
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package packet
 
 import (
 	"github.com/go-gl/mathgl/mgl32"
+	"math"
 	"phoenix/minecraft/protocol"
 )
 
@@ -170,6 +171,8 @@ func (pk *PlayerAuthInput) Unmarshal(r *protocol.Reader) {
 	if pk.InputData&InputFlagPerformBlockActions != 0 {
 		var l int32
 		r.Varint32(&l)
+		r.LimitInt32(l, 0, math.MaxInt32)
+		r.LimitLength(uint32(l))
 		pk.BlockActions = make([]protocol.PlayerBlockAction, l)
 		for i := int32(0); i < l; i++ {
 			protocol.BlockAction(r, &pk.BlockActions[i])
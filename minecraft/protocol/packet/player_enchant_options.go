@@ -35,6 +35,7 @@ func (pk *PlayerEnchantOptions) Unmarshal(r *protocol.Reader) {
 	var l uint32
 
 	r.Varuint32(&l)
+	r.LimitLength(l)
 	pk.Options = make([]protocol.EnchantmentOption, l)
 	for i := uint32(0); i < l; i++ {
 		protocol.EnchantOption(r, &pk.Options[i])
@@ -30,6 +30,7 @@ func (pk *PlayerFog) Marshal(w *protocol.Writer) {
 func (pk *PlayerFog) Unmarshal(r *protocol.Reader) {
 	var count uint32
 	r.Varuint32(&count)
+	r.LimitLength(count)
 	pk.Stack = make([]string, count)
 	for i := uint32(0); i < count; i++ {
 		r.String(&pk.Stack[i])
@@ -55,6 +55,7 @@ func (pk *PlayerList) Unmarshal(r *protocol.Reader) {
 	var count uint32
 	r.Uint8(&pk.ActionType)
 	r.Varuint32(&count)
+	r.LimitLength(count)
 
 	pk.Entries = make([]protocol.PlayerListEntry, count)
 	for i := uint32(0); i < count; i++ {
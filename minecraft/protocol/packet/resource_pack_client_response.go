@@ -42,6 +42,7 @@ func (pk *ResourcePackClientResponse) Unmarshal(r *protocol.Reader) {
 	var length uint16
 	r.Uint8(&pk.Response)
 	r.Uint16(&length)
+	r.LimitLength(uint32(length))
 
 	pk.PacksToDownload = make([]string, length)
 	for i := uint16(0); i < length; i++ {
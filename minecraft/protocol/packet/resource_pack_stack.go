@@ -60,12 +60,14 @@ func (pk *ResourcePackStack) Unmarshal(r *protocol.Reader) {
 	var length uint32
 	r.Bool(&pk.TexturePackRequired)
 	r.Varuint32(&length)
+	r.LimitLength(length)
 
 	pk.BehaviourPacks = make([]protocol.StackResourcePack, length)
 	for i := uint32(0); i < length; i++ {
 		protocol.StackPack(r, &pk.BehaviourPacks[i])
 	}
 	r.Varuint32(&length)
+	r.LimitLength(length)
 	pk.TexturePacks = make([]protocol.StackResourcePack, length)
 	for i := uint32(0); i < length; i++ {
 		protocol.StackPack(r, &pk.TexturePacks[i])
@@ -73,6 +75,7 @@ func (pk *ResourcePackStack) Unmarshal(r *protocol.Reader) {
 	r.String(&pk.BaseGameVersion)
 	var l uint32
 	r.Uint32(&l)
+	r.LimitLength(l)
 	pk.Experiments = make([]protocol.ExperimentData, l)
 	for i := uint32(0); i < l; i++ {
 		protocol.Experiment(r, &pk.Experiments[i])
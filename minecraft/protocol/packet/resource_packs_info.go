@@ -55,12 +55,14 @@ func (pk *ResourcePacksInfo) Unmarshal(r *protocol.Reader) {
 	r.Bool(&pk.ForcingServerPacks)
 
 	r.Uint16(&length)
+	r.LimitLength(uint32(length))
 	pk.BehaviourPacks = make([]protocol.BehaviourPackInfo, length)
 	for i := uint16(0); i < length; i++ {
 		protocol.BehaviourPackInformation(r, &pk.BehaviourPacks[i])
 	}
 
 	r.Uint16(&length)
+	r.LimitLength(uint32(length))
 	pk.TexturePacks = make([]protocol.TexturePackInfo, length)
 	for i := uint16(0); i < length; i++ {
 		protocol.TexturePackInformation(r, &pk.TexturePacks[i])
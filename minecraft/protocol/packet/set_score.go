@@ -47,6 +47,7 @@ func (pk *SetScore) Unmarshal(r *protocol.Reader) {
 	var count uint32
 	r.Uint8(&pk.ActionType)
 	r.Varuint32(&count)
+	r.LimitLength(count)
 
 	if pk.ActionType != ScoreboardActionRemove && pk.ActionType != ScoreboardActionModify {
 		r.UnknownEnumOption(pk.ActionType, "set score action type")
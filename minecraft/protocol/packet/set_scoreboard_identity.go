@@ -46,6 +46,7 @@ func (pk *SetScoreboardIdentity) Unmarshal(r *protocol.Reader) {
 	var count uint32
 	r.Uint8(&pk.ActionType)
 	r.Varuint32(&count)
+	r.LimitLength(count)
 
 	pk.Entries = make([]protocol.ScoreboardIdentityEntry, count)
 	for i := uint32(0); i < count; i++ {
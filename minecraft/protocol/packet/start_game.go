@@ -322,6 +322,7 @@ func (pk *StartGame) Unmarshal(r *protocol.Reader) {
 	protocol.GameRules(r, &pk.GameRules)
 	var l uint32
 	r.Uint32(&l)
+	r.LimitLength(l)
 	pk.Experiments = make([]protocol.ExperimentData, l)
 	for i := uint32(0); i < l; i++ {
 		protocol.Experiment(r, &pk.Experiments[i])
@@ -358,12 +359,14 @@ func (pk *StartGame) Unmarshal(r *protocol.Reader) {
 	r.Varint32(&pk.EnchantmentSeed)
 
 	r.Varuint32(&blockCount)
+	r.LimitLength(blockCount)
 	pk.Blocks = make([]protocol.BlockEntry, blockCount)
 	for i := uint32(0); i < blockCount; i++ {
 		protocol.Block(r, &pk.Blocks[i])
 	}
 
 	r.Varuint32(&itemCount)
+	r.LimitLength(itemCount)
 	pk.Items = make([]protocol.ItemEntry, itemCount)
 	for i := uint32(0); i < itemCount; i++ {
 		protocol.Item(r, &pk.Items[i])
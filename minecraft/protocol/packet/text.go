@@ -89,6 +89,7 @@ func (pk *Text) Unmarshal(r *protocol.Reader) {
 
 		r.String(&pk.Message)
 		r.Varuint32(&length)
+		r.LimitLength(length)
 		pk.Parameters = make([]string, length)
 		for i := uint32(0); i < length; i++ {
 			r.String(&pk.Parameters[i])
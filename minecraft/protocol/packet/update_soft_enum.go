@@ -49,6 +49,7 @@ func (pk *UpdateSoftEnum) Unmarshal(r *protocol.Reader) {
 	var count uint32
 	r.String(&pk.EnumType)
 	r.Varuint32(&count)
+	r.LimitLength(count)
 
 	pk.Options = make([]string, count)
 	for i := uint32(0); i < count; i++ {
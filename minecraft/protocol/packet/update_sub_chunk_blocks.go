@@ -45,6 +45,7 @@ func (pk *UpdateSubChunkBlocks) Unmarshal(r *protocol.Reader) {
 	var blocksLen, extraLen uint32
 
 	r.Varuint32(&blocksLen)
+	r.LimitLength(blocksLen)
 
 	pk.Blocks = make([]protocol.BlockChangeEntry, blocksLen)
 	for i := uint32(0); i < blocksLen; i++ {
@@ -52,6 +53,7 @@ func (pk *UpdateSubChunkBlocks) Unmarshal(r *protocol.Reader) {
 	}
 
 	r.Varuint32(&extraLen)
+	r.LimitLength(extraLen)
 
 	pk.Extra = make([]protocol.BlockChangeEntry, extraLen)
 	for i := uint32(0); i < extraLen; i++ {
@@ -58,14 +58,10 @@ var errStringTooLong = errors.New("string length overflows a 32-bit integer")
 func (r *Reader) StringUTF(x *string) {
 	var length int16
 	r.Int16(&length)
-	l := int(length)
-	if l > math.MaxInt16 {
-		r.panic(errStringTooLong)
-	}
-	data := make([]byte, l)
-	if _, err := r.r.Read(data); err != nil {
-		r.panic(err)
+	if length < 0 {
+		r.panicf("string length %v is negative", length)
 	}
+	data := r.read(int(length))
 	*x = *(*string)(unsafe.Pointer(&data))
 }
 
@@ -73,14 +69,10 @@ func (r *Reader) StringUTF(x *string) {
 func (r *Reader) String(x *string) {
 	var length uint32
 	r.Varuint32(&length)
-	l := int(length)
-	if l > math.MaxInt32 {
+	if length > math.MaxInt32 {
 		r.panic(errStringTooLong)
 	}
-	data := make([]byte, l)
-	if _, err := r.r.Read(data); err != nil {
-		r.panic(err)
-	}
+	data := r.read(int(length))
 	*x = *(*string)(unsafe.Pointer(&data))
 }
 
@@ -88,15 +80,10 @@ func (r *Reader) String(x *string) {
 func (r *Reader) ByteSlice(x *[]byte) {
 	var length uint32
 	r.Varuint32(&length)
-	l := int(length)
-	if l > math.MaxInt32 {
+	if length > math.MaxInt32 {
 		r.panic(errStringTooLong)
 	}
-	data := make([]byte, l)
-	if _, err := r.r.Read(data); err != nil {
-		r.panic(err)
-	}
-	*x = data
+	*x = r.read(int(length))
 }
 
 // Vec3 reads three float32s into an mgl32.Vec3 from the underlying buffer.
@@ -172,10 +159,7 @@ func (r *Reader) NBTList(m *[]interface{}, encoding nbt.Encoding) {
 
 // UUID reads a uuid.UUID from the underlying buffer.
 func (r *Reader) UUID(x *uuid.UUID) {
-	b := make([]byte, 16)
-	if _, err := r.r.Read(b); err != nil {
-		r.panic(err)
-	}
+	b := r.read(16)
 
 	// The UUIDs we read are Little Endian, but the uuid library is based on Big Endian UUIDs, so we need to
 	// reverse the two int64s the UUID is composed of, then reverse their bytes too.
@@ -193,21 +177,23 @@ func (r *Reader) PlayerInventoryAction(x *UseItemTransactionData) {
 	if x.LegacyRequestID < -1 && (x.LegacyRequestID&1) == 0 {
 		var l uint32
 		r.Varuint32(&l)
+		r.LimitLength(l)
 
 		x.LegacySetItemSlots = make([]LegacySetItemSlot, l)
 
-		for _, slot := range x.LegacySetItemSlots {
-			SetItemSlot(r, &slot)
+		for i := range x.LegacySetItemSlots {
+			SetItemSlot(r, &x.LegacySetItemSlots[i])
 		}
 	}
 
 	var l uint32
 	r.Varuint32(&l)
+	r.LimitLength(l)
 
 	x.Actions = make([]InventoryAction, l)
 
-	for _, a := range x.Actions {
-		InvAction(r, &a)
+	for i := range x.Actions {
+		InvAction(r, &x.Actions[i])
 	}
 
 	r.Varuint32(&x.ActionType)
@@ -415,7 +401,7 @@ func (r *Reader) MaterialReducer(m *MaterialReducer) {
 	r.Varint32(&mix)
 	r.Varuint32(&itemCountsLen)
 
-	m.InputItem = ItemType{NetworkID: mix << 16, MetadataValue: uint32(mix & 0x7fff)}
+	m.InputItem = ItemType{NetworkID: mix >> 16, MetadataValue: uint32(mix & 0x7fff)}
 
 	for i := uint32(0); i < itemCountsLen; i++ {
 		var out MaterialReducerOutput
@@ -430,8 +416,8 @@ func (r *Reader) MaterialReducer(m *MaterialReducer) {
 // LimitUint32 checks if the value passed is lower than the limit passed. If not, the Reader panics.
 func (r *Reader) LimitUint32(value uint32, max uint32) {
 	if max == math.MaxUint32 {
-		// Account for 0-1 overflowing into max.
-		max = 0
+		// Account for 0-1 overflowing into max: No value is valid if the limit was derived from an empty slice.
+		r.panicf("uint32 %v exceeds maximum of -1", value)
 	}
 	if value > max {
 		r.panicf("uint32 %v exceeds maximum of %v", value, max)
@@ -540,6 +526,53 @@ func (r *Reader) Varuint32(x *uint32) {
 	r.panic(errVarIntOverflow)
 }
 
+// LimitLength checks if the length passed, which is the number of elements of a slice read from the
+// underlying buffer, does not exceed the number of bytes left in the buffer. As every element takes up at
+// least one byte, a larger length can only be the result of malformed data, and the Reader panics instead of
+// allocating the slice. The length is not checked if the number of bytes left is not known.
+func (r *Reader) LimitLength(length uint32) {
+	if l, ok := r.r.(interface{ Len() int }); ok && uint64(length) > uint64(l.Len()) {
+		r.panicf("length %v exceeds the %v bytes left", length, l.Len())
+	}
+}
+
+// read reads exactly n bytes from the underlying buffer. If the number of bytes left in the buffer is known,
+// n is checked against it first, so that no huge slices are allocated for malformed data. Otherwise, the
+// bytes are read in chunks, so that at most twice the number of bytes actually present is allocated.
+func (r *Reader) read(n int) []byte {
+	if l, ok := r.r.(interface{ Len() int }); ok {
+		if n > l.Len() {
+			r.panic(io.ErrUnexpectedEOF)
+		}
+		data := make([]byte, n)
+		if _, err := io.ReadFull(r.r, data); err != nil {
+			r.panic(err)
+		}
+		return data
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, minInt(n, 4096)))
+	if _, err := io.CopyN(buf, r.r, int64(n)); err != nil {
+		r.panic(unexpectedEOF(err))
+	}
+	return buf.Bytes()
+}
+
+// unexpectedEOF turns an io.EOF into io.ErrUnexpectedEOF, as the data read was incomplete.
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// minInt returns the smaller of the two ints passed.
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
 // panicf panics with the format and values passed and assigns the error created to the Reader.
 func (r *Reader) panicf(format string, a ...interface{}) {
 	panic(fmt.Errorf(format, a...))
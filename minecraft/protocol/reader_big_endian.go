@@ -4,13 +4,14 @@ package protocol
 
 import (
 	"encoding/binary"
+	"io"
 	"math"
 )
 
 // Uint16 reads a little endian uint16 from the underlying buffer.
 func (r *Reader) Uint16(x *uint16) {
 	b := make([]byte, 2)
-	if _, err := r.r.Read(b); err != nil {
+	if _, err := io.ReadFull(r.r, b); err != nil {
 		r.panic(err)
 	}
 	*x = binary.BigEndian.Uint16(b)
@@ -19,7 +20,7 @@ func (r *Reader) Uint16(x *uint16) {
 // Int16 reads a little endian int16 from the underlying buffer.
 func (r *Reader) Int16(x *int16) {
 	b := make([]byte, 2)
-	if _, err := r.r.Read(b); err != nil {
+	if _, err := io.ReadFull(r.r, b); err != nil {
 		r.panic(err)
 	}
 	*x = int16(binary.BigEndian.Uint16(b))
@@ -28,7 +29,7 @@ func (r *Reader) Int16(x *int16) {
 // Uint32 reads a little endian uint32 from the underlying buffer.
 func (r *Reader) Uint32(x *uint32) {
 	b := make([]byte, 4)
-	if _, err := r.r.Read(b); err != nil {
+	if _, err := io.ReadFull(r.r, b); err != nil {
 		r.panic(err)
 	}
 	*x = binary.BigEndian.Uint32(b)
@@ -37,7 +38,7 @@ func (r *Reader) Uint32(x *uint32) {
 // Int32 reads a little endian int32 from the underlying buffer.
 func (r *Reader) Int32(x *int32) {
 	b := make([]byte, 4)
-	if _, err := r.r.Read(b); err != nil {
+	if _, err := io.ReadFull(r.r, b); err != nil {
 		r.panic(err)
 	}
 	*x = int32(binary.BigEndian.Uint32(b))
@@ -46,7 +47,7 @@ func (r *Reader) Int32(x *int32) {
 // BEInt32 reads a big endian int32 from the underlying buffer.
 func (r *Reader) BEInt32(x *int32) {
 	b := make([]byte, 4)
-	if _, err := r.r.Read(b); err != nil {
+	if _, err := io.ReadFull(r.r, b); err != nil {
 		r.panic(err)
 	}
 	*x = *(*int32)(unsafe.Pointer(&b[0]))
@@ -55,7 +56,7 @@ func (r *Reader) BEInt32(x *int32) {
 // Uint64 reads a little endian uint64 from the underlying buffer.
 func (r *Reader) Uint64(x *uint64) {
 	b := make([]byte, 8)
-	if _, err := r.r.Read(b); err != nil {
+	if _, err := io.ReadFull(r.r, b); err != nil {
 		r.panic(err)
 	}
 	*x = binary.BigEndian.Uint64(b)
@@ -64,7 +65,7 @@ func (r *Reader) Uint64(x *uint64) {
 // Int64 reads a little endian int64 from the underlying buffer.
 func (r *Reader) Int64(x *int64) {
 	b := make([]byte, 8)
-	if _, err := r.r.Read(b); err != nil {
+	if _, err := io.ReadFull(r.r, b); err != nil {
 		r.panic(err)
 	}
 	*x = int64(binary.BigEndian.Uint64(b))
@@ -73,7 +74,7 @@ func (r *Reader) Int64(x *int64) {
 // Float32 reads a little endian float32 from the underlying buffer.
 func (r *Reader) Float32(x *float32) {
 	b := make([]byte, 4)
-	if _, err := r.r.Read(b); err != nil {
+	if _, err := io.ReadFull(r.r, b); err != nil {
 		r.panic(err)
 	}
 	*x = math.Float32frombits(binary.BigEndian.Uint32(b))
@@ -126,6 +126,7 @@ func SerialisedSkin(r *Reader, x *Skin) {
 	r.Uint32(&x.SkinImageHeight)
 	r.ByteSlice(&x.SkinData)
 	r.Uint32(&animationCount)
+	r.LimitLength(animationCount)
 
 	x.Animations = make([]SkinAnimation, animationCount)
 	for i := uint32(0); i < animationCount; i++ {
@@ -143,11 +144,13 @@ func SerialisedSkin(r *Reader, x *Skin) {
 	r.String(&x.SkinColour)
 
 	r.Uint32(&count)
+	r.LimitLength(count)
 	x.PersonaPieces = make([]PersonaPiece, count)
 	for i := uint32(0); i < count; i++ {
 		SkinPiece(r, &x.PersonaPieces[i])
 	}
 	r.Uint32(&count)
+	r.LimitLength(count)
 	x.PieceTintColours = make([]PersonaPieceTintColour, count)
 	for i := uint32(0); i < count; i++ {
 		SkinPieceTint(r, &x.PieceTintColours[i])
@@ -291,6 +294,7 @@ func SkinPieceTint(r *Reader, x *PersonaPieceTintColour) {
 	r.String(&x.PieceType)
 
 	r.Uint32(&c)
+	r.LimitLength(c)
 	x.Colours = make([]string, c)
 	for i := uint32(0); i < c; i++ {
 		r.String(&x.Colours[i])
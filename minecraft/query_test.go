@@ -0,0 +1,36 @@
+package minecraft_test
+
+import (
+	"phoenix/minecraft"
+	"phoenix/minecraft/protocol/login"
+	"phoenix/query"
+	"reflect"
+	"testing"
+)
+
+// TestListenerQuery queries a Listener answering queries on localhost UDP and checks that the full stat holds
+// the status of its StatusProvider and the names of the players logged in.
+func TestListenerQuery(t *testing.T) {
+	const network = "pipe-query"
+	listener := listenPipe(t, network, minecraft.ListenConfig{
+		AuthenticationDisabled: true,
+		StatusProvider:         minecraft.NewStatusProvider("Query Server"),
+		MaximumPlayers:         10,
+		QueryAddress:           "127.0.0.1:0",
+	})
+	dialAccept(t, listener, network, minecraft.Dialer{IdentityData: login.IdentityData{DisplayName: "Tester"}})
+
+	stat, err := query.DoFull(listener.QueryAddr().String())
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if stat.HostName != "Query Server" || stat.Map != "Query Server" || stat.GameID != "MINECRAFTPE" {
+		t.Fatalf("got full stat %+v, expected the status of the StatusProvider", stat)
+	}
+	if stat.NumPlayers != 1 || stat.MaxPlayers != 10 || !reflect.DeepEqual(stat.Players, []string{"Tester"}) {
+		t.Fatalf("got players %v (%v/%v), expected [Tester] (1/10)", stat.Players, stat.NumPlayers, stat.MaxPlayers)
+	}
+	if stat.HostIP != "127.0.0.1" || stat.HostPort != 19132 {
+		t.Fatalf("got host %v:%v, expected %v", stat.HostIP, stat.HostPort, pipeAddress)
+	}
+}
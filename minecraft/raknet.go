@@ -0,0 +1,37 @@
+package minecraft
+
+import (
+	"context"
+	"github.com/sandertv/go-raknet"
+	"io/ioutil"
+	"log"
+	"net"
+)
+
+// RakNet is the Network implementation of the RakNet protocol over UDP, used by Minecraft: Bedrock Edition.
+// It is registered under the name "raknet".
+type RakNet struct{}
+
+// DialContext ...
+func (RakNet) DialContext(ctx context.Context, address string) (net.Conn, error) {
+	conn, err := raknet.Dialer{ErrorLog: log.New(ioutil.Discard, "", 0)}.DialContext(ctx, address)
+	if err != nil {
+		// Return an untyped nil so that the net.Conn returned compares equal to nil.
+		return nil, err
+	}
+	return conn, nil
+}
+
+// PingContext ...
+func (RakNet) PingContext(ctx context.Context, address string) (pong []byte, err error) {
+	return raknet.Dialer{ErrorLog: log.New(ioutil.Discard, "", 0)}.PingContext(ctx, address)
+}
+
+// Listen ...
+func (RakNet) Listen(address string) (NetworkListener, error) {
+	listener, err := raknet.ListenConfig{ErrorLog: log.New(ioutil.Discard, "", 0)}.Listen(address)
+	if err != nil {
+		return nil, err
+	}
+	return listener, nil
+}
@@ -0,0 +1,169 @@
+package resource
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"path"
+	"phoenix/minecraft/protocol"
+	"strings"
+)
+
+// builderNamespace is the namespace of the UUIDs that a Builder derives from the names of packs.
+var builderNamespace = uuid.MustParse("8d3f4b7e-2c1a-4e5f-9b6d-0a7c8e9f1b2d")
+
+// Builder builds a pack from Go, for example a behaviour pack with functions generated by a program. A
+// Builder is created using NewBuilder. Its methods return the Builder itself, so that calls may be chained.
+// Builders are not safe for concurrent use.
+type Builder struct {
+	manifest Manifest
+	files    map[string][]byte
+	err      error
+}
+
+// NewBuilder returns a Builder for a pack with the name passed, version 1.0.0 and no modules. The UUID of the
+// pack is derived from its name, so that a pack built again with the same name has the same UUID and does
+// not need to be downloaded again by clients that cached it. The minimum game version of the pack is the
+// version of the game implemented by the protocol package.
+func NewBuilder(name string) *Builder {
+	minVersion, _ := ParseVersion(protocol.CurrentVersion)
+	return &Builder{
+		manifest: Manifest{
+			FormatVersion: 2,
+			Header: Header{
+				Name:               name,
+				UUID:               uuid.NewSHA1(builderNamespace, []byte(name)).String(),
+				Version:            Version{1, 0, 0},
+				MinimumGameVersion: minVersion,
+			},
+		},
+		files: make(map[string][]byte),
+	}
+}
+
+// Description sets the description of the pack.
+func (b *Builder) Description(description string) *Builder {
+	b.manifest.Header.Description = description
+	return b
+}
+
+// UUID sets the UUID of the pack, replacing the one derived from its name.
+func (b *Builder) UUID(id string) *Builder {
+	b.manifest.Header.UUID = strings.ToLower(id)
+	return b
+}
+
+// Version sets the version of the pack and of its modules.
+func (b *Builder) Version(v Version) *Builder {
+	b.manifest.Header.Version = v
+	return b
+}
+
+// MinimumGameVersion sets the minimum version of the game that the pack was written for.
+func (b *Builder) MinimumGameVersion(v Version) *Builder {
+	b.manifest.Header.MinimumGameVersion = v
+	return b
+}
+
+// Module adds a module of the type passed, such as "resources" or "data", to the pack. The UUID of the module
+// is derived from the UUID of the pack when the pack is built.
+func (b *Builder) Module(typ string) *Builder {
+	b.manifest.Modules = append(b.manifest.Modules, Module{Type: typ})
+	return b
+}
+
+// Dependency adds the dependency passed to the pack.
+func (b *Builder) Dependency(dependency Dependency) *Builder {
+	b.manifest.Dependencies = append(b.manifest.Dependencies, dependency)
+	return b
+}
+
+// DependOn adds a dependency on the current version of the pack passed to the pack.
+func (b *Builder) DependOn(pack *Pack) *Builder {
+	return b.Dependency(Dependency{UUID: pack.UUID(), Version: pack.manifest.Header.Version})
+}
+
+// File adds a file with the slash separated path and data passed to the pack, replacing the file at the path
+// if the pack already had one. The path must be relative and may not point outside of the pack, and the
+// manifest.json is always generated by the Builder.
+func (b *Builder) File(name string, data []byte) *Builder {
+	clean := path.Clean(name)
+	switch {
+	case name == "" || path.IsAbs(name) || clean == ".." || strings.HasPrefix(clean, "../"):
+		b.fail(fmt.Errorf("file path %q must be relative and within the pack", name))
+	case clean == "manifest.json":
+		b.fail(fmt.Errorf("file path %q is reserved for the manifest", name))
+	default:
+		b.files[clean] = data
+	}
+	return b
+}
+
+// Function adds a function with the name passed, such as "build/wall", that runs the commands passed to the
+// pack. Commands are written without a leading slash. A "data" module is added to the pack if it has none,
+// as functions are only loaded from behaviour packs.
+func (b *Builder) Function(name string, commands ...string) *Builder {
+	if !b.hasModule("data") {
+		b.Module("data")
+	}
+	lines := make([]string, len(commands))
+	for i, command := range commands {
+		lines[i] = strings.TrimPrefix(strings.TrimSpace(command), "/")
+	}
+	return b.File("functions/"+name+".mcfunction", []byte(strings.Join(lines, "\n")+"\n"))
+}
+
+// Manifest returns the manifest of the pack as it would be built.
+func (b *Builder) Manifest() Manifest {
+	m := b.manifest
+	m.Modules = make([]Module, len(b.manifest.Modules))
+	packUUID, err := uuid.Parse(m.Header.UUID)
+	for i, module := range b.manifest.Modules {
+		if err == nil {
+			module.UUID = uuid.NewSHA1(packUUID, []byte(fmt.Sprintf("module %v %v", i, module.Type))).String()
+		}
+		module.Version = m.Header.Version
+		m.Modules[i] = module
+	}
+	m.Dependencies = append([]Dependency(nil), b.manifest.Dependencies...)
+	return m
+}
+
+// Build validates the manifest of the pack and builds the pack. The first error that occurred while adding
+// files or validating the manifest is returned.
+func (b *Builder) Build() (*Pack, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	m := b.Manifest()
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding manifest: %v", err)
+	}
+	files := make(map[string][]byte, len(b.files)+1)
+	for name, file := range b.files {
+		files[name] = file
+	}
+	files["manifest.json"] = data
+	return packFromFiles(files)
+}
+
+// hasModule checks if the pack has a module of the type passed.
+func (b *Builder) hasModule(typ string) bool {
+	for _, module := range b.manifest.Modules {
+		if module.Type == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// fail records the error passed to be returned by Build, unless an error was already recorded.
+func (b *Builder) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
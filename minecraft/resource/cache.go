@@ -0,0 +1,190 @@
+package resource
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Cache is a directory in which resource packs are saved, so that packs sent by a server do not need to be
+// downloaded again the next time it is joined. Packs are identified by their UUID and version, and their
+// checksum is verified when they are loaded. A Cache is safe for concurrent use, also by different
+// connections.
+type Cache struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// cacheEntry holds the information about a pack in a Cache, which is saved next to its archive.
+type cacheEntry struct {
+	UUID    string
+	Version string
+	// Checksum is the hex encoded SHA256 checksum of the archive of the pack.
+	Checksum string
+	// ContentKey is the key that the pack is encrypted with, if any.
+	ContentKey string `json:",omitempty"`
+}
+
+// OpenCache opens the Cache in the directory passed, creating the directory if it does not yet exist. As the
+// Cache holds the keys of encrypted packs, the directory created is only accessible by the current user.
+func OpenCache(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("error creating pack cache directory: %v", err)
+	}
+	return &Cache{dir: dir}, nil
+}
+
+// Dir returns the directory of the Cache.
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// Load loads the pack with the UUID and version passed from the Cache. If the pack is encrypted and its key
+// was known when it was stored, the Pack returned has its content key set. Load returns an error wrapping
+// os.ErrNotExist if the pack is not in the Cache. Packs of which the archive does not match its checksum
+// are removed from the Cache.
+func (c *Cache) Load(uuid, version string) (*Pack, error) {
+	name, err := cacheName(uuid, version)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.load(name)
+}
+
+// load loads the pack saved under the name passed.
+func (c *Cache) load(name string) (*Pack, error) {
+	data, err := ioutil.ReadFile(filepath.Join(c.dir, name+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading pack cache entry: %w", err)
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("error decoding pack cache entry %v: %v", name, err)
+	}
+	archive, err := ioutil.ReadFile(filepath.Join(c.dir, name+".mcpack"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading cached pack: %w", err)
+	}
+	pack, err := FromBytes(archive)
+	if err == nil {
+		if checksum := pack.Checksum(); hex.EncodeToString(checksum[:]) != entry.Checksum {
+			err = fmt.Errorf("checksum mismatch")
+		}
+	}
+	if err == nil {
+		pack, err = pack.WithValidContentKey(entry.ContentKey)
+	}
+	if err != nil {
+		c.remove(name)
+		return nil, fmt.Errorf("cached pack %v is corrupted and was removed: %v: %w", name, err, os.ErrNotExist)
+	}
+	return pack, nil
+}
+
+// Store saves the pack passed to the Cache, replacing the pack with the same UUID and version if the Cache
+// already had one. The content key of the pack is saved with it.
+func (c *Cache) Store(pack *Pack) error {
+	name, err := cacheName(pack.UUID(), pack.Version())
+	if err != nil {
+		return err
+	}
+	archive := make([]byte, pack.Len())
+	if _, err := pack.ReadAt(archive, 0); err != nil {
+		return fmt.Errorf("error reading pack content: %v", err)
+	}
+	checksum := pack.Checksum()
+	entry, _ := json.MarshalIndent(cacheEntry{
+		UUID:       pack.UUID(),
+		Version:    pack.Version(),
+		Checksum:   hex.EncodeToString(checksum[:]),
+		ContentKey: pack.ContentKey(),
+	}, "", "\t")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// The entry is written after the archive, so that it is never found without its archive.
+	if err := writeFileAtomic(filepath.Join(c.dir, name+".mcpack"), archive); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(c.dir, name+".json"), entry)
+}
+
+// Packs loads all packs in the Cache. Packs that are corrupted are removed from the Cache and left out.
+func (c *Cache) Packs() ([]*Pack, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	names, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	packs := make([]*Pack, 0, len(names))
+	for _, name := range names {
+		pack, err := c.load(strings.TrimSuffix(filepath.Base(name), ".json"))
+		if err != nil {
+			continue
+		}
+		packs = append(packs, pack)
+	}
+	return packs, nil
+}
+
+// Export unpacks all packs in the Cache into the directory passed, each in a directory named after its UUID
+// and version. Encrypted packs are decrypted if their key is known.
+func (c *Cache) Export(dir string) error {
+	packs, err := c.Packs()
+	if err != nil {
+		return err
+	}
+	for _, pack := range packs {
+		if err := pack.Unpack(filepath.Join(dir, pack.UUID()+"_"+pack.Version())); err != nil {
+			return fmt.Errorf("error exporting pack %v: %w", pack, err)
+		}
+	}
+	return nil
+}
+
+// remove removes the files of the pack saved under the name passed.
+func (c *Cache) remove(name string) {
+	_ = os.Remove(filepath.Join(c.dir, name+".json"))
+	_ = os.Remove(filepath.Join(c.dir, name+".mcpack"))
+}
+
+// cacheName returns the name that the pack with the UUID and version passed is saved under. An error is
+// returned if either is malformed, so that names sent by a server cannot point outside of the Cache.
+func cacheName(id, version string) (string, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return "", fmt.Errorf("invalid pack UUID %q: %v", id, err)
+	}
+	if version == "" || strings.Trim(version, "0123456789.") != "" {
+		return "", fmt.Errorf("invalid pack version %q", version)
+	}
+	return strings.ToLower(id) + "_" + version, nil
+}
+
+// writeFileAtomic writes the data passed to a temporary file which then replaces the file at the path passed.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file: %v", err)
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("error writing %v: %v", path, err)
+	}
+	return nil
+}
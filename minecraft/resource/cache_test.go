@@ -0,0 +1,71 @@
+package resource
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestCache stores a pack in a Cache, loads it again and checks that a corrupted pack or one with an invalid
+// content key is removed, and that names that point outside of the Cache are refused.
+func TestCache(t *testing.T) {
+	pack, err := EncryptPack(writeTestPack(t), "s5s5ejuDru4uchuF2drUFuthaspAbepE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache, err := OpenCache(filepath.Join(t.TempDir(), "packs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(cache.Dir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != 0700 {
+			t.Fatalf("cache directory created with permissions %v, expected %v", perm, os.FileMode(0700))
+		}
+	}
+	if _, err := cache.Load(pack.UUID(), pack.Version()); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("loading a pack not in the cache returned %v, expected %v", err, os.ErrNotExist)
+	}
+	if err := cache.Store(pack); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := cache.Load(pack.UUID(), pack.Version())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Checksum() != pack.Checksum() || loaded.ContentKey() != pack.ContentKey() {
+		t.Fatalf("loaded pack %v with content key %q, expected %v with %q", loaded, loaded.ContentKey(), pack, pack.ContentKey())
+	}
+
+	archive := filepath.Join(cache.Dir(), pack.UUID()+"_"+pack.Version()+".mcpack")
+	data, _ := ioutil.ReadFile(archive)
+	data[len(data)/2] ^= 0xff
+	if err := ioutil.WriteFile(archive, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.Load(pack.UUID(), pack.Version()); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("loading a corrupted pack returned %v, expected %v", err, os.ErrNotExist)
+	}
+	if packs, _ := cache.Packs(); len(packs) != 0 {
+		t.Fatalf("cache holds %v after loading a corrupted pack, expected it removed", packs)
+	}
+	// A pack stored with an invalid content key is corrupted as well.
+	if err := cache.Store(pack.WithContentKey("invalid key")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.Load(pack.UUID(), pack.Version()); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("loading a pack with an invalid content key returned %v, expected %v", err, os.ErrNotExist)
+	}
+	if _, err := cache.Load("../"+pack.UUID(), pack.Version()); err == nil || errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("loading a pack with a malformed UUID returned %v", err)
+	}
+	if _, err := cache.Load(pack.UUID(), "../1.0.0"); err == nil || errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("loading a pack with a malformed version returned %v", err)
+	}
+}
@@ -2,4 +2,6 @@
 // It ensures the data in the resource pack is valid (for example, it checks if the manifest is present and
 // holds correct data) and extracts information which may be obtained by calling the exported methods of a
 // *resource.Pack.
+// Resource packs may be encrypted in the format of the Marketplace using EncryptPack, and decrypted again
+// using DecryptPack with the content key they were encrypted with.
 package resource
@@ -0,0 +1,333 @@
+package resource
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/muhammadmuzzammil1998/jsonc"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// contentsMagic is the magic number found in the header of the contents.json of encrypted packs.
+	contentsMagic = 0x9bcfb9fc
+	// contentsHeaderSize is the size of the unencrypted header of the contents.json of encrypted packs, which
+	// is followed by the encrypted contents.
+	contentsHeaderSize = 0x100
+	// keyLength is the length of the content keys of packs and of the keys of the files in them.
+	keyLength = 32
+)
+
+// unencryptedFiles holds the names of the files that are never encrypted, as the client reads them before
+// it has the key of a pack.
+var unencryptedFiles = map[string]bool{"manifest.json": true, "pack_icon.png": true, "bug_pack_icon.png": true}
+
+// contents is the index of an encrypted pack, found encrypted in its contents.json. It lists every file of
+// the pack and the key that it is encrypted with, if any.
+type contents struct {
+	Content []contentEntry `json:"content"`
+}
+
+// contentEntry is an entry in the contents of an encrypted pack.
+type contentEntry struct {
+	Path string `json:"path"`
+	Key  string `json:"key,omitempty"`
+}
+
+// EncryptPack encrypts the resource pack found at the path passed, which may be a directory or an archive
+// like those passed to Compile, using the content key passed. Every file of the pack is encrypted with its
+// own key, except for the manifest and pack icons, and the keys are listed in a contents.json encrypted with
+// the content key. The encrypted pack returned has the content key set, so that it may be sent to clients.
+// The key must be 32 characters long and may only hold ASCII letters and digits.
+func EncryptPack(path, key string) (*Pack, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+	files, err := readPackFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	root, manifest, err := findManifest(files)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := files[root+"contents.json"]; ok {
+		return nil, fmt.Errorf("resource pack %v already has a contents.json", manifest.Header.UUID)
+	}
+
+	var index contents
+	encrypted := make(map[string][]byte, len(files)+1)
+	for _, name := range sortedNames(files) {
+		data := files[name]
+		if !strings.HasPrefix(name, root) {
+			encrypted[name] = data
+			continue
+		}
+		entry := contentEntry{Path: strings.TrimPrefix(name, root)}
+		if !unencryptedFiles[entry.Path] {
+			entry.Key = randomKey()
+			data = encryptBytes(data, entry.Key)
+		}
+		index.Content = append(index.Content, entry)
+		encrypted[name] = data
+	}
+	data, _ := json.Marshal(index)
+	header := make([]byte, contentsHeaderSize, contentsHeaderSize+len(data))
+	binary.LittleEndian.PutUint32(header[4:], contentsMagic)
+	header[0x10] = byte(len(manifest.Header.UUID))
+	copy(header[0x11:], manifest.Header.UUID)
+	encrypted[root+"contents.json"] = append(header, encryptBytes(data, key)...)
+
+	pack, err := packFromFiles(encrypted)
+	if err != nil {
+		return nil, err
+	}
+	return pack.WithContentKey(key), nil
+}
+
+// DecryptPack decrypts the encrypted resource pack held in the archive passed using the content key passed
+// and returns the decrypted pack, which no longer has a contents.json. An error is returned if the pack is
+// not encrypted, if the key is malformed or if the pack was not encrypted with it.
+func DecryptPack(archive []byte, key string) (*Pack, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+	files, err := readArchiveFiles(archive)
+	if err != nil {
+		return nil, err
+	}
+	root, manifest, err := findManifest(files)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := files[root+"contents.json"]
+	if !ok {
+		return nil, fmt.Errorf("resource pack %v is not encrypted: no contents.json", manifest.Header.UUID)
+	}
+	if len(data) < contentsHeaderSize || binary.LittleEndian.Uint32(data[4:]) != contentsMagic {
+		return nil, fmt.Errorf("resource pack %v is not encrypted: contents.json has no encryption header", manifest.Header.UUID)
+	}
+	// The header holds the content ID, which is the UUID of the pack, prefixed by its length.
+	end := 0x11 + int(data[0x10])
+	if end > contentsHeaderSize {
+		return nil, fmt.Errorf("contents.json of resource pack %v has an invalid content ID length", manifest.Header.UUID)
+	}
+	if id := data[0x11:end]; !strings.EqualFold(string(id), manifest.Header.UUID) {
+		return nil, fmt.Errorf("contents.json of resource pack %v has content ID %q", manifest.Header.UUID, id)
+	}
+	var index contents
+	if err := json.Unmarshal(decryptBytes(data[contentsHeaderSize:], key), &index); err != nil {
+		return nil, fmt.Errorf("resource pack %v is not encrypted with the key passed: %v", manifest.Header.UUID, err)
+	}
+
+	delete(files, root+"contents.json")
+	for _, entry := range index.Content {
+		name := root + entry.Path
+		data, ok := files[name]
+		if !ok || entry.Key == "" {
+			continue
+		}
+		if err := validateKey(entry.Key); err != nil {
+			return nil, fmt.Errorf("key of %v: %w", entry.Path, err)
+		}
+		files[name] = decryptBytes(data, entry.Key)
+	}
+	return packFromFiles(files)
+}
+
+// ValidateContentKey checks if the key passed may be used as the content key of a pack: It must either be
+// empty, for packs that are not encrypted, or be 32 characters long and only hold ASCII letters and digits.
+func ValidateContentKey(key string) error {
+	if key == "" {
+		return nil
+	}
+	return validateKey(key)
+}
+
+// validateKey checks if the key passed may be used to encrypt a pack or a file in one.
+func validateKey(key string) error {
+	if len(key) != keyLength {
+		return fmt.Errorf("invalid key: must be %v characters long, got %v", keyLength, len(key))
+	}
+	for _, c := range key {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			return fmt.Errorf("invalid key: must only hold ASCII letters and digits, got %q", c)
+		}
+	}
+	return nil
+}
+
+// randomKey returns a new random key to encrypt a file with.
+func randomKey() string {
+	const chars = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	b := make([]byte, keyLength)
+	_, _ = rand.Read(b)
+	for i := range b {
+		b[i] = chars[int(b[i])%len(chars)]
+	}
+	return string(b)
+}
+
+// encryptBytes returns the data passed encrypted using AES-256 in CFB8 mode with the key passed, which is
+// also the source of the IV.
+func encryptBytes(data []byte, key string) []byte {
+	block, _ := aes.NewCipher([]byte(key))
+	out := make([]byte, len(data))
+	newCFB8(block, []byte(key[:aes.BlockSize]), false).XORKeyStream(out, data)
+	return out
+}
+
+// decryptBytes returns the data passed decrypted using AES-256 in CFB8 mode with the key passed.
+func decryptBytes(data []byte, key string) []byte {
+	block, _ := aes.NewCipher([]byte(key))
+	out := make([]byte, len(data))
+	newCFB8(block, []byte(key[:aes.BlockSize]), true).XORKeyStream(out, data)
+	return out
+}
+
+// cfb8 implements cipher.Stream for a block cipher in CFB mode with a segment size of 8 bits, which the
+// crypto/cipher package does not provide.
+type cfb8 struct {
+	block   cipher.Block
+	iv, out []byte
+	decrypt bool
+}
+
+// newCFB8 returns a cfb8 stream for the block and IV passed.
+func newCFB8(block cipher.Block, iv []byte, decrypt bool) cipher.Stream {
+	return &cfb8{block: block, iv: append([]byte(nil), iv...), out: make([]byte, block.BlockSize()), decrypt: decrypt}
+}
+
+// XORKeyStream encrypts or decrypts src into dst, one byte at a time.
+func (c *cfb8) XORKeyStream(dst, src []byte) {
+	for i, b := range src {
+		c.block.Encrypt(c.out, c.iv)
+		dst[i] = b ^ c.out[0]
+
+		// The cipher text byte is shifted into the IV.
+		copy(c.iv, c.iv[1:])
+		if c.decrypt {
+			c.iv[len(c.iv)-1] = b
+		} else {
+			c.iv[len(c.iv)-1] = dst[i]
+		}
+	}
+}
+
+// findManifest finds the manifest.json in the files of a pack passed, which may be in a directory if the
+// pack was archived with its directory. The directory of the manifest is returned, with a trailing slash
+// unless it is the root, with the parsed manifest.
+func findManifest(files map[string][]byte) (string, *Manifest, error) {
+	for _, name := range sortedNames(files) {
+		if path.Base(name) != "manifest.json" {
+			continue
+		}
+		manifest := &Manifest{}
+		if err := jsonc.Unmarshal(files[name], manifest); err != nil {
+			return "", nil, fmt.Errorf("error decoding manifest JSON: %v", err)
+		}
+		manifest.Header.UUID = strings.ToLower(manifest.Header.UUID)
+		return strings.TrimSuffix(name, "manifest.json"), manifest, nil
+	}
+	return "", nil, fmt.Errorf("error loading manifest: could not find 'manifest.json'")
+}
+
+// readPackFiles reads the files of the pack at the path passed, which is either a directory or an archive,
+// into a map indexed by their slash separated path.
+func readPackFiles(p string) (map[string][]byte, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, fmt.Errorf("error opening resource pack path: %v", err)
+	}
+	if !info.IsDir() {
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("error reading resource pack file content: %v", err)
+		}
+		return readArchiveFiles(data)
+	}
+	files := make(map[string][]byte)
+	err = filepath.Walk(p, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(p, filePath)
+		if err != nil {
+			return fmt.Errorf("error finding relative path: %v", err)
+		}
+		data, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return fmt.Errorf("error reading resource pack file %v: %v", filePath, err)
+		}
+		files[filepath.ToSlash(relPath)] = data
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading resource pack directory: %v", err)
+	}
+	return files, nil
+}
+
+// readArchiveFiles reads the files in the zip archive passed into a map indexed by their path.
+func readArchiveFiles(archive []byte) (map[string][]byte, error) {
+	r, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, fmt.Errorf("error opening zip reader: %v", err)
+	}
+	files := make(map[string][]byte, len(r.File))
+	for _, file := range r.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		f, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("error opening zip file %v: %v", file.Name, err)
+		}
+		data, err := ioutil.ReadAll(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading zip file %v: %v", file.Name, err)
+		}
+		files[file.Name] = data
+	}
+	return files, nil
+}
+
+// packFromFiles archives the files passed and compiles a Pack from the archive.
+func packFromFiles(files map[string][]byte) (*Pack, error) {
+	buf := bytes.NewBuffer(nil)
+	writer := zip.NewWriter(buf)
+	for _, name := range sortedNames(files) {
+		f, err := writer.Create(name)
+		if err != nil {
+			return nil, fmt.Errorf("error creating new zip file: %v", err)
+		}
+		if _, err := f.Write(files[name]); err != nil {
+			return nil, fmt.Errorf("error writing file data to zip: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("error building zip archive: %v", err)
+	}
+	return FromBytes(buf.Bytes())
+}
+
+// sortedNames returns the names of the files passed in sorted order.
+func sortedNames(files map[string][]byte) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
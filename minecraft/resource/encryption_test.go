@@ -0,0 +1,169 @@
+package resource
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestCFB8 checks the cfb8 stream against the AES-256 CFB8 example vectors of NIST SP 800-38A.
+func TestCFB8(t *testing.T) {
+	key, _ := hex.DecodeString("603deb1015ca71be2b73aef0857d77811f352c073b6108d72d9810a30914dff4")
+	iv, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	plain, _ := hex.DecodeString("6bc1bee22e409f96e93d7e117393172aae2d")
+	cipherText, _ := hex.DecodeString("dc1f1a8520a64db55fcc8ac554844e889700")
+
+	block, _ := aes.NewCipher(key)
+	out := make([]byte, len(plain))
+	newCFB8(block, iv, false).XORKeyStream(out, plain)
+	if !bytes.Equal(out, cipherText) {
+		t.Fatalf("encrypted to %x, expected %x", out, cipherText)
+	}
+	newCFB8(block, iv, true).XORKeyStream(out, cipherText)
+	if !bytes.Equal(out, plain) {
+		t.Fatalf("decrypted to %x, expected %x", out, plain)
+	}
+}
+
+// testPackFiles holds the files of the pack encrypted in tests.
+var testPackFiles = map[string]string{
+	"manifest.json": `{
+	"format_version": 2,
+	"header": {"name": "Test Pack", "description": "Encrypted", "uuid": "1A2B3C4D-0000-4000-8000-000000000001", "version": [1, 0, 0]},
+	"modules": [{"type": "resources", "uuid": "1a2b3c4d-0000-4000-8000-000000000002", "version": [1, 0, 0]}]
+}`,
+	"pack_icon.png":                 "icon",
+	"textures/blocks/stone.png":     "stone texture",
+	"texts/en_US.lang":              "tile.stone.name=Stone",
+	"textures/terrain_texture.json": `{"texture_data": {}}`,
+}
+
+// writeTestPack writes the testPackFiles to a new directory and returns its path.
+func writeTestPack(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range testPackFiles {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// packArchive returns the full archive content of the pack passed.
+func packArchive(pack *Pack) []byte {
+	data := make([]byte, pack.Len())
+	_, _ = pack.ReadAt(data, 0)
+	return data
+}
+
+// TestEncryptPack encrypts a pack and decrypts it again, and checks that only the files expected are
+// encrypted and that the decrypted pack holds the original files.
+func TestEncryptPack(t *testing.T) {
+	const key = "s5s5ejuDru4uchuF2drUFuthaspAbepE"
+	pack, err := EncryptPack(writeTestPack(t), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pack.Encrypted() || pack.ContentKey() != key {
+		t.Fatalf("encrypted pack has content key %q, expected %q", pack.ContentKey(), key)
+	}
+	if pack.UUID() != "1a2b3c4d-0000-4000-8000-000000000001" || pack.Name() != "Test Pack" {
+		t.Fatalf("encrypted pack has unexpected manifest %+v", pack.Manifest().Header)
+	}
+	archive := packArchive(pack)
+	files, err := readArchiveFiles(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(testPackFiles)+1 {
+		t.Fatalf("encrypted pack holds %v files, expected %v", len(files), len(testPackFiles)+1)
+	}
+	for name, data := range testPackFiles {
+		if encrypted := unencryptedFiles[name]; encrypted == (string(files[name]) != data) {
+			t.Fatalf("%v: encrypted = %v, expected %v", name, !encrypted, encrypted)
+		}
+	}
+
+	decrypted, err := DecryptPack(archive, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted.Encrypted() {
+		t.Fatal("decrypted pack has a content key")
+	}
+	files, err = readArchiveFiles(packArchive(decrypted))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(testPackFiles) {
+		t.Fatalf("decrypted pack holds %v files, expected %v", len(files), len(testPackFiles))
+	}
+	for name, data := range testPackFiles {
+		if string(files[name]) != data {
+			t.Fatalf("%v decrypted to %q, expected %q", name, files[name], data)
+		}
+	}
+}
+
+// TestDecryptPackKeys checks that decrypting a pack fails with malformed or wrong keys and for packs that are
+// not encrypted.
+func TestDecryptPackKeys(t *testing.T) {
+	dir := writeTestPack(t)
+	pack, err := EncryptPack(dir, "s5s5ejuDru4uchuF2drUFuthaspAbepE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"", "short", "s5s5ejuDru4uchuF2drUFuthaspAbep!", "s5s5ejuDru4uchuF2drUFuthaspAbepEE"} {
+		if _, err := EncryptPack(dir, key); err == nil {
+			t.Fatalf("encrypted pack with malformed key %q", key)
+		}
+		if _, err := DecryptPack(packArchive(pack), key); err == nil {
+			t.Fatalf("decrypted pack with malformed key %q", key)
+		}
+	}
+	if _, err := DecryptPack(packArchive(pack), "WrongKeyWrongKeyWrongKeyWrongKey"); err == nil {
+		t.Fatal("decrypted pack with wrong key")
+	}
+	plain, err := Compile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecryptPack(packArchive(plain), "s5s5ejuDru4uchuF2drUFuthaspAbepE"); err == nil {
+		t.Fatal("decrypted pack that is not encrypted")
+	}
+}
+
+// TestValidContentKey checks that only empty keys and keys that may be used to encrypt a pack are accepted as
+// content keys.
+func TestValidContentKey(t *testing.T) {
+	pack, err := Compile(writeTestPack(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		key   string
+		valid bool
+	}{
+		{"", true},
+		{"s5s5ejuDru4uchuF2drUFuthaspAbepE", true},
+		{"s5s5ejuDru4uchuF2drUFuthaspAbep", false},
+		{"s5s5ejuDru4uchuF2drUFuthaspAbep!", false},
+	} {
+		if err := ValidateContentKey(tc.key); (err == nil) != tc.valid {
+			t.Fatalf("key %q: got error %v, expected valid = %v", tc.key, err, tc.valid)
+		}
+		withKey, err := pack.WithValidContentKey(tc.key)
+		if (err == nil) != tc.valid || (tc.valid && withKey.ContentKey() != tc.key) {
+			t.Fatalf("key %q: got pack %v and error %v, expected valid = %v", tc.key, withKey, err, tc.valid)
+		}
+	}
+}
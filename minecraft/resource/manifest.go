@@ -33,9 +33,9 @@ type Header struct {
 	// UUID is a unique identifier identifier this pack from any other pack.
 	UUID string `json:"uuid"`
 	// Version is the version of the pack, which can be used to identify changes in the pack.
-	Version [3]int `json:"version"`
+	Version Version `json:"version"`
 	// MinimumGameVersion is the minimum version of the game that this resource pack was written for.
-	MinimumGameVersion [3]int `json:"min_engine_version"`
+	MinimumGameVersion Version `json:"min_engine_version"`
 }
 
 // Module describes a module that comprises the pack. Each module defines one of the kinds of contents of the
@@ -51,17 +51,20 @@ type Module struct {
 	Type string `json:"type"`
 	// Version is the version of the module in the same format as the pack's version in the header. This can
 	// be used to further identify changes in the pack.
-	Version [3]int `json:"version"`
+	Version Version `json:"version"`
 }
 
 // Dependency describes a pack that this pack depends on in order to work.
 type Dependency struct {
 	// UUID is the unique identifier of the pack that this pack depends on. It needs to be the exact same UUID
 	// that the pack has defined in the header section of it's manifest file.
-	UUID string `json:"uuid"`
+	UUID string `json:"uuid,omitempty"`
+	// ModuleName is the name of the built-in module that the pack depends on, such as "@minecraft/server",
+	// if the dependency is not another pack. It is set instead of UUID.
+	ModuleName string `json:"module_name,omitempty"`
 	// Version is the specific version of the pack that the pack depends on. Should match the version the
 	// other pack has in its manifest file.
-	Version [3]int `json:"version"`
+	Version Version `json:"version"`
 }
 
 // Capability is a particular feature that the pack utilises of that isn't necessarily enabled by default.
@@ -0,0 +1,166 @@
+package resource
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestParseVersion checks that versions are parsed, compared and decoded from both of their JSON forms.
+func TestParseVersion(t *testing.T) {
+	for s, expected := range map[string]Version{"1.2.3": {1, 2, 3}, "0.0.0": {}, "10.20.300": {10, 20, 300}} {
+		v, err := ParseVersion(s)
+		if err != nil || v != expected {
+			t.Fatalf("parsed %q to %v (%v), expected %v", s, v, err, expected)
+		}
+		if v.String() != s {
+			t.Fatalf("version %v formatted as %q, expected %q", v, v.String(), s)
+		}
+	}
+	for _, s := range []string{"", "1.2", "1.2.3.4", "1.x.3", "1.-2.3", "01.2.3", "1.2.3-beta"} {
+		if v, err := ParseVersion(s); err == nil {
+			t.Fatalf("parsed invalid version %q to %v", s, v)
+		}
+	}
+
+	ordered := []Version{{0, 9, 9}, {1, 0, 0}, {1, 0, 1}, {1, 2, 0}, {2, 0, 0}}
+	for i := range ordered {
+		for j := range ordered {
+			expected := 0
+			if i < j {
+				expected = -1
+			} else if i > j {
+				expected = 1
+			}
+			if c := ordered[i].Compare(ordered[j]); c != expected {
+				t.Fatalf("%v compared to %v is %v, expected %v", ordered[i], ordered[j], c, expected)
+			}
+		}
+	}
+
+	for data, expected := range map[string]Version{`[1, 2, 3]`: {1, 2, 3}, `[1, 16]`: {1, 16, 0}, `"1.2.3"`: {1, 2, 3}, `"1.2.0+build.5"`: {1, 2, 0}} {
+		var v Version
+		if err := json.Unmarshal([]byte(data), &v); err != nil || v != expected {
+			t.Fatalf("decoded %v to %v (%v), expected %v", data, v, err, expected)
+		}
+	}
+	for _, data := range []string{`[1, 2, 3, 4]`, `[1, -2, 3]`, `"1.2"`, `{}`, `"1.2.0-beta"`, `"1.2.0-beta+build.5"`} {
+		var v Version
+		if err := json.Unmarshal([]byte(data), &v); err == nil {
+			t.Fatalf("decoded invalid version %v to %v", data, v)
+		}
+	}
+}
+
+// validManifest returns a valid manifest with a module and a dependency.
+func validManifest() Manifest {
+	return Manifest{
+		FormatVersion: 2,
+		Header:        Header{Name: "Pack", UUID: "0f0e0d0c-0000-4000-8000-000000000001", Version: Version{1, 0, 0}},
+		Modules:       []Module{{UUID: "0f0e0d0c-0000-4000-8000-000000000002", Type: "data", Version: Version{1, 0, 0}}},
+		Dependencies:  []Dependency{{UUID: "0f0e0d0c-0000-4000-8000-000000000003", Version: Version{1, 0, 0}}},
+	}
+}
+
+// TestManifestValidate checks that Validate reports the field of the manifest that is invalid.
+func TestManifestValidate(t *testing.T) {
+	if err := validManifest().Validate(); err != nil {
+		t.Fatalf("valid manifest: %v", err)
+	}
+	for field, invalidate := range map[string]func(m *Manifest){
+		"format_version":            func(m *Manifest) { m.FormatVersion = 4 },
+		"header.name":               func(m *Manifest) { m.Header.Name = " " },
+		"header.uuid":               func(m *Manifest) { m.Header.UUID = "not-a-uuid" },
+		"header.version":            func(m *Manifest) { m.Header.Version = Version{1, -1, 0} },
+		"modules":                   func(m *Manifest) { m.Modules = nil },
+		"modules[0].uuid":           func(m *Manifest) { m.Modules[0].UUID = strings.ToUpper(m.Header.UUID) },
+		"modules[0].type":           func(m *Manifest) { m.Modules[0].Type = "behaviours" },
+		"dependencies[0]":           func(m *Manifest) { m.Dependencies[0].UUID = "" },
+		"dependencies[0].uuid":      func(m *Manifest) { m.Dependencies[0].UUID = m.Header.UUID },
+		"header.min_engine_version": func(m *Manifest) { m.Header.MinimumGameVersion = Version{-1, 0, 0} },
+	} {
+		m := validManifest()
+		invalidate(&m)
+		var manifestErr *ManifestError
+		if err := m.Validate(); !errors.As(err, &manifestErr) || manifestErr.Field != field {
+			t.Fatalf("invalid %v: got error %v, expected one for the field", field, err)
+		}
+	}
+}
+
+// TestResolvePacks orders packs by their dependencies and checks that unmet dependencies and cycles are
+// reported.
+func TestResolvePacks(t *testing.T) {
+	build := func(b *Builder) *Pack {
+		t.Helper()
+		pack, err := b.Module("resources").Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pack
+	}
+	a := build(NewBuilder("A").Version(Version{1, 2, 0}))
+	b := build(NewBuilder("B").DependOn(a))
+	c := build(NewBuilder("C").DependOn(b).Dependency(Dependency{ModuleName: "@minecraft/server", Version: Version{1, 0, 0}}))
+
+	ordered, err := ResolvePacks([]*Pack{c, a, b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ordered) != 3 || ordered[0] != a || ordered[1] != b || ordered[2] != c {
+		t.Fatalf("resolved packs to %v, expected [A B C]", ordered)
+	}
+
+	for name, packs := range map[string][]*Pack{
+		"missing dependency": {b, c},
+		"duplicate pack":     {a, a},
+		"too old dependency": {build(NewBuilder("A").Version(Version{1, 1, 9})), b},
+		"major version":      {build(NewBuilder("A").Version(Version{2, 0, 0})), b},
+		"dependency cycle": {
+			build(NewBuilder("X").Dependency(Dependency{UUID: NewBuilder("Y").Manifest().Header.UUID, Version: Version{1, 0, 0}})),
+			build(NewBuilder("Y").Dependency(Dependency{UUID: NewBuilder("X").Manifest().Header.UUID, Version: Version{1, 0, 0}})),
+		},
+	} {
+		var manifestErr *ManifestError
+		if _, err := ResolvePacks(packs); !errors.As(err, &manifestErr) {
+			t.Fatalf("%v: got error %v, expected a *ManifestError", name, err)
+		}
+	}
+	if _, err := ResolvePacks([]*Pack{build(NewBuilder("A").Version(Version{1, 3, 0})), b}); err != nil {
+		t.Fatalf("newer minor version of dependency: %v", err)
+	}
+}
+
+// TestBuilder builds a behaviour pack with a function and checks that invalid file paths are refused.
+func TestBuilder(t *testing.T) {
+	pack, err := NewBuilder("Builds").Description("Generated builds").Function("build/wall", "/fill ~ ~ ~ ~10 ~3 ~ stone", "say done").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pack.Name() != "Builds" || pack.Description() != "Generated builds" || pack.Version() != "1.0.0" {
+		t.Fatalf("built pack %v", pack)
+	}
+	if !pack.HasBehaviours() || pack.HasTextures() {
+		t.Fatalf("built pack has modules %+v, expected a single data module", pack.Modules())
+	}
+	if again := NewBuilder("Builds").Module("data").Manifest(); again.Header.UUID != pack.UUID() || again.Modules[0].UUID != pack.Modules()[0].UUID {
+		t.Fatalf("pack built again with the same name has UUIDs %v and %v, expected %v and %v", again.Header.UUID, again.Modules[0].UUID, pack.UUID(), pack.Modules()[0].UUID)
+	}
+	files, err := readArchiveFiles(packArchive(pack))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := string(files["functions/build/wall.mcfunction"]); f != "fill ~ ~ ~ ~10 ~3 ~ stone\nsay done\n" {
+		t.Fatalf("function holds %q", f)
+	}
+
+	for _, name := range []string{"../escape.txt", "/abs.txt", "manifest.json", ""} {
+		if _, err := NewBuilder("Files").Module("data").File(name, nil).Build(); err == nil {
+			t.Fatalf("built pack with file %q", name)
+		}
+	}
+	if _, err := NewBuilder("Empty").Build(); err == nil {
+		t.Fatal("built pack without modules")
+	}
+}
@@ -10,7 +10,6 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 )
 
@@ -93,7 +92,7 @@ func (pack *Pack) Description() string {
 // Version returns the string version of the resource pack. It is guaranteed to have 3 digits in it, joined
 // by a dot.
 func (pack *Pack) Version() string {
-	return strconv.Itoa(pack.manifest.Header.Version[0]) + "." + strconv.Itoa(pack.manifest.Header.Version[1]) + "." + strconv.Itoa(pack.manifest.Header.Version[2])
+	return pack.manifest.Header.Version.String()
 }
 
 // Modules returns all modules that the resource pack exists out of. Resource packs usually have only one
@@ -195,6 +194,15 @@ func (pack Pack) WithContentKey(key string) *Pack {
 	return &pack
 }
 
+// WithValidContentKey works like WithContentKey, but returns an error if the key provided is not a valid
+// content key, as checked by ValidateContentKey.
+func (pack Pack) WithValidContentKey(key string) (*Pack, error) {
+	if err := ValidateContentKey(key); err != nil {
+		return nil, err
+	}
+	return pack.WithContentKey(key), nil
+}
+
 // Manifest returns the manifest found in the manifest.json of the resource pack. It contains information
 // about the pack such as its name.
 func (pack *Pack) Manifest() Manifest {
@@ -206,6 +214,59 @@ func (pack *Pack) String() string {
 	return fmt.Sprintf("%v v%v (%v): %v", pack.Name(), pack.Version(), pack.UUID(), pack.Description())
 }
 
+// Unpack extracts the files of the pack into the directory passed, creating it if it does not yet exist. If
+// the pack has a content key, it is decrypted first. Encrypted packs of which the key is not known are
+// extracted as they are.
+func (pack *Pack) Unpack(dir string) error {
+	archive := make([]byte, pack.Len())
+	if _, err := pack.ReadAt(archive, 0); err != nil {
+		return fmt.Errorf("error reading pack content: %v", err)
+	}
+	if pack.Encrypted() {
+		decrypted, err := DecryptPack(archive, pack.ContentKey())
+		if err != nil {
+			return err
+		}
+		return decrypted.Unpack(dir)
+	}
+	r, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return fmt.Errorf("error opening zip reader: %v", err)
+	}
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range r.File {
+		p := filepath.Join(root, filepath.FromSlash(file.Name))
+		if p != root && !strings.HasPrefix(p, root+string(filepath.Separator)) {
+			return fmt.Errorf("zip file %v points outside of the pack", file.Name)
+		}
+		if file.FileInfo().IsDir() {
+			if err := os.MkdirAll(p, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+		f, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("error opening zip file %v: %v", file.Name, err)
+		}
+		data, err := ioutil.ReadAll(f)
+		_ = f.Close()
+		if err != nil {
+			return fmt.Errorf("error reading zip file %v: %v", file.Name, err)
+		}
+		if err := ioutil.WriteFile(p, data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // compile compiles the resource pack found in path, either a zip archive or a directory, and returns a
 // resource pack if successful.
 func compile(path string) (*Pack, error) {
@@ -0,0 +1,196 @@
+package resource
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"strings"
+)
+
+// ManifestError is returned when a manifest is invalid, or when the dependencies of a pack are not met by the
+// packs it is used with. It describes the field of the manifest that is invalid.
+type ManifestError struct {
+	// Pack is the UUID of the pack that the manifest belongs to, or its name if the UUID is not valid.
+	Pack string
+	// Field is the path to the invalid field in the manifest, such as "modules[1].type".
+	Field string
+	// Err is the error describing why the field is invalid.
+	Err error
+}
+
+// Error returns the pack, field and reason of the ManifestError.
+func (e *ManifestError) Error() string {
+	return fmt.Sprintf("manifest of pack %v: %v: %v", e.Pack, e.Field, e.Err)
+}
+
+// Unwrap returns the error describing why the field is invalid.
+func (e *ManifestError) Unwrap() error {
+	return e.Err
+}
+
+// moduleTypes holds the types that modules of a pack may have.
+var moduleTypes = map[string]bool{
+	"resources":      true,
+	"data":           true,
+	"client_data":    true,
+	"interface":      true,
+	"world_template": true,
+	"skin_pack":      true,
+	"script":         true,
+	"javascript":     true,
+}
+
+// Validate checks if the manifest is valid. The format version must be 1, 2 or 3, the header must have a
+// name, and the UUIDs of the header and the modules must be valid and different from each other. Every
+// module must have a known type, and every dependency must have either a valid UUID other than that of the
+// pack, or a module name. Versions may not be negative. The first problem found is returned as a
+// *ManifestError.
+func (m Manifest) Validate() error {
+	pack := m.Header.UUID
+	if _, err := uuid.Parse(pack); err != nil {
+		pack = m.Header.Name
+	}
+	fail := func(field string, format string, a ...interface{}) error {
+		return &ManifestError{Pack: pack, Field: field, Err: fmt.Errorf(format, a...)}
+	}
+
+	if m.FormatVersion < 1 || m.FormatVersion > 3 {
+		return fail("format_version", "unsupported format version %v, expected 1, 2 or 3", m.FormatVersion)
+	}
+	if strings.TrimSpace(m.Header.Name) == "" {
+		return fail("header.name", "name must not be empty")
+	}
+	if err := validateVersion(m.Header.Version); err != nil {
+		return fail("header.version", "%v", err)
+	}
+	if err := validateVersion(m.Header.MinimumGameVersion); err != nil {
+		return fail("header.min_engine_version", "%v", err)
+	}
+	// used maps the UUIDs of the header and modules to the field they were found in.
+	used := make(map[string]string, len(m.Modules)+1)
+	if err := useUUID(used, m.Header.UUID, "header.uuid"); err != nil {
+		return fail("header.uuid", "%v", err)
+	}
+	if len(m.Modules) == 0 {
+		return fail("modules", "pack must have at least one module")
+	}
+	for i, module := range m.Modules {
+		field := fmt.Sprintf("modules[%v]", i)
+		if err := useUUID(used, module.UUID, field+".uuid"); err != nil {
+			return fail(field+".uuid", "%v", err)
+		}
+		if !moduleTypes[module.Type] {
+			return fail(field+".type", "unknown module type %q", module.Type)
+		}
+		if err := validateVersion(module.Version); err != nil {
+			return fail(field+".version", "%v", err)
+		}
+	}
+	for i, dependency := range m.Dependencies {
+		field := fmt.Sprintf("dependencies[%v]", i)
+		switch {
+		case dependency.UUID == "" && dependency.ModuleName == "":
+			return fail(field, "dependency must have either a UUID or a module name")
+		case dependency.UUID != "" && dependency.ModuleName != "":
+			return fail(field, "dependency must not have both a UUID and a module name")
+		case dependency.UUID != "":
+			if _, err := uuid.Parse(dependency.UUID); err != nil {
+				return fail(field+".uuid", "invalid UUID %q", dependency.UUID)
+			}
+			if strings.EqualFold(dependency.UUID, m.Header.UUID) {
+				return fail(field+".uuid", "pack must not depend on itself")
+			}
+		}
+		if err := validateVersion(dependency.Version); err != nil {
+			return fail(field+".version", "%v", err)
+		}
+	}
+	return nil
+}
+
+// useUUID checks if the UUID passed is valid and not yet used, and marks it as used by the field passed.
+func useUUID(used map[string]string, id, field string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return fmt.Errorf("invalid UUID %q", id)
+	}
+	id = strings.ToLower(id)
+	if other, ok := used[id]; ok {
+		return fmt.Errorf("UUID %v is already used by %v", id, other)
+	}
+	used[id] = field
+	return nil
+}
+
+// validateVersion checks if none of the parts of the version passed are negative.
+func validateVersion(v Version) error {
+	for i, n := range v {
+		if n < 0 {
+			return fmt.Errorf("part %v of version %v is negative", i+1, v)
+		}
+	}
+	return nil
+}
+
+// ResolvePacks validates the manifests of the packs passed and checks if the dependencies of every pack on
+// other packs are met by the packs passed. A dependency is met by the pack with its UUID if the version of
+// that pack has the same major version as the version depended on, and is not lower than it. The UUIDs of
+// all packs and their modules must be unique.
+// The packs are returned ordered so that every pack comes after the packs it depends on, but otherwise in the
+// order passed. The first problem found is returned as a *ManifestError.
+func ResolvePacks(packs []*Pack) ([]*Pack, error) {
+	byUUID := make(map[string]*Pack, len(packs))
+	used := make(map[string]string)
+	for _, pack := range packs {
+		if err := pack.manifest.Validate(); err != nil {
+			return nil, err
+		}
+		byUUID[pack.UUID()] = pack
+		if err := useUUID(used, pack.UUID(), "pack "+pack.UUID()); err != nil {
+			return nil, &ManifestError{Pack: pack.UUID(), Field: "header.uuid", Err: err}
+		}
+		for i, module := range pack.manifest.Modules {
+			if err := useUUID(used, module.UUID, "a module of pack "+pack.UUID()); err != nil {
+				return nil, &ManifestError{Pack: pack.UUID(), Field: fmt.Sprintf("modules[%v].uuid", i), Err: err}
+			}
+		}
+	}
+
+	ordered := make([]*Pack, 0, len(packs))
+	// state is 1 for packs of which the dependencies are being visited and 2 for packs that were ordered.
+	state := make(map[*Pack]int, len(packs))
+	var visit func(pack *Pack, path []string) error
+	visit = func(pack *Pack, path []string) error {
+		switch state[pack] {
+		case 1:
+			return &ManifestError{Pack: pack.UUID(), Field: "dependencies", Err: fmt.Errorf("dependency cycle: %v", strings.Join(append(path, pack.UUID()), " -> "))}
+		case 2:
+			return nil
+		}
+		state[pack] = 1
+		for i, dependency := range pack.manifest.Dependencies {
+			if dependency.UUID == "" {
+				// Dependencies on built-in modules are met by the game.
+				continue
+			}
+			field := fmt.Sprintf("dependencies[%v]", i)
+			other, ok := byUUID[strings.ToLower(dependency.UUID)]
+			if !ok {
+				return &ManifestError{Pack: pack.UUID(), Field: field, Err: fmt.Errorf("depends on pack %v, which is not present", dependency.UUID)}
+			}
+			if v := other.manifest.Header.Version; v[0] != dependency.Version[0] || v.Compare(dependency.Version) < 0 {
+				return &ManifestError{Pack: pack.UUID(), Field: field, Err: fmt.Errorf("depends on version %v of pack %v, but version %v is present", dependency.Version, dependency.UUID, v)}
+			}
+			if err := visit(other, append(path, pack.UUID())); err != nil {
+				return err
+			}
+		}
+		state[pack] = 2
+		ordered = append(ordered, pack)
+		return nil
+	}
+	for _, pack := range packs {
+		if err := visit(pack, nil); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
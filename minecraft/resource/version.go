@@ -0,0 +1,91 @@
+package resource
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is the version of a pack, module or dependency in a manifest, or the minimum version of the game
+// that a pack was written for. In manifests it is either an array of three numbers, such as [1, 2, 3], or a
+// semantic version string, such as "1.2.3". It is always encoded as an array.
+type Version [3]int
+
+// ParseVersion parses a version in the form "major.minor.patch", such as "1.2.3".
+func ParseVersion(s string) (Version, error) {
+	var v Version
+	parts := strings.Split(s, ".")
+	if len(parts) != len(v) {
+		return v, fmt.Errorf("invalid version %q: must have %v parts, got %v", s, len(v), len(parts))
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || (len(part) > 1 && part[0] == '0') {
+			return v, fmt.Errorf("invalid version %q: part %v (%q) is not a non-negative integer", s, i+1, part)
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+// String returns the version in the form "major.minor.patch".
+func (v Version) String() string {
+	return strconv.Itoa(v[0]) + "." + strconv.Itoa(v[1]) + "." + strconv.Itoa(v[2])
+}
+
+// Compare compares the version to the version passed. It returns -1 if v is lower than o, 1 if it is higher
+// and 0 if they are equal.
+func (v Version) Compare(o Version) int {
+	for i := range v {
+		switch {
+		case v[i] < o[i]:
+			return -1
+		case v[i] > o[i]:
+			return 1
+		}
+	}
+	return 0
+}
+
+// UnmarshalJSON decodes a version from either an array of up to three numbers, of which missing numbers are
+// zero, or a semantic version string. The build metadata of semantic versions, such as the "build.5" in
+// "1.2.0+build.5", does not affect the order of versions and is ignored. Pre-release versions, such as
+// "1.2.0-beta", precede their release and cannot be held by a Version, so an error is returned for them.
+func (v *Version) UnmarshalJSON(b []byte) error {
+	if b = bytes.TrimSpace(b); len(b) != 0 && b[0] == '"' {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		version := s
+		if i := strings.IndexByte(version, '+'); i != -1 {
+			version = version[:i]
+		}
+		if i := strings.IndexByte(version, '-'); i != -1 {
+			return fmt.Errorf("invalid version %q: pre-release %q is not supported", s, version[i+1:])
+		}
+		parsed, err := ParseVersion(version)
+		if err != nil {
+			return err
+		}
+		*v = parsed
+		return nil
+	}
+	var parts []int
+	if err := json.Unmarshal(b, &parts); err != nil {
+		return fmt.Errorf("invalid version %s: must be an array of numbers or a string", b)
+	}
+	if len(parts) > len(v) {
+		return fmt.Errorf("invalid version %s: must have at most %v parts, got %v", b, len(v), len(parts))
+	}
+	*v = Version{}
+	for i, n := range parts {
+		if n < 0 {
+			return fmt.Errorf("invalid version %s: part %v is negative", b, i+1)
+		}
+		v[i] = n
+	}
+	return nil
+}
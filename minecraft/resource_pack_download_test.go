@@ -0,0 +1,70 @@
+package minecraft
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"phoenix/minecraft/protocol"
+	"phoenix/minecraft/protocol/packet"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestPackDownloadChecksum checks that a connection downloading a resource pack of which the checksum does not
+// match the one sent by the server is closed with an error, rather than waiting for the pack forever.
+func TestPackDownloadChecksum(t *testing.T) {
+	const uuid = "5f2b3e0a-0000-4000-8000-000000000001"
+	buf := bytes.NewBuffer(nil)
+	w := zip.NewWriter(buf)
+	f, _ := w.Create("manifest.json")
+	_, _ = f.Write([]byte(`{
+	"format_version": 2,
+	"header": {"name": "Pack", "description": "", "uuid": "` + uuid + `", "version": [1, 0, 0]},
+	"modules": [{"type": "resources", "uuid": "5f2b3e0a-0000-4000-8000-000000000002", "version": [1, 0, 0]}]
+}`))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	archive := buf.Bytes()
+
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		_, _ = io.Copy(ioutil.Discard, server)
+	}()
+	key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	conn := newConn(client, key, log.New(ioutil.Discard, "", 0))
+	defer conn.Close()
+
+	info := &packet.ResourcePacksInfo{TexturePacks: []protocol.TexturePackInfo{{UUID: uuid, Version: "1.0.0", Size: uint64(len(archive))}}}
+	if err := conn.handleResourcePacksInfo(info); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.handleResourcePackDataInfo(&packet.ResourcePackDataInfo{
+		UUID:          uuid + "_1.0.0",
+		DataChunkSize: uint32(len(archive)),
+		ChunkCount:    1,
+		Size:          uint64(len(archive)),
+		Hash:          make([]byte, 32),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.handleResourcePackChunkData(&packet.ResourcePackChunkData{UUID: uuid + "_1.0.0", Data: archive}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-conn.close:
+	case <-time.After(time.Second * 5):
+		t.Fatal("connection not closed after downloading a pack with a mismatched checksum")
+	}
+	if err := conn.closeErr("dial"); !strings.Contains(err.Error(), "checksum of resource pack") {
+		t.Fatalf("connection closed with %v, expected a checksum error", err)
+	}
+}
@@ -28,6 +28,8 @@ type downloadingPack struct {
 	expectedIndex uint32
 	newFrag       chan []byte
 	contentKey    string
+	// checksum is the SHA256 checksum of the pack sent by the server, which the downloaded pack must match.
+	checksum []byte
 }
 
 // Request 'requests' all resource packs passed, provided they all exist in the resourcePackQueue. If not,
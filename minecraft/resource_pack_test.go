@@ -0,0 +1,138 @@
+package minecraft_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"phoenix/minecraft"
+	"phoenix/minecraft/protocol/login"
+	"phoenix/minecraft/protocol/packet"
+	"phoenix/minecraft/resource"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+// writePack writes a resource pack with a texture to a new directory and returns its path.
+func writePack(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"manifest.json": `{
+	"format_version": 2,
+	"header": {"name": "Cached Pack", "description": "", "uuid": "5f2b3e0a-0000-4000-8000-000000000001", "version": [1, 2, 3]},
+	"modules": [{"type": "resources", "uuid": "5f2b3e0a-0000-4000-8000-000000000002", "version": [1, 2, 3]}]
+}`,
+		"textures/blocks/stone.png": "stone texture",
+	}
+	for name, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// TestPackCache joins a Listener with an encrypted resource pack using a Dialer with a pack cache, and checks
+// that the pack is only downloaded the first time, that the content key sent by the server is used and that
+// the pack may be exported decrypted from the cache.
+func TestPackCache(t *testing.T) {
+	const key = "u8bDp4xLm2NqR7sT1vW3yZ5aC9eG0hJk"
+	pack, err := resource.EncryptPack(writePack(t), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chunkRequests atomic.Int32
+	const network = "pipe-pack-cache"
+	listener := listenPipe(t, network, minecraft.ListenConfig{
+		AuthenticationDisabled: true,
+		ResourcePacks:          []*resource.Pack{pack},
+		PacketFunc: func(header packet.Header, payload []byte, src, dst net.Addr) {
+			if header.PacketID == packet.IDResourcePackChunkRequest {
+				chunkRequests.Inc()
+			}
+		},
+	})
+	cache, err := resource.OpenCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialer := minecraft.Dialer{IdentityData: login.IdentityData{DisplayName: "Tester"}, PackCache: cache}
+
+	for i := 0; i < 2; i++ {
+		client, _ := dialAccept(t, listener, network, dialer)
+		packs := client.ResourcePacks()
+		if len(packs) != 1 || packs[0].UUID() != pack.UUID() || packs[0].Checksum() != pack.Checksum() {
+			t.Fatalf("client has resource packs %v, expected %v", packs, pack)
+		}
+		if packs[0].ContentKey() != key {
+			t.Fatalf("client has content key %q, expected %q", packs[0].ContentKey(), key)
+		}
+		if n := chunkRequests.Load(); n != 1 {
+			t.Fatalf("%v chunks requested after joining %v times, expected 1", n, i+1)
+		}
+	}
+
+	dir := t.TempDir()
+	if err := cache.Export(dir); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, pack.UUID()+"_1.2.3", "textures", "blocks", "stone.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "stone texture" {
+		t.Fatalf("exported texture holds %q, expected it decrypted", data)
+	}
+
+	// The content key sent by the server is used even if the cached pack was stored without it.
+	cached, err := cache.Load(pack.UUID(), pack.Version())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Store(cached.WithContentKey("")); err != nil {
+		t.Fatal(err)
+	}
+	client, _ := dialAccept(t, listener, network, dialer)
+	if packs := client.ResourcePacks(); len(packs) != 1 || packs[0].ContentKey() != key {
+		t.Fatalf("client has resource packs %v loaded from the cache, expected %v with content key %q", packs, pack, key)
+	}
+}
+
+// TestPackInvalidContentKey checks that a Dialer refuses to join a server that sends a resource pack with a
+// malformed content key.
+func TestPackInvalidContentKey(t *testing.T) {
+	pack, err := resource.Compile(writePack(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const network = "pipe-pack-invalid-key"
+	listener := listenPipe(t, network, minecraft.ListenConfig{
+		AuthenticationDisabled: true,
+		ResourcePacks:          []*resource.Pack{pack.WithContentKey("not a content key")},
+	})
+	go func() {
+		if c, err := listener.Accept(); err == nil {
+			_ = c.Close()
+		}
+	}()
+	// The error closing the connection is logged before the connection is closed and Dial returns.
+	buf := bytes.NewBuffer(nil)
+	dialer := minecraft.Dialer{IdentityData: login.IdentityData{DisplayName: "Tester"}, ErrorLog: log.New(buf, "", 0)}
+	if conn, err := dialer.DialTimeout(network, pipeAddress, time.Second*5); err == nil {
+		_ = conn.Close()
+		t.Fatal("dial succeeded with a resource pack with an invalid content key")
+	}
+	if !strings.Contains(buf.String(), "invalid content key") {
+		t.Fatalf("dial failed with log %q, expected an invalid content key error", buf)
+	}
+}
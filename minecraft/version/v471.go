@@ -0,0 +1,79 @@
+package version
+
+import (
+	"bytes"
+	"phoenix/minecraft"
+	"phoenix/minecraft/protocol"
+	"phoenix/minecraft/protocol/packet"
+)
+
+// Protocol471 implements minecraft.Protocol for Minecraft 1.17.40. Compared to 1.18.0, the StartGame packet
+// does not end with a block state checksum, and sub chunks cannot be requested separately: SubChunk and
+// SubChunkRequest packets do not exist, so these are never sent over a connection of this protocol. Other
+// packets, including PlayerAuthInput and ItemStackRequest, are encoded as in 1.18.0 and are not translated.
+type Protocol471 struct{}
+
+// ID ...
+func (Protocol471) ID() int32 { return 471 }
+
+// Ver ...
+func (Protocol471) Ver() string { return "1.17.40" }
+
+// Packets ...
+func (Protocol471) Packets() packet.Pool {
+	pool := packet.NewPool()
+	pool[packet.IDStartGame] = func() packet.Packet { return &StartGame471{} }
+	delete(pool, packet.IDSubChunk)
+	delete(pool, packet.IDSubChunkRequest)
+	return pool
+}
+
+// ConvertToLatest converts a StartGame471 packet to a packet.StartGame with an empty block state checksum.
+func (Protocol471) ConvertToLatest(pk packet.Packet, _ *minecraft.Conn) []packet.Packet {
+	if pk, ok := pk.(*StartGame471); ok {
+		return []packet.Packet{&pk.StartGame}
+	}
+	return []packet.Packet{pk}
+}
+
+// ConvertFromLatest converts a packet.StartGame to a StartGame471 packet and drops SubChunk and
+// SubChunkRequest packets.
+func (Protocol471) ConvertFromLatest(pk packet.Packet, _ *minecraft.Conn) []packet.Packet {
+	switch pk := pk.(type) {
+	case *packet.StartGame:
+		return []packet.Packet{&StartGame471{StartGame: *pk}}
+	case *packet.SubChunk, *packet.SubChunkRequest:
+		return nil
+	}
+	return []packet.Packet{pk}
+}
+
+// StartGame471 is the StartGame packet of protocol 471. It is equal to packet.StartGame, except that it does
+// not have the ServerBlockStateChecksum field, which was added to the end of the packet in 1.18.0. The field
+// is left empty when reading and is not written.
+type StartGame471 struct {
+	packet.StartGame
+}
+
+// blockStateChecksumSize is the size of the ServerBlockStateChecksum field in bytes.
+const blockStateChecksumSize = 8
+
+// Marshal ...
+func (pk *StartGame471) Marshal(w *protocol.Writer) {
+	// The StartGame packet holds no item instances, so the shield ID is not needed to encode it.
+	buf := bytes.NewBuffer(nil)
+	pk.StartGame.Marshal(protocol.NewWriter(buf, 0))
+	b := buf.Bytes()[:buf.Len()-blockStateChecksumSize]
+	w.Bytes(&b)
+}
+
+// Unmarshal ...
+func (pk *StartGame471) Unmarshal(r *protocol.Reader) {
+	var b []byte
+	r.Bytes(&b)
+	buf := bytes.NewBuffer(append(b, make([]byte, blockStateChecksumSize)...))
+	pk.StartGame.Unmarshal(protocol.NewReader(buf, 0))
+	if buf.Len() != 0 {
+		r.InvalidValue(buf.Len(), "StartGame", "unread bytes left")
+	}
+}
@@ -0,0 +1,542 @@
+package version
+
+import (
+	"fmt"
+	"math"
+	"phoenix/minecraft"
+	"phoenix/minecraft/protocol"
+	"phoenix/minecraft/protocol/packet"
+)
+
+// Protocol486 implements minecraft.Protocol for Minecraft 1.18.10. Compared to 1.18.0, sub chunks are
+// requested and sent in batches: A single SubChunkRequest may request multiple sub chunks around a position,
+// which are all sent back in a single SubChunk packet. LevelChunk packets may limit the sub chunks requested
+// by the client, and item stack requests that auto craft a recipe, sent in ItemStackRequest and
+// PlayerAuthInput packets, list the ingredients used.
+type Protocol486 struct{}
+
+// ID ...
+func (Protocol486) ID() int32 { return 486 }
+
+// Ver ...
+func (Protocol486) Ver() string { return "1.18.10" }
+
+// Packets ...
+func (Protocol486) Packets() packet.Pool {
+	pool := packet.NewPool()
+	pool[packet.IDSubChunk] = func() packet.Packet { return &SubChunk486{} }
+	pool[packet.IDSubChunkRequest] = func() packet.Packet { return &SubChunkRequest486{} }
+	pool[packet.IDLevelChunk] = func() packet.Packet { return &LevelChunk486{} }
+	pool[packet.IDItemStackRequest] = func() packet.Packet { return &ItemStackRequest486{} }
+	pool[packet.IDPlayerAuthInput] = func() packet.Packet { return &PlayerAuthInput486{} }
+	return pool
+}
+
+// ConvertToLatest splits batched SubChunk and SubChunkRequest packets into one packet per sub chunk. A
+// LevelChunk limiting the sub chunks requested has the client request sub chunks without limit, and the
+// ingredients of auto crafting actions are dropped.
+func (Protocol486) ConvertToLatest(pk packet.Packet, _ *minecraft.Conn) []packet.Packet {
+	switch pk := pk.(type) {
+	case *LevelChunk486:
+		if pk.SubChunkCount == SubChunkRequestModeLimited {
+			pk.SubChunkCount = SubChunkRequestModeUnlimited
+		}
+		return []packet.Packet{&pk.LevelChunk}
+	case *ItemStackRequest486:
+		for i := range pk.Requests {
+			actionsToLatest(pk.Requests[i].Actions)
+		}
+		return []packet.Packet{&pk.ItemStackRequest}
+	case *PlayerAuthInput486:
+		actionsToLatest(pk.ItemStackRequest.Actions)
+		return []packet.Packet{&pk.PlayerAuthInput}
+	case *SubChunk486:
+		pks := make([]packet.Packet, 0, len(pk.Entries))
+		for _, entry := range pk.Entries {
+			x, y, z := pk.Position.Add(entry.Offset)
+			pks = append(pks, &packet.SubChunk{
+				Dimension:     pk.Dimension,
+				SubChunkX:     x,
+				SubChunkY:     y,
+				SubChunkZ:     z,
+				Data:          entry.RawPayload,
+				RequestResult: int32(entry.Result),
+				HeightMapType: entry.HeightMapType,
+				HeightMapData: entry.HeightMapData,
+				CacheEnabled:  pk.CacheEnabled,
+				BlobHash:      entry.BlobHash,
+			})
+		}
+		return pks
+	case *SubChunkRequest486:
+		pks := make([]packet.Packet, 0, len(pk.Offsets))
+		for _, offset := range pk.Offsets {
+			x, y, z := pk.Position.Add(offset)
+			pks = append(pks, &packet.SubChunkRequest{Dimension: pk.Dimension, SubChunkX: x, SubChunkY: y, SubChunkZ: z})
+		}
+		return pks
+	}
+	return []packet.Packet{pk}
+}
+
+// ConvertFromLatest turns SubChunk and SubChunkRequest packets into batches holding a single sub chunk. Auto
+// crafting actions are sent without ingredients, which the latest protocol does not have.
+func (Protocol486) ConvertFromLatest(pk packet.Packet, _ *minecraft.Conn) []packet.Packet {
+	switch pk := pk.(type) {
+	case *packet.LevelChunk:
+		return []packet.Packet{&LevelChunk486{LevelChunk: *pk}}
+	case *packet.ItemStackRequest:
+		converted := &ItemStackRequest486{ItemStackRequest: *pk}
+		converted.Requests = make([]protocol.ItemStackRequest, len(pk.Requests))
+		for i, req := range pk.Requests {
+			req.Actions = actionsFromLatest(req.Actions)
+			converted.Requests[i] = req
+		}
+		return []packet.Packet{converted}
+	case *packet.PlayerAuthInput:
+		converted := &PlayerAuthInput486{PlayerAuthInput: *pk}
+		converted.ItemStackRequest.Actions = actionsFromLatest(pk.ItemStackRequest.Actions)
+		return []packet.Packet{converted}
+	case *packet.SubChunk:
+		return []packet.Packet{&SubChunk486{
+			CacheEnabled: pk.CacheEnabled,
+			Dimension:    pk.Dimension,
+			Position:     SubChunkPos{pk.SubChunkX, pk.SubChunkY, pk.SubChunkZ},
+			Entries: []SubChunkEntry{{
+				Result:        byte(pk.RequestResult),
+				RawPayload:    pk.Data,
+				HeightMapType: pk.HeightMapType,
+				HeightMapData: pk.HeightMapData,
+				BlobHash:      pk.BlobHash,
+			}},
+		}}
+	case *packet.SubChunkRequest:
+		return []packet.Packet{&SubChunkRequest486{
+			Dimension: pk.Dimension,
+			Position:  SubChunkPos{pk.SubChunkX, pk.SubChunkY, pk.SubChunkZ},
+			Offsets:   []SubChunkOffset{{}},
+		}}
+	}
+	return []packet.Packet{pk}
+}
+
+// SubChunkResultSuccessAllAir is a result of a SubChunkEntry that is new in 1.18.10. It indicates that the
+// sub chunk was found, but consists only of air, so that no payload is sent for it if the blob cache is
+// enabled. It is passed on as the RequestResult of a packet.SubChunk as it is.
+const SubChunkResultSuccessAllAir = 6
+
+// SubChunkPos is the position of a sub chunk in sub chunk coordinates.
+type SubChunkPos [3]int32
+
+// Add returns the coordinates of the sub chunk at the offset passed from the position.
+func (pos SubChunkPos) Add(offset SubChunkOffset) (x, y, z int32) {
+	return pos[0] + int32(offset[0]), pos[1] + int32(offset[1]), pos[2] + int32(offset[2])
+}
+
+// SubChunkOffset is the offset of a sub chunk relative to a SubChunkPos.
+type SubChunkOffset [3]int8
+
+// SubChunkEntry holds the data of a single sub chunk in a SubChunk486 packet.
+type SubChunkEntry struct {
+	// Offset is the offset of the sub chunk relative to the Position of the SubChunk486 packet.
+	Offset SubChunkOffset
+	// Result is the result of the request for the sub chunk. It is one of the packet.SubChunkRequestResult
+	// constants or SubChunkResultSuccessAllAir.
+	Result byte
+	// RawPayload is the sub chunk data, such as the blocks. It is not sent if the blob cache is enabled and
+	// Result is SubChunkResultSuccessAllAir.
+	RawPayload []byte
+	// HeightMapType is one of the packet.HeightMapDataType constants.
+	HeightMapType byte
+	// HeightMapData is the data for the height map. It holds 256 values if HeightMapType is
+	// packet.HeightMapDataTypeHasData.
+	HeightMapData []byte
+	// BlobHash is the hash of the blob. It is only sent if the blob cache is enabled.
+	BlobHash uint64
+}
+
+// SubChunk486 is the SubChunk packet of protocol 486. It sends a batch of sub chunks around a position.
+type SubChunk486 struct {
+	// CacheEnabled is whether the sub chunk caching is enabled or not.
+	CacheEnabled bool
+	// Dimension is the dimension of the sub chunks.
+	Dimension int32
+	// Position is the position that the offsets of the entries are relative to.
+	Position SubChunkPos
+	// Entries holds the sub chunks sent.
+	Entries []SubChunkEntry
+}
+
+// ID ...
+func (*SubChunk486) ID() uint32 {
+	return packet.IDSubChunk
+}
+
+// Marshal ...
+func (pk *SubChunk486) Marshal(w *protocol.Writer) {
+	w.Bool(&pk.CacheEnabled)
+	w.Varint32(&pk.Dimension)
+	subChunkPos(w, &pk.Position)
+	l := uint32(len(pk.Entries))
+	w.Uint32(&l)
+	for i := range pk.Entries {
+		subChunkEntry(w, &pk.Entries[i], pk.CacheEnabled)
+	}
+}
+
+// Unmarshal ...
+func (pk *SubChunk486) Unmarshal(r *protocol.Reader) {
+	var count uint32
+	r.Bool(&pk.CacheEnabled)
+	r.Varint32(&pk.Dimension)
+	subChunkPos(r, &pk.Position)
+	r.Uint32(&count)
+	r.LimitLength(count)
+	pk.Entries = make([]SubChunkEntry, count)
+	for i := range pk.Entries {
+		subChunkEntry(r, &pk.Entries[i], pk.CacheEnabled)
+	}
+}
+
+// SubChunkRequest486 is the SubChunkRequest packet of protocol 486. It requests a batch of sub chunks at
+// offsets of a position.
+type SubChunkRequest486 struct {
+	// Dimension is the dimension of the sub chunks.
+	Dimension int32
+	// Position is the position that the offsets are relative to.
+	Position SubChunkPos
+	// Offsets holds the offsets of all sub chunks requested.
+	Offsets []SubChunkOffset
+}
+
+// ID ...
+func (*SubChunkRequest486) ID() uint32 {
+	return packet.IDSubChunkRequest
+}
+
+// Marshal ...
+func (pk *SubChunkRequest486) Marshal(w *protocol.Writer) {
+	w.Varint32(&pk.Dimension)
+	subChunkPos(w, &pk.Position)
+	l := uint32(len(pk.Offsets))
+	w.Uint32(&l)
+	for i := range pk.Offsets {
+		subChunkOffset(w, &pk.Offsets[i])
+	}
+}
+
+// Unmarshal ...
+func (pk *SubChunkRequest486) Unmarshal(r *protocol.Reader) {
+	var count uint32
+	r.Varint32(&pk.Dimension)
+	subChunkPos(r, &pk.Position)
+	r.Uint32(&count)
+	r.LimitLength(count)
+	pk.Offsets = make([]SubChunkOffset, count)
+	for i := range pk.Offsets {
+		subChunkOffset(r, &pk.Offsets[i])
+	}
+}
+
+// subChunkPos reads/writes a SubChunkPos x using IO r.
+func subChunkPos(r protocol.IO, x *SubChunkPos) {
+	r.Varint32(&x[0])
+	r.Varint32(&x[1])
+	r.Varint32(&x[2])
+}
+
+// subChunkOffset reads/writes a SubChunkOffset x using IO r.
+func subChunkOffset(r protocol.IO, x *SubChunkOffset) {
+	for i := range x {
+		v := uint8(x[i])
+		r.Uint8(&v)
+		x[i] = int8(v)
+	}
+}
+
+// subChunkEntry reads/writes a SubChunkEntry x using IO r. The fields sent depend on whether the blob cache
+// is enabled.
+func subChunkEntry(r protocol.IO, x *SubChunkEntry, cacheEnabled bool) {
+	subChunkOffset(r, &x.Offset)
+	r.Uint8(&x.Result)
+	if !cacheEnabled || x.Result != SubChunkResultSuccessAllAir {
+		r.ByteSlice(&x.RawPayload)
+	}
+	r.Uint8(&x.HeightMapType)
+	if x.HeightMapType == packet.HeightMapDataTypeHasData {
+		if len(x.HeightMapData) != 256 {
+			x.HeightMapData = make([]byte, 256)
+		}
+		for i := range x.HeightMapData {
+			r.Uint8(&x.HeightMapData[i])
+		}
+	}
+	if cacheEnabled {
+		r.Uint64(&x.BlobHash)
+	}
+}
+
+const (
+	// SubChunkRequestModeUnlimited is the SubChunkCount of a LevelChunk packet without sub chunks, of which
+	// the client requests all sub chunks using SubChunkRequest packets.
+	SubChunkRequestModeUnlimited = math.MaxUint32
+	// SubChunkRequestModeLimited is a SubChunkCount of a LevelChunk486 packet that is new in 1.18.10. Like
+	// SubChunkRequestModeUnlimited, the client requests the sub chunks of the chunk, but only up to the
+	// HighestSubChunk of the packet.
+	SubChunkRequestModeLimited = math.MaxUint32 - 1
+)
+
+// LevelChunk486 is the LevelChunk packet of protocol 486. It is equal to packet.LevelChunk, except that the
+// HighestSubChunk field follows the SubChunkCount if it is SubChunkRequestModeLimited.
+type LevelChunk486 struct {
+	packet.LevelChunk
+	// HighestSubChunk is the highest sub chunk the client requests if SubChunkCount is
+	// SubChunkRequestModeLimited. It is not sent otherwise.
+	HighestSubChunk uint16
+}
+
+// Marshal ...
+func (pk *LevelChunk486) Marshal(w *protocol.Writer) {
+	w.Varint32(&pk.ChunkX)
+	w.Varint32(&pk.ChunkZ)
+	w.Varuint32(&pk.SubChunkCount)
+	if pk.SubChunkCount == SubChunkRequestModeLimited {
+		w.Uint16(&pk.HighestSubChunk)
+	}
+	w.Bool(&pk.CacheEnabled)
+	if pk.CacheEnabled {
+		l := uint32(len(pk.BlobHashes))
+		w.Varuint32(&l)
+		for _, hash := range pk.BlobHashes {
+			w.Uint64(&hash)
+		}
+	}
+	w.ByteSlice(&pk.RawPayload)
+}
+
+// Unmarshal ...
+func (pk *LevelChunk486) Unmarshal(r *protocol.Reader) {
+	r.Varint32(&pk.ChunkX)
+	r.Varint32(&pk.ChunkZ)
+	r.Varuint32(&pk.SubChunkCount)
+	if pk.SubChunkCount == SubChunkRequestModeLimited {
+		r.Uint16(&pk.HighestSubChunk)
+	}
+	r.Bool(&pk.CacheEnabled)
+	if pk.CacheEnabled {
+		var count uint32
+		r.Varuint32(&count)
+		r.LimitLength(count)
+		pk.BlobHashes = make([]uint64, count)
+		for i := uint32(0); i < count; i++ {
+			r.Uint64(&pk.BlobHashes[i])
+		}
+	}
+	r.ByteSlice(&pk.RawPayload)
+}
+
+// AutoCraftRecipeStackRequestAction486 is the protocol.AutoCraftRecipeStackRequestAction of protocol 486,
+// which additionally lists the ingredients used to craft the recipe.
+type AutoCraftRecipeStackRequestAction486 struct {
+	protocol.AutoCraftRecipeStackRequestAction
+	// Ingredients holds the items used to craft the recipe.
+	Ingredients []protocol.RecipeIngredientItem
+}
+
+// Marshal ...
+func (a *AutoCraftRecipeStackRequestAction486) Marshal(w *protocol.Writer) {
+	a.AutoCraftRecipeStackRequestAction.Marshal(w)
+	l := uint8(len(a.Ingredients))
+	w.Uint8(&l)
+	for i := range a.Ingredients {
+		protocol.RecipeIngredient(w, &a.Ingredients[i])
+	}
+}
+
+// Unmarshal ...
+func (a *AutoCraftRecipeStackRequestAction486) Unmarshal(r *protocol.Reader) {
+	a.AutoCraftRecipeStackRequestAction.Unmarshal(r)
+	var count uint8
+	r.Uint8(&count)
+	a.Ingredients = make([]protocol.RecipeIngredientItem, count)
+	for i := range a.Ingredients {
+		protocol.RecipeIngredient(r, &a.Ingredients[i])
+	}
+}
+
+// ItemStackRequest486 is the ItemStackRequest packet of protocol 486. It is equal to packet.ItemStackRequest,
+// except that auto crafting actions are AutoCraftRecipeStackRequestAction486 actions.
+type ItemStackRequest486 struct {
+	packet.ItemStackRequest
+}
+
+// Marshal ...
+func (pk *ItemStackRequest486) Marshal(w *protocol.Writer) {
+	l := uint32(len(pk.Requests))
+	w.Varuint32(&l)
+	for i := range pk.Requests {
+		writeStackRequest486(w, &pk.Requests[i])
+	}
+}
+
+// Unmarshal ...
+func (pk *ItemStackRequest486) Unmarshal(r *protocol.Reader) {
+	var count uint32
+	r.Varuint32(&count)
+	r.LimitUint32(count, 64)
+	pk.Requests = make([]protocol.ItemStackRequest, count)
+	for i := range pk.Requests {
+		stackRequest486(r, &pk.Requests[i])
+	}
+}
+
+// PlayerAuthInput486 is the PlayerAuthInput packet of protocol 486. It is equal to packet.PlayerAuthInput,
+// except that auto crafting actions in the ItemStackRequest are AutoCraftRecipeStackRequestAction486
+// actions.
+type PlayerAuthInput486 struct {
+	packet.PlayerAuthInput
+}
+
+// Marshal ...
+func (pk *PlayerAuthInput486) Marshal(w *protocol.Writer) {
+	w.Float32(&pk.Pitch)
+	w.Float32(&pk.Yaw)
+	w.Vec3(&pk.Position)
+	w.Vec2(&pk.MoveVector)
+	w.Float32(&pk.HeadYaw)
+	w.Varuint64(&pk.InputData)
+	w.Varuint32(&pk.InputMode)
+	w.Varuint32(&pk.PlayMode)
+	if pk.PlayMode == packet.PlayModeReality {
+		w.Vec3(&pk.GazeDirection)
+	}
+	w.Varuint64(&pk.Tick)
+	w.Vec3(&pk.Delta)
+	if pk.InputData&packet.InputFlagPerformItemInteraction != 0 {
+		w.PlayerInventoryAction(&pk.ItemInteractionData)
+	}
+	if pk.InputData&packet.InputFlagPerformItemStackRequest != 0 {
+		writeStackRequest486(w, &pk.ItemStackRequest)
+	}
+	if pk.InputData&packet.InputFlagPerformBlockActions != 0 {
+		l := int32(len(pk.BlockActions))
+		w.Varint32(&l)
+		for i := range pk.BlockActions {
+			protocol.BlockAction(w, &pk.BlockActions[i])
+		}
+	}
+}
+
+// Unmarshal ...
+func (pk *PlayerAuthInput486) Unmarshal(r *protocol.Reader) {
+	r.Float32(&pk.Pitch)
+	r.Float32(&pk.Yaw)
+	r.Vec3(&pk.Position)
+	r.Vec2(&pk.MoveVector)
+	r.Float32(&pk.HeadYaw)
+	r.Varuint64(&pk.InputData)
+	r.Varuint32(&pk.InputMode)
+	r.Varuint32(&pk.PlayMode)
+	if pk.PlayMode == packet.PlayModeReality {
+		r.Vec3(&pk.GazeDirection)
+	}
+	r.Varuint64(&pk.Tick)
+	r.Vec3(&pk.Delta)
+	if pk.InputData&packet.InputFlagPerformItemInteraction != 0 {
+		r.PlayerInventoryAction(&pk.ItemInteractionData)
+	}
+	if pk.InputData&packet.InputFlagPerformItemStackRequest != 0 {
+		stackRequest486(r, &pk.ItemStackRequest)
+	}
+	if pk.InputData&packet.InputFlagPerformBlockActions != 0 {
+		var l int32
+		r.Varint32(&l)
+		r.LimitInt32(l, 0, math.MaxInt32)
+		r.LimitLength(uint32(l))
+		pk.BlockActions = make([]protocol.PlayerBlockAction, l)
+		for i := range pk.BlockActions {
+			protocol.BlockAction(r, &pk.BlockActions[i])
+		}
+	}
+}
+
+// writeStackRequest486 writes an ItemStackRequest x as sent in protocol 486 to Writer w. Its auto crafting
+// actions must be AutoCraftRecipeStackRequestAction486 actions.
+func writeStackRequest486(w *protocol.Writer, x *protocol.ItemStackRequest) {
+	l := uint32(len(x.Actions))
+	w.Varint32(&x.RequestID)
+	w.Varuint32(&l)
+	for _, action := range x.Actions {
+		id, ok := protocol.StackRequestActionID(action)
+		if _, auto := action.(*AutoCraftRecipeStackRequestAction486); auto {
+			id, ok = protocol.StackRequestActionCraftRecipeAuto, true
+		} else if id == protocol.StackRequestActionCraftRecipeAuto {
+			ok = false
+		}
+		if !ok {
+			w.UnknownEnumOption(fmt.Sprintf("%T", action), "stack request action type")
+		}
+		w.Uint8(&id)
+		action.Marshal(w)
+	}
+	l = uint32(len(x.CustomNames))
+	w.Varuint32(&l)
+	for i := range x.CustomNames {
+		w.String(&x.CustomNames[i])
+	}
+}
+
+// stackRequest486 reads an ItemStackRequest x as sent in protocol 486 from Reader r.
+func stackRequest486(r *protocol.Reader, x *protocol.ItemStackRequest) {
+	var count uint32
+	r.Varint32(&x.RequestID)
+	r.Varuint32(&count)
+	r.LimitUint32(count, 256)
+	x.Actions = make([]protocol.StackRequestAction, count)
+	for i := range x.Actions {
+		var id uint8
+		r.Uint8(&id)
+		action, ok := protocol.NewStackRequestAction(id)
+		if !ok {
+			r.UnknownEnumOption(id, "stack request action type")
+			return
+		}
+		if id == protocol.StackRequestActionCraftRecipeAuto {
+			action = &AutoCraftRecipeStackRequestAction486{}
+		}
+		action.Unmarshal(r)
+		x.Actions[i] = action
+	}
+	r.Varuint32(&count)
+	r.LimitUint32(count, 64)
+	x.CustomNames = make([]string, count)
+	for i := range x.CustomNames {
+		r.String(&x.CustomNames[i])
+	}
+}
+
+// actionsToLatest replaces the AutoCraftRecipeStackRequestAction486 actions of the slice passed with the
+// protocol.AutoCraftRecipeStackRequestAction they hold.
+func actionsToLatest(actions []protocol.StackRequestAction) {
+	for i, action := range actions {
+		if auto, ok := action.(*AutoCraftRecipeStackRequestAction486); ok {
+			actions[i] = &auto.AutoCraftRecipeStackRequestAction
+		}
+	}
+}
+
+// actionsFromLatest returns a copy of the actions passed, with protocol.AutoCraftRecipeStackRequestAction
+// actions replaced by AutoCraftRecipeStackRequestAction486 actions without ingredients.
+func actionsFromLatest(actions []protocol.StackRequestAction) []protocol.StackRequestAction {
+	if actions == nil {
+		return nil
+	}
+	converted := make([]protocol.StackRequestAction, len(actions))
+	for i, action := range actions {
+		if auto, ok := action.(*protocol.AutoCraftRecipeStackRequestAction); ok {
+			action = &AutoCraftRecipeStackRequestAction486{AutoCraftRecipeStackRequestAction: *auto}
+		}
+		converted[i] = action
+	}
+	return converted
+}
@@ -0,0 +1,26 @@
+// Package version implements minecraft.Protocol for versions of Minecraft other than the latest one supported
+// by the packet package, so that connections may be made to servers running, and accepted from clients
+// running, those versions.
+//
+// Each Protocol holds the packet ID table of its version and translates, field by field, the packets that
+// differ from those in the packet package. Packets that are not translated are exchanged as they are:
+//
+//	Protocol486 (1.18.10): SubChunk and SubChunkRequest, which are batched in this version, LevelChunk,
+//	                       which may limit the sub chunks requested, and ItemStackRequest and
+//	                       PlayerAuthInput, of which auto crafting actions list their ingredients.
+//	Protocol471 (1.17.40): StartGame, which lacks the block state checksum, and SubChunk and
+//	                       SubChunkRequest, which do not exist in this version. PlayerAuthInput and
+//	                       ItemStackRequest are encoded as in 1.18.0.
+//
+// A Protocol is passed to minecraft.Dialer.Protocols to allow a Dialer to negotiate it with a server, or to
+// minecraft.ListenConfig.AcceptedProtocols to allow clients of its version to join a Listener.
+package version
+
+import (
+	"phoenix/minecraft"
+)
+
+// All returns all protocols implemented in this package, ordered from newest to oldest.
+func All() []minecraft.Protocol {
+	return []minecraft.Protocol{Protocol486{}, Protocol471{}}
+}
@@ -0,0 +1,434 @@
+package version
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/go-gl/mathgl/mgl32"
+	"phoenix/minecraft"
+	"phoenix/minecraft/protocol"
+	"phoenix/minecraft/protocol/packet"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pipeAddress is the address Listeners in tests listen on.
+const pipeAddress = "127.0.0.1:19132"
+
+// pongNetwork is a minecraft.Network that answers pings with a pong advertising a specific protocol, so that
+// a Dialer negotiates that protocol regardless of the protocol of the Listener.
+type pongNetwork struct {
+	minecraft.Network
+	proto minecraft.Protocol
+}
+
+// PingContext ...
+func (n pongNetwork) PingContext(context.Context, string) ([]byte, error) {
+	return []byte(fmt.Sprintf("MCPE;Test Server;%v;%v;0;1;", n.proto.ID(), n.proto.Ver())), nil
+}
+
+// marshal encodes the packet passed and returns its payload.
+func marshal(pk packet.Packet) []byte {
+	buf := bytes.NewBuffer(nil)
+	pk.Marshal(protocol.NewWriter(buf, 0))
+	return buf.Bytes()
+}
+
+// unmarshal decodes the payload passed into the packet passed and fails the test if it could not be decoded
+// completely.
+func unmarshal(t *testing.T, pk packet.Packet, b []byte) {
+	t.Helper()
+	buf := bytes.NewBuffer(b)
+	func() {
+		defer func() {
+			if err := recover(); err != nil {
+				t.Fatalf("decode %T: %v", pk, err)
+			}
+		}()
+		pk.Unmarshal(protocol.NewReader(buf, 0))
+	}()
+	if buf.Len() != 0 {
+		t.Fatalf("decode %T: %v unread bytes left", pk, buf.Len())
+	}
+}
+
+// TestSubChunk486 checks that batched sub chunks survive encoding, and that they are split into and built
+// from packets of the latest protocol correctly.
+func TestSubChunk486(t *testing.T) {
+	heightMap := make([]byte, 256)
+	heightMap[3] = 7
+	for _, cacheEnabled := range []bool{false, true} {
+		pk := &SubChunk486{
+			CacheEnabled: cacheEnabled,
+			Dimension:    1,
+			Position:     SubChunkPos{10, 4, -3},
+			Entries: []SubChunkEntry{
+				{Offset: SubChunkOffset{0, 0, 0}, Result: byte(packet.SubChunkRequestResultSuccess), RawPayload: []byte{9, 1}, HeightMapType: packet.HeightMapDataTypeHasData, HeightMapData: heightMap},
+				{Offset: SubChunkOffset{-1, 2, 1}, Result: byte(packet.SubChunkRequestResultChunkNotFound), RawPayload: []byte{}, HeightMapType: packet.HeightMapDataTypeTooLow},
+			},
+		}
+		if cacheEnabled {
+			pk.Entries[0].BlobHash, pk.Entries[1].BlobHash = 1, 2
+			pk.Entries = append(pk.Entries, SubChunkEntry{Offset: SubChunkOffset{0, 1, 0}, Result: SubChunkResultSuccessAllAir, BlobHash: 3})
+		}
+		decoded := &SubChunk486{}
+		unmarshal(t, decoded, marshal(pk))
+		if !reflect.DeepEqual(decoded, pk) {
+			t.Fatalf("cache %v: decoded %+v, expected %+v", cacheEnabled, decoded, pk)
+		}
+
+		pks := Protocol486{}.ConvertToLatest(pk, nil)
+		if len(pks) != len(pk.Entries) {
+			t.Fatalf("cache %v: got %v sub chunks, expected %v", cacheEnabled, len(pks), len(pk.Entries))
+		}
+		second := pks[1].(*packet.SubChunk)
+		if second.SubChunkX != 9 || second.SubChunkY != 6 || second.SubChunkZ != -2 || second.Dimension != 1 || second.CacheEnabled != cacheEnabled {
+			t.Fatalf("cache %v: got sub chunk %+v", cacheEnabled, second)
+		}
+		for i, converted := range pks {
+			back := Protocol486{}.ConvertFromLatest(converted, nil)[0].(*SubChunk486)
+			x, y, z := back.Position.Add(back.Entries[0].Offset)
+			ex, ey, ez := pk.Position.Add(pk.Entries[i].Offset)
+			if x != ex || y != ey || z != ez || !bytes.Equal(back.Entries[0].RawPayload, pk.Entries[i].RawPayload) || back.Entries[0].BlobHash != pk.Entries[i].BlobHash {
+				t.Fatalf("cache %v: sub chunk %v converted back to %+v", cacheEnabled, i, back)
+			}
+		}
+	}
+}
+
+// TestSubChunkRequest486 checks that batched sub chunk requests survive encoding and are split into a request
+// per offset.
+func TestSubChunkRequest486(t *testing.T) {
+	pk := &SubChunkRequest486{Dimension: 2, Position: SubChunkPos{-5, 0, 5}, Offsets: []SubChunkOffset{{0, 0, 0}, {1, -1, 127}}}
+	decoded := &SubChunkRequest486{}
+	unmarshal(t, decoded, marshal(pk))
+	if !reflect.DeepEqual(decoded, pk) {
+		t.Fatalf("decoded %+v, expected %+v", decoded, pk)
+	}
+	pks := Protocol486{}.ConvertToLatest(pk, nil)
+	expected := []packet.Packet{
+		&packet.SubChunkRequest{Dimension: 2, SubChunkX: -5, SubChunkY: 0, SubChunkZ: 5},
+		&packet.SubChunkRequest{Dimension: 2, SubChunkX: -4, SubChunkY: -1, SubChunkZ: 132},
+	}
+	if !reflect.DeepEqual(pks, expected) {
+		t.Fatalf("converted to %+v, expected %+v", pks, expected)
+	}
+}
+
+// TestStartGame471 checks that a StartGame471 packet is encoded as a packet.StartGame without its trailing
+// block state checksum.
+func TestStartGame471(t *testing.T) {
+	pk := packet.StartGame{
+		EntityUniqueID:  1,
+		EntityRuntimeID: 1,
+		PlayerPosition:  mgl32.Vec3{1, 2, 3},
+		WorldName:       "World",
+		GameVersion:     "1.17.40",
+		GameRules:       []protocol.GameRule{},
+		Blocks:          []protocol.BlockEntry{},
+		Items:           []protocol.ItemEntry{},
+	}
+	native := marshal(&pk)
+	old := marshal(&StartGame471{StartGame: pk})
+	if !bytes.Equal(old, native[:len(native)-blockStateChecksumSize]) {
+		t.Fatalf("encoded as %x, expected %x", old, native[:len(native)-blockStateChecksumSize])
+	}
+	decoded := &StartGame471{}
+	unmarshal(t, decoded, old)
+	if b := marshal(&decoded.StartGame); !bytes.Equal(b, native) {
+		t.Fatalf("decoded packet encodes as %x, expected %x", b, native)
+	}
+}
+
+// TestPlayerAuthInput486 checks that PlayerAuthInput and ItemStackRequest packets of protocol 486, in which
+// auto crafting actions list their ingredients, survive encoding and are converted from and to packets of the
+// latest protocol.
+func TestPlayerAuthInput486(t *testing.T) {
+	req := protocol.ItemStackRequest{
+		RequestID: -3,
+		Actions: []protocol.StackRequestAction{
+			&AutoCraftRecipeStackRequestAction486{
+				AutoCraftRecipeStackRequestAction: protocol.AutoCraftRecipeStackRequestAction{RecipeNetworkID: 12, TimesCrafted: 2},
+				Ingredients:                       []protocol.RecipeIngredientItem{{NetworkID: 5, MetadataValue: 1, Count: 2}, {}},
+			},
+			&protocol.CraftCreativeStackRequestAction{CreativeItemNetworkID: 7},
+		},
+		CustomNames: []string{"name"},
+	}
+	input := &PlayerAuthInput486{PlayerAuthInput: packet.PlayerAuthInput{
+		Pitch:            10,
+		Position:         mgl32.Vec3{1, 2, 3},
+		InputData:        packet.InputFlagPerformItemStackRequest | packet.InputFlagPerformBlockActions,
+		InputMode:        packet.InputModeMouse,
+		Tick:             40,
+		ItemStackRequest: req,
+		BlockActions:     []protocol.PlayerBlockAction{{Action: protocol.PlayerActionStartBreak, BlockPos: protocol.BlockPos{1, 2, 3}, Face: 1}},
+	}}
+	requests := &ItemStackRequest486{ItemStackRequest: packet.ItemStackRequest{Requests: []protocol.ItemStackRequest{req}}}
+
+	for _, tc := range []struct {
+		pk, decoded packet.Packet
+		latest      func(pk packet.Packet) protocol.ItemStackRequest
+	}{
+		{input, &PlayerAuthInput486{}, func(pk packet.Packet) protocol.ItemStackRequest {
+			return pk.(*packet.PlayerAuthInput).ItemStackRequest
+		}},
+		{requests, &ItemStackRequest486{}, func(pk packet.Packet) protocol.ItemStackRequest {
+			return pk.(*packet.ItemStackRequest).Requests[0]
+		}},
+	} {
+		unmarshal(t, tc.decoded, marshal(tc.pk))
+		if !reflect.DeepEqual(tc.decoded, tc.pk) {
+			t.Fatalf("decoded %+v, expected %+v", tc.decoded, tc.pk)
+		}
+
+		converted := Protocol486{}.ConvertToLatest(tc.decoded, nil)
+		actions := tc.latest(converted[0]).Actions
+		if auto, ok := actions[0].(*protocol.AutoCraftRecipeStackRequestAction); !ok || auto.RecipeNetworkID != 12 || auto.TimesCrafted != 2 {
+			t.Fatalf("%T: converted auto crafting action to %#v", tc.pk, actions[0])
+		}
+		// The ingredients are lost in the conversion, so the packet converted back only lacks those.
+		back := Protocol486{}.ConvertFromLatest(converted[0], nil)[0]
+		auto := req.Actions[0].(*AutoCraftRecipeStackRequestAction486)
+		ingredients := auto.Ingredients
+		auto.Ingredients = nil
+		expected := marshal(tc.pk)
+		auto.Ingredients = ingredients
+		if a, b := marshal(back), expected; !bytes.Equal(a, b) {
+			t.Fatalf("%T: converted back and encoded as %x, expected %x", tc.pk, a, b)
+		}
+	}
+
+	// Packets without auto crafting actions are encoded as in the latest protocol.
+	latest := input.PlayerAuthInput
+	latest.ItemStackRequest.Actions = latest.ItemStackRequest.Actions[1:]
+	if a, b := marshal(&PlayerAuthInput486{PlayerAuthInput: latest}), marshal(&latest); !bytes.Equal(a, b) {
+		t.Fatalf("encoded as %x, expected %x", a, b)
+	}
+}
+
+// TestLevelChunk486 checks that a LevelChunk486 packet only holds the highest sub chunk if the sub chunks
+// requested are limited, and that such a limit is lifted when converting to the latest protocol.
+func TestLevelChunk486(t *testing.T) {
+	pk := &LevelChunk486{LevelChunk: packet.LevelChunk{
+		ChunkX:        -4,
+		ChunkZ:        9,
+		SubChunkCount: SubChunkRequestModeLimited,
+		CacheEnabled:  true,
+		BlobHashes:    []uint64{1},
+		RawPayload:    []byte{1, 2, 3},
+	}, HighestSubChunk: 12}
+	decoded := &LevelChunk486{}
+	unmarshal(t, decoded, marshal(pk))
+	if !reflect.DeepEqual(decoded, pk) {
+		t.Fatalf("decoded %+v, expected %+v", decoded, pk)
+	}
+	converted := Protocol486{}.ConvertToLatest(decoded, nil)[0].(*packet.LevelChunk)
+	if converted.SubChunkCount != SubChunkRequestModeUnlimited || converted.ChunkX != -4 || !bytes.Equal(converted.RawPayload, pk.RawPayload) {
+		t.Fatalf("converted to %+v", converted)
+	}
+
+	latest := packet.LevelChunk{ChunkX: 1, ChunkZ: 2, SubChunkCount: 3, RawPayload: []byte{4}}
+	back := Protocol486{}.ConvertFromLatest(&latest, nil)[0]
+	if a, b := marshal(back), marshal(&latest); !bytes.Equal(a, b) {
+		t.Fatalf("encoded as %x, expected %x", a, b)
+	}
+}
+
+// TestPlayerAuthInput471 checks that PlayerAuthInput packets, which did not change between 1.17.40 and
+// 1.18.0, are exchanged over protocol 471 as they are.
+func TestPlayerAuthInput471(t *testing.T) {
+	pk := &packet.PlayerAuthInput{
+		Yaw:       90,
+		InputData: packet.InputFlagPerformItemStackRequest,
+		ItemStackRequest: protocol.ItemStackRequest{Actions: []protocol.StackRequestAction{
+			&protocol.AutoCraftRecipeStackRequestAction{RecipeNetworkID: 3, TimesCrafted: 1},
+		}, CustomNames: []string{}},
+	}
+	decoded := Protocol471{}.Packets()[packet.IDPlayerAuthInput]()
+	unmarshal(t, decoded, marshal(pk))
+	if !reflect.DeepEqual(decoded, pk) {
+		t.Fatalf("decoded %+v, expected %+v", decoded, pk)
+	}
+	for _, converted := range [][]packet.Packet{Protocol471{}.ConvertToLatest(decoded, nil), Protocol471{}.ConvertFromLatest(decoded, nil)} {
+		if len(converted) != 1 || converted[0] != decoded {
+			t.Fatalf("converted to %+v, expected the packet as it is", converted)
+		}
+	}
+}
+
+// dial connects a Dialer that supports all protocols to a Listener over a Pipe, with the pong of the Listener
+// advertising the protocol passed. The Listener accepts the protocols passed. The server side connection
+// sends the packets passed once the client spawned. Both connections are returned.
+func dial(t *testing.T, proto minecraft.Protocol, accepted []minecraft.Protocol, pks ...packet.Packet) (client, server *minecraft.Conn, err error) {
+	t.Helper()
+	network := fmt.Sprintf("pipe-version-%v-%v", proto.ID(), len(accepted))
+	minecraft.RegisterNetwork(network, pongNetwork{Network: minecraft.NewPipe(), proto: proto})
+	listener, err := minecraft.ListenConfig{AuthenticationDisabled: true, AcceptedProtocols: accepted}.Listen(network, pipeAddress)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	servers := make(chan *minecraft.Conn, 1)
+	go func() {
+		c, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		conn := c.(*minecraft.Conn)
+		t.Cleanup(func() {
+			_ = conn.Close()
+		})
+		if err := conn.StartGameTimeout(minecraft.GameData{WorldName: "World", EntityRuntimeID: 1}, time.Second*5); err != nil {
+			t.Errorf("start game: %v", err)
+			return
+		}
+		for _, pk := range pks {
+			_ = conn.WritePacket(pk)
+		}
+		servers <- conn
+	}()
+
+	client, err = minecraft.Dialer{Protocols: All()}.DialTimeout(network, pipeAddress, time.Second*5)
+	if err != nil {
+		return nil, nil, err
+	}
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	if err := client.DoSpawnTimeout(time.Second * 5); err != nil {
+		t.Fatalf("spawn: %v", err)
+	}
+	return client, <-servers, nil
+}
+
+// TestDial486 checks that a Dialer negotiates protocol 486 from the pong of a Listener accepting it, and that
+// sub chunks sent by the server arrive as packets of the latest protocol.
+func TestDial486(t *testing.T) {
+	sent := []packet.Packet{
+		&packet.SubChunk{Dimension: 0, SubChunkX: 1, SubChunkY: 2, SubChunkZ: 3, Data: []byte{8}, RequestResult: packet.SubChunkRequestResultSuccess},
+		&packet.Text{TextType: packet.TextTypeRaw, Message: "done"},
+	}
+	client, server, err := dial(t, Protocol486{}, All(), sent...)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if client.Protocol().ID() != 486 || server.Protocol().ID() != 486 {
+		t.Fatalf("client speaks protocol %v and server speaks protocol %v, expected 486", client.Protocol().ID(), server.Protocol().ID())
+	}
+	if v := client.ClientData().GameVersion; v != "1.18.10" {
+		t.Fatalf("client logged in with game version %v, expected 1.18.10", v)
+	}
+	_ = client.SetReadDeadline(time.Now().Add(time.Second * 5))
+	for {
+		pk, err := client.ReadPacket()
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		switch pk := pk.(type) {
+		case *packet.SubChunk:
+			if !reflect.DeepEqual(pk, sent[0]) {
+				t.Fatalf("got sub chunk %+v, expected %+v", pk, sent[0])
+			}
+		case *packet.Text:
+			t.Fatal("got text before sub chunk")
+		default:
+			continue
+		}
+		return
+	}
+}
+
+// TestDial471 checks that the whole login sequence, including the StartGame packet, works over protocol 471,
+// and that sub chunks are not sent to clients of this protocol.
+func TestDial471(t *testing.T) {
+	client, server, err := dial(t, Protocol471{}, All(),
+		&packet.SubChunk{SubChunkY: 2, Data: []byte{8}},
+		&packet.Text{TextType: packet.TextTypeRaw, Message: "done"},
+	)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if client.Protocol().ID() != 471 || server.Protocol().ID() != 471 {
+		t.Fatalf("client speaks protocol %v and server speaks protocol %v, expected 471", client.Protocol().ID(), server.Protocol().ID())
+	}
+	if got := client.GameData().WorldName; got != "World" {
+		t.Fatalf("client got world name %q, expected %q", got, "World")
+	}
+	_ = client.SetReadDeadline(time.Now().Add(time.Second * 5))
+	for {
+		pk, err := client.ReadPacket()
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		switch pk.(type) {
+		case *packet.SubChunk:
+			t.Fatal("client of protocol 471 got a sub chunk")
+		case *packet.Text:
+			return
+		}
+	}
+}
+
+// TestListenerPong checks that the pong of a Listener advertises the newest protocol it accepts, so that a
+// Dialer negotiates that protocol without the pong being altered.
+func TestListenerPong(t *testing.T) {
+	pipe := minecraft.NewPipe()
+	network := "pipe-version-pong"
+	minecraft.RegisterNetwork(network, pipe)
+	t.Cleanup(func() {
+		minecraft.UnregisterNetwork(network)
+	})
+	listener, err := minecraft.ListenConfig{AuthenticationDisabled: true, AcceptedProtocols: []minecraft.Protocol{Protocol471{}, Protocol486{}}}.Listen(network, pipeAddress)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+	// The pong data is set by the Listener once it starts listening, which may be shortly after Listen
+	// returns.
+	var pong []byte
+	for deadline := time.Now().Add(time.Second * 5); len(pong) == 0 && time.Now().Before(deadline); time.Sleep(time.Millisecond * 10) {
+		if pong, err = pipe.PingContext(context.Background(), pipeAddress); err != nil {
+			t.Fatalf("ping: %v", err)
+		}
+	}
+	if !strings.HasPrefix(string(pong), "MCPE;") || !strings.Contains(string(pong), ";486;1.18.10;") {
+		t.Fatalf("got pong %q, expected protocol 486 to be advertised", pong)
+	}
+
+	go func() {
+		c, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		conn := c.(*minecraft.Conn)
+		t.Cleanup(func() {
+			_ = conn.Close()
+		})
+		_ = conn.StartGameTimeout(minecraft.GameData{WorldName: "World", EntityRuntimeID: 1}, time.Second*5)
+	}()
+	client, err := minecraft.Dialer{Protocols: All()}.DialTimeout(network, pipeAddress, time.Second*5)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	if client.Protocol().ID() != 486 {
+		t.Fatalf("client negotiated protocol %v, expected 486", client.Protocol().ID())
+	}
+}
+
+// TestDialNotAccepted checks that a Listener refuses a client with a protocol it does not accept.
+func TestDialNotAccepted(t *testing.T) {
+	if _, _, err := dial(t, Protocol486{}, nil); err == nil {
+		t.Fatal("dial succeeded with a protocol the listener does not accept")
+	}
+}
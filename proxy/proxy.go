@@ -0,0 +1,255 @@
+// Package proxy implements a Minecraft: Bedrock Edition proxy that sits between a client and a server. A
+// client joining the proxy is logged in to the server with the client's own identity data, after which
+// packets are forwarded both ways. Handlers may be added to inspect, modify, drop or inject packets in either
+// direction.
+//
+// When the proxy's Dialer has a TokenSource, the proxy logs in to the server with that account. Running the
+// proxy with the account of the player joining it therefore lets a tool act within that player's own session,
+// without requiring a second account.
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"phoenix/minecraft"
+	"phoenix/minecraft/protocol/packet"
+	"sync"
+	"time"
+)
+
+// Direction is the direction a packet travels through the proxy in.
+type Direction int
+
+const (
+	// ClientToServer is the direction of packets sent by the client, on their way to the server.
+	ClientToServer Direction = iota
+	// ServerToClient is the direction of packets sent by the server, on their way to the client.
+	ServerToClient
+)
+
+// String ...
+func (d Direction) String() string {
+	if d == ClientToServer {
+		return "client->server"
+	}
+	return "server->client"
+}
+
+// Handler handles a packet passing through a Session. It may inspect the packet, modify it in place, or
+// return a different packet to forward instead. Returning nil drops the packet, so that it is not passed to
+// the next Handler or forwarded. Packets may be injected using Session.WriteToClient and
+// Session.WriteToServer.
+// Handlers of one direction are called from a single goroutine per Session, in the order they were added.
+type Handler func(s *Session, pk packet.Packet) packet.Packet
+
+// Config holds settings of a Proxy.
+type Config struct {
+	// Listen is the config of the Listener that clients join. AuthenticationDisabled should usually be true
+	// if the Dialer has no TokenSource, as the server does not verify the login of the proxy in that case.
+	Listen minecraft.ListenConfig
+	// Dialer is used to connect to the server. Its IdentityData and ClientData are replaced with those of the
+	// client joining.
+	Dialer minecraft.Dialer
+	// RemoteNetwork and RemoteAddress are the network and address of the server connected to. RemoteNetwork
+	// defaults to "raknet".
+	RemoteNetwork, RemoteAddress string
+	// ErrorLog is a logger that errors of sessions are written to. By default, errors are discarded.
+	ErrorLog *log.Logger
+}
+
+// Proxy accepts clients on a minecraft.Listener and connects each of them to the server.
+type Proxy struct {
+	cfg      Config
+	listener *minecraft.Listener
+
+	mu       sync.RWMutex
+	handlers [2][]Handler
+	sessions map[*Session]struct{}
+}
+
+// Listen starts a Proxy listening on the network and address passed. Clients are not accepted until Serve is
+// called.
+func Listen(network, address string, cfg Config) (*Proxy, error) {
+	if cfg.RemoteNetwork == "" {
+		cfg.RemoteNetwork = "raknet"
+	}
+	if cfg.ErrorLog == nil {
+		cfg.ErrorLog = log.New(ioutil.Discard, "", 0)
+	}
+	if cfg.Listen.StatusProvider == nil && cfg.RemoteNetwork == "raknet" {
+		provider, err := minecraft.NewForeignStatusProvider(cfg.RemoteAddress)
+		if err == nil {
+			cfg.Listen.StatusProvider = provider
+		}
+	}
+	listener, err := cfg.Listen.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return &Proxy{cfg: cfg, listener: listener, sessions: make(map[*Session]struct{})}, nil
+}
+
+// Handle adds a Handler called for packets travelling in the direction passed. Handlers added while the
+// Proxy is serving apply to sessions that already started too.
+func (p *Proxy) Handle(dir Direction, h Handler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.handlers[dir] = append(p.handlers[dir], h)
+}
+
+// Addr returns the address the Proxy listens on.
+func (p *Proxy) Addr() net.Addr {
+	return p.listener.Addr()
+}
+
+// Serve accepts clients until the Proxy is closed, starting a Session for each of them. It always returns a
+// non-nil error.
+func (p *Proxy) Serve() error {
+	for {
+		c, err := p.listener.Accept()
+		if err != nil {
+			return err
+		}
+		go p.serve(c.(*minecraft.Conn))
+	}
+}
+
+// Close closes the Listener of the Proxy and all sessions.
+func (p *Proxy) Close() error {
+	err := p.listener.Close()
+	p.mu.Lock()
+	sessions := make([]*Session, 0, len(p.sessions))
+	for s := range p.sessions {
+		sessions = append(sessions, s)
+	}
+	p.mu.Unlock()
+	for _, s := range sessions {
+		_ = s.Close()
+	}
+	return err
+}
+
+// serve connects the client passed to the server and forwards packets until either side disconnects.
+func (p *Proxy) serve(client *minecraft.Conn) {
+	d := p.cfg.Dialer
+	d.IdentityData = client.IdentityData()
+	d.ClientData = client.ClientData()
+	server, err := d.DialTimeout(p.cfg.RemoteNetwork, p.cfg.RemoteAddress, time.Minute)
+	if err != nil {
+		p.cfg.ErrorLog.Printf("dial server for %v: %v", client.IdentityData().DisplayName, err)
+		_ = p.listener.Disconnect(client, fmt.Sprintf("Could not connect to the server: %v", err))
+		return
+	}
+	s := &Session{proxy: p, client: client, server: server}
+
+	// The client is spawned with the game data sent by the server, while the connection to the server is
+	// spawned at the same time.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	errs := make(chan error, 2)
+	go func() { errs <- client.StartGameContext(ctx, server.GameData()) }()
+	go func() { errs <- server.DoSpawnContext(ctx) }()
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			p.cfg.ErrorLog.Printf("spawn %v: %v", client.IdentityData().DisplayName, err)
+			_ = s.Close()
+			return
+		}
+	}
+
+	p.mu.Lock()
+	p.sessions[s] = struct{}{}
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.sessions, s)
+		p.mu.Unlock()
+	}()
+
+	done := make(chan struct{}, 2)
+	go s.forward(ClientToServer, client, server, done)
+	go s.forward(ServerToClient, server, client, done)
+	<-done
+	_ = s.Close()
+	<-done
+}
+
+// Session is a client connected to the server through the Proxy.
+type Session struct {
+	proxy          *Proxy
+	client, server *minecraft.Conn
+	once           sync.Once
+}
+
+// Client returns the connection of the Session to the client.
+func (s *Session) Client() *minecraft.Conn {
+	return s.client
+}
+
+// Server returns the connection of the Session to the server.
+func (s *Session) Server() *minecraft.Conn {
+	return s.server
+}
+
+// WriteToClient injects a packet, sending it to the client as if the server sent it. The packet does not
+// pass through the Handlers.
+func (s *Session) WriteToClient(pk packet.Packet) error {
+	return s.client.WritePacket(pk)
+}
+
+// WriteToServer injects a packet, sending it to the server as if the client sent it. The packet does not
+// pass through the Handlers.
+func (s *Session) WriteToServer(pk packet.Packet) error {
+	return s.server.WritePacket(pk)
+}
+
+// Close closes the connections to both the client and the server.
+func (s *Session) Close() error {
+	s.once.Do(func() {
+		_ = s.server.Close()
+		_ = s.client.Close()
+	})
+	return nil
+}
+
+// forward reads packets from src, passes them through the Handlers of the direction passed and writes them
+// to dst, until either connection is closed.
+func (s *Session) forward(dir Direction, src, dst *minecraft.Conn, done chan<- struct{}) {
+	defer func() {
+		done <- struct{}{}
+	}()
+	for {
+		pk, err := src.ReadPacket()
+		if err != nil {
+			var disconnect minecraft.DisconnectError
+			if errors.As(err, &disconnect) && dir == ServerToClient {
+				// Pass the reason of the disconnection on to the client before both connections are closed.
+				_ = s.proxy.listener.Disconnect(dst, string(disconnect))
+			}
+			return
+		}
+		if pk = s.handle(dir, pk); pk == nil {
+			continue
+		}
+		if err := dst.WritePacket(pk); err != nil {
+			return
+		}
+	}
+}
+
+// handle passes a packet through the Handlers of the direction passed.
+func (s *Session) handle(dir Direction, pk packet.Packet) packet.Packet {
+	s.proxy.mu.RLock()
+	handlers := s.proxy.handlers[dir]
+	s.proxy.mu.RUnlock()
+	for _, h := range handlers {
+		if pk = h(s, pk); pk == nil {
+			return nil
+		}
+	}
+	return pk
+}
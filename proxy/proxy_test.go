@@ -0,0 +1,193 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"phoenix/internal/testserver"
+	"phoenix/minecraft"
+	"phoenix/minecraft/protocol"
+	"phoenix/minecraft/protocol/login"
+	"phoenix/minecraft/protocol/packet"
+	"strings"
+	"testing"
+	"time"
+)
+
+// start starts a test server and a Proxy in front of it, and connects a spawned client named Player to the
+// Proxy. Handlers are added before the client joins.
+func start(t *testing.T, handlers map[Direction][]Handler) (*testserver.Server, *minecraft.Conn) {
+	t.Helper()
+	s, err := testserver.New(testserver.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = s.Close()
+	})
+
+	network := "proxy-" + uuid.New().String()
+	minecraft.RegisterNetwork(network, minecraft.NewPipe())
+	p, err := Listen(network, "127.0.0.1:19133", Config{
+		Listen:        minecraft.ListenConfig{AuthenticationDisabled: true},
+		RemoteNetwork: s.Network(),
+		RemoteAddress: s.Address(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for dir, hs := range handlers {
+		for _, h := range hs {
+			p.Handle(dir, h)
+		}
+	}
+	go func() {
+		_ = p.Serve()
+	}()
+	t.Cleanup(func() {
+		_ = p.Close()
+	})
+
+	conn, err := minecraft.Dialer{IdentityData: login.IdentityData{DisplayName: "Player"}}.DialTimeout(network, "127.0.0.1:19133", time.Second*5)
+	if err != nil {
+		t.Fatalf("dial proxy: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	if err := conn.DoSpawnTimeout(time.Second * 5); err != nil {
+		t.Fatalf("spawn: %v", err)
+	}
+	return s, conn
+}
+
+// command sends a command through the proxy and waits for its output.
+func command(t *testing.T, conn *minecraft.Conn, line string) *packet.CommandOutput {
+	t.Helper()
+	id := uuid.New()
+	if err := conn.WritePacket(&packet.CommandRequest{
+		CommandOrigin: protocol.CommandOrigin{Origin: protocol.CommandOriginPlayer, UUID: id},
+		CommandLine:   line,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return readUntil(t, conn, func(pk packet.Packet) bool {
+		output, ok := pk.(*packet.CommandOutput)
+		return ok && output.CommandOrigin.UUID == id
+	}).(*packet.CommandOutput)
+}
+
+// readUntil reads packets from the connection until one matches the function passed.
+func readUntil(t *testing.T, conn *minecraft.Conn, match func(pk packet.Packet) bool) packet.Packet {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	defer conn.SetReadDeadline(time.Time{})
+	for {
+		pk, err := conn.ReadPacket()
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if match(pk) {
+			return pk
+		}
+	}
+}
+
+func TestProxyForward(t *testing.T) {
+	s, conn := start(t, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if _, err := s.WaitPlayer(ctx, "Player"); err != nil {
+		t.Fatalf("client identity not passed to server: %v", err)
+	}
+	if output := command(t, conn, "setblock 0 10 0 stone"); !output.OutputMessages[0].Success {
+		t.Fatalf("command failed: %+v", output.OutputMessages[0])
+	}
+	if b := s.World().Block(protocol.BlockPos{0, 10, 0}); b.Name != "minecraft:stone" {
+		t.Fatalf("block not placed through proxy: %v", b)
+	}
+}
+
+func TestProxyHandlers(t *testing.T) {
+	var seen int
+	s, conn := start(t, map[Direction][]Handler{
+		ClientToServer: {
+			// Drop all chat messages sent by the client.
+			func(s *Session, pk packet.Packet) packet.Packet {
+				if _, ok := pk.(*packet.Text); ok {
+					return nil
+				}
+				return pk
+			},
+			// Rewrite placed blocks to gold, and answer a custom command without the server.
+			func(s *Session, pk packet.Packet) packet.Packet {
+				if req, ok := pk.(*packet.CommandRequest); ok {
+					if req.CommandLine == "ping" {
+						_ = s.WriteToClient(&packet.CommandOutput{
+							CommandOrigin:  req.CommandOrigin,
+							SuccessCount:   1,
+							OutputMessages: []protocol.CommandOutputMessage{{Success: true, Message: "pong"}},
+						})
+						return nil
+					}
+					req.CommandLine = strings.Replace(req.CommandLine, "stone", "gold_block", 1)
+				}
+				return pk
+			},
+		},
+		ServerToClient: {
+			func(s *Session, pk packet.Packet) packet.Packet {
+				if _, ok := pk.(*packet.CommandOutput); ok {
+					seen++
+				}
+				return pk
+			},
+		},
+	})
+
+	if err := conn.WritePacket(&packet.Text{TextType: packet.TextTypeChat, SourceName: "Player", Message: "dropped"}); err != nil {
+		t.Fatal(err)
+	}
+	command(t, conn, "setblock 0 10 0 stone")
+	if b := s.World().Block(protocol.BlockPos{0, 10, 0}); b.Name != "minecraft:gold_block" {
+		t.Fatalf("command not modified by handler, placed %v", b)
+	}
+	if output := command(t, conn, "ping"); output.OutputMessages[0].Message != "pong" {
+		t.Fatalf("injected output not received: %+v", output)
+	}
+	if seen != 1 {
+		t.Fatalf("server to client handler saw %v command outputs, expected 1", seen)
+	}
+	for _, line := range s.Commands() {
+		if line == "ping" {
+			t.Fatal("dropped command reached the server")
+		}
+	}
+
+	// The chat message was dropped, so the only chat the client receives is this one from the server.
+	s.Chat("Server", "hello")
+	text := readUntil(t, conn, func(pk packet.Packet) bool {
+		_, ok := pk.(*packet.Text)
+		return ok
+	}).(*packet.Text)
+	if text.Message != "hello" {
+		t.Fatalf("dropped chat message was forwarded: %v", text.Message)
+	}
+}
+
+func TestProxyDisconnect(t *testing.T) {
+	s, conn := start(t, nil)
+	_ = s.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	for {
+		_, err := conn.ReadPacket()
+		if err == nil {
+			continue
+		}
+		var disconnect minecraft.DisconnectError
+		if !errors.As(err, &disconnect) || disconnect != "Server closed." {
+			t.Fatalf("expected disconnect with the message of the server, got %v", err)
+		}
+		return
+	}
+}
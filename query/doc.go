@@ -2,6 +2,10 @@
 // http://wiki.unrealadmin.org/UT3_query_protocol. It is composed of a handshake, followed by data sent
 // by the server that responds to a query sent by the client.
 //
+// Do and DoFull query the full stat of a server, which holds its information, plugins and players. Do returns
+// it as a map, whereas DoFull parses it into a FullStat. On the server side, a Responder created using Listen answers queries with a FullStat. A minecraft.Listener runs a
+// Responder if its ListenConfig.QueryAddress is set.
+//
 // Where some server softwares (most common public ones, such as PocketMine) support this query protocol,
 // others do not. A different kind of 'query', which is supported by all servers, may be performed using the
 // go-raknet library. (raknet.Ping()) Server softwares which do not implement the query protocol include the
@@ -6,14 +6,15 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"sort"
 	"strconv"
-	"strings"
 )
 
 // version is the version of the query protocol. It represents Gamespy Query Protocol version 4.
 var version = [2]byte{0xfe, 0xfd}
 
-// padding is the padding used for the queryTypeInformation request.
+// padding is the padding used for the queryTypeInformation request. A request with padding requests the full
+// stat of the server, one without it the basic stat.
 var padding = [4]byte{0xff, 0xff, 0xff, 0x01}
 
 // splitNum is the split number set in a response before the Information is written. It is conventionally
@@ -41,6 +42,9 @@ type request struct {
 	// ResponseNumber is the number sent in the response following a handshake request. It only requires being
 	// set if RequestType is queryTypeInformation.
 	ResponseNumber int32
+	// Full specifies if the full stat of the server is requested rather than the basic stat. It is only used
+	// if RequestType is queryTypeInformation.
+	Full bool
 }
 
 // response is a packet sent by the server to the client. It is sent in response to a request, with either a
@@ -59,8 +63,17 @@ type response struct {
 	// Information is a list of all information of the server. It is sent only if ResponseType is
 	// queryTypeInformation.
 	Information map[string]string
+	// Players holds the names of the players online. It is sent only if ResponseType is queryTypeInformation
+	// and Full is true, and is nil if the response holds no player list at all.
+	Players []string
+	// Full specifies if the response holds the full stat of the server rather than the basic stat. A basic
+	// stat only holds the keys listed in basicKeys.
+	Full bool
 }
 
+// basicKeys are the keys of the information held in a basic stat, in the order they are written.
+var basicKeys = [...]string{"hostname", "gametype", "map", "numplayers", "maxplayers", "hostport", "hostip"}
+
 // Marshal ...
 func (pk *request) Marshal(w io.Writer) {
 	_, _ = w.Write(version[:])
@@ -68,7 +81,9 @@ func (pk *request) Marshal(w io.Writer) {
 	_ = binary.Write(w, binary.BigEndian, pk.SequenceNumber)
 	if pk.RequestType == queryTypeInformation {
 		_ = binary.Write(w, binary.BigEndian, pk.ResponseNumber)
-		_, _ = w.Write(padding[:])
+		if pk.Full {
+			_, _ = w.Write(padding[:])
+		}
 	}
 }
 
@@ -84,16 +99,18 @@ func (pk *request) Unmarshal(r io.Reader) error {
 	if err := binary.Read(r, binary.BigEndian, &pk.RequestType); err != nil {
 		return err
 	}
-	if err := binary.Read(r, binary.BigEndian, &pk.RequestType); err != nil {
+	if err := binary.Read(r, binary.BigEndian, &pk.SequenceNumber); err != nil {
 		return err
 	}
 	if pk.RequestType == queryTypeInformation {
 		if err := binary.Read(r, binary.BigEndian, &pk.ResponseNumber); err != nil {
 			return err
 		}
+		// The padding is only present in full stat requests. Its content differs between clients, so only its
+		// presence is checked.
 		p := make([]byte, 4)
-		_, err := r.Read(p)
-		return err
+		n, _ := io.ReadFull(r, p)
+		pk.Full = n == len(p)
 	} else if pk.RequestType != queryTypeHandshake {
 		return fmt.Errorf("unknown request type %X", pk.RequestType)
 	}
@@ -111,17 +128,36 @@ func (pk *response) Marshal(w io.Writer) {
 			v = append(v, make([]byte, 12-len(v))...)
 		}
 		_, _ = w.Write(v)
-	} else {
+	} else if pk.Full {
 		_, _ = w.Write(splitNum[:])
 		_ = binary.Write(w, binary.BigEndian, byte(0x80)) // Number of packets, but in our case always 0x80.
 		_ = binary.Write(w, binary.BigEndian, byte(0))    // Unused.
-		values := make([][]byte, 0, len(pk.Information)*2)
-		for key, value := range pk.Information {
-			values = append(values, []byte(key))
-			values = append(values, []byte(value))
+		keys := make([]string, 0, len(pk.Information))
+		for key := range pk.Information {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			// Keys and values are all terminated by a null byte, with an empty key ending the list.
+			_, _ = w.Write(append([]byte(key), 0x00))
+			_, _ = w.Write(append([]byte(pk.Information[key]), 0x00))
+		}
+		// The player key starts with the null byte that ends the list of keys and values.
+		_, _ = w.Write(playerKey[:])
+		for _, player := range pk.Players {
+			_, _ = w.Write(append([]byte(player), 0x00))
+		}
+		_, _ = w.Write([]byte{0x00})
+	} else {
+		for _, key := range basicKeys {
+			if key == "hostport" {
+				// The host port is written as a little endian short instead of a string.
+				port, _ := strconv.ParseUint(pk.Information[key], 10, 16)
+				_ = binary.Write(w, binary.LittleEndian, uint16(port))
+				continue
+			}
+			_, _ = w.Write(append([]byte(pk.Information[key]), 0x00))
 		}
-		// Join all keys and values together using a null byte.
-		_, _ = w.Write(bytes.Join(values, []byte{0x00}))
 	}
 }
 
@@ -149,47 +185,73 @@ func (pk *response) Unmarshal(r io.Reader) error {
 		}
 		pk.ResponseNumber = int32(num)
 	case queryTypeInformation:
-		// We don't care about these first 11 bytes, so we skip them all and move on to the actual information.
-		v := make([]byte, 11)
-		if _, err := r.Read(v); err != nil {
-			return err
-		}
-		information, err := ioutil.ReadAll(r)
+		data, err := ioutil.ReadAll(r)
 		if err != nil {
 			return err
 		}
-		playerIndex := bytes.Index(information, playerKey[:])
-		data := information
-		if playerIndex != -1 {
-			information = information[:playerIndex]
-		}
-		values := bytes.Split(information, []byte{0x00})
-		pk.Information = make(map[string]string, len(values)/2)
-		if len(values)%2 != 0 {
-			// Sometimes, the information is null terminated, whereas with others it is not. We remove the
-			// null byte if it's there.
-			values = values[:len(values)-1]
-		}
-		for i := 0; i < len(values); i += 2 {
-			pk.Information[string(values[i])] = string(values[i+1])
-		}
-		if playerIndex != -1 {
-			playerData := data[playerIndex+len(playerKey):]
-			values = bytes.Split(playerData, []byte{0x00})
-			players := make([]string, 0, len(values))
-			for i := 0; i < len(values); i++ {
-				if len(values[i]) == 0 {
-					// Empty string means we've reached the end of the data. Break immediately so that the
-					// name isn't added to the players slice.
-					break
-				}
-				players = append(players, string(values[i]))
-			}
-			pk.Information["players"] = strings.Join(players, ", ")
+		// Full stat responses start with the split number, whereas basic stat responses start with the
+		// information immediately.
+		if len(data) >= 11 && bytes.EqualFold(data[:len(splitNum)], splitNum[:]) {
+			pk.Full = true
+			pk.unmarshalFull(data[11:])
+			return nil
 		}
-
+		return pk.unmarshalBasic(data)
 	default:
 		return fmt.Errorf("unknown response type %X", pk.ResponseType)
 	}
 	return nil
 }
+
+// unmarshalFull unmarshals the information and players of a full stat response, starting after the split
+// number.
+func (pk *response) unmarshalFull(data []byte) {
+	information := data
+	playerIndex := bytes.Index(data, playerKey[:])
+	if playerIndex != -1 {
+		information = data[:playerIndex]
+	}
+	values := bytes.Split(information, []byte{0x00})
+	pk.Information = make(map[string]string, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		if len(values[i]) == 0 {
+			// An empty key ends the list of keys and values.
+			break
+		}
+		pk.Information[string(values[i])] = string(values[i+1])
+	}
+	if playerIndex == -1 {
+		return
+	}
+	pk.Players = []string{}
+	for _, name := range bytes.Split(data[playerIndex+len(playerKey):], []byte{0x00}) {
+		if len(name) == 0 {
+			// Empty string means we've reached the end of the data. Break immediately so that the name isn't
+			// added to the players slice.
+			break
+		}
+		pk.Players = append(pk.Players, string(name))
+	}
+}
+
+// unmarshalBasic unmarshals the information of a basic stat response into the keys listed in basicKeys.
+func (pk *response) unmarshalBasic(data []byte) error {
+	pk.Information = make(map[string]string, len(basicKeys))
+	for _, key := range basicKeys {
+		if key == "hostport" {
+			if len(data) < 2 {
+				return fmt.Errorf("basic query response has no host port")
+			}
+			pk.Information[key] = strconv.Itoa(int(binary.LittleEndian.Uint16(data)))
+			data = data[2:]
+			continue
+		}
+		index := bytes.IndexByte(data, 0x00)
+		if index == -1 {
+			return fmt.Errorf("basic query response has unterminated %v", key)
+		}
+		pk.Information[key] = string(data[:index])
+		data = data[index+1:]
+	}
+	return nil
+}
@@ -6,18 +6,47 @@ import (
 	"math"
 	"math/rand"
 	"net"
+	"strings"
 	"time"
 )
 
 // Do queries a server at the address passed using the UT3 query protocol. If the server responds, a map
-// containing information is returned.
+// containing information is returned. Callers that need the plugins or players of the server should use
+// DoFull, which returns them parsed into a FullStat.
 // Note that some servers do not support querying, in which case the query will time out. Do will take at
 // most five seconds to try and get the query information.
 func Do(address string) (information map[string]string, err error) {
+	resp, err := do(address)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Players != nil {
+		resp.Information["players"] = strings.Join(resp.Players, ", ")
+	}
+	return resp.Information, nil
+}
+
+// DoFull queries the full stat of a server at the address passed using the UT3 query protocol. If the server
+// responds, a FullStat holding its information, plugins and players is returned.
+// Like Do, DoFull will take at most five seconds to try and get the query information.
+func DoFull(address string) (FullStat, error) {
+	resp, err := do(address)
+	if err != nil {
+		return FullStat{}, err
+	}
+	return parseFullStat(resp.Information, resp.Players)
+}
+
+// do performs a handshake with the server at the address passed, after which it requests the full stat of the
+// server and returns the response.
+func do(address string) (*response, error) {
 	conn, err := net.Dial("udp", address)
 	if err != nil {
 		return nil, fmt.Errorf("error dialing UDP conn: %v", err)
 	}
+	defer func() {
+		_ = conn.Close()
+	}()
 	// We set a deadline of five seconds: There is no point waiting even longer if the query isn't finished
 	// by then.
 	if err := conn.SetDeadline(time.Now().Add(time.Second * 5)); err != nil {
@@ -51,6 +80,7 @@ func Do(address string) (information map[string]string, err error) {
 		RequestType:    queryTypeInformation,
 		SequenceNumber: r.Int31(),
 		ResponseNumber: resp.ResponseNumber,
+		Full:           true,
 	}).Marshal(b)
 	if _, err := conn.Write(b.Bytes()); err != nil {
 		return nil, err
@@ -61,5 +91,11 @@ func Do(address string) (information map[string]string, err error) {
 		return nil, err
 	}
 	resp = &response{}
-	return resp.Information, resp.Unmarshal(bytes.NewBuffer(data[:n]))
+	if err := resp.Unmarshal(bytes.NewBuffer(data[:n])); err != nil {
+		return nil, err
+	}
+	if resp.ResponseType != queryTypeInformation || !resp.Full {
+		return nil, fmt.Errorf("unexpected query response to information request")
+	}
+	return resp, nil
 }
@@ -0,0 +1,149 @@
+package query
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testStat is the FullStat answered by the Responder in tests.
+var testStat = FullStat{
+	HostName:     "Test Server",
+	GameType:     "SMP",
+	GameID:       "MINECRAFTPE",
+	Version:      "1.16.201",
+	ServerEngine: "Test Engine 1.0",
+	Plugins:      []string{"Plugin A v1.0", "Plugin B v2.0"},
+	Map:          "world",
+	NumPlayers:   2,
+	MaxPlayers:   20,
+	WhiteList:    true,
+	HostIP:       "127.0.0.1",
+	HostPort:     19132,
+	Players:      []string{"Steve", "Alex"},
+	Other:        map[string]string{"motd": "Hello"},
+}
+
+// listen starts a Responder answering testStat on a random port of localhost.
+func listen(t *testing.T) *Responder {
+	t.Helper()
+	r, err := Listen("127.0.0.1:0", func() FullStat {
+		return testStat
+	})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = r.Close()
+	})
+	return r
+}
+
+// TestDoFull queries the full stat of a Responder and checks that it is returned as it was answered.
+func TestDoFull(t *testing.T) {
+	r := listen(t)
+	stat, err := DoFull(r.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stat, testStat) {
+		t.Fatalf("got full stat %+v, expected %+v", stat, testStat)
+	}
+
+	information, err := Do(r.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if information["hostname"] != "Test Server" || information["plugins"] != "Test Engine 1.0: Plugin A v1.0; Plugin B v2.0" || information["players"] != "Steve, Alex" {
+		t.Fatalf("got information %v", information)
+	}
+}
+
+// TestBasicStat queries the basic stat of a Responder and checks that it holds the basic information only.
+func TestBasicStat(t *testing.T) {
+	r := listen(t)
+	conn, err := net.Dial("udp", r.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(time.Second * 5))
+
+	handshake := exchange(t, conn, &request{RequestType: queryTypeHandshake, SequenceNumber: 1})
+	resp := exchange(t, conn, &request{RequestType: queryTypeInformation, SequenceNumber: 2, ResponseNumber: handshake.ResponseNumber})
+	expected := map[string]string{
+		"hostname":   "Test Server",
+		"gametype":   "SMP",
+		"map":        "world",
+		"numplayers": "2",
+		"maxplayers": "20",
+		"hostport":   "19132",
+		"hostip":     "127.0.0.1",
+	}
+	if !reflect.DeepEqual(resp.Information, expected) || resp.Players != nil {
+		t.Fatalf("got basic stat %v %v, expected %v", resp.Information, resp.Players, expected)
+	}
+}
+
+// TestDoNoPlayers checks that Do returns an empty "players" value if the full stat of the server holds an
+// empty player list.
+func TestDoNoPlayers(t *testing.T) {
+	r, err := Listen("127.0.0.1:0", func() FullStat {
+		return FullStat{HostName: "Test Server"}
+	})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer r.Close()
+
+	information, err := Do(r.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if players, ok := information["players"]; !ok || players != "" {
+		t.Fatalf("got information %v, expected an empty players value", information)
+	}
+}
+
+// TestResponderInvalidToken checks that a Responder does not answer requests holding a token that it did not
+// hand out to the client.
+func TestResponderInvalidToken(t *testing.T) {
+	r := listen(t)
+	conn, err := net.Dial("udp", r.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	b := new(bytes.Buffer)
+	(&request{RequestType: queryTypeInformation, SequenceNumber: 1, ResponseNumber: 12345, Full: true}).Marshal(b)
+	if _, err := conn.Write(b.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(time.Millisecond * 200))
+	if n, err := conn.Read(make([]byte, 1500)); err == nil {
+		t.Fatalf("request with invalid token was answered with %v bytes", n)
+	}
+}
+
+// exchange writes the request passed to the conn and reads the response to it.
+func exchange(t *testing.T, conn net.Conn, pk *request) *response {
+	t.Helper()
+	b := new(bytes.Buffer)
+	pk.Marshal(b)
+	if _, err := conn.Write(b.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 1500)
+	n, err := conn.Read(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := &response{}
+	if err := resp.Unmarshal(bytes.NewBuffer(data[:n])); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
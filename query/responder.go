@@ -0,0 +1,134 @@
+package query
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// tokenLifetime is the duration after which the secret that handshake tokens are derived from is replaced.
+// Tokens remain valid for at least this duration and at most twice this duration.
+const tokenLifetime = time.Second * 30
+
+// Responder answers queries sent to it using the UT3 query protocol. It answers handshakes and requests for
+// both the basic and the full stat of a server. A Responder is created using Listen.
+type Responder struct {
+	conn net.PacketConn
+	stat func() FullStat
+
+	mu sync.Mutex
+	// secret and prevSecret are the current and previous secrets that handshake tokens are derived from.
+	// rotated is the time at which secret was created.
+	secret, prevSecret []byte
+	rotated            time.Time
+}
+
+// Listen announces on the UDP address passed and returns a Responder that answers queries sent to it. The
+// function passed is called for each request for the stat of the server and must return its current stat.
+// Basic stat requests are answered with the relevant subset of the FullStat. The function may be called
+// concurrently.
+// Close must be called on the Responder once it is no longer used.
+func Listen(address string, stat func() FullStat) (*Responder, error) {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	r := &Responder{conn: conn, stat: stat}
+	// Rotate twice so that the previous secret is never empty either.
+	r.rotate()
+	r.rotate()
+	go r.listen()
+	return r, nil
+}
+
+// Addr returns the address that the Responder is listening on.
+func (r *Responder) Addr() net.Addr {
+	return r.conn.LocalAddr()
+}
+
+// Close closes the Responder, after which it no longer answers queries.
+func (r *Responder) Close() error {
+	return r.conn.Close()
+}
+
+// listen reads requests from the connection of the Responder until it is closed, answering each of them.
+func (r *Responder) listen() {
+	b := make([]byte, 1500)
+	for {
+		n, addr, err := r.conn.ReadFrom(b)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+		pk := &request{}
+		if err := pk.Unmarshal(bytes.NewBuffer(b[:n])); err != nil {
+			// The packet was not a query request, which may happen if the address is shared with another
+			// protocol. We simply ignore it.
+			continue
+		}
+		resp, ok := r.respond(pk, addr)
+		if !ok {
+			continue
+		}
+		buf := new(bytes.Buffer)
+		resp.Marshal(buf)
+		_, _ = r.conn.WriteTo(buf.Bytes(), addr)
+	}
+}
+
+// respond returns the response to a request sent by the address passed. It returns false if the request
+// should not be answered, which is the case if it holds a token that was not handed out to the address.
+func (r *Responder) respond(pk *request, addr net.Addr) (*response, bool) {
+	resp := &response{ResponseType: pk.RequestType, SequenceNumber: pk.SequenceNumber}
+	if pk.RequestType == queryTypeHandshake {
+		resp.ResponseNumber = r.token(addr, false)
+		return resp, true
+	}
+	if pk.ResponseNumber != r.token(addr, false) && pk.ResponseNumber != r.token(addr, true) {
+		return nil, false
+	}
+	stat := r.stat()
+	resp.Full = pk.Full
+	if pk.Full {
+		resp.Information, resp.Players = stat.information(), stat.Players
+	} else {
+		resp.Information = stat.basicInformation()
+	}
+	return resp, true
+}
+
+// token returns the handshake token of the address passed. Tokens are derived from a secret, so that only
+// the client at the address can know its token. If prev is true, the token derived from the previous secret
+// is returned.
+func (r *Responder) token(addr net.Addr, prev bool) int32 {
+	r.mu.Lock()
+	if time.Since(r.rotated) > tokenLifetime {
+		r.rotate()
+	}
+	secret := r.secret
+	if prev {
+		secret = r.prevSecret
+	}
+	r.mu.Unlock()
+
+	h := hmac.New(sha256.New, secret)
+	_, _ = h.Write([]byte(addr.String()))
+	// Tokens are sent as strings of at most 12 bytes, so we make sure they are never negative.
+	return int32(binary.BigEndian.Uint32(h.Sum(nil)) & math.MaxInt32)
+}
+
+// rotate replaces the secret of the Responder with a new one. The mutex of the Responder must be held if it
+// is listening.
+func (r *Responder) rotate() {
+	secret := make([]byte, 32)
+	_, _ = rand.Read(secret)
+	r.prevSecret, r.secret, r.rotated = r.secret, secret, time.Now()
+}
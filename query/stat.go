@@ -0,0 +1,124 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FullStat holds the full stat of a server, as returned by DoFull and by the function passed to Listen.
+type FullStat struct {
+	// HostName is the name or MOTD of the server.
+	HostName string
+	// GameType is the type of the game, which is conventionally 'SMP'.
+	GameType string
+	// GameID is the ID of the game, which is conventionally 'MINECRAFTPE'.
+	GameID string
+	// Version is the game version that the server runs, such as '1.16.201'.
+	Version string
+	// ServerEngine is the name and version of the software that the server runs.
+	ServerEngine string
+	// Plugins holds the names of the plugins that the server has loaded, typically including their versions.
+	Plugins []string
+	// Map is the name of the map or world that the server is running.
+	Map string
+	// NumPlayers is the amount of players online.
+	NumPlayers int
+	// MaxPlayers is the maximum amount of players that may be online at the same time.
+	MaxPlayers int
+	// WhiteList specifies if the server has a whitelist enabled.
+	WhiteList bool
+	// HostIP and HostPort are the IP address and port that players connect to the server on.
+	HostIP   string
+	HostPort int
+	// Players holds the names of the players online.
+	Players []string
+	// Other holds all information sent by the server under keys not covered by the other fields.
+	Other map[string]string
+}
+
+// information returns the information of the FullStat as a map of keys and values, as sent in a full stat
+// response.
+func (stat FullStat) information() map[string]string {
+	information := make(map[string]string, len(stat.Other)+12)
+	for key, value := range stat.Other {
+		information[key] = value
+	}
+	plugins := stat.ServerEngine
+	if len(stat.Plugins) != 0 {
+		// Plugins are conventionally listed after the server engine, separated by a semicolon.
+		plugins += ": " + strings.Join(stat.Plugins, "; ")
+	}
+	whiteList := "off"
+	if stat.WhiteList {
+		whiteList = "on"
+	}
+	information["hostname"] = stat.HostName
+	information["gametype"] = stat.GameType
+	information["game_id"] = stat.GameID
+	information["version"] = stat.Version
+	information["server_engine"] = stat.ServerEngine
+	information["plugins"] = plugins
+	information["map"] = stat.Map
+	information["numplayers"] = strconv.Itoa(stat.NumPlayers)
+	information["maxplayers"] = strconv.Itoa(stat.MaxPlayers)
+	information["whitelist"] = whiteList
+	information["hostip"] = stat.HostIP
+	information["hostport"] = strconv.Itoa(stat.HostPort)
+	return information
+}
+
+// basicInformation returns the information of the FullStat held in a basic stat response.
+func (stat FullStat) basicInformation() map[string]string {
+	information := stat.information()
+	basic := make(map[string]string, len(basicKeys))
+	for _, key := range basicKeys {
+		basic[key] = information[key]
+	}
+	return basic
+}
+
+// parseFullStat parses the information and players of a full stat response into a FullStat. An error is
+// returned if one of the numeric values is not a number.
+func parseFullStat(information map[string]string, players []string) (FullStat, error) {
+	stat := FullStat{Players: players, Other: make(map[string]string)}
+	for key, value := range information {
+		var err error
+		switch key {
+		case "hostname":
+			stat.HostName = value
+		case "gametype":
+			stat.GameType = value
+		case "game_id":
+			stat.GameID = value
+		case "version":
+			stat.Version = value
+		case "server_engine":
+			stat.ServerEngine = value
+		case "plugins":
+			// The plugins are listed after the server engine and a colon. If there is no colon, the server
+			// has no plugins.
+			if i := strings.Index(value, ": "); i != -1 && value[i+2:] != "" {
+				stat.Plugins = strings.Split(value[i+2:], "; ")
+			}
+		case "map":
+			stat.Map = value
+		case "numplayers":
+			stat.NumPlayers, err = strconv.Atoi(value)
+		case "maxplayers":
+			stat.MaxPlayers, err = strconv.Atoi(value)
+		case "whitelist":
+			stat.WhiteList = value == "on"
+		case "hostip":
+			stat.HostIP = value
+		case "hostport":
+			stat.HostPort, err = strconv.Atoi(value)
+		default:
+			stat.Other[key] = value
+		}
+		if err != nil {
+			return stat, fmt.Errorf("invalid %v in full stat query response: %v", key, err)
+		}
+	}
+	return stat, nil
+}